@@ -9,16 +9,19 @@ type Config struct {
 	DatabaseURL string
 	JWTSecret   string
 	LogDir      string
+	// MetricsToken guards the Prometheus /metrics endpoint; empty disables it.
+	MetricsToken string
 }
 
 func FromEnv() Config {
 	cfg := Config{
-		Addr:        getEnv("SERVER_ADDR", ":6365"),
-		DBType:      getEnv("DB_TYPE", "sqlite"),
-		DBPath:      getEnv("DB_PATH", "/app/data/gost.db"),
-		DatabaseURL: getEnv("DATABASE_URL", ""),
-		JWTSecret:   getEnv("JWT_SECRET", ""),
-		LogDir:      getEnv("LOG_DIR", "/app/logs"),
+		Addr:         getEnv("SERVER_ADDR", ":6365"),
+		DBType:       getEnv("DB_TYPE", "sqlite"),
+		DBPath:       getEnv("DB_PATH", "/app/data/gost.db"),
+		DatabaseURL:  getEnv("DATABASE_URL", ""),
+		JWTSecret:    getEnv("JWT_SECRET", ""),
+		LogDir:       getEnv("LOG_DIR", "/app/logs"),
+		MetricsToken: getEnv("METRICS_TOKEN", ""),
 	}
 
 	return cfg
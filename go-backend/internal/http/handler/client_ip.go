@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/response"
+	"go-backend/internal/metrics"
+	"go-backend/internal/store/repo"
+)
+
+// clientIPWindow is how long a source IP keeps counting towards its owner's
+// limit after the last connection an agent reported for it.
+const clientIPWindow = 5 * time.Minute
+
+// clientIPHistory is how long source IP rows are kept for the forward IP
+// listing before the hourly job purges them.
+const clientIPHistory = 24 * time.Hour
+
+// clientIPGuard is the admission state pushed to a forward's services. A
+// locked guard only lets the allowed IPs open new connections.
+type clientIPGuard struct {
+	userID  int64
+	locked  bool
+	allowed []string
+}
+
+func (g clientIPGuard) key() string {
+	if !g.locked {
+		return ""
+	}
+	return strings.Join(g.allowed, ",")
+}
+
+func (g clientIPGuard) allows(ip string) bool {
+	if !g.locked {
+		return true
+	}
+	i := sort.SearchStrings(g.allowed, ip)
+	return i < len(g.allowed) && g.allowed[i] == ip
+}
+
+// recordClientIPs stores the source IPs an agent reported for a forward
+// service and returns the owner, whose IP limits the caller re-evaluates
+// once per upload rather than once per item.
+func (h *Handler) recordClientIPs(nodeID int64, item flowItem) int64 {
+	if h == nil || h.repo == nil || nodeID <= 0 || len(item.I) == 0 {
+		return 0
+	}
+	forwardID, userID, userTunnelID, ok := parseFlowServiceIDs(strings.TrimSpace(item.N))
+	if !ok {
+		return 0
+	}
+	now := time.Now().UnixMilli()
+	if err := h.repo.TouchForwardClientIPs(forwardID, userID, userTunnelID, nodeID, item.I, now); err != nil {
+		return 0
+	}
+
+	// An IP outside a locked guard means the node lost it, typically after an
+	// agent restart, so forget the pushed state and send it again.
+	h.clientIPMu.Lock()
+	if guard, ok := h.clientIPGuards[forwardID]; ok {
+		for _, ip := range item.I {
+			if !guard.allows(ip) {
+				delete(h.clientIPGuards, forwardID)
+				break
+			}
+		}
+	}
+	h.clientIPMu.Unlock()
+	return userID
+}
+
+// enforceClientIPLimits counts the distinct source IPs active within the
+// window for the user and each limited user tunnel. In reject mode a scope
+// that reached its limit is locked to the IPs already counted; in alert
+// mode the excess is only logged and counted in metrics.
+func (h *Handler) enforceClientIPLimits(userID, now int64) {
+	if h == nil || h.repo == nil || userID <= 0 {
+		return
+	}
+	userMax, mode, err := h.repo.GetUserIPLimit(userID)
+	if err != nil {
+		return
+	}
+	tunnelMax, err := h.repo.ListUserTunnelIPLimits(userID)
+	if err != nil {
+		return
+	}
+	// Without limits there is nothing to count; only a guard left from a
+	// removed limit still needs the forwards walked to lift it.
+	if userMax == 0 && len(tunnelMax) == 0 && !h.hasClientIPGuards(userID) {
+		h.setClientIPExceeded(clientIPScopeKey(userID, 0), false)
+		return
+	}
+	since := now - clientIPWindow.Milliseconds()
+
+	userGuard := clientIPGuard{}
+	if userMax > 0 {
+		userGuard = h.evaluateClientIPScope(userID, 0, userMax, mode, since)
+	} else {
+		h.setClientIPExceeded(clientIPScopeKey(userID, 0), false)
+	}
+	tunnelGuards := make(map[int64]clientIPGuard, len(tunnelMax))
+	for userTunnelID, max := range tunnelMax {
+		tunnelGuards[userTunnelID] = h.evaluateClientIPScope(userID, userTunnelID, max, mode, since)
+	}
+
+	forwards, err := h.listActiveForwardsByUser(userID)
+	if err != nil {
+		return
+	}
+	for i := range forwards {
+		forward := &forwards[i]
+		userTunnelID, _, _, err := h.resolveUserTunnelAndLimiter(forward.UserID, forward.TunnelID)
+		if err != nil {
+			continue
+		}
+		guard := mergeClientIPGuards(userGuard, tunnelGuards[userTunnelID])
+		h.applyClientIPGuard(forward, userTunnelID, guard)
+	}
+}
+
+// reevaluateClientIPGuards re-runs the limits of every user owning a locked
+// forward. A locked service rejects new IPs before they are reported, so
+// without this no report would arrive to lift the lock once the counted IPs
+// leave the window.
+func (h *Handler) reevaluateClientIPGuards(now time.Time) {
+	if h == nil || h.repo == nil {
+		return
+	}
+	h.clientIPMu.Lock()
+	forwardIDs := make([]int64, 0, len(h.clientIPGuards))
+	for forwardID := range h.clientIPGuards {
+		forwardIDs = append(forwardIDs, forwardID)
+	}
+	h.clientIPMu.Unlock()
+
+	userIDs := make(map[int64]struct{})
+	for _, forwardID := range forwardIDs {
+		forward, err := h.getForwardRecord(forwardID)
+		if errors.Is(err, errForwardNotFound) {
+			h.clientIPMu.Lock()
+			delete(h.clientIPGuards, forwardID)
+			h.clientIPMu.Unlock()
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		userIDs[forward.UserID] = struct{}{}
+	}
+	for userID := range userIDs {
+		h.enforceClientIPLimits(userID, now.UnixMilli())
+	}
+}
+
+func (h *Handler) hasClientIPGuards(userID int64) bool {
+	h.clientIPMu.Lock()
+	defer h.clientIPMu.Unlock()
+	for _, guard := range h.clientIPGuards {
+		if guard.userID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) evaluateClientIPScope(userID, userTunnelID int64, max, mode int, since int64) clientIPGuard {
+	ips, err := h.repo.ListActiveClientIPs(userID, userTunnelID, since)
+	if err != nil {
+		return clientIPGuard{}
+	}
+
+	scope := "user"
+	if userTunnelID > 0 {
+		scope = "userTunnel"
+	}
+	modeLabel := "reject"
+	if mode == repo.IPLimitModeAlert {
+		modeLabel = "alert"
+	}
+	exceeded := len(ips) > max
+	if h.setClientIPExceeded(clientIPScopeKey(userID, userTunnelID), exceeded) && exceeded {
+		metrics.ClientIPLimitExceeded.Inc(scope, modeLabel)
+		log.Printf("client ip limit exceeded: user=%d userTunnel=%d ips=%d max=%d mode=%s", userID, userTunnelID, len(ips), max, modeLabel)
+	}
+
+	if mode == repo.IPLimitModeAlert || len(ips) < max {
+		return clientIPGuard{}
+	}
+	allowed := make([]string, 0, max)
+	for _, row := range ips[:max] {
+		allowed = append(allowed, row.IP)
+	}
+	sort.Strings(allowed)
+	return clientIPGuard{userID: userID, locked: true, allowed: allowed}
+}
+
+// setClientIPExceeded records whether a scope is over its limit and reports
+// whether that changed, so an excess is alerted once rather than on every
+// report.
+func (h *Handler) setClientIPExceeded(scopeKey string, exceeded bool) bool {
+	h.clientIPMu.Lock()
+	defer h.clientIPMu.Unlock()
+	if h.clientIPExceeded[scopeKey] == exceeded {
+		return false
+	}
+	if exceeded {
+		h.clientIPExceeded[scopeKey] = true
+	} else {
+		delete(h.clientIPExceeded, scopeKey)
+	}
+	return true
+}
+
+func clientIPScopeKey(userID, userTunnelID int64) string {
+	if userTunnelID > 0 {
+		return fmt.Sprintf("ut_%d", userTunnelID)
+	}
+	return fmt.Sprintf("user_%d", userID)
+}
+
+// mergeClientIPGuards combines the user and user tunnel guards of a forward:
+// when both are locked only IPs allowed by both may connect.
+func mergeClientIPGuards(a, b clientIPGuard) clientIPGuard {
+	if !a.locked {
+		return b
+	}
+	if !b.locked {
+		return a
+	}
+	allowed := make([]string, 0, len(a.allowed))
+	for _, ip := range a.allowed {
+		if b.allows(ip) {
+			allowed = append(allowed, ip)
+		}
+	}
+	return clientIPGuard{userID: a.userID, locked: true, allowed: allowed}
+}
+
+// applyClientIPGuard pushes a changed guard to every node hosting the
+// forward. A failed push is forgotten so the next report retries it.
+func (h *Handler) applyClientIPGuard(forward *forwardRecord, userTunnelID int64, guard clientIPGuard) {
+	h.clientIPMu.Lock()
+	prev, known := h.clientIPGuards[forward.ID]
+	if (known && prev.key() == guard.key()) || (!known && !guard.locked) {
+		h.clientIPMu.Unlock()
+		return
+	}
+	if guard.locked {
+		h.clientIPGuards[forward.ID] = guard
+	} else {
+		delete(h.clientIPGuards, forward.ID)
+	}
+	h.clientIPMu.Unlock()
+
+	ports, err := h.listForwardPorts(forward.ID)
+	if err != nil {
+		return
+	}
+	base := buildForwardServiceBase(forward.ID, forward.UserID, userTunnelID)
+	allowed := guard.allowed
+	if allowed == nil {
+		allowed = []string{}
+	}
+	payload := map[string]interface{}{
+		"services": forwardServiceNames(base, forward.Protocol),
+		"locked":   guard.locked,
+		"allowed":  allowed,
+	}
+	seen := make(map[int64]struct{})
+	for _, fp := range h.forwardServicePorts(forward.TunnelID, ports) {
+		if _, ok := seen[fp.NodeID]; ok {
+			continue
+		}
+		seen[fp.NodeID] = struct{}{}
+		if _, err := h.sendNodeCommand(fp.NodeID, "SetClientIPGuard", payload, false, false); err != nil && guard.locked {
+			h.clientIPMu.Lock()
+			delete(h.clientIPGuards, forward.ID)
+			h.clientIPMu.Unlock()
+		}
+	}
+}
+
+func (h *Handler) forwardClientIPs(w http.ResponseWriter, r *http.Request) {
+	id := asInt64FromBodyKey(r, w, "forwardId")
+	if id <= 0 {
+		return
+	}
+	forward, _, _, err := h.resolveForwardAccess(r, id)
+	if err != nil {
+		if errors.Is(err, errForwardNotFound) {
+			response.WriteJSON(w, response.ErrDefault("转发不存在"))
+			return
+		}
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	rows, err := h.repo.ListForwardClientIPs(forward.ID, now-clientIPHistory.Milliseconds())
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	activeSince := now - clientIPWindow.Milliseconds()
+	items := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, map[string]interface{}{
+			"ip":        row.IP,
+			"nodeId":    row.NodeID,
+			"firstSeen": row.FirstSeen,
+			"lastSeen":  row.LastSeen,
+			"active":    row.LastSeen >= activeSince,
+		})
+	}
+	response.WriteJSON(w, response.OK(items))
+}
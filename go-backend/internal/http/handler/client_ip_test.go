@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/repo"
+)
+
+func TestClientIPLimitLocksForwardAndAlertModeReleases(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "client_ip.db")
+	r, err := repo.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	h := New(r, "secret")
+	nowMs := time.Now().UnixMilli()
+
+	if err := r.DB().Exec(`
+		INSERT INTO user(id, user, pwd, role_id, exp_time, flow, in_flow, out_flow, flow_reset_time, num, max_ips, ip_limit_mode, created_time, updated_time, status)
+		VALUES(2, 'ip_user', 'x', 1, ?, 100, 0, 0, 1, 1, 2, 0, ?, ?, 1)
+	`, nowMs+int64(time.Hour/time.Millisecond), nowMs, nowMs).Error; err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	if err := r.DB().Exec(`
+		INSERT INTO tunnel(id, name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, in_ip, inx)
+		VALUES(1, 't1', 1.0, 1, 'tls', 1, ?, ?, 1, NULL, 0)
+	`, nowMs, nowMs).Error; err != nil {
+		t.Fatalf("insert tunnel: %v", err)
+	}
+	if err := r.DB().Exec(`
+		INSERT INTO user_tunnel(id, user_id, tunnel_id, speed_id, num, flow, in_flow, out_flow, flow_reset_time, exp_time, status)
+		VALUES(10, 2, 1, NULL, 1, 100, 0, 0, 1, ?, 1)
+	`, nowMs+int64(time.Hour/time.Millisecond)).Error; err != nil {
+		t.Fatalf("insert user_tunnel: %v", err)
+	}
+	if err := r.DB().Exec(`
+		INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, in_flow, out_flow, created_time, updated_time, status, inx)
+		VALUES(20, 2, 'ip_user', 'f1', 1, '1.1.1.1:443', 'fifo', 0, 0, ?, ?, 1, 0)
+	`, nowMs, nowMs).Error; err != nil {
+		t.Fatalf("insert forward: %v", err)
+	}
+
+	item := flowItem{N: "20_2_10_tcp", I: []string{"10.0.0.3", "10.0.0.1", "10.0.0.2"}}
+	if got := h.recordClientIPs(1, item); got != 2 {
+		t.Fatalf("expected the report to name user 2, got %d", got)
+	}
+	h.processFlowItem(item)
+	h.enforceClientIPLimits(2, time.Now().UnixMilli())
+
+	if got := mustQueryInt(t, r, `SELECT COUNT(*) FROM usage_ledger WHERE kind = 'flow'`); got != 0 {
+		t.Fatalf("expected IP-only report to skip the ledger, got %d rows", got)
+	}
+	if got := mustQueryInt(t, r, `SELECT COUNT(*) FROM forward_client_ip WHERE forward_id = 20`); got != 3 {
+		t.Fatalf("expected 3 recorded IPs, got %d", got)
+	}
+
+	guard, ok := h.clientIPGuards[20]
+	if !ok || !guard.locked {
+		t.Fatalf("expected forward to be locked, got %+v", guard)
+	}
+	if len(guard.allowed) != 2 || guard.allowed[0] != "10.0.0.1" || guard.allowed[1] != "10.0.0.2" {
+		t.Fatalf("unexpected allowed set: %v", guard.allowed)
+	}
+	if !h.clientIPExceeded[clientIPScopeKey(2, 0)] {
+		t.Fatalf("expected user scope to be marked exceeded")
+	}
+
+	// The locked node no longer reports new IPs, so the periodic job has to
+	// lift the lock once the counted IPs leave the window.
+	stale := time.Now().Add(-2 * clientIPWindow).UnixMilli()
+	if err := r.DB().Exec(`UPDATE forward_client_ip SET last_seen = ? WHERE ip <> '10.0.0.1'`, stale).Error; err != nil {
+		t.Fatalf("age client ips: %v", err)
+	}
+	h.reevaluateClientIPGuards(time.Now())
+	if _, ok := h.clientIPGuards[20]; ok {
+		t.Fatalf("expected the periodic job to release the lock")
+	}
+
+	h.recordClientIPs(1, item)
+	h.enforceClientIPLimits(2, time.Now().UnixMilli())
+	if _, ok := h.clientIPGuards[20]; !ok {
+		t.Fatalf("expected forward to be locked again")
+	}
+	if err := r.DB().Exec(`UPDATE user SET ip_limit_mode = ? WHERE id = 2`, repo.IPLimitModeAlert).Error; err != nil {
+		t.Fatalf("switch to alert mode: %v", err)
+	}
+	h.enforceClientIPLimits(2, time.Now().UnixMilli())
+	if _, ok := h.clientIPGuards[20]; ok {
+		t.Fatalf("expected alert mode to release the lock")
+	}
+
+	// Removing the limit skips the counting but still lifts a held lock.
+	if err := r.DB().Exec(`UPDATE user SET ip_limit_mode = ? WHERE id = 2`, repo.IPLimitModeReject).Error; err != nil {
+		t.Fatalf("switch to reject mode: %v", err)
+	}
+	h.enforceClientIPLimits(2, time.Now().UnixMilli())
+	if _, ok := h.clientIPGuards[20]; !ok {
+		t.Fatalf("expected reject mode to lock again")
+	}
+	if err := r.DB().Exec(`UPDATE user SET max_ips = 0 WHERE id = 2`).Error; err != nil {
+		t.Fatalf("remove user limit: %v", err)
+	}
+	h.enforceClientIPLimits(2, time.Now().UnixMilli())
+	if h.hasClientIPGuards(2) {
+		t.Fatalf("expected removing the limit to release the lock")
+	}
+}
+
+func TestMergeClientIPGuardsIntersectsLockedSets(t *testing.T) {
+	a := clientIPGuard{locked: true, allowed: []string{"1.1.1.1", "2.2.2.2"}}
+	b := clientIPGuard{locked: true, allowed: []string{"2.2.2.2", "3.3.3.3"}}
+
+	got := mergeClientIPGuards(a, b)
+	if !got.locked || len(got.allowed) != 1 || got.allowed[0] != "2.2.2.2" {
+		t.Fatalf("unexpected merged guard: %+v", got)
+	}
+	if got := mergeClientIPGuards(clientIPGuard{}, b); got.key() != b.key() {
+		t.Fatalf("expected unlocked user guard to defer to tunnel guard, got %+v", got)
+	}
+	if !got.allows("2.2.2.2") || got.allows("1.1.1.1") {
+		t.Fatalf("unexpected allows result for %+v", got)
+	}
+}
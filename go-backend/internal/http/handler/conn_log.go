@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/response"
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+const (
+	// defaultConnLogRetentionDays applies when conn_log_retention_days is
+	// not configured.
+	defaultConnLogRetentionDays = 7
+	// connLogMaxRows caps the table whatever the retention, so a busy
+	// forward cannot fill the panel's disk.
+	connLogMaxRows = 1_000_000
+	// connLogReportMax bounds the logs taken from one report item.
+	connLogReportMax = 1000
+	connLogPageMax   = 200
+)
+
+// connLogItem is one connection in an agent's flow report. Times are unix
+// milliseconds, U counts the bytes the client sent and D those it
+// received, and R is empty for a connection closed without error.
+type connLogItem struct {
+	C string `json:"c"`
+	E string `json:"e"`
+	T string `json:"t"`
+	P string `json:"p"`
+	S int64  `json:"s"`
+	F int64  `json:"f"`
+	U int64  `json:"u"`
+	D int64  `json:"d"`
+	R string `json:"r,omitempty"`
+}
+
+func parseConnLog(req map[string]interface{}, def int) int {
+	v, ok := req["connLog"]
+	if !ok {
+		return def
+	}
+	if asBool(v, false) {
+		return 1
+	}
+	return 0
+}
+
+// recordConnLogs stores the connections an agent logged for a forward
+// service.
+func (h *Handler) recordConnLogs(nodeID int64, item flowItem) {
+	if h == nil || h.repo == nil || nodeID <= 0 || len(item.C) == 0 {
+		return
+	}
+	forwardID, userID, _, ok := parseFlowServiceIDs(strings.TrimSpace(item.N))
+	if !ok {
+		return
+	}
+	logs := item.C
+	if len(logs) > connLogReportMax {
+		logs = logs[len(logs)-connLogReportMax:]
+	}
+	rows := make([]model.ForwardConnLog, 0, len(logs))
+	for _, c := range logs {
+		if c.S <= 0 {
+			continue
+		}
+		rows = append(rows, model.ForwardConnLog{
+			ForwardID:  forwardID,
+			UserID:     userID,
+			NodeID:     nodeID,
+			Network:    clipString(c.P, 10),
+			ClientAddr: clipString(c.C, 64),
+			EntryAddr:  clipString(c.E, 64),
+			TargetAddr: clipString(c.T, 255),
+			StartTime:  c.S,
+			EndTime:    max(c.F, c.S),
+			InBytes:    max(c.U, 0),
+			OutBytes:   max(c.D, 0),
+			Reason:     clipString(c.R, 255),
+		})
+	}
+	_ = h.repo.InsertForwardConnLogs(rows)
+}
+
+func clipString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// connLogRetention reads conn_log_retention_days, falling back to the
+// default for a missing or invalid value.
+func (h *Handler) connLogRetention() time.Duration {
+	days := defaultConnLogRetentionDays
+	if v, err := h.repo.GetViteConfigValue("conn_log_retention_days"); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			days = n
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (h *Handler) purgeConnLogs(now time.Time) {
+	_ = h.repo.PurgeForwardConnLogs(now.Add(-h.connLogRetention()).UnixMilli(), connLogMaxRows)
+}
+
+func (h *Handler) forwardConnLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	userID, roleID, err := userRoleFromRequest(r)
+	if err != nil {
+		response.WriteJSON(w, response.Err(401, "无效的token或token已过期"))
+		return
+	}
+
+	var req struct {
+		ForwardID int64  `json:"forwardId"`
+		NodeID    int64  `json:"nodeId"`
+		Client    string `json:"client"`
+		Target    string `json:"target"`
+		Failed    bool   `json:"failed"`
+		StartTime int64  `json:"startTime"`
+		EndTime   int64  `json:"endTime"`
+		Current   int    `json:"current"`
+		Size      int    `json:"size"`
+	}
+	if err := decodeJSON(r.Body, &req); err != nil && err != io.EOF {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+
+	q := repo.ConnLogQuery{
+		NodeID: req.NodeID,
+		Client: strings.TrimSpace(req.Client),
+		Target: strings.TrimSpace(req.Target),
+		Failed: req.Failed,
+		Since:  req.StartTime,
+		Until:  req.EndTime,
+	}
+	if roleID != 0 {
+		q.UserID = userID
+	}
+	if req.ForwardID > 0 {
+		forward, err := h.ensureForwardAccessByActor(userID, roleID, req.ForwardID)
+		if err != nil {
+			if errors.Is(err, errForwardNotFound) {
+				response.WriteJSON(w, response.ErrDefault("转发不存在"))
+				return
+			}
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+		q.ForwardID = forward.ID
+	}
+	q.Limit = req.Size
+	if q.Limit <= 0 || q.Limit > connLogPageMax {
+		q.Limit = 50
+	}
+	if req.Current > 1 {
+		q.Offset = (req.Current - 1) * q.Limit
+	}
+
+	rows, total, err := h.repo.SearchForwardConnLogs(q)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OK(map[string]interface{}{
+		"total": total,
+		"list":  rows,
+	}))
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-backend/internal/auth"
+	"go-backend/internal/http/middleware"
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestRecordAndSearchConnLogs(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "connlog.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	start := time.Now().Add(-time.Minute).UnixMilli()
+	h.recordConnLogs(3, flowItem{N: "4_2_0_tcp", C: []connLogItem{
+		{C: "203.0.113.8:50000", E: "0.0.0.0:10000", T: "10.0.0.1:80", P: "tcp", S: start, F: start + 1000, U: 120, D: 4096},
+		{C: "203.0.113.9:50001", E: "0.0.0.0:10000", T: "10.0.0.2:80", P: "tcp", S: start + 10, F: start + 20, R: "connection refused"},
+	}})
+	h.recordConnLogs(3, flowItem{N: "5_7_0_tcp", C: []connLogItem{
+		{C: "198.51.100.1:40000", T: "10.0.0.3:80", P: "tcp", S: start + 20, F: start + 30},
+	}})
+	h.recordConnLogs(3, flowItem{N: "bogus", C: []connLogItem{{S: start}}})
+
+	search := func(sub string, role int, body map[string]interface{}) (int64, []model.ForwardConnLog) {
+		t.Helper()
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/forward/conn-logs", bytes.NewReader(raw))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.ClaimsContextKey, auth.Claims{Sub: sub, RoleID: role}))
+		res := httptest.NewRecorder()
+		h.forwardConnLogs(res, req)
+
+		var payload struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+			Data struct {
+				Total int64                  `json:"total"`
+				List  []model.ForwardConnLog `json:"list"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if payload.Code != 0 {
+			t.Fatalf("search failed: %s", payload.Msg)
+		}
+		return payload.Data.Total, payload.Data.List
+	}
+
+	if total, _ := search("1", 0, nil); total != 3 {
+		t.Fatalf("expected an admin to see all logs, got %d", total)
+	}
+	total, list := search("2", 1, map[string]interface{}{})
+	if total != 2 || list[0].ClientAddr != "203.0.113.9:50001" || list[1].OutBytes != 4096 {
+		t.Fatalf("expected the user's own logs newest first, got %d %+v", total, list)
+	}
+	if total, list := search("2", 1, map[string]interface{}{"failed": true}); total != 1 || list[0].Reason != "connection refused" {
+		t.Fatalf("expected only the failed connection, got %d %+v", total, list)
+	}
+	if total, _ := search("2", 1, map[string]interface{}{"client": "203.0.113.8"}); total != 1 {
+		t.Fatalf("expected the client filter to match one log, got %d", total)
+	}
+	if total, list := search("2", 1, map[string]interface{}{"size": 1, "current": 2}); total != 2 || len(list) != 1 || list[0].ClientAddr != "203.0.113.8:50000" {
+		t.Fatalf("expected the second page to hold the older log, got %d %+v", total, list)
+	}
+
+	if err := r.PurgeForwardConnLogs(0, 1); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if total, list := search("1", 0, nil); total != 1 || list[0].ForwardID != 5 {
+		t.Fatalf("expected only the newest log to survive the row cap, got %d %+v", total, list)
+	}
+}
+
+func TestConnLogServiceMetadata(t *testing.T) {
+	forward := &forwardRecord{ID: 4, UserID: 5, TunnelID: 2, RemoteAddr: "10.0.0.1:80", Protocol: "tcp+udp", ConnLog: 1}
+	node := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+
+	services := buildForwardServiceConfigs("4_5_7", forward, nil, node, 10000, "", "", false)
+	if len(services) != 2 {
+		t.Fatalf("expected tcp and udp services, got %d", len(services))
+	}
+	for _, svc := range services {
+		md, _ := svc["handler"].(map[string]interface{})["metadata"].(map[string]interface{})
+		if md["connLog"] != true {
+			t.Fatalf("expected %v to log connections", svc["name"])
+		}
+	}
+}
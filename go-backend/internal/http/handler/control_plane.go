@@ -12,11 +12,14 @@ import (
 
 	"go-backend/internal/http/client"
 	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
 	"go-backend/internal/ws"
 )
 
 var errForwardNotFound = errors.New("forward not found")
 
+var errLoadBalanceStrategy = errors.New("负载均衡策略只能是 fifo、round、rand、hash、weighted、least 或 sticky")
+
 type forwardRecord = model.ForwardRecord
 type tunnelRecord = model.TunnelRecord
 type forwardPortRecord = model.ForwardPortRecord
@@ -116,7 +119,7 @@ func (h *Handler) getNodeRecord(nodeID int64) (*nodeRecord, error) {
 	return n, nil
 }
 
-func (h *Handler) resolveUserTunnelAndLimiter(userID, tunnelID int64) (int64, *int64, *int, error) {
+func (h *Handler) resolveUserTunnelAndLimiter(userID, tunnelID int64) (int64, *int64, []string, error) {
 	info, err := h.repo.ResolveUserTunnelAndLimiter(userID, tunnelID)
 	if err != nil {
 		return 0, nil, nil, err
@@ -124,7 +127,11 @@ func (h *Handler) resolveUserTunnelAndLimiter(userID, tunnelID int64) (int64, *i
 	if info == nil {
 		return 0, nil, nil, nil
 	}
-	return info.UserTunnelID, info.LimiterID, info.Speed, nil
+	var limits []string
+	if info.LimiterID != nil && info.Speed != nil {
+		limits = speedLimitLimits(*info.Speed, info.ConnSpeed, info.IPSpeed)
+	}
+	return info.UserTunnelID, info.LimiterID, limits, nil
 }
 
 func (h *Handler) listUserTunnelIDs(userID, tunnelID int64) ([]int64, error) {
@@ -136,6 +143,13 @@ func (h *Handler) listUserTunnelIDsByUser(userID int64) ([]int64, error) {
 }
 
 func (h *Handler) syncForwardServices(forward *forwardRecord, method string, allowFallbackAdd bool) error {
+	return h.syncForwardServicesDrain(forward, method, allowFallbackAdd, 0)
+}
+
+// syncForwardServicesDrain deploys the forward like syncForwardServices. With
+// a positive drain an update migrates the services instead: the new listeners
+// come up before the old ones, which keep serving for drain seconds.
+func (h *Handler) syncForwardServicesDrain(forward *forwardRecord, method string, allowFallbackAdd bool, drain int) error {
 	if h == nil || forward == nil {
 		return errors.New("invalid forward sync context")
 	}
@@ -152,7 +166,7 @@ func (h *Handler) syncForwardServices(forward *forwardRecord, method string, all
 		return errors.New("转发入口端口不存在")
 	}
 
-	userTunnelID, limiterID, speed, err := h.resolveUserTunnelAndLimiter(forward.UserID, forward.TunnelID)
+	userTunnelID, limiterID, limits, err := h.resolveUserTunnelAndLimiter(forward.UserID, forward.TunnelID)
 	if err != nil {
 		return err
 	}
@@ -161,24 +175,104 @@ func (h *Handler) syncForwardServices(forward *forwardRecord, method string, all
 	if err != nil {
 		return err
 	}
+	if forward.InterfaceName == "" {
+		// A forward without its own egress uses the user's tunnel setting.
+		if egress, _ := h.repo.GetUserTunnelInterface(forward.UserID, forward.TunnelID); egress != "" {
+			withEgress := *forward
+			withEgress.InterfaceName = egress
+			forward = &withEgress
+		}
+	}
 
-	for _, fp := range ports {
-		if limiterID != nil && speed != nil {
-			h.ensureLimiterOnNode(fp.NodeID, *limiterID, *speed)
+	userSpeed := h.userSpeed(forward.UserID)
+	limiter := serviceLimiterRef(limiterID, forward.UserID, userSpeed)
+	connLimits := forwardConnLimits(forward.MaxConns, forward.MaxIPConns)
+	climiter := ""
+	if len(connLimits) > 0 {
+		climiter = connLimiterName(forward.ID)
+	}
+	admissions := forwardIPACLAdmissions(forward, tunnel)
+	exitNodeID := int64(0)
+	if tunnel.Type == 3 {
+		if exitNodeID = h.reverseTunnelExitNodeID(tunnel.ID); exitNodeID <= 0 {
+			return errors.New("隧道配置不完整")
+		}
+	}
+	var cert *model.Certificate
+	if forward.ForwardHTTP.Mode == httpModeTLS {
+		if cert, err = h.repo.GetCertificate(forward.ForwardHTTP.CertID); err != nil {
+			return errors.New("证书不存在")
 		}
+	}
 
-		node, err := h.getNodeRecord(fp.NodeID)
+	for _, fp := range ports {
+		// The entry node sets the listen address; a reverse tunnel's exit
+		// node binds it there and runs the services itself.
+		entryNode, err := h.getNodeRecord(fp.NodeID)
 		if err != nil {
 			return err
 		}
-		services := buildForwardServiceConfigs(serviceBase, forward, tunnel, node, fp.Port, limiterID, tunnelTLSProtocol)
-		_, err = h.sendNodeCommand(node.ID, method, services, true, false)
-		if err != nil && allowFallbackAdd && method == "UpdateService" {
+		node := entryNode
+		if exitNodeID > 0 {
+			if node, err = h.getNodeRecord(exitNodeID); err != nil {
+				return err
+			}
+		}
+
+		if limiterID != nil && len(limits) > 0 {
+			h.ensureLimiterOnNode(node.ID, *limiterID, limits)
+		}
+		if userSpeed > 0 {
+			h.ensureUserLimiterOnNode(node.ID, forward.UserID, userSpeed)
+		}
+		if climiter != "" {
+			h.ensureConnLimiterOnNode(node.ID, climiter, connLimits)
+		}
+		// A service referencing a missing admission rejects every client.
+		if err := h.ensureAdmissionsOnNode(node.ID, admissions); err != nil {
+			return fmt.Errorf("节点 %s 下发失败: %w", node.Name, err)
+		}
+		if cert != nil {
+			if err := h.ensureCertificateOnNode(node.ID, cert); err != nil {
+				return fmt.Errorf("节点 %s 下发证书失败: %w", node.Name, err)
+			}
+		}
+		resolver, dns := forwardResolver(forward, node)
+		if resolver != "" {
+			if err := h.ensureResolverOnNode(node.ID, resolver, dns); err != nil {
+				return fmt.Errorf("节点 %s 下发解析器失败: %w", node.Name, err)
+			}
+		}
+		services := buildForwardServiceConfigs(serviceBase, forward, tunnel, entryNode, fp.Port, limiter, climiter, tunnelTLSProtocol)
+		if resolver != "" {
+			for _, svc := range services {
+				svc["resolver"] = resolver
+			}
+		}
+		migrate := drain > 0 && method == "UpdateService" && node.IsRemote != 1
+		if migrate {
+			_, err = h.sendNodeCommand(node.ID, "MigrateService", map[string]interface{}{
+				"data":  services,
+				"drain": drain,
+			}, false, false)
+			if err != nil && strings.Contains(err.Error(), "未知命令") {
+				// Agents before port migration replace the services in place.
+				_, err = h.sendNodeCommand(node.ID, method, services, true, false)
+			}
+		} else {
+			_, err = h.sendNodeCommand(node.ID, method, services, true, false)
+		}
+		if err != nil && allowFallbackAdd && method == "UpdateService" && !migrate {
 			_, err = h.sendNodeCommand(node.ID, "AddService", services, true, false)
 		}
 		if err != nil {
 			return fmt.Errorf("节点 %s 下发失败: %w", node.Name, err)
 		}
+		if method == "UpdateService" {
+			if stale := disabledForwardServiceNames(serviceBase, forward.Protocol); len(stale) > 0 {
+				_, _ = h.sendNodeCommand(node.ID, "DeleteService", map[string]interface{}{"services": stale}, false, true)
+			}
+		}
 	}
 	return nil
 }
@@ -194,6 +288,7 @@ func (h *Handler) controlForwardServices(forward *forwardRecord, commandType str
 	if len(ports) == 0 {
 		return nil
 	}
+	ports = h.forwardServicePorts(forward.TunnelID, ports)
 	userTunnelID, _, _, err := h.resolveUserTunnelAndLimiter(forward.UserID, forward.TunnelID)
 	if err != nil {
 		return err
@@ -221,8 +316,10 @@ func (h *Handler) controlForwardServices(forward *forwardRecord, commandType str
 		nodeHandled := false
 
 		for _, base := range bases {
-			variants := []string{base + "_tcp", base + "_udp"}
-			if shouldTryLegacySingleService(commandType) || strings.EqualFold(strings.TrimSpace(commandType), "DeleteService") {
+			variants := forwardServiceNames(base, forward.Protocol)
+			if strings.EqualFold(strings.TrimSpace(commandType), "DeleteService") {
+				variants = append([]string{base + "_tcp", base + "_udp"}, base)
+			} else if shouldTryLegacySingleService(commandType) {
 				variants = append(variants, base)
 			}
 
@@ -286,8 +383,12 @@ func (h *Handler) sendNodeCommand(nodeID int64, commandType string, data interfa
 	if err == nil {
 		return result, nil
 	}
+	// A structured failure names its stage; only a name clash means the
+	// item already exists, not e.g. a port already in use.
+	stage := asString(result.Data["stage"])
+	err = agentUpdateError(result, err)
 	msg := strings.ToLower(strings.TrimSpace(err.Error()))
-	if tolerateExists {
+	if tolerateExists && (stage == "" || stage == "register") {
 		if strings.Contains(msg, "exists") || strings.Contains(msg, "already") || strings.Contains(msg, "已存在") {
 			return result, nil
 		}
@@ -300,6 +401,36 @@ func (h *Handler) sendNodeCommand(nodeID int64, commandType string, data interfa
 	return result, err
 }
 
+var agentUpdateKinds = map[string]string{
+	"service": "服务",
+	"chain":   "转发链",
+	"limiter": "限速器",
+}
+
+var agentUpdateStages = map[string]string{
+	"validate": "配置校验",
+	"parse":    "解析或监听",
+	"register": "注册",
+}
+
+// agentUpdateError rewrites the failure an agent reports for an update with
+// the item and stage that failed, noting when the node kept its previous
+// config. Replies from older agents carry no details and pass through.
+func agentUpdateError(result ws.CommandResult, err error) error {
+	name := asString(result.Data["name"])
+	stage := asString(result.Data["stage"])
+	if stage == "" {
+		return err
+	}
+	kind := defaultString(agentUpdateKinds[asString(result.Data["kind"])], asString(result.Data["kind"]))
+	subject := strings.TrimSpace(kind + " " + name)
+	msg := fmt.Sprintf("%s %s失败: %s", subject, defaultString(agentUpdateStages[stage], stage), asString(result.Data["error"]))
+	if asBool(result.Data["rolledBack"], false) {
+		msg += "（节点保持原配置）"
+	}
+	return errors.New(msg)
+}
+
 func (h *Handler) sendRemoteNodeCommand(node *nodeRecord, commandType string, data interface{}) (ws.CommandResult, error) {
 	if node == nil {
 		return ws.CommandResult{}, errors.New("节点不存在")
@@ -364,17 +495,44 @@ func (h *Handler) diagnoseForwardRuntime(forward *forwardRecord) (map[string]int
 	results := make([]map[string]interface{}, 0, len(chainRows)*2+len(targets))
 	nodeCache := map[int64]*nodeRecord{}
 
+	// Target probes are TCP pings, which say nothing about a UDP-only target.
+	protocol := repo.NormalizeForwardProtocol(forward.Protocol)
+	appendTargetDiagnosis := h.appendPathDiagnosis
+	if protocol == repo.ForwardProtocolUDP {
+		appendTargetDiagnosis = h.appendSkippedTargetDiagnosis
+	}
+
+	// Domain targets are resolved where the services run, with the resolver
+	// they use; the probes then dial the address the services would.
+	resolveTarget := func(nodeID int64, nodeName string, chainType int, target diagnosisTarget) string {
+		description := fmt.Sprintf("%s(%s)解析(%s)", chainTypeLabel(chainType), nodeName, target.IP)
+		return h.appendResolveDiagnosis(&results, nodeCache, forward, nodeID, target, description, map[string]interface{}{
+			"fromChainType": chainType,
+		})
+	}
+
 	switch tunnel.Type {
 	case 1:
 		for _, inNode := range inNodes {
 			for _, target := range targets {
+				ip := resolveTarget(inNode.NodeID, inNode.NodeName, 1, target)
 				description := fmt.Sprintf("入口(%s)->目标(%s)", inNode.NodeName, target.Address)
-				h.appendPathDiagnosis(&results, nodeCache, inNode.NodeID, target.IP, target.Port, description, map[string]interface{}{
+				appendTargetDiagnosis(&results, nodeCache, inNode.NodeID, ip, target.Port, description, map[string]interface{}{
 					"fromChainType": 1,
 				})
 			}
 		}
 	case 2:
+		// The entry node resolves and the exit node dials what it got.
+		resolved := make([]string, len(targets))
+		for i, target := range targets {
+			resolved[i] = target.IP
+			for j, inNode := range inNodes {
+				if ip := resolveTarget(inNode.NodeID, inNode.NodeName, 1, target); j == 0 {
+					resolved[i] = ip
+				}
+			}
+		}
 		for _, inNode := range inNodes {
 			if len(chainHops) > 0 {
 				for _, firstNode := range chainHops[0] {
@@ -422,9 +580,26 @@ func (h *Handler) diagnoseForwardRuntime(forward *forwardRecord) (map[string]int
 		}
 
 		for _, outNode := range outNodes {
+			for i, target := range targets {
+				description := fmt.Sprintf("出口(%s)->目标(%s)", outNode.NodeName, target.Address)
+				appendTargetDiagnosis(&results, nodeCache, outNode.NodeID, resolved[i], target.Port, description, map[string]interface{}{
+					"fromChainType": 3,
+				})
+			}
+		}
+	case 3:
+		for _, outNode := range outNodes {
+			for _, inNode := range inNodes {
+				description := fmt.Sprintf("出口(%s)->入口(%s)", outNode.NodeName, inNode.NodeName)
+				h.appendChainHopDiagnosis(&results, nodeCache, outNode.NodeID, inNode, description, map[string]interface{}{
+					"fromChainType": 3,
+					"toChainType":   1,
+				}, "")
+			}
 			for _, target := range targets {
+				ip := resolveTarget(outNode.NodeID, outNode.NodeName, 3, target)
 				description := fmt.Sprintf("出口(%s)->目标(%s)", outNode.NodeName, target.Address)
-				h.appendPathDiagnosis(&results, nodeCache, outNode.NodeID, target.IP, target.Port, description, map[string]interface{}{
+				appendTargetDiagnosis(&results, nodeCache, outNode.NodeID, ip, target.Port, description, map[string]interface{}{
 					"fromChainType": 3,
 				})
 			}
@@ -432,8 +607,9 @@ func (h *Handler) diagnoseForwardRuntime(forward *forwardRecord) (map[string]int
 	default:
 		for _, inNode := range inNodes {
 			for _, target := range targets {
+				ip := resolveTarget(inNode.NodeID, inNode.NodeName, 1, target)
 				description := fmt.Sprintf("入口(%s)->目标(%s)", inNode.NodeName, target.Address)
-				h.appendPathDiagnosis(&results, nodeCache, inNode.NodeID, target.IP, target.Port, description, map[string]interface{}{
+				appendTargetDiagnosis(&results, nodeCache, inNode.NodeID, ip, target.Port, description, map[string]interface{}{
 					"fromChainType": 1,
 				})
 			}
@@ -442,8 +618,13 @@ func (h *Handler) diagnoseForwardRuntime(forward *forwardRecord) (map[string]int
 
 	payload := map[string]interface{}{
 		"forwardName": forward.Name,
+		"protocol":    protocol,
 		"timestamp":   time.Now().UnixMilli(),
 		"results":     results,
+		"ipAcl": map[string]interface{}{
+			"forward": ipACLPayload(forward.AllowIPs, forward.DenyIPs),
+			"tunnel":  ipACLPayload(tunnel.AllowIPs, tunnel.DenyIPs),
+		},
 	}
 	return payload, nil
 }
@@ -536,6 +717,18 @@ func (h *Handler) diagnoseTunnelRuntime(tunnelID int64) (map[string]interface{},
 				"fromChainType": 3,
 			})
 		}
+	case 3:
+		// The exit node sits behind NAT, so only its way out to the entry
+		// node matters.
+		for _, outNode := range outNodes {
+			for _, inNode := range inNodes {
+				description := fmt.Sprintf("出口(%s)->入口(%s)", outNode.NodeName, inNode.NodeName)
+				h.appendChainHopDiagnosis(&results, nodeCache, outNode.NodeID, inNode, description, map[string]interface{}{
+					"fromChainType": 3,
+					"toChainType":   1,
+				}, ipPreference)
+			}
+		}
 	default:
 		for _, inNode := range inNodes {
 			description := fmt.Sprintf("入口(%s)->外网", inNode.NodeName)
@@ -547,13 +740,30 @@ func (h *Handler) diagnoseTunnelRuntime(tunnelID int64) (map[string]interface{},
 
 	payload := map[string]interface{}{
 		"tunnelName": tunnelName,
-		"tunnelType": map[bool]string{true: "端口转发", false: "隧道转发"}[tunnel.Type == 1],
+		"tunnelType": tunnelTypeName(tunnel.Type),
 		"timestamp":  time.Now().UnixMilli(),
 		"results":    results,
 	}
 	return payload, nil
 }
 
+func chainTypeLabel(chainType int) string {
+	if chainType == 3 {
+		return "出口"
+	}
+	return "入口"
+}
+
+func tunnelTypeName(tunnelType int) string {
+	switch tunnelType {
+	case 1:
+		return "端口转发"
+	case 3:
+		return "反向隧道"
+	}
+	return "隧道转发"
+}
+
 func splitChainNodeGroups(rows []chainNodeRecord) ([]chainNodeRecord, [][]chainNodeRecord, []chainNodeRecord) {
 	inNodes := make([]chainNodeRecord, 0)
 	outNodes := make([]chainNodeRecord, 0)
@@ -644,6 +854,21 @@ func (h *Handler) appendFailedDiagnosis(results *[]map[string]interface{}, nodeC
 	*results = append(*results, item)
 }
 
+func (h *Handler) appendSkippedTargetDiagnosis(results *[]map[string]interface{}, nodeCache map[int64]*nodeRecord, fromNodeID int64, targetIP string, targetPort int, description string, metadata map[string]interface{}) {
+	h.appendSkippedDiagnosis(results, nodeCache, fromNodeID, targetIP, targetPort, description, metadata, "仅UDP转发，跳过TCP连通性检测")
+}
+
+func (h *Handler) appendSkippedDiagnosis(results *[]map[string]interface{}, nodeCache map[int64]*nodeRecord, fromNodeID int64, targetIP string, targetPort int, description string, metadata map[string]interface{}, message string) {
+	item := newDiagnosisResultItem(fromNodeID, targetIP, targetPort, description, metadata)
+	if fromNode, err := h.cachedNode(nodeCache, fromNodeID); err == nil {
+		item["nodeName"] = fromNode.Name
+	}
+	item["success"] = true
+	item["skipped"] = true
+	item["message"] = message
+	*results = append(*results, item)
+}
+
 func (h *Handler) appendPathDiagnosis(results *[]map[string]interface{}, nodeCache map[int64]*nodeRecord, fromNodeID int64, targetIP string, targetPort int, description string, metadata map[string]interface{}) {
 	item := newDiagnosisResultItem(fromNodeID, targetIP, targetPort, description, metadata)
 
@@ -701,11 +926,18 @@ func (h *Handler) appendChainHopDiagnosis(results *[]map[string]interface{}, nod
 		h.appendFailedDiagnosis(results, nodeCache, fromNodeID, "", 0, description, metadata, err.Error())
 		return
 	}
+	metadata["protocol"] = toNode.Protocol
 	targetIP, targetPort, err := resolveChainProbeTarget(fromNode, targetNode, toNode.Port, ipPreference)
 	if err != nil {
 		h.appendFailedDiagnosis(results, nodeCache, fromNodeID, strings.Trim(strings.TrimSpace(targetNode.ServerIP), "[]"), toNode.Port, description, metadata, err.Error())
 		return
 	}
+	// A TCP probe cannot reach a hop listening on UDP.
+	if isUDPTunnelProtocol(toNode.Protocol) {
+		h.appendSkippedDiagnosis(results, nodeCache, fromNodeID, targetIP, targetPort, description, metadata,
+			fmt.Sprintf("%s 传输基于UDP，跳过TCP连通性检测", strings.ToUpper(toNode.Protocol)))
+		return
+	}
 	h.appendPathDiagnosis(results, nodeCache, fromNodeID, targetIP, targetPort, description, metadata)
 }
 
@@ -794,15 +1026,67 @@ func (h *Handler) tcpPingViaRemoteNode(node *nodeRecord, ip string, port int) (m
 	})
 }
 
-func splitRemoteTargets(remoteAddr string) []string {
+const maxTargetWeight = 100
+
+// remoteTarget is one entry of a forward's target list. The weight comes
+// from an optional "#weight=N" suffix and defaults to 1. A target of a port
+// range forward may name a port range, kept as its first port in addr and
+// its size in ports.
+type remoteTarget struct {
+	addr   string
+	weight int
+	ports  int
+}
+
+// parseRemoteTargets splits a target list and reads the per-target weights.
+// Targets with a malformed suffix keep weight 1 and are reported in err.
+func parseRemoteTargets(remoteAddr string) ([]remoteTarget, error) {
 	parts := strings.Split(remoteAddr, ",")
-	out := make([]string, 0, len(parts))
+	out := make([]remoteTarget, 0, len(parts))
+	var err error
 	for _, part := range parts {
 		part = strings.TrimSpace(part)
 		if part == "" {
 			continue
 		}
-		out = append(out, processServerAddress(part))
+		target := remoteTarget{weight: 1}
+		addr, suffix, found := strings.Cut(part, "#")
+		target.addr = processServerAddress(addr)
+		if host, port, splitErr := net.SplitHostPort(target.addr); splitErr == nil && strings.Contains(port, "-") {
+			first, last, ok := parsePortSpan(port)
+			if !ok {
+				if err == nil {
+					err = fmt.Errorf("目标端口段格式错误: %s", part)
+				}
+			} else {
+				target.addr = net.JoinHostPort(host, strconv.Itoa(first))
+				target.ports = last - first + 1
+			}
+		}
+		if found {
+			key, value, _ := strings.Cut(strings.TrimSpace(suffix), "=")
+			weight, convErr := strconv.Atoi(strings.TrimSpace(value))
+			if !strings.EqualFold(strings.TrimSpace(key), "weight") || convErr != nil || weight < 1 || weight > maxTargetWeight {
+				if err == nil {
+					err = fmt.Errorf("目标权重格式错误: %s（应为 地址#weight=1-%d）", part, maxTargetWeight)
+				}
+			} else {
+				target.weight = weight
+			}
+		}
+		if target.addr == "" {
+			continue
+		}
+		out = append(out, target)
+	}
+	return out, err
+}
+
+func splitRemoteTargets(remoteAddr string) []string {
+	targets, _ := parseRemoteTargets(remoteAddr)
+	out := make([]string, 0, len(targets))
+	for _, target := range targets {
+		out = append(out, target.addr)
 	}
 	return out
 }
@@ -861,6 +1145,86 @@ func buildForwardServiceBaseCandidates(forwardID, userID, preferredUserTunnelID
 	return bases
 }
 
+// forwardServiceProtocols lists the listener protocols a forward runs.
+func forwardServiceProtocols(protocol string) []string {
+	switch repo.NormalizeForwardProtocol(protocol) {
+	case repo.ForwardProtocolTCP:
+		return []string{"tcp"}
+	case repo.ForwardProtocolUDP:
+		return []string{"udp"}
+	default:
+		return []string{"tcp", "udp"}
+	}
+}
+
+// forwardServiceNames returns the service names a forward with the given
+// protocol runs on a node.
+func forwardServiceNames(base, protocol string) []string {
+	protocols := forwardServiceProtocols(protocol)
+	names := make([]string, 0, len(protocols))
+	for _, p := range protocols {
+		names = append(names, base+"_"+p)
+	}
+	return names
+}
+
+// disabledForwardServiceNames returns the service names a forward with the
+// given protocol must not run, left behind by an earlier protocol choice.
+func disabledForwardServiceNames(base, protocol string) []string {
+	var names []string
+	for _, p := range []string{"tcp", "udp"} {
+		if !forwardServesProtocol(protocol, p) {
+			names = append(names, base+"_"+p)
+		}
+	}
+	return names
+}
+
+func forwardServesProtocol(protocol, serviceProtocol string) bool {
+	for _, p := range forwardServiceProtocols(protocol) {
+		if p == serviceProtocol {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxyProtocolVersion validates a PROXY protocol version, where 0
+// turns it off.
+func parseProxyProtocolVersion(v interface{}, def int) (int, bool) {
+	version := asInt(v, def)
+	return version, version >= 0 && version <= 2
+}
+
+// parseForwardProtocol validates a requested forward protocol, falling back
+// to def when the request leaves it out.
+func parseForwardProtocol(v interface{}, def string) (string, bool) {
+	protocol := strings.ToLower(strings.TrimSpace(asString(v)))
+	if protocol == "" {
+		return repo.NormalizeForwardProtocol(def), true
+	}
+	switch protocol {
+	case repo.ForwardProtocolTCP, repo.ForwardProtocolUDP, repo.ForwardProtocolBoth:
+		return protocol, true
+	}
+	return "", false
+}
+
+// parseLoadBalanceStrategy validates a requested target selection strategy,
+// falling back to def when the request leaves it out. weighted, least and
+// sticky honour the per-target weights.
+func parseLoadBalanceStrategy(v interface{}, def string) (string, bool) {
+	strategy := strings.TrimSpace(asString(v))
+	if strategy == "" {
+		strategy = strings.TrimSpace(def)
+	}
+	switch strategy {
+	case "fifo", "round", "rand", "hash", "weighted", "least", "sticky":
+		return strategy, true
+	}
+	return "", false
+}
+
 func buildForwardControlServiceNames(base, commandType string) []string {
 	names := []string{base + "_tcp", base + "_udp"}
 	if strings.EqualFold(strings.TrimSpace(commandType), "DeleteService") {
@@ -882,10 +1246,12 @@ func isNotFoundError(err error) bool {
 	return strings.Contains(msg, "not found") || strings.Contains(msg, "不存在")
 }
 
-func buildForwardServiceConfigs(baseName string, forward *forwardRecord, tunnel *tunnelRecord, node *nodeRecord, port int, limiterID *int64, tunnelTLSProtocol bool) []map[string]interface{} {
-	protocols := []string{"tcp", "udp"}
-	services := make([]map[string]interface{}, 0, 2)
-	targets := splitRemoteTargets(forward.RemoteAddr)
+func buildForwardServiceConfigs(baseName string, forward *forwardRecord, tunnel *tunnelRecord, node *nodeRecord, port int, limiter, climiter string, tunnelTLSProtocol bool) []map[string]interface{} {
+	protocols := forwardServiceProtocols(forward.Protocol)
+	services := make([]map[string]interface{}, 0, len(protocols))
+	targets, _ := parseRemoteTargets(forward.RemoteAddr)
+	portMap := len(targets) > 0 && targets[0].ports > 0
+	admissions := admissionNames(forwardIPACLAdmissions(forward, tunnel))
 	strategy := strings.TrimSpace(forward.Strategy)
 	if strategy == "" {
 		strategy = "fifo"
@@ -896,9 +1262,10 @@ func buildForwardServiceConfigs(baseName string, forward *forwardRecord, tunnel
 		if protocol == "udp" {
 			listenerAddr = node.UDPListenAddr
 		}
+		listenerAddr = forwardListenHost(forward.ListenIP, listenerAddr)
 		service := map[string]interface{}{
 			"name": fmt.Sprintf("%s_%s", baseName, protocol),
-			"addr": fmt.Sprintf("%s:%d", listenerAddr, port),
+			"addr": fmt.Sprintf("%s:%s", listenerAddr, forwardListenPorts(port, forward.PortCount)),
 			"handler": map[string]interface{}{
 				"type": protocol,
 			},
@@ -914,6 +1281,14 @@ func buildForwardServiceConfigs(baseName string, forward *forwardRecord, tunnel
 				},
 			},
 		}
+		if protocol == "tcp" && forward.SNIHosts != "" {
+			// Forwards sharing the port are told apart by TLS server name or
+			// HTTP Host; each keeps its own service, limits and traffic.
+			service["listener"] = map[string]interface{}{
+				"type":     "sni",
+				"metadata": map[string]interface{}{"sni.hosts": splitSNIHosts(forward.SNIHosts)},
+			}
+		}
 		if protocol == "udp" {
 			listenerMetadata := map[string]interface{}{"keepAlive": true}
 			if tunnelTLSProtocol {
@@ -924,11 +1299,63 @@ func buildForwardServiceConfigs(baseName string, forward *forwardRecord, tunnel
 		if tunnel != nil && tunnel.Type == 2 {
 			service["handler"].(map[string]interface{})["chain"] = fmt.Sprintf("chains_%d", forward.TunnelID)
 		}
-		if tunnel != nil && tunnel.Type == 1 && strings.TrimSpace(node.InterfaceName) != "" {
-			service["metadata"] = map[string]interface{}{"interface": node.InterfaceName}
+		if tunnel != nil && tunnel.Type == 3 {
+			// The exit node binds the port on the entry node and accepts
+			// its connections through the reverse tunnel.
+			listener := service["listener"].(map[string]interface{})
+			listener["type"] = "r" + protocol
+			listener["chain"] = fmt.Sprintf("chains_%d", forward.TunnelID)
+		}
+		serviceMetadata := map[string]interface{}{}
+		if egress := forwardEgress(forward, tunnel, node); egress != "" {
+			serviceMetadata["interface"] = egress
+		}
+		if protocol == "tcp" && forward.ProxyIn > 0 {
+			serviceMetadata["proxyProtocol"] = forward.ProxyIn
+		}
+		if len(serviceMetadata) > 0 {
+			service["metadata"] = serviceMetadata
+		}
+		handlerMetadata := healthCheckMetadata(forward.ForwardHealthCheck)
+		// The header is written by the entry node only; chain hops relay it
+		// to the target as part of the stream.
+		if protocol == "tcp" && forward.ProxyOut > 0 {
+			if handlerMetadata == nil {
+				handlerMetadata = map[string]interface{}{}
+			}
+			handlerMetadata["proxyProtocol"] = forward.ProxyOut
+		}
+		if portMap {
+			if handlerMetadata == nil {
+				handlerMetadata = map[string]interface{}{}
+			}
+			handlerMetadata["portMap"] = true
+		}
+		if forward.ConnLog == 1 {
+			if handlerMetadata == nil {
+				handlerMetadata = map[string]interface{}{}
+			}
+			handlerMetadata["connLog"] = true
+		}
+		if protocol == "tcp" {
+			for k, v := range httpProxyMetadata(forward.ForwardHTTP) {
+				if handlerMetadata == nil {
+					handlerMetadata = map[string]interface{}{}
+				}
+				handlerMetadata[k] = v
+			}
+		}
+		if handlerMetadata != nil {
+			service["handler"].(map[string]interface{})["metadata"] = handlerMetadata
+		}
+		if len(admissions) > 0 {
+			service["admissions"] = admissions
+		}
+		if limiter != "" {
+			service["limiter"] = limiter
 		}
-		if limiterID != nil && *limiterID > 0 {
-			service["limiter"] = strconv.FormatInt(*limiterID, 10)
+		if climiter != "" && protocol == "tcp" {
+			service["climiter"] = climiter
 		}
 		services = append(services, service)
 	}
@@ -936,13 +1363,17 @@ func buildForwardServiceConfigs(baseName string, forward *forwardRecord, tunnel
 	return services
 }
 
-func buildForwarderNodes(targets []string) []map[string]interface{} {
+func buildForwarderNodes(targets []remoteTarget) []map[string]interface{} {
 	nodes := make([]map[string]interface{}, 0, len(targets))
-	for i, addr := range targets {
-		nodes = append(nodes, map[string]interface{}{
+	for i, target := range targets {
+		node := map[string]interface{}{
 			"name": fmt.Sprintf("node_%d", i+1),
-			"addr": addr,
-		})
+			"addr": target.addr,
+		}
+		if target.weight > 1 {
+			node["metadata"] = map[string]interface{}{"weight": target.weight}
+		}
+		nodes = append(nodes, node)
 	}
 	return nodes
 }
@@ -992,13 +1423,16 @@ func asBool(v interface{}, def bool) bool {
 	}
 }
 
-func (h *Handler) sendLimiterConfig(limiterID int64, speedMbps int, tunnelID int64) error {
-	rate := float64(speedMbps) / 8.0
-	limitStr := fmt.Sprintf("$ %.1fMB %.1fMB", rate, rate)
-
+func (h *Handler) sendLimiterConfig(limiterID int64, limits []string, tunnelID int64) error {
+	// UpdateLimiters registers the limiter when it is missing, so it covers
+	// both create and edit without the agent rejecting a duplicate name.
+	name := strconv.FormatInt(limiterID, 10)
 	payload := map[string]interface{}{
-		"name":   strconv.FormatInt(limiterID, 10),
-		"limits": []string{limitStr},
+		"limiter": name,
+		"data": map[string]interface{}{
+			"name":   name,
+			"limits": limits,
+		},
 	}
 
 	nodes, err := h.tunnelEntryNodeIDs(tunnelID)
@@ -1007,7 +1441,7 @@ func (h *Handler) sendLimiterConfig(limiterID int64, speedMbps int, tunnelID int
 	}
 
 	for _, nodeID := range nodes {
-		_, _ = h.sendNodeCommand(nodeID, "AddLimiters", payload, false, false)
+		_, _ = h.sendNodeCommand(nodeID, "UpdateLimiters", payload, false, false)
 	}
 	return nil
 }
@@ -1028,12 +1462,177 @@ func (h *Handler) sendDeleteLimiterConfig(limiterID int64, tunnelID int64) error
 	return nil
 }
 
-func (h *Handler) ensureLimiterOnNode(nodeID int64, limiterID int64, speed int) {
-	rate := float64(speed) / 8.0
-	limitStr := fmt.Sprintf("$ %.1fMB %.1fMB", rate, rate)
+func (h *Handler) ensureLimiterOnNode(nodeID int64, limiterID int64, limits []string) {
 	payload := map[string]interface{}{
 		"name":   strconv.FormatInt(limiterID, 10),
-		"limits": []string{limitStr},
+		"limits": limits,
 	}
 	_, _ = h.sendNodeCommand(nodeID, "AddLimiters", payload, false, false)
 }
+
+// mbpsLimit renders one gost traffic limiter line with the same rate in
+// both directions.
+func mbpsLimit(key string, mbps int) string {
+	rate := float64(mbps) / 8.0
+	return fmt.Sprintf("%s %.1fMB %.1fMB", key, rate, rate)
+}
+
+// speedLimitLimits turns a speed-limit rule into traffic limiter lines. "$"
+// is one bucket for every service using the rule, "$$" is a bucket per
+// connection, and the catch-all CIDRs give each source IP its own bucket.
+func speedLimitLimits(speed, connSpeed, ipSpeed int) []string {
+	limits := []string{mbpsLimit("$", speed)}
+	if connSpeed > 0 {
+		limits = append(limits, mbpsLimit("$$", connSpeed))
+	}
+	if ipSpeed > 0 {
+		limits = append(limits, mbpsLimit("0.0.0.0/0", ipSpeed), mbpsLimit("::/0", ipSpeed))
+	}
+	return limits
+}
+
+// connLimiterName is the per-forward gost conn limiter on each entry node.
+func connLimiterName(forwardID int64) string {
+	return fmt.Sprintf("fwd_%d", forwardID)
+}
+
+// forwardConnLimits renders the forward's connection caps as conn limiter
+// lines: "$" counts all connections of the service, "$$" each source IP.
+func forwardConnLimits(maxConns, maxIPConns int) []string {
+	var limits []string
+	if maxConns > 0 {
+		limits = append(limits, fmt.Sprintf("$ %d", maxConns))
+	}
+	if maxIPConns > 0 {
+		limits = append(limits, fmt.Sprintf("$$ %d", maxIPConns))
+	}
+	return limits
+}
+
+func (h *Handler) ensureConnLimiterOnNode(nodeID int64, name string, limits []string) {
+	payload := map[string]interface{}{
+		"limiter": name,
+		"data": map[string]interface{}{
+			"name":   name,
+			"limits": limits,
+		},
+	}
+	_, _ = h.sendNodeCommand(nodeID, "UpdateCLimiters", payload, false, false)
+}
+
+func (h *Handler) deleteConnLimiterOnNodes(name string, ports []forwardPortRecord) {
+	seen := make(map[int64]struct{})
+	for _, fp := range ports {
+		if _, ok := seen[fp.NodeID]; ok {
+			continue
+		}
+		seen[fp.NodeID] = struct{}{}
+		_, _ = h.sendNodeCommand(fp.NodeID, "DeleteCLimiters", map[string]interface{}{"limiter": name}, false, true)
+	}
+}
+
+// staleNodePorts returns the ports in old on nodes that have no port in
+// current, i.e. the nodes a forward no longer runs on.
+func staleNodePorts(old, current []forwardPortRecord) []forwardPortRecord {
+	kept := make(map[int64]struct{}, len(current))
+	for _, fp := range current {
+		kept[fp.NodeID] = struct{}{}
+	}
+	stale := make([]forwardPortRecord, 0)
+	for _, fp := range old {
+		if _, ok := kept[fp.NodeID]; !ok {
+			stale = append(stale, fp)
+		}
+	}
+	return stale
+}
+
+// userLimiterName is the node limiter shared by all services of a user. Its
+// service-level ("$") bucket is a single object on each node, so every
+// forward referencing it draws from one combined budget on that node.
+func userLimiterName(userID int64) string {
+	return fmt.Sprintf("user_%d", userID)
+}
+
+// serviceLimiterRef joins the user-tunnel limiter and the user limiter into
+// the comma separated list the agent combines into one limiter group.
+func serviceLimiterRef(limiterID *int64, userID int64, userSpeed int) string {
+	names := make([]string, 0, 2)
+	if limiterID != nil && *limiterID > 0 {
+		names = append(names, strconv.FormatInt(*limiterID, 10))
+	}
+	if userID > 0 && userSpeed > 0 {
+		names = append(names, userLimiterName(userID))
+	}
+	return strings.Join(names, ",")
+}
+
+func (h *Handler) userSpeed(userID int64) int {
+	speed, err := h.repo.GetUserSpeed(userID)
+	if err != nil {
+		return 0
+	}
+	return speed
+}
+
+func (h *Handler) ensureUserLimiterOnNode(nodeID, userID int64, speed int) {
+	payload := map[string]interface{}{
+		"name":   userLimiterName(userID),
+		"limits": []string{mbpsLimit("$", speed)},
+	}
+	_, _ = h.sendNodeCommand(nodeID, "AddLimiters", payload, false, false)
+}
+
+// applyUserSpeedChange pushes a changed user cap to every node hosting the
+// user's active forwards. Turning the cap on or off changes the services'
+// limiter reference, so those forwards are resynced as well.
+func (h *Handler) applyUserSpeedChange(userID int64, oldSpeed, newSpeed int) {
+	if oldSpeed == newSpeed {
+		return
+	}
+	forwards, err := h.listActiveForwardsByUser(userID)
+	if err != nil {
+		return
+	}
+	nodeIDs := make([]int64, 0)
+	seen := make(map[int64]struct{})
+	for i := range forwards {
+		ports, err := h.listForwardPorts(forwards[i].ID)
+		if err != nil {
+			continue
+		}
+		for _, fp := range h.forwardServicePorts(forwards[i].TunnelID, ports) {
+			if _, ok := seen[fp.NodeID]; ok {
+				continue
+			}
+			seen[fp.NodeID] = struct{}{}
+			nodeIDs = append(nodeIDs, fp.NodeID)
+		}
+	}
+
+	name := userLimiterName(userID)
+	if newSpeed > 0 {
+		payload := map[string]interface{}{
+			"limiter": name,
+			"data": map[string]interface{}{
+				"name":   name,
+				"limits": []string{mbpsLimit("$", newSpeed)},
+			},
+		}
+		for _, nodeID := range nodeIDs {
+			_, _ = h.sendNodeCommand(nodeID, "UpdateLimiters", payload, false, false)
+		}
+	}
+
+	if (oldSpeed > 0) != (newSpeed > 0) {
+		for i := range forwards {
+			_ = h.syncForwardServices(&forwards[i], "UpdateService", true)
+		}
+	}
+
+	if newSpeed <= 0 {
+		for _, nodeID := range nodeIDs {
+			_, _ = h.sendNodeCommand(nodeID, "DeleteLimiters", map[string]interface{}{"limiter": name}, false, true)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package handler
 
 import (
+	"errors"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
+
+	"go-backend/internal/store/repo"
+	"go-backend/internal/ws"
 )
 
 func TestBuildForwardControlServiceNamesPauseResume(t *testing.T) {
@@ -53,3 +59,261 @@ func TestShouldTryLegacySingleService(t *testing.T) {
 		t.Fatalf("DeleteService should not require legacy fallback")
 	}
 }
+
+func TestServiceLimiterRefCombinesUserLimiter(t *testing.T) {
+	limiterID := int64(12)
+	cases := []struct {
+		limiterID *int64
+		userSpeed int
+		want      string
+	}{
+		{nil, 0, ""},
+		{&limiterID, 0, "12"},
+		{nil, 100, "user_5"},
+		{&limiterID, 100, "12,user_5"},
+	}
+	for _, tc := range cases {
+		if got := serviceLimiterRef(tc.limiterID, 5, tc.userSpeed); got != tc.want {
+			t.Fatalf("serviceLimiterRef(%v, %d) = %q, want %q", tc.limiterID, tc.userSpeed, got, tc.want)
+		}
+	}
+
+	forward := &forwardRecord{ID: 1, UserID: 5, TunnelID: 2, RemoteAddr: "1.1.1.1:443"}
+	node := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+	for _, svc := range buildForwardServiceConfigs("1_5_7", forward, nil, node, 10000, "12,user_5", "", false) {
+		if svc["limiter"] != "12,user_5" {
+			t.Fatalf("service %v missing combined limiter", svc["name"])
+		}
+	}
+}
+
+func TestUserLimiterKeptWhileUserHasSpeed(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "user-speed.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	now := time.Now().UnixMilli()
+	if err := r.CreateUser("capped", "x", 1, now+int64(time.Hour/time.Millisecond), 100, 1, 10, 50, 0, 0, 1, now); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	userID := mustLastInsertID(t, r, "user")
+	name := userLimiterName(userID)
+
+	if !h.speedLimiterExists(name) {
+		t.Fatalf("expected %s to be kept while the user has a cap", name)
+	}
+	if err := r.UpdateUserWithoutPassword(userID, "capped", 100, 10, 0, 0, 0, now, 1, 1, now); err != nil {
+		t.Fatalf("update user: %v", err)
+	}
+	if h.speedLimiterExists(name) {
+		t.Fatalf("expected %s to be orphaned once the cap is removed", name)
+	}
+	if h.speedLimiterExists("user_999") {
+		t.Fatalf("expected limiter of unknown user to be orphaned")
+	}
+}
+
+func TestSpeedLimitAndConnLimitLines(t *testing.T) {
+	got := speedLimitLimits(80, 16, 8)
+	want := []string{"$ 10.0MB 10.0MB", "$$ 2.0MB 2.0MB", "0.0.0.0/0 1.0MB 1.0MB", "::/0 1.0MB 1.0MB"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("speedLimitLimits = %v, want %v", got, want)
+	}
+	if got := speedLimitLimits(80, 0, 0); !reflect.DeepEqual(got, []string{"$ 10.0MB 10.0MB"}) {
+		t.Fatalf("expected service line only, got %v", got)
+	}
+
+	if got := forwardConnLimits(0, 0); len(got) != 0 {
+		t.Fatalf("expected no conn limits, got %v", got)
+	}
+	if got := forwardConnLimits(100, 5); !reflect.DeepEqual(got, []string{"$ 100", "$$ 5"}) {
+		t.Fatalf("unexpected conn limits %v", got)
+	}
+
+	forward := &forwardRecord{ID: 9, UserID: 5, TunnelID: 2, RemoteAddr: "1.1.1.1:443", MaxConns: 100}
+	node := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+	for _, svc := range buildForwardServiceConfigs("9_5_7", forward, nil, node, 10000, "", connLimiterName(9), false) {
+		climiter, ok := svc["climiter"]
+		if svc["name"] == "9_5_7_tcp" && climiter != "fwd_9" {
+			t.Fatalf("tcp service missing conn limiter: %v", svc)
+		}
+		if svc["name"] == "9_5_7_udp" && ok {
+			t.Fatalf("udp service should not carry a conn limiter: %v", svc)
+		}
+	}
+}
+
+func TestStaleNodePortsKeepsNodesStillRunningTheForward(t *testing.T) {
+	old := []forwardPortRecord{{NodeID: 1, Port: 10000}, {NodeID: 2, Port: 10000}, {NodeID: 3, Port: 10000}}
+	current := []forwardPortRecord{{NodeID: 2, Port: 10001}, {NodeID: 4, Port: 10001}}
+	got := staleNodePorts(old, current)
+	want := []forwardPortRecord{{NodeID: 1, Port: 10000}, {NodeID: 3, Port: 10000}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("staleNodePorts = %v, want %v", got, want)
+	}
+	if got := staleNodePorts(old, old); len(got) != 0 {
+		t.Fatalf("expected no stale nodes when nothing moved, got %v", got)
+	}
+}
+
+func TestForwardProtocolSelectsServices(t *testing.T) {
+	node := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+	cases := map[string][]string{
+		"tcp":     {"4_5_7_tcp"},
+		"udp":     {"4_5_7_udp"},
+		"tcp+udp": {"4_5_7_tcp", "4_5_7_udp"},
+		"":        {"4_5_7_tcp", "4_5_7_udp"},
+	}
+	for protocol, want := range cases {
+		forward := &forwardRecord{ID: 4, UserID: 5, TunnelID: 2, RemoteAddr: "1.1.1.1:53", Protocol: protocol}
+		var got []string
+		for _, svc := range buildForwardServiceConfigs("4_5_7", forward, nil, node, 10000, "", "", false) {
+			got = append(got, svc["name"].(string))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("protocol %q: expected services %v, got %v", protocol, want, got)
+		}
+	}
+
+	if got := disabledForwardServiceNames("4_5_7", "udp"); !reflect.DeepEqual(got, []string{"4_5_7_tcp"}) {
+		t.Fatalf("unexpected disabled services for udp: %v", got)
+	}
+	if got := disabledForwardServiceNames("4_5_7", "tcp+udp"); len(got) != 0 {
+		t.Fatalf("expected no disabled services for tcp+udp, got %v", got)
+	}
+	if got, ok := parseForwardProtocol(" UDP ", "tcp"); !ok || got != "udp" {
+		t.Fatalf("expected udp, got %q (%v)", got, ok)
+	}
+	if got, ok := parseForwardProtocol(nil, "tcp"); !ok || got != "tcp" {
+		t.Fatalf("expected fallback to tcp, got %q (%v)", got, ok)
+	}
+	if _, ok := parseForwardProtocol("sctp", "tcp"); ok {
+		t.Fatalf("expected sctp to be rejected")
+	}
+}
+
+func TestUsedPortsOnlyCountOverlappingForwardProtocols(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "forward_protocol.db")
+	r, err := repo.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	nowMs := time.Now().UnixMilli()
+	if err := r.DB().Exec(`
+		INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, protocol, in_flow, out_flow, created_time, updated_time, status, inx)
+		VALUES(1, 1, 'admin', 'dns', 1, '1.1.1.1:53', 'fifo', 'udp', 0, 0, ?, ?, 1, 0)
+	`, nowMs, nowMs).Error; err != nil {
+		t.Fatalf("insert forward: %v", err)
+	}
+	if err := r.DB().Exec(`INSERT INTO forward_port(id, forward_id, node_id, port) VALUES(1, 1, 7, 5353)`).Error; err != nil {
+		t.Fatalf("insert forward_port: %v", err)
+	}
+
+	for protocol, want := range map[string]bool{"tcp": false, "udp": true, "tcp+udp": true} {
+		used, err := r.GetUsedPortsOnNodeAsMap(7, protocol, "")
+		if err != nil {
+			t.Fatalf("used ports for %s: %v", protocol, err)
+		}
+		if used[5353] != want {
+			t.Fatalf("protocol %s: expected port 5353 used=%v, got %v", protocol, want, used[5353])
+		}
+	}
+}
+
+func TestForwardProxyProtocolOnlyOnTCPService(t *testing.T) {
+	forward := &forwardRecord{ID: 6, UserID: 5, TunnelID: 2, RemoteAddr: "10.0.0.8:80", ProxyIn: 2, ProxyOut: 1}
+	tunnel := &tunnelRecord{ID: 2, Type: 1}
+	node := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "[::]", InterfaceName: "eth1"}
+
+	services := buildForwardServiceConfigs("6_5_7", forward, tunnel, node, 10000, "", "", false)
+	if len(services) != 2 {
+		t.Fatalf("expected tcp and udp services, got %d", len(services))
+	}
+	for _, svc := range services {
+		md, _ := svc["metadata"].(map[string]interface{})
+		handlerMD, _ := svc["handler"].(map[string]interface{})["metadata"].(map[string]interface{})
+		if md["interface"] != "eth1" {
+			t.Fatalf("expected interface metadata to be kept: %v", svc)
+		}
+		switch svc["name"] {
+		case "6_5_7_tcp":
+			if md["proxyProtocol"] != 2 || handlerMD["proxyProtocol"] != 1 {
+				t.Fatalf("tcp service missing PROXY protocol settings: %v", svc)
+			}
+		case "6_5_7_udp":
+			if _, ok := md["proxyProtocol"]; ok || handlerMD != nil {
+				t.Fatalf("udp service should not carry PROXY protocol settings: %v", svc)
+			}
+		}
+	}
+
+	if _, ok := parseProxyProtocolVersion(3, 0); ok {
+		t.Fatalf("expected version 3 to be rejected")
+	}
+	if got, ok := parseProxyProtocolVersion(nil, 2); !ok || got != 2 {
+		t.Fatalf("expected fallback to 2, got %d (%v)", got, ok)
+	}
+}
+
+func TestForwardTargetWeightsAndStrategy(t *testing.T) {
+	forward := &forwardRecord{ID: 9, UserID: 5, TunnelID: 2, RemoteAddr: "10.0.0.1:80#weight=3, [::1]:80,10.0.0.2:80#weight=1", Strategy: "least", Protocol: "tcp"}
+	node := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+
+	services := buildForwardServiceConfigs("9_5_7", forward, nil, node, 10000, "", "", false)
+	if len(services) != 1 {
+		t.Fatalf("expected a single tcp service, got %d", len(services))
+	}
+	forwarder := services[0]["forwarder"].(map[string]interface{})
+	if strategy := forwarder["selector"].(map[string]interface{})["strategy"]; strategy != "least" {
+		t.Fatalf("expected least strategy, got %v", strategy)
+	}
+	nodes := forwarder["nodes"].([]map[string]interface{})
+	if len(nodes) != 3 || nodes[0]["addr"] != "10.0.0.1:80" || nodes[1]["addr"] != "[::1]:80" || nodes[2]["addr"] != "10.0.0.2:80" {
+		t.Fatalf("unexpected forwarder nodes: %v", nodes)
+	}
+	if !reflect.DeepEqual(nodes[0]["metadata"], map[string]interface{}{"weight": 3}) {
+		t.Fatalf("expected weight metadata on the first node, got %v", nodes[0])
+	}
+	if _, ok := nodes[2]["metadata"]; ok {
+		t.Fatalf("weight 1 should not add metadata: %v", nodes[2])
+	}
+	if got := splitRemoteTargets(forward.RemoteAddr); !reflect.DeepEqual(got, []string{"10.0.0.1:80", "[::1]:80", "10.0.0.2:80"}) {
+		t.Fatalf("expected weights to be stripped, got %v", got)
+	}
+
+	for _, remoteAddr := range []string{"10.0.0.1:80#weight=0", "10.0.0.1:80#weight=101", "10.0.0.1:80#w=2", "10.0.0.1:80#weight=x"} {
+		if _, err := parseRemoteTargets(remoteAddr); err == nil {
+			t.Fatalf("expected %q to be rejected", remoteAddr)
+		}
+	}
+	if got, ok := parseLoadBalanceStrategy(nil, "round"); !ok || got != "round" {
+		t.Fatalf("expected fallback to round, got %q (%v)", got, ok)
+	}
+	if _, ok := parseLoadBalanceStrategy("leastconn", "fifo"); ok {
+		t.Fatalf("expected unknown strategy to be rejected")
+	}
+}
+
+func TestAgentUpdateErrorNamesFailedItem(t *testing.T) {
+	raw := errors.New("update service 7_2_3_tcp failed: listen tcp :20000: bind: address already in use")
+	err := agentUpdateError(ws.CommandResult{Data: map[string]interface{}{
+		"kind":       "service",
+		"name":       "7_2_3_tcp",
+		"stage":      "parse",
+		"error":      "listen tcp :20000: bind: address already in use",
+		"rolledBack": true,
+	}}, raw)
+	want := "服务 7_2_3_tcp 解析或监听失败: listen tcp :20000: bind: address already in use（节点保持原配置）"
+	if err.Error() != want {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+
+	if got := agentUpdateError(ws.CommandResult{}, raw); got != raw {
+		t.Fatalf("expected a reply without details to pass through, got %v", got)
+	}
+}
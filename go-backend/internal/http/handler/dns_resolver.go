@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/store/model"
+)
+
+const (
+	maxDNSServers = 5
+	maxDNSTTL     = 86400
+)
+
+// A forward's services resolve domain targets through a gost resolver
+// registered on the node running them: the forward's own when it sets
+// nameservers, otherwise the node's. Resolution happens where the services
+// run, so for tunnel forwarding the entry node resolves and the exit node
+// dials the address it was given.
+
+func forwardResolverName(forwardID int64) string {
+	return fmt.Sprintf("dns_fwd_%d", forwardID)
+}
+
+func nodeResolverName(nodeID int64) string {
+	return fmt.Sprintf("dns_node_%d", nodeID)
+}
+
+// parseDNSResolver reads the resolver fields of a forward or node request.
+// Fields left out keep their value in def; without nameservers the other
+// settings are cleared, as the system resolver is used then.
+func parseDNSResolver(req map[string]interface{}, def model.DNSResolver) (model.DNSResolver, error) {
+	cfg := def
+	if v, ok := req["dnsServers"]; ok {
+		servers, err := parseNameservers(asString(v))
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Servers = strings.Join(servers, "\n")
+	}
+	if v, ok := req["dnsPrefer"]; ok {
+		cfg.Prefer = strings.ToLower(strings.TrimSpace(asString(v)))
+	}
+	cfg.TTL = asInt(req["dnsTtl"], cfg.TTL)
+	if cfg.Servers == "" {
+		return model.DNSResolver{}, nil
+	}
+	switch cfg.Prefer {
+	case "", "ipv4", "ipv6":
+	default:
+		return cfg, errors.New("解析优先只能是 ipv4 或 ipv6")
+	}
+	if cfg.TTL < 0 || cfg.TTL > maxDNSTTL {
+		return cfg, fmt.Errorf("DNS 缓存时间范围为 0-%d 秒", maxDNSTTL)
+	}
+	return cfg, nil
+}
+
+// parseNameservers reads one nameserver per line or comma: a plain
+// "host[:port]" for DNS over UDP, or a tcp://, tls:// (dot://) or https://
+// URL. Addresses get their default port so the agent dials what is shown.
+func parseNameservers(s string) ([]string, error) {
+	var out []string
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ',' }) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		server, err := normalizeNameserver(item)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, server)
+	}
+	if len(out) > maxDNSServers {
+		return nil, fmt.Errorf("DNS 服务器最多 %d 个", maxDNSServers)
+	}
+	return out, nil
+}
+
+func normalizeNameserver(item string) (string, error) {
+	scheme, rest, found := strings.Cut(item, "://")
+	if !found {
+		scheme, rest = "udp", item
+	}
+	scheme = strings.ToLower(scheme)
+	invalid := fmt.Errorf("DNS 服务器格式错误: %s", item)
+
+	if scheme == "https" {
+		u, err := url.Parse(item)
+		if err != nil || u.Host == "" {
+			return "", invalid
+		}
+		if u.Path == "" {
+			u.Path = "/dns-query"
+		}
+		return u.String(), nil
+	}
+
+	defaultPort := "53"
+	switch scheme {
+	case "udp", "tcp":
+	case "tls", "dot":
+		scheme, defaultPort = "tls", "853"
+	default:
+		return "", invalid
+	}
+	host, port, err := net.SplitHostPort(rest)
+	if err != nil {
+		host, port = strings.Trim(rest, "[]"), defaultPort
+	}
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return "", invalid
+	}
+	if host == "" || strings.ContainsAny(host, "/ ") {
+		return "", invalid
+	}
+	addr := net.JoinHostPort(host, port)
+	if scheme == "udp" {
+		return addr, nil
+	}
+	return scheme + "://" + addr, nil
+}
+
+// forwardResolver picks the resolver a forward's services on node use, or
+// an empty name for the system resolver.
+func forwardResolver(forward *forwardRecord, node *nodeRecord) (string, model.DNSResolver) {
+	if forward != nil && forward.DNSResolver.Servers != "" {
+		return forwardResolverName(forward.ID), forward.DNSResolver
+	}
+	if node != nil && node.DNSResolver.Servers != "" {
+		return nodeResolverName(node.ID), node.DNSResolver
+	}
+	return "", model.DNSResolver{}
+}
+
+// buildResolverConfig renders resolver settings as a gost resolver. Every
+// nameserver shares the preference and cache time; they are tried in order.
+func buildResolverConfig(name string, dns model.DNSResolver) map[string]interface{} {
+	nameservers := make([]map[string]interface{}, 0)
+	for _, server := range strings.Split(dns.Servers, "\n") {
+		if server = strings.TrimSpace(server); server == "" {
+			continue
+		}
+		ns := map[string]interface{}{"addr": server}
+		if dns.Prefer != "" {
+			ns["prefer"] = dns.Prefer
+		}
+		if dns.TTL > 0 {
+			ns["ttl"] = int64(time.Duration(dns.TTL) * time.Second)
+		}
+		nameservers = append(nameservers, ns)
+	}
+	return map[string]interface{}{
+		"name":        name,
+		"nameservers": nameservers,
+	}
+}
+
+func (h *Handler) ensureResolverOnNode(nodeID int64, name string, dns model.DNSResolver) error {
+	payload := map[string]interface{}{
+		"resolver": name,
+		"data":     buildResolverConfig(name, dns),
+	}
+	_, err := h.sendNodeCommand(nodeID, "UpdateResolvers", payload, false, false)
+	return err
+}
+
+func (h *Handler) deleteResolverOnNodes(name string, ports []forwardPortRecord) {
+	seen := make(map[int64]struct{})
+	for _, fp := range ports {
+		if _, ok := seen[fp.NodeID]; ok {
+			continue
+		}
+		seen[fp.NodeID] = struct{}{}
+		_, _ = h.sendNodeCommand(fp.NodeID, "DeleteResolvers", map[string]interface{}{"resolver": name}, false, true)
+	}
+}
+
+// applyNodeResolver rolls a node's resolver change out. Edited nameservers
+// take effect in place; the forwards running on the node without their own
+// resolver are redeployed only when it is turned on or off, since that
+// changes the resolver their services reference.
+func (h *Handler) applyNodeResolver(nodeID int64, old, updated model.DNSResolver) {
+	if old == updated {
+		return
+	}
+	name := nodeResolverName(nodeID)
+	if updated.Servers != "" {
+		_ = h.ensureResolverOnNode(nodeID, name, updated)
+	}
+	if (old.Servers == "") != (updated.Servers == "") {
+		ids, _ := h.repo.ListActiveForwardIDsOnNode(nodeID)
+		for _, id := range ids {
+			forward, err := h.getForwardRecord(id)
+			if err != nil || forward.DNSResolver.Servers != "" {
+				continue
+			}
+			_ = h.syncForwardServices(forward, "UpdateService", true)
+		}
+	}
+	if updated.Servers == "" {
+		_, _ = h.sendNodeCommand(nodeID, "DeleteResolvers", map[string]interface{}{"resolver": name}, false, true)
+	}
+}
+
+// appendResolveDiagnosis resolves a domain target on the node running a
+// forward's services, with the resolver they use. It returns the first
+// address, which the later probes dial as the services would, or the host
+// itself when it is an IP or could not be resolved.
+func (h *Handler) appendResolveDiagnosis(results *[]map[string]interface{}, nodeCache map[int64]*nodeRecord, forward *forwardRecord, nodeID int64, target diagnosisTarget, description string, metadata map[string]interface{}) string {
+	if net.ParseIP(target.IP) != nil {
+		return target.IP
+	}
+	node, err := h.cachedNode(nodeCache, nodeID)
+	if err != nil || node.IsRemote == 1 {
+		return target.IP
+	}
+	resolver, _ := forwardResolver(forward, node)
+	item := newDiagnosisResultItem(nodeID, target.IP, target.Port, description, metadata)
+	item["resolve"] = true
+	item["resolver"] = resolver
+	item["nodeName"] = node.Name
+
+	res, err := h.sendNodeCommand(nodeID, "Resolve", map[string]interface{}{
+		"host":     target.IP,
+		"resolver": resolver,
+	}, false, false)
+	if err != nil && strings.Contains(err.Error(), "未知命令") {
+		// Agents before resolver support cannot report their lookups.
+		return target.IP
+	}
+	if err == nil && res.Data == nil {
+		err = errors.New("节点未返回解析结果")
+	}
+	if err != nil {
+		item["success"] = false
+		item["message"] = "解析失败: " + err.Error()
+		*results = append(*results, item)
+		return target.IP
+	}
+
+	var ips []string
+	if list, ok := res.Data["ips"].([]interface{}); ok {
+		for _, ip := range list {
+			ips = append(ips, asString(ip))
+		}
+	}
+	if !asBool(res.Data["success"], false) || len(ips) == 0 {
+		item["success"] = false
+		item["message"] = "解析失败: " + defaultString(asString(res.Data["errorMessage"]), "未解析到任何地址")
+		*results = append(*results, item)
+		return target.IP
+	}
+	item["success"] = true
+	item["packetLoss"] = 0
+	item["resolvedIps"] = ips
+	item["message"] = "解析到 " + strings.Join(ips, ", ")
+	*results = append(*results, item)
+	return ips[0]
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"testing"
+
+	"go-backend/internal/store/model"
+)
+
+func TestParseDNSResolverNormalizesNameservers(t *testing.T) {
+	cfg, err := parseDNSResolver(map[string]interface{}{
+		"dnsServers": "1.1.1.1\n2001:4860:4860::8888, tcp://8.8.8.8:5353\ndot://dns.google\nhttps://1.1.1.1",
+		"dnsPrefer":  "IPv4",
+		"dnsTtl":     60,
+	}, model.DNSResolver{})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := "1.1.1.1:53\n[2001:4860:4860::8888]:53\ntcp://8.8.8.8:5353\ntls://dns.google:853\nhttps://1.1.1.1/dns-query"
+	if cfg.Servers != want || cfg.Prefer != "ipv4" || cfg.TTL != 60 {
+		t.Fatalf("unexpected resolver %+v", cfg)
+	}
+
+	kept, err := parseDNSResolver(map[string]interface{}{"dnsTtl": 30}, cfg)
+	if err != nil || kept.Servers != want || kept.TTL != 30 {
+		t.Fatalf("expected omitted fields to be kept, got %+v, %v", kept, err)
+	}
+	cleared, err := parseDNSResolver(map[string]interface{}{"dnsServers": ""}, cfg)
+	if err != nil || cleared != (model.DNSResolver{}) {
+		t.Fatalf("expected clearing nameservers to reset the resolver, got %+v, %v", cleared, err)
+	}
+
+	for _, req := range []map[string]interface{}{
+		{"dnsServers": "quic://1.1.1.1"},
+		{"dnsServers": "1.1.1.1:70000"},
+		{"dnsServers": "https:///dns-query"},
+		{"dnsServers": "1.1.1.1", "dnsPrefer": "ipv5"},
+		{"dnsServers": "1.1.1.1", "dnsTtl": -1},
+		{"dnsServers": "1.1.1.1,1.0.0.1,8.8.8.8,8.8.4.4,9.9.9.9,149.112.112.112"},
+	} {
+		if _, err := parseDNSResolver(req, model.DNSResolver{}); err == nil {
+			t.Fatalf("expected %v to be rejected", req)
+		}
+	}
+}
+
+func TestForwardResolverPrefersForward(t *testing.T) {
+	node := &nodeRecord{ID: 7, DNSResolver: model.DNSResolver{Servers: "1.1.1.1:53"}}
+	forward := &forwardRecord{ID: 3}
+
+	if name, _ := forwardResolver(forward, &nodeRecord{ID: 7}); name != "" {
+		t.Fatalf("expected the system resolver, got %q", name)
+	}
+	if name, dns := forwardResolver(forward, node); name != "dns_node_7" || dns.Servers != "1.1.1.1:53" {
+		t.Fatalf("expected the node resolver, got %q %+v", name, dns)
+	}
+	forward.DNSResolver = model.DNSResolver{Servers: "8.8.8.8:53", TTL: 30}
+	name, dns := forwardResolver(forward, node)
+	if name != "dns_fwd_3" || dns.Servers != "8.8.8.8:53" {
+		t.Fatalf("expected the forward resolver, got %q %+v", name, dns)
+	}
+
+	nameservers, _ := buildResolverConfig(name, dns)["nameservers"].([]map[string]interface{})
+	if len(nameservers) != 1 || nameservers[0]["addr"] != "8.8.8.8:53" || nameservers[0]["ttl"] != int64(30e9) {
+		t.Fatalf("unexpected nameservers %v", nameservers)
+	}
+}
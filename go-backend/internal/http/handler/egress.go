@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"go-backend/internal/store/model"
+)
+
+// parseEgress normalizes the interface name or source IP a forward's
+// outbound connections to its targets leave from. An empty result keeps the
+// node's own setting.
+func parseEgress(v interface{}) (string, error) {
+	raw := strings.TrimSpace(asString(v))
+	if raw == "" {
+		return "", nil
+	}
+	if ip := net.ParseIP(strings.Trim(raw, "[]")); ip != nil {
+		return ip.String(), nil
+	}
+	if len(raw) > 64 || strings.ContainsAny(raw, " \t\r\n,") {
+		return "", fmt.Errorf("出口网卡或 IP 无效: %s", raw)
+	}
+	return raw, nil
+}
+
+// nodeInterfaceList decodes the interfaces a node reported. It returns nil
+// for nodes running an agent that does not report them.
+func nodeInterfaceList(node *nodeRecord) []model.NodeInterface {
+	if node == nil || strings.TrimSpace(node.Interfaces) == "" {
+		return nil
+	}
+	var list []model.NodeInterface
+	if json.Unmarshal([]byte(node.Interfaces), &list) != nil {
+		return nil
+	}
+	return list
+}
+
+// nodeHasEgress reports whether egress names one of a node's interfaces or
+// one of their addresses.
+func nodeHasEgress(list []model.NodeInterface, egress string) bool {
+	for _, item := range list {
+		if item.Name == egress {
+			return true
+		}
+		for _, addr := range item.Addrs {
+			if ip := net.ParseIP(addr); ip != nil && ip.String() == egress {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkForwardEgress makes sure every node dialing a forward's targets has
+// the chosen interface or address: the entry nodes of a port forward, or
+// the exit node of a reverse tunnel. Tunnel forwarding leaves from its exit
+// node's relay, which all forwards of the tunnel share, so it cannot pick
+// one per forward.
+func (h *Handler) checkForwardEgress(egress string, tunnel *tunnelRecord) error {
+	if egress == "" || tunnel == nil {
+		return nil
+	}
+	var nodeIDs []int64
+	switch tunnel.Type {
+	case 1:
+		nodeIDs, _ = h.tunnelEntryNodeIDs(tunnel.ID)
+	case 3:
+		if exitID := h.reverseTunnelExitNodeID(tunnel.ID); exitID > 0 {
+			nodeIDs = []int64{exitID}
+		}
+	default:
+		return errors.New("隧道转发的出口由出口节点决定，不能单独指定出口 IP")
+	}
+	for _, nodeID := range nodeIDs {
+		node, err := h.getNodeRecord(nodeID)
+		if err != nil {
+			return err
+		}
+		if node.IsRemote == 1 {
+			return fmt.Errorf("远程节点 %s 不能指定出口 IP", nodeDisplayName(node))
+		}
+		list := nodeInterfaceList(node)
+		if list == nil {
+			return fmt.Errorf("节点 %s 未上报网卡信息，请升级节点后再设置", nodeDisplayName(node))
+		}
+		if !nodeHasEgress(list, egress) {
+			return fmt.Errorf("出口 %s 不是节点 %s 的网卡或地址", egress, nodeDisplayName(node))
+		}
+	}
+	return nil
+}
+
+// forwardEgress is the interface or source IP a forward's services dial
+// their targets from: the forward's own choice, then the user's tunnel
+// permission, then for port forwards the entry node's interface.
+func forwardEgress(forward *forwardRecord, tunnel *tunnelRecord, node *nodeRecord) string {
+	if tunnel == nil || tunnel.Type == 2 {
+		return ""
+	}
+	if forward.InterfaceName != "" {
+		return forward.InterfaceName
+	}
+	if tunnel.Type == 1 && node != nil {
+		return strings.TrimSpace(node.InterfaceName)
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestParseEgress(t *testing.T) {
+	for in, want := range map[string]string{" eth1 ": "eth1", "2001:db8::0:1": "2001:db8::1", "": ""} {
+		if got, err := parseEgress(in); err != nil || got != want {
+			t.Fatalf("parseEgress(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := parseEgress("eth0 eth1"); err == nil {
+		t.Fatalf("expected a list to be rejected")
+	}
+}
+
+func TestForwardEgressOverridesNode(t *testing.T) {
+	forward := &forwardRecord{ID: 1, UserID: 2, TunnelID: 3, RemoteAddr: "10.0.0.1:22", Protocol: "tcp", InterfaceName: "203.0.113.2"}
+	node := &nodeRecord{ID: 7, TCPListenAddr: "[::]", UDPListenAddr: "[::]", InterfaceName: "eth0"}
+
+	for _, tc := range []struct {
+		tunnelType int
+		own        string
+		want       interface{}
+	}{
+		{1, "203.0.113.2", "203.0.113.2"},
+		{1, "", "eth0"},
+		{3, "203.0.113.2", "203.0.113.2"},
+		{3, "", nil},
+		{2, "203.0.113.2", nil},
+	} {
+		forward.InterfaceName = tc.own
+		svc := buildForwardServiceConfigs("1_2_3", forward, &tunnelRecord{ID: 3, Type: tc.tunnelType}, node, 443, "", "", false)[0]
+		metadata, _ := svc["metadata"].(map[string]interface{})
+		if metadata["interface"] != tc.want {
+			t.Fatalf("tunnel type %d with %q: expected interface %v, got %v", tc.tunnelType, tc.own, tc.want, metadata["interface"])
+		}
+	}
+}
+
+func TestCheckForwardEgress(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "egress.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	now := time.Now().UnixMilli()
+	if err := r.CreateNode("multi", "s", "203.0.113.1", nil, nil, "1000-65535", nil, nil, 0, 0, 0, now, 1, "[::]", "[::]", "", model.DNSResolver{}, 0, 0, nil, nil, nil); err != nil {
+		t.Fatalf("create node: %v", err)
+	}
+	tx := r.BeginTx()
+	tunnels := []model.Tunnel{{Name: "direct", Type: 1, Protocol: "tls", Status: 1}, {Name: "chain", Type: 2, Protocol: "tls", Status: 1}}
+	for i := range tunnels {
+		if err := tx.Create(&tunnels[i]).Error; err != nil {
+			t.Fatalf("create tunnel: %v", err)
+		}
+	}
+	if err := r.CreateChainTunnelTx(tx, tunnels[0].ID, "1", 1, sql.NullInt64{}, "round", 0, "tls", ""); err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	direct, _ := h.getTunnelRecord(tunnels[0].ID)
+	chain, _ := h.getTunnelRecord(tunnels[1].ID)
+
+	if err := h.checkForwardEgress("eth1", direct); err == nil {
+		t.Fatalf("expected a node without reported interfaces to be rejected")
+	}
+	if err := r.UpdateNodeInterfaces(1, `[{"name":"eth0","addrs":["203.0.113.1"]},{"name":"eth1","addrs":["203.0.113.2","2001:db8::2"]}]`); err != nil {
+		t.Fatalf("update interfaces: %v", err)
+	}
+	for _, egress := range []string{"eth1", "203.0.113.2", "2001:db8::2"} {
+		if err := h.checkForwardEgress(egress, direct); err != nil {
+			t.Fatalf("expected %q to be accepted: %v", egress, err)
+		}
+	}
+	if err := h.checkForwardEgress("198.51.100.1", direct); err == nil {
+		t.Fatalf("expected an address of another host to be rejected")
+	}
+	if err := h.checkForwardEgress("eth1", chain); err == nil {
+		t.Fatalf("expected tunnel forwarding to be rejected")
+	}
+}
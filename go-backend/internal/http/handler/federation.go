@@ -545,6 +545,18 @@ func validateRemoteNodePort(node *nodeRecord, port int) error {
 	return nil
 }
 
+// validateRemoteNodePortRange checks every port of a forward's entry port
+// range against the range a remote node allows.
+func validateRemoteNodePortRange(node *nodeRecord, port, portCount int) error {
+	if err := validateRemoteNodePort(node, port); err != nil {
+		return err
+	}
+	if portCount > 1 {
+		return validateRemoteNodePort(node, port+portCount-1)
+	}
+	return nil
+}
+
 func parseRemoteShareUsageConfig(raw string) (int64, int64, int64, int64, int, int) {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
@@ -1216,7 +1228,7 @@ func (h *Handler) federationRuntimeCommand(w http.ResponseWriter, r *http.Reques
 
 func isFederationRuntimeCommandAllowed(commandType string) bool {
 	switch strings.ToLower(strings.TrimSpace(commandType)) {
-	case "addservice", "updateservice", "deleteservice", "pauseservice", "resumeservice", "addchains", "deletechains", "addlimiters", "deletelimiters", "tcpping", "reload":
+	case "addservice", "updateservice", "deleteservice", "pauseservice", "resumeservice", "addchains", "deletechains", "addlimiters", "deletelimiters", "setcertificates", "deletecertificates", "tcpping", "reload":
 		return true
 	default:
 		return false
@@ -2,9 +2,15 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"strconv"
 	"strings"
 	"time"
+
+	"go-backend/internal/metrics"
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
 )
 
 const bytesPerGB int64 = 1024 * 1024 * 1024
@@ -21,9 +27,12 @@ type userTunnelPolicy struct {
 }
 
 type gostConfigSnapshot struct {
-	Services []namedConfigItem `json:"services"`
-	Chains   []namedConfigItem `json:"chains"`
-	Limiters []namedConfigItem `json:"limiters"`
+	Services   []namedConfigItem `json:"services"`
+	Chains     []namedConfigItem `json:"chains"`
+	Limiters   []namedConfigItem `json:"limiters"`
+	CLimiters  []namedConfigItem `json:"climiters"`
+	Admissions []namedConfigItem `json:"admissions"`
+	Resolvers  []namedConfigItem `json:"resolvers"`
 }
 
 type namedConfigItem struct {
@@ -36,10 +45,32 @@ func (h *Handler) processFlowItem(item flowItem) {
 		return
 	}
 
+	if item.U == 0 && item.D == 0 {
+		return
+	}
+
 	forwardID, userID, userTunnelID, ok := parseFlowServiceIDs(serviceName)
 	if ok {
-		inFlow, outFlow := h.scaleFlowByTunnel(forwardID, item.D, item.U)
-		_ = h.repo.AddFlow(forwardID, userID, userTunnelID, inFlow, outFlow)
+		tunnelID, inFlow, outFlow := h.scaleFlowByTunnel(forwardID, item.D, item.U)
+		err := h.repo.RecordFlowUsage(model.UsageLedger{
+			UserID:       userID,
+			UserTunnelID: userTunnelID,
+			ForwardID:    forwardID,
+			TunnelID:     tunnelID,
+			RawIn:        item.D,
+			RawOut:       item.U,
+			InFlow:       inFlow,
+			OutFlow:      outFlow,
+			CreatedTime:  time.Now().UnixMilli(),
+		})
+		if err != nil {
+			reason := "error"
+			if errors.Is(err, repo.ErrUsagePeriodClosed) {
+				reason = "period_closed"
+			}
+			metrics.FlowUsageWriteErrors.Inc(reason)
+			log.Printf("record flow usage failed: service=%s in=%d out=%d: %v", serviceName, item.D, item.U, err)
+		}
 
 		if userTunnelID > 0 {
 			h.enforceFlowPolicies(userID, userTunnelID)
@@ -136,20 +167,20 @@ func (h *Handler) enforcePeerShareFlowLimit(shareID int64) {
 	}
 }
 
-func (h *Handler) scaleFlowByTunnel(forwardID int64, inFlow int64, outFlow int64) (int64, int64) {
+func (h *Handler) scaleFlowByTunnel(forwardID int64, inFlow int64, outFlow int64) (int64, int64, int64) {
 	forward, err := h.getForwardRecord(forwardID)
 	if err != nil || forward == nil {
-		return inFlow, outFlow
+		return 0, inFlow, outFlow
 	}
 
 	tunnel, err := h.getTunnelRecord(forward.TunnelID)
 	if err != nil || tunnel == nil {
-		return inFlow, outFlow
+		return forward.TunnelID, inFlow, outFlow
 	}
 
 	scaledIn := int64(float64(inFlow)*tunnel.TrafficRatio) * tunnel.Flow
 	scaledOut := int64(float64(outFlow)*tunnel.TrafficRatio) * tunnel.Flow
-	return scaledIn, scaledOut
+	return forward.TunnelID, scaledIn, scaledOut
 }
 
 func (h *Handler) enforceFlowPolicies(userID int64, userTunnelID int64) {
@@ -268,6 +299,9 @@ func (h *Handler) cleanNodeConfigs(nodeID int64, rawConfig string) {
 	h.cleanOrphanedServices(nodeID, snapshot.Services)
 	h.cleanOrphanedChains(nodeID, snapshot.Chains)
 	h.cleanOrphanedLimiters(nodeID, snapshot.Limiters)
+	h.cleanOrphanedConnLimiters(nodeID, snapshot.CLimiters)
+	h.cleanOrphanedAdmissions(nodeID, snapshot.Admissions)
+	h.cleanOrphanedResolvers(nodeID, snapshot.Resolvers)
 }
 
 func (h *Handler) cleanOrphanedServices(nodeID int64, services []namedConfigItem) {
@@ -286,6 +320,15 @@ func (h *Handler) cleanOrphanedServices(nodeID int64, services []namedConfigItem
 			}
 		}
 		suffix := parts[len(parts)-1]
+		if len(parts) >= 4 && (suffix == "tcp" || suffix == "udp") {
+			forwardID, err := strconv.ParseInt(parts[0], 10, 64)
+			if err == nil && forwardID > 0 {
+				if forward, err := h.getForwardRecord(forwardID); err == nil && !forwardServesProtocol(forward.Protocol, suffix) {
+					_, _ = h.sendNodeCommand(nodeID, "DeleteService", map[string]interface{}{"services": []string{name}}, false, true)
+					continue
+				}
+			}
+		}
 
 		switch suffix {
 		case "tls":
@@ -337,6 +380,87 @@ func (h *Handler) cleanOrphanedLimiters(nodeID int64, limiters []namedConfigItem
 	}
 }
 
+func (h *Handler) cleanOrphanedConnLimiters(nodeID int64, limiters []namedConfigItem) {
+	for _, item := range limiters {
+		name := strings.TrimSpace(item.Name)
+		raw, ok := strings.CutPrefix(name, "fwd_")
+		if !ok {
+			continue
+		}
+		forwardID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || forwardID <= 0 {
+			continue
+		}
+		forward, err := h.getForwardRecord(forwardID)
+		if err != nil && !errors.Is(err, errForwardNotFound) {
+			continue
+		}
+		if err == nil && len(forwardConnLimits(forward.MaxConns, forward.MaxIPConns)) > 0 {
+			continue
+		}
+		_, _ = h.sendNodeCommand(nodeID, "DeleteCLimiters", map[string]interface{}{"limiter": name}, false, true)
+	}
+}
+
+// cleanOrphanedAdmissions drops allow/deny admissions whose forward or
+// tunnel is gone. Admissions of existing owners are kept even when the list
+// was cleared, since a paused service may still reference them.
+func (h *Handler) cleanOrphanedAdmissions(nodeID int64, admissions []namedConfigItem) {
+	for _, item := range admissions {
+		name := strings.TrimSpace(item.Name)
+		parts := strings.Split(name, "_")
+		if len(parts) != 3 || (parts[2] != "allow" && parts[2] != "deny") {
+			continue
+		}
+		id, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || id <= 0 {
+			continue
+		}
+		switch parts[0] {
+		case "fwd":
+			if h.forwardExists(id) {
+				continue
+			}
+		case "tunnel":
+			if h.tunnelExists(id) {
+				continue
+			}
+		default:
+			continue
+		}
+		_, _ = h.sendNodeCommand(nodeID, "DeleteAdmissions", map[string]interface{}{"admission": name}, false, true)
+	}
+}
+
+// cleanOrphanedResolvers drops forward resolvers whose forward is gone or no
+// longer sets nameservers, and a node resolver the node turned off.
+func (h *Handler) cleanOrphanedResolvers(nodeID int64, resolvers []namedConfigItem) {
+	for _, item := range resolvers {
+		name := strings.TrimSpace(item.Name)
+		if raw, ok := strings.CutPrefix(name, "dns_fwd_"); ok {
+			forwardID, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || forwardID <= 0 {
+				continue
+			}
+			forward, err := h.getForwardRecord(forwardID)
+			if err != nil && !errors.Is(err, errForwardNotFound) {
+				continue
+			}
+			if err == nil && forward.DNSResolver.Servers != "" {
+				continue
+			}
+		} else if name == nodeResolverName(nodeID) {
+			node, err := h.getNodeRecord(nodeID)
+			if err != nil || node.DNSResolver.Servers != "" {
+				continue
+			}
+		} else {
+			continue
+		}
+		_, _ = h.sendNodeCommand(nodeID, "DeleteResolvers", map[string]interface{}{"resolver": name}, false, true)
+	}
+}
+
 func (h *Handler) tunnelExists(tunnelID int64) bool {
 	ok, _ := h.repo.TunnelExists(tunnelID)
 	return ok
@@ -351,6 +475,13 @@ func (h *Handler) speedLimiterExists(name string) bool {
 	if name == "" {
 		return false
 	}
+	if raw, ok := strings.CutPrefix(name, "user_"); ok {
+		userID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || userID <= 0 {
+			return false
+		}
+		return h.userSpeed(userID) > 0
+	}
 	id, err := strconv.ParseInt(name, 10, 64)
 	if err != nil || id <= 0 {
 		return false
@@ -0,0 +1,383 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/response"
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+// maxForwardBatchItems caps the forwards one template or clone call
+// creates, since each of them is deployed before the call returns.
+const maxForwardBatchItems = 500
+
+// forwardTemplateKeys are the forward request fields a template carries.
+// The tunnel, entry port, listen IP and egress depend on the nodes a
+// forward lands on, so they are chosen when it is created.
+var forwardTemplateKeys = []string{
+	"remoteAddr", "strategy", "protocol", "portCount", "proxyIn", "proxyOut",
+	"maxConns", "maxIpConns", "allowIps", "denyIps", "sniHosts", "connLog",
+	"healthCheck", "healthInterval", "healthPath", "healthyThreshold", "unhealthyThreshold",
+	"scheduleOn", "scheduleOff",
+	"httpMode", "httpRoutes", "httpCertId", "httpAccessLog",
+	"dnsServers", "dnsPrefer", "dnsTtl",
+}
+
+// parseForwardTemplateConfig picks the template fields out of a request and
+// checks them the way creating a forward would.
+func parseForwardTemplateConfig(req map[string]interface{}) (map[string]interface{}, error) {
+	cfg := make(map[string]interface{}, len(forwardTemplateKeys))
+	for _, key := range forwardTemplateKeys {
+		if v, ok := req[key]; ok && v != nil {
+			cfg[key] = v
+		}
+	}
+	remoteAddr := asString(cfg["remoteAddr"])
+	if remoteAddr == "" {
+		return nil, errors.New("目标地址不能为空")
+	}
+	if _, ok := parseLoadBalanceStrategy(cfg["strategy"], "fifo"); !ok {
+		return nil, errLoadBalanceStrategy
+	}
+	protocol, ok := parseForwardProtocol(cfg["protocol"], repo.ForwardProtocolBoth)
+	if !ok {
+		return nil, errors.New("转发协议只能是 tcp、udp 或 tcp+udp")
+	}
+	proxyIn, inOK := parseProxyProtocolVersion(cfg["proxyIn"], 0)
+	proxyOut, outOK := parseProxyProtocolVersion(cfg["proxyOut"], 0)
+	if !inOK || !outOK {
+		return nil, errors.New("PROXY 协议版本只能是 0、1 或 2")
+	}
+	if asInt(cfg["maxConns"], 0) < 0 || asInt(cfg["maxIpConns"], 0) < 0 {
+		return nil, errors.New("连接数限制不能为负数")
+	}
+	for _, key := range []string{"allowIps", "denyIps"} {
+		if _, err := parseIPACL(cfg[key]); err != nil {
+			return nil, err
+		}
+	}
+	sniHosts, err := parseSNIHosts(cfg["sniHosts"])
+	if err != nil {
+		return nil, err
+	}
+	portCount, err := parseForwardPortCount(cfg, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateForwardTargets(remoteAddr, portCount); err != nil {
+		return nil, err
+	}
+	if err := validateSNIForward(sniHosts, protocol, portCount, proxyIn); err != nil {
+		return nil, err
+	}
+	if _, err := parseForwardHealthCheck(cfg, model.ForwardHealthCheck{}); err != nil {
+		return nil, err
+	}
+	if _, err := parseSchedule(cfg, "scheduleOn", "scheduleOff", model.Schedule{}); err != nil {
+		return nil, err
+	}
+	httpCfg, err := parseForwardHTTP(cfg, model.ForwardHTTP{})
+	if err != nil {
+		return nil, err
+	}
+	if err := validateHTTPForward(httpCfg, protocol, portCount, proxyOut); err != nil {
+		return nil, err
+	}
+	if _, err := parseDNSResolver(cfg, model.DNSResolver{}); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// forwardTemplateConfig is the template form of an existing forward.
+func forwardTemplateConfig(f *forwardRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"remoteAddr":         f.RemoteAddr,
+		"strategy":           f.Strategy,
+		"protocol":           f.Protocol,
+		"portCount":          f.PortCount,
+		"proxyIn":            f.ProxyIn,
+		"proxyOut":           f.ProxyOut,
+		"maxConns":           f.MaxConns,
+		"maxIpConns":         f.MaxIPConns,
+		"allowIps":           f.AllowIPs,
+		"denyIps":            f.DenyIPs,
+		"sniHosts":           f.SNIHosts,
+		"connLog":            f.ConnLog == 1,
+		"healthCheck":        f.ForwardHealthCheck.Type,
+		"healthInterval":     f.ForwardHealthCheck.Interval,
+		"healthPath":         f.ForwardHealthCheck.Path,
+		"healthyThreshold":   f.ForwardHealthCheck.HealthyThreshold,
+		"unhealthyThreshold": f.ForwardHealthCheck.UnhealthyThreshold,
+		"scheduleOn":         f.Schedule.On,
+		"scheduleOff":        f.Schedule.Off,
+		"httpMode":           f.ForwardHTTP.Mode,
+		"httpRoutes":         f.ForwardHTTP.Routes,
+		"httpCertId":         f.ForwardHTTP.CertID,
+		"httpAccessLog":      f.ForwardHTTP.AccessLog == 1,
+		"dnsServers":         f.DNSResolver.Servers,
+		"dnsPrefer":          f.DNSResolver.Prefer,
+		"dnsTtl":             f.DNSResolver.TTL,
+	}
+}
+
+func decodeForwardTemplateConfig(t *model.ForwardTemplate) map[string]interface{} {
+	cfg := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(t.Config), &cfg)
+	return cfg
+}
+
+// forwardBatchItem creates one forward of a template or clone call and
+// reports the outcome next to the owner and tunnel it was meant for.
+func (h *Handler) forwardBatchItem(req map[string]interface{}, userID, tunnelID int64) map[string]interface{} {
+	item := map[string]interface{}{
+		"name":       asString(req["name"]),
+		"userId":     userID,
+		"userName":   h.repo.GetUsernameByID(userID),
+		"tunnelId":   tunnelID,
+		"tunnelName": h.repo.GetTunnelNameByID(tunnelID),
+		"success":    false,
+	}
+	roleID, err := h.repo.GetUserRoleID(userID)
+	if err != nil {
+		item["message"] = "用户不存在"
+		return item
+	}
+	if h.ensureTunnelPermission(userID, roleID, tunnelID) != nil {
+		item["message"] = "用户没有该隧道的权限"
+		return item
+	}
+	req["tunnelId"] = tunnelID
+	forwardID, err := h.createForward(req, userID, roleID, 0)
+	if err != nil {
+		item["message"] = err.Error()
+		return item
+	}
+	item["success"] = true
+	item["forwardId"] = forwardID
+	if port := h.repo.GetMinForwardPort(forwardID); port.Valid {
+		item["inPort"] = port.Int64
+	}
+	return item
+}
+
+func forwardBatchResult(items []map[string]interface{}) map[string]interface{} {
+	success := 0
+	for _, item := range items {
+		if item["success"] == true {
+			success++
+		}
+	}
+	return map[string]interface{}{
+		"successCount": success,
+		"failCount":    len(items) - success,
+		"results":      items,
+	}
+}
+
+func (h *Handler) forwardTemplateList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	templates, err := h.repo.ListForwardTemplates()
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	items := make([]map[string]interface{}, 0, len(templates))
+	for i := range templates {
+		t := &templates[i]
+		items = append(items, map[string]interface{}{
+			"id": t.ID, "name": t.Name, "config": decodeForwardTemplateConfig(t),
+			"createdTime": t.CreatedTime, "updatedTime": t.UpdatedTime,
+		})
+	}
+	response.WriteJSON(w, response.OK(items))
+}
+
+// forwardTemplateFromRequest reads a template's name and settings, either
+// given field by field or copied from the forward named by forwardId.
+func (h *Handler) forwardTemplateFromRequest(req map[string]interface{}) (string, string, error) {
+	name := strings.TrimSpace(asString(req["name"]))
+	if name == "" {
+		return "", "", errors.New("模板名称不能为空")
+	}
+	if forwardID := asInt64(req["forwardId"], 0); forwardID > 0 {
+		forward, err := h.getForwardRecord(forwardID)
+		if err != nil {
+			return "", "", errors.New("转发不存在")
+		}
+		req = forwardTemplateConfig(forward)
+	}
+	cfg, err := parseForwardTemplateConfig(req)
+	if err != nil {
+		return "", "", err
+	}
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return "", "", err
+	}
+	return name, string(raw), nil
+}
+
+func (h *Handler) forwardTemplateCreate(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	name, config, err := h.forwardTemplateFromRequest(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	now := time.Now().UnixMilli()
+	t := &model.ForwardTemplate{Name: name, Config: config, CreatedTime: now, UpdatedTime: now}
+	if err := h.repo.CreateForwardTemplate(t); err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OK(map[string]interface{}{"id": t.ID}))
+}
+
+func (h *Handler) forwardTemplateUpdate(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	t, err := h.repo.GetForwardTemplate(asInt64(req["id"], 0))
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault("模板不存在"))
+		return
+	}
+	name, config, err := h.forwardTemplateFromRequest(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := h.repo.UpdateForwardTemplate(t.ID, name, config, time.Now().UnixMilli()); err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OKEmpty())
+}
+
+func (h *Handler) forwardTemplateDelete(w http.ResponseWriter, r *http.Request) {
+	id := idFromBody(r, w)
+	if id <= 0 {
+		return
+	}
+	if err := h.repo.DeleteForwardTemplate(id); err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OKEmpty())
+}
+
+// forwardTemplateApply creates a forward from a template for every pair of
+// the given users and tunnels, each on a freshly allocated entry port. The
+// forwards that could be created stay when others fail.
+func (h *Handler) forwardTemplateApply(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID        int64   `json:"id"`
+		Name      string  `json:"name"`
+		UserIDs   []int64 `json:"userIds"`
+		TunnelIDs []int64 `json:"tunnelIds"`
+	}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	t, err := h.repo.GetForwardTemplate(req.ID)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault("模板不存在"))
+		return
+	}
+	if len(req.UserIDs) == 0 || len(req.TunnelIDs) == 0 {
+		response.WriteJSON(w, response.ErrDefault("请选择用户和隧道"))
+		return
+	}
+	if len(req.UserIDs)*len(req.TunnelIDs) > maxForwardBatchItems {
+		response.WriteJSON(w, response.ErrDefault(fmt.Sprintf("单次最多创建 %d 个转发", maxForwardBatchItems)))
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = t.Name
+	}
+	items := make([]map[string]interface{}, 0, len(req.UserIDs)*len(req.TunnelIDs))
+	for _, userID := range req.UserIDs {
+		for _, tunnelID := range req.TunnelIDs {
+			forwardReq := decodeForwardTemplateConfig(t)
+			forwardReq["name"] = name
+			items = append(items, h.forwardBatchItem(forwardReq, userID, tunnelID))
+		}
+	}
+	response.WriteJSON(w, response.OK(forwardBatchResult(items)))
+}
+
+// forwardClone copies forwards, or all forwards of a user, onto another
+// tunnel and/or to another user. Each copy gets a freshly allocated entry
+// port; it keeps its listen IP and egress only on the tunnel it came from,
+// as other tunnels may run on different nodes.
+func (h *Handler) forwardClone(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ForwardIDs     []int64 `json:"forwardIds"`
+		UserID         int64   `json:"userId"`
+		TargetTunnelID int64   `json:"targetTunnelId"`
+		TargetUserID   int64   `json:"targetUserId"`
+	}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	ids := req.ForwardIDs
+	if len(ids) == 0 && req.UserID > 0 {
+		var err error
+		if ids, err = h.repo.ListForwardIDsByUser(req.UserID); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if len(ids) == 0 {
+		response.WriteJSON(w, response.ErrDefault("没有需要复制的转发"))
+		return
+	}
+	if len(ids) > maxForwardBatchItems {
+		response.WriteJSON(w, response.ErrDefault(fmt.Sprintf("单次最多创建 %d 个转发", maxForwardBatchItems)))
+		return
+	}
+	items := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		source, err := h.getForwardRecord(id)
+		if err != nil {
+			items = append(items, map[string]interface{}{"sourceId": id, "success": false, "message": "转发不存在"})
+			continue
+		}
+		userID, tunnelID := source.UserID, source.TunnelID
+		if req.TargetUserID > 0 {
+			userID = req.TargetUserID
+		}
+		if req.TargetTunnelID > 0 {
+			tunnelID = req.TargetTunnelID
+		}
+		forwardReq := forwardTemplateConfig(source)
+		forwardReq["name"] = source.Name
+		if tunnelID == source.TunnelID {
+			forwardReq["listenIp"] = source.ListenIP
+			forwardReq["interfaceName"] = source.InterfaceName
+		}
+		item := h.forwardBatchItem(forwardReq, userID, tunnelID)
+		item["sourceId"] = id
+		items = append(items, item)
+	}
+	response.WriteJSON(w, response.OK(forwardBatchResult(items)))
+}
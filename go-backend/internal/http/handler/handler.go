@@ -17,7 +17,9 @@ import (
 	"go-backend/internal/auth"
 	"go-backend/internal/http/middleware"
 	"go-backend/internal/http/response"
+	"go-backend/internal/metrics"
 	"go-backend/internal/security"
+	"go-backend/internal/store/model"
 	"go-backend/internal/store/repo"
 	"go-backend/internal/ws"
 )
@@ -34,6 +36,15 @@ type Handler struct {
 	jobsCancel  context.CancelFunc
 	jobsStarted bool
 	jobsWG      sync.WaitGroup
+
+	metricsToken string
+
+	clientIPMu       sync.Mutex
+	clientIPGuards   map[int64]clientIPGuard
+	clientIPExceeded map[string]bool
+
+	targetHealthMu sync.Mutex
+	targetHealth   map[int64]map[string]map[int64]targetHealthState
 }
 
 type loginRequest struct {
@@ -64,9 +75,12 @@ type changePasswordRequest struct {
 }
 
 type flowItem struct {
-	N string `json:"n"`
-	U int64  `json:"u"`
-	D int64  `json:"d"`
+	N string          `json:"n"`
+	U int64           `json:"u"`
+	D int64           `json:"d"`
+	I []string        `json:"i,omitempty"`
+	H map[string]bool `json:"h,omitempty"`
+	C []connLogItem   `json:"c,omitempty"`
 }
 
 func New(repo *repo.Repository, jwtSecret string) *Handler {
@@ -75,6 +89,11 @@ func New(repo *repo.Repository, jwtSecret string) *Handler {
 		jwtSecret:     jwtSecret,
 		wsServer:      ws.NewServer(repo, jwtSecret),
 		captchaTokens: make(map[string]int64),
+
+		clientIPGuards:   make(map[int64]clientIPGuard),
+		clientIPExceeded: make(map[string]bool),
+
+		targetHealth: make(map[int64]map[string]map[int64]targetHealthState),
 	}
 }
 
@@ -124,6 +143,7 @@ func (h *Handler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/tunnel/update-order", h.tunnelUpdateOrder)
 	mux.HandleFunc("/api/v1/tunnel/batch-delete", h.tunnelBatchDelete)
 	mux.HandleFunc("/api/v1/tunnel/batch-redeploy", h.tunnelBatchRedeploy)
+	mux.HandleFunc("/api/v1/tunnel/batch-rotate-auth", h.tunnelBatchRotateAuth)
 	mux.HandleFunc("/api/v1/tunnel/user/assign", h.userTunnelAssign)
 	mux.HandleFunc("/api/v1/tunnel/user/batch-assign", h.userTunnelBatchAssign)
 	mux.HandleFunc("/api/v1/tunnel/user/remove", h.userTunnelRemove)
@@ -136,12 +156,24 @@ func (h *Handler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/forward/pause", h.forwardPause)
 	mux.HandleFunc("/api/v1/forward/resume", h.forwardResume)
 	mux.HandleFunc("/api/v1/forward/diagnose", h.forwardDiagnose)
+	mux.HandleFunc("/api/v1/forward/client-ips", h.forwardClientIPs)
+	mux.HandleFunc("/api/v1/forward/conn-logs", h.forwardConnLogs)
 	mux.HandleFunc("/api/v1/forward/update-order", h.forwardUpdateOrder)
 	mux.HandleFunc("/api/v1/forward/batch-delete", h.forwardBatchDelete)
 	mux.HandleFunc("/api/v1/forward/batch-pause", h.forwardBatchPause)
 	mux.HandleFunc("/api/v1/forward/batch-resume", h.forwardBatchResume)
 	mux.HandleFunc("/api/v1/forward/batch-redeploy", h.forwardBatchRedeploy)
 	mux.HandleFunc("/api/v1/forward/batch-change-tunnel", h.forwardBatchChangeTunnel)
+	mux.HandleFunc("/api/v1/forward/clone", h.forwardClone)
+	mux.HandleFunc("/api/v1/forward/template/list", h.forwardTemplateList)
+	mux.HandleFunc("/api/v1/forward/template/create", h.forwardTemplateCreate)
+	mux.HandleFunc("/api/v1/forward/template/update", h.forwardTemplateUpdate)
+	mux.HandleFunc("/api/v1/forward/template/delete", h.forwardTemplateDelete)
+	mux.HandleFunc("/api/v1/forward/template/apply", h.forwardTemplateApply)
+	mux.HandleFunc("/api/v1/certificate/list", h.certificateList)
+	mux.HandleFunc("/api/v1/certificate/create", h.certificateCreate)
+	mux.HandleFunc("/api/v1/certificate/update", h.certificateUpdate)
+	mux.HandleFunc("/api/v1/certificate/delete", h.certificateDelete)
 	mux.HandleFunc("/api/v1/speed-limit/list", h.speedLimitList)
 	mux.HandleFunc("/api/v1/speed-limit/create", h.speedLimitCreate)
 	mux.HandleFunc("/api/v1/speed-limit/update", h.speedLimitUpdate)
@@ -179,6 +211,13 @@ func (h *Handler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/federation/node/import", h.nodeImport)
 	mux.HandleFunc("/api/v1/announcement/get", h.getAnnouncement)
 	mux.HandleFunc("/api/v1/announcement/update", h.updateAnnouncement)
+	mux.HandleFunc("/api/v1/ledger/list", h.ledgerList)
+	mux.HandleFunc("/api/v1/ledger/export", h.ledgerExport)
+	mux.HandleFunc("/api/v1/ledger/period/list", h.ledgerPeriodList)
+	mux.HandleFunc("/api/v1/ledger/period/close", h.ledgerPeriodClose)
+	mux.HandleFunc("/api/v1/ledger/reconcile", h.ledgerReconcile)
+
+	mux.HandleFunc("/metrics", h.metricsEndpoint)
 
 	mux.HandleFunc("/flow/test", h.flowTest)
 	mux.HandleFunc("/flow/config", h.flowConfig)
@@ -404,6 +443,19 @@ func (h *Handler) forwardList(w http.ResponseWriter, r *http.Request) {
 		}
 		items = filtered
 	}
+	now := time.Now().UnixMilli()
+	for _, item := range items {
+		if asString(item["healthCheck"]) != "" {
+			item["targetHealth"] = h.forwardTargetHealth(asInt64(item["id"], 0), splitRemoteTargets(asString(item["remoteAddr"])), now)
+		}
+		schedule := newForwardSchedule(
+			model.Schedule{On: asString(item["scheduleOn"]), Off: asString(item["scheduleOff"])},
+			model.Schedule{On: asString(item["tunnelScheduleOn"]), Off: asString(item["tunnelScheduleOff"])},
+		)
+		if next := schedule.nextTransition(time.UnixMilli(now)); !next.IsZero() {
+			item["nextTransitionTime"] = next.UnixMilli()
+		}
+	}
 	response.WriteJSON(w, response.OK(items))
 }
 
@@ -560,6 +612,10 @@ func (h *Handler) userTunnelList(w http.ResponseWriter, r *http.Request) {
 			"status":         1,
 			"flow":           t.Flow,
 			"num":            t.Num,
+			"maxIps":         t.MaxIPs,
+			"interfaceName":  t.InterfaceName,
+			"scheduleOn":     t.On,
+			"scheduleOff":    t.Off,
 			"expTime":        t.ExpTime,
 			"flowResetTime":  t.FlowResetTime,
 			"inFlow":         t.InFlow,
@@ -697,19 +753,35 @@ func (h *Handler) flowConfig(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) flowUpload(w http.ResponseWriter, r *http.Request) {
 	secret := r.URL.Query().Get("secret")
-	if ok, _ := h.repo.NodeExistsBySecret(secret); !ok {
+	node, _ := h.repo.GetNodeBySecret(secret)
+	if node == nil {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		_, _ = w.Write([]byte("ok"))
 		return
 	}
 
+	nodeLabel := strconv.FormatInt(node.ID, 10)
+	metrics.FlowUploads.Inc(nodeLabel)
 	raw, err := readAndDecryptFlowBody(r.Body, secret)
 	if err == nil && strings.TrimSpace(raw) != "" {
 		var items []flowItem
 		if json.Unmarshal([]byte(raw), &items) == nil {
+			metrics.FlowUploadItems.Add(float64(len(items)), nodeLabel)
+			ipUsers := make(map[int64]struct{})
 			for _, item := range items {
+				metrics.FlowUploadBytes.Add(float64(item.D), nodeLabel, "in")
+				metrics.FlowUploadBytes.Add(float64(item.U), nodeLabel, "out")
+				if userID := h.recordClientIPs(node.ID, item); userID > 0 {
+					ipUsers[userID] = struct{}{}
+				}
+				h.recordTargetHealth(node.ID, item)
+				h.recordConnLogs(node.ID, item)
 				h.processFlowItem(item)
 			}
+			now := time.Now().UnixMilli()
+			for userID := range ipUsers {
+				h.enforceClientIPLimits(userID, now)
+			}
 		}
 	}
 
@@ -836,6 +908,10 @@ func (h *Handler) userPackage(w http.ResponseWriter, r *http.Request) {
 			"inFlow":         t.InFlow,
 			"outFlow":        t.OutFlow,
 			"num":            t.Num,
+			"maxIps":         t.MaxIPs,
+			"interfaceName":  t.InterfaceName,
+			"scheduleOn":     t.On,
+			"scheduleOff":    t.Off,
 			"flowResetTime":  t.FlowResetTime,
 			"expTime":        t.ExpTime,
 			"speedId":        nil,
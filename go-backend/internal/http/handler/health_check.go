@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-backend/internal/store/model"
+)
+
+// targetHealthTTL is how long a target state reported by an entry node is
+// shown. Agents report changes right away and repeat unchanged states every
+// minute, so a missing refresh means the node or its checker went away.
+const targetHealthTTL = 3 * time.Minute
+
+const (
+	defaultHealthInterval     = 10
+	defaultHealthyThreshold   = 2
+	defaultUnhealthyThreshold = 3
+	maxHealthInterval         = 3600
+	maxHealthThreshold        = 10
+	healthStatusHealthy       = "healthy"
+	healthStatusUnhealthy     = "unhealthy"
+	healthStatusUnknown       = "unknown"
+)
+
+// targetHealthState is the last result an entry node reported for a target.
+type targetHealthState struct {
+	healthy   bool
+	updatedAt int64
+}
+
+// parseForwardHealthCheck reads the health check fields of a forward
+// request. Fields left out keep their value in def; turning the check off
+// clears the rest of the settings.
+func parseForwardHealthCheck(req map[string]interface{}, def model.ForwardHealthCheck) (model.ForwardHealthCheck, error) {
+	hc := def
+	if v, ok := req["healthCheck"]; ok {
+		hc.Type = strings.ToLower(strings.TrimSpace(asString(v)))
+	}
+	switch hc.Type {
+	case "", "none", "off":
+		return model.ForwardHealthCheck{}, nil
+	case "tcp", "udp", "http":
+	default:
+		return hc, errors.New("健康检查类型只能是 tcp、udp 或 http")
+	}
+
+	hc.Interval = asInt(req["healthInterval"], hc.Interval)
+	if hc.Interval == 0 {
+		hc.Interval = defaultHealthInterval
+	}
+	if hc.Interval < 1 || hc.Interval > maxHealthInterval {
+		return hc, fmt.Errorf("健康检查间隔需在 1-%d 秒之间", maxHealthInterval)
+	}
+	hc.HealthyThreshold = asInt(req["healthyThreshold"], hc.HealthyThreshold)
+	if hc.HealthyThreshold == 0 {
+		hc.HealthyThreshold = defaultHealthyThreshold
+	}
+	hc.UnhealthyThreshold = asInt(req["unhealthyThreshold"], hc.UnhealthyThreshold)
+	if hc.UnhealthyThreshold == 0 {
+		hc.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+	if hc.HealthyThreshold < 1 || hc.HealthyThreshold > maxHealthThreshold || hc.UnhealthyThreshold < 1 || hc.UnhealthyThreshold > maxHealthThreshold {
+		return hc, fmt.Errorf("健康检查阈值需在 1-%d 之间", maxHealthThreshold)
+	}
+
+	if v, ok := req["healthPath"]; ok {
+		hc.Path = strings.TrimSpace(asString(v))
+	}
+	if hc.Type != "http" {
+		hc.Path = ""
+	} else if hc.Path == "" {
+		hc.Path = "/"
+	} else if !strings.HasPrefix(hc.Path, "/") {
+		return hc, errors.New("健康检查路径必须以 / 开头")
+	}
+	return hc, nil
+}
+
+// healthCheckMetadata returns the forward handler metadata that turns on
+// active probing of the targets, or nil when the check is off.
+func healthCheckMetadata(hc model.ForwardHealthCheck) map[string]interface{} {
+	if hc.Type == "" {
+		return nil
+	}
+	md := map[string]interface{}{
+		"healthCheck.type":      hc.Type,
+		"healthCheck.interval":  fmt.Sprintf("%ds", hc.Interval),
+		"healthCheck.healthy":   hc.HealthyThreshold,
+		"healthCheck.unhealthy": hc.UnhealthyThreshold,
+	}
+	if hc.Type == "http" {
+		md["healthCheck.path"] = hc.Path
+	}
+	return md
+}
+
+// recordTargetHealth stores the target states an agent reported for a
+// forward service.
+func (h *Handler) recordTargetHealth(nodeID int64, item flowItem) {
+	if h == nil || nodeID <= 0 || len(item.H) == 0 {
+		return
+	}
+	forwardID, _, _, ok := parseFlowServiceIDs(strings.TrimSpace(item.N))
+	if !ok {
+		return
+	}
+	now := time.Now().UnixMilli()
+
+	h.targetHealthMu.Lock()
+	defer h.targetHealthMu.Unlock()
+
+	targets, ok := h.targetHealth[forwardID]
+	if !ok {
+		targets = make(map[string]map[int64]targetHealthState)
+		h.targetHealth[forwardID] = targets
+	}
+	for addr, healthy := range item.H {
+		nodes, ok := targets[addr]
+		if !ok {
+			nodes = make(map[int64]targetHealthState)
+			targets[addr] = nodes
+		}
+		nodes[nodeID] = targetHealthState{healthy: healthy, updatedAt: now}
+	}
+}
+
+// clearTargetHealth forgets the reported states of a forward, so a changed
+// target list or check starts from unknown.
+func (h *Handler) clearTargetHealth(forwardID int64) {
+	if h == nil {
+		return
+	}
+	h.targetHealthMu.Lock()
+	delete(h.targetHealth, forwardID)
+	h.targetHealthMu.Unlock()
+}
+
+// forwardTargetHealth returns the status of each target of a forward in
+// target order. A target is unhealthy when any entry node reported it down
+// and unknown until a fresh report arrives.
+func (h *Handler) forwardTargetHealth(forwardID int64, targets []string, now int64) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(targets))
+	if h == nil {
+		return out
+	}
+	since := now - targetHealthTTL.Milliseconds()
+
+	h.targetHealthMu.Lock()
+	defer h.targetHealthMu.Unlock()
+
+	reported := h.targetHealth[forwardID]
+	for _, addr := range targets {
+		status := healthStatusUnknown
+		var updatedAt int64
+		for nodeID, st := range reported[addr] {
+			if st.updatedAt < since {
+				delete(reported[addr], nodeID)
+				continue
+			}
+			if st.updatedAt > updatedAt {
+				updatedAt = st.updatedAt
+			}
+			if !st.healthy {
+				status = healthStatusUnhealthy
+			} else if status == healthStatusUnknown {
+				status = healthStatusHealthy
+			}
+		}
+		item := map[string]interface{}{"addr": addr, "status": status}
+		if updatedAt > 0 {
+			item["updatedTime"] = updatedAt
+		}
+		out = append(out, item)
+	}
+	return out
+}
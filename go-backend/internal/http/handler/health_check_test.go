@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestParseForwardHealthCheckDefaultsAndValidation(t *testing.T) {
+	hc, err := parseForwardHealthCheck(map[string]interface{}{"healthCheck": "HTTP"}, model.ForwardHealthCheck{})
+	if err != nil {
+		t.Fatalf("parse http check: %v", err)
+	}
+	want := model.ForwardHealthCheck{Type: "http", Interval: 10, Path: "/", HealthyThreshold: 2, UnhealthyThreshold: 3}
+	if hc != want {
+		t.Fatalf("expected %+v, got %+v", want, hc)
+	}
+
+	kept, err := parseForwardHealthCheck(map[string]interface{}{"healthInterval": 5}, hc)
+	if err != nil || kept.Type != "http" || kept.Interval != 5 || kept.Path != "/" {
+		t.Fatalf("expected absent fields to be kept, got %+v (%v)", kept, err)
+	}
+	if off, err := parseForwardHealthCheck(map[string]interface{}{"healthCheck": ""}, hc); err != nil || off != (model.ForwardHealthCheck{}) {
+		t.Fatalf("expected the check to be cleared, got %+v (%v)", off, err)
+	}
+
+	for _, req := range []map[string]interface{}{
+		{"healthCheck": "icmp"},
+		{"healthCheck": "tcp", "healthInterval": -1},
+		{"healthCheck": "tcp", "unhealthyThreshold": 11},
+		{"healthCheck": "http", "healthPath": "healthz"},
+	} {
+		if _, err := parseForwardHealthCheck(req, model.ForwardHealthCheck{}); err == nil {
+			t.Fatalf("expected %v to be rejected", req)
+		}
+	}
+}
+
+func TestForwardServicesCarryHealthCheckMetadata(t *testing.T) {
+	forward := &forwardRecord{ID: 8, UserID: 5, TunnelID: 2, RemoteAddr: "10.0.0.1:80,10.0.0.2:80", ProxyOut: 2}
+	forward.ForwardHealthCheck = model.ForwardHealthCheck{Type: "http", Interval: 5, Path: "/healthz", HealthyThreshold: 2, UnhealthyThreshold: 3}
+	node := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+
+	for _, svc := range buildForwardServiceConfigs("8_5_7", forward, nil, node, 10000, "", "", false) {
+		md, _ := svc["handler"].(map[string]interface{})["metadata"].(map[string]interface{})
+		if md["healthCheck.type"] != "http" || md["healthCheck.interval"] != "5s" || md["healthCheck.path"] != "/healthz" {
+			t.Fatalf("service %v missing health check metadata: %v", svc["name"], md)
+		}
+		_, hasProxy := md["proxyProtocol"]
+		if hasProxy != (svc["name"] == "8_5_7_tcp") {
+			t.Fatalf("unexpected PROXY protocol metadata on %v: %v", svc["name"], md)
+		}
+	}
+}
+
+func TestTargetHealthMergesEntryNodeReports(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "health.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	hc := model.ForwardHealthCheck{Type: "tcp", Interval: 10, HealthyThreshold: 2, UnhealthyThreshold: 3}
+	now := time.Now().UnixMilli()
+	forwardID, err := r.CreateForwardTx(model.ForwardRecord{UserID: 1, UserName: "admin", Name: "web", TunnelID: 1, RemoteAddr: "10.0.0.1:80,10.0.0.2:80,10.0.0.3:80", Strategy: "fifo", Protocol: "tcp", ForwardHealthCheck: hc}, now, 0, nil, 10000)
+	if err != nil {
+		t.Fatalf("create forward: %v", err)
+	}
+	record, err := r.GetForwardRecord(forwardID)
+	if err != nil || record == nil || record.ForwardHealthCheck != hc {
+		t.Fatalf("expected health check to be stored, got %+v (%v)", record, err)
+	}
+
+	items, err := r.ListForwards()
+	if err != nil || len(items) != 1 || items[0]["healthCheck"] != "tcp" || items[0]["unhealthyThreshold"] != 3 {
+		t.Fatalf("expected health check in forward list, got %v (%v)", items, err)
+	}
+
+	name := buildForwardServiceBaseCandidates(forwardID, 1, 0, nil)[0] + "_tcp"
+	h.recordTargetHealth(3, flowItem{N: name, H: map[string]bool{"10.0.0.1:80": true, "10.0.0.2:80": true}})
+	h.recordTargetHealth(4, flowItem{N: name, H: map[string]bool{"10.0.0.1:80": true, "10.0.0.2:80": false}})
+
+	got := h.forwardTargetHealth(forwardID, splitRemoteTargets(record.RemoteAddr), time.Now().UnixMilli())
+	want := []string{healthStatusHealthy, healthStatusUnhealthy, healthStatusUnknown}
+	for i, item := range got {
+		if item["status"] != want[i] {
+			t.Fatalf("target %v: expected %s, got %v", item["addr"], want[i], item["status"])
+		}
+	}
+
+	later := time.Now().Add(targetHealthTTL + time.Second).UnixMilli()
+	for _, item := range h.forwardTargetHealth(forwardID, splitRemoteTargets(record.RemoteAddr), later) {
+		if item["status"] != healthStatusUnknown {
+			t.Fatalf("expected stale reports to expire, got %v", item)
+		}
+	}
+}
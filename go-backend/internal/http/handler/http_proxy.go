@@ -0,0 +1,415 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/response"
+	"go-backend/internal/store/model"
+)
+
+const (
+	httpModePlain    = "http"
+	httpModeTLS      = "https"
+	maxHTTPRoutes    = 64
+	maxCertificateSz = 64 * 1024
+)
+
+// httpRoute sends the requests matching Host and Path to its own targets
+// instead of the forward's. An empty Host matches any host and an empty
+// Path any path.
+type httpRoute struct {
+	Host    string
+	Path    string
+	Targets []string
+}
+
+func certificateName(certID int64) string {
+	return fmt.Sprintf("cert_%d", certID)
+}
+
+// parseForwardHTTP reads the reverse proxy fields of a forward request.
+// Fields left out keep their value in def; turning the proxy off clears the
+// rest of the settings.
+func parseForwardHTTP(req map[string]interface{}, def model.ForwardHTTP) (model.ForwardHTTP, error) {
+	cfg := def
+	if v, ok := req["httpMode"]; ok {
+		cfg.Mode = strings.ToLower(strings.TrimSpace(asString(v)))
+	}
+	switch cfg.Mode {
+	case "", "none", "off":
+		return model.ForwardHTTP{}, nil
+	case httpModePlain, httpModeTLS:
+	default:
+		return cfg, errors.New("反向代理模式只能是 http 或 https")
+	}
+
+	if v, ok := req["httpRoutes"]; ok {
+		routes, err := parseHTTPRoutes(asString(v))
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Routes = formatHTTPRoutes(routes)
+	}
+	cfg.CertID = asInt64(req["httpCertId"], cfg.CertID)
+	if cfg.Mode != httpModeTLS {
+		cfg.CertID = 0
+	} else if cfg.CertID <= 0 {
+		return cfg, errors.New("HTTPS 反向代理需要选择证书")
+	}
+	if v, ok := req["httpAccessLog"]; ok {
+		cfg.AccessLog = 0
+		if asBool(v, false) {
+			cfg.AccessLog = 1
+		}
+	}
+	return cfg, nil
+}
+
+// parseHTTPRoutes reads one rule per line: a match such as
+// "api.example.com/v1", "*.example.com" or "/static", then the targets
+// separated by commas.
+func parseHTTPRoutes(s string) ([]httpRoute, error) {
+	var routes []httpRoute
+	for _, line := range strings.Split(s, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("路由规则格式错误: %s", strings.TrimSpace(line))
+		}
+		route := httpRoute{}
+		match := fields[0]
+		if i := strings.Index(match, "/"); i >= 0 {
+			route.Host, route.Path = match[:i], match[i:]
+		} else {
+			route.Host = match
+		}
+		route.Host = strings.TrimSuffix(strings.ToLower(route.Host), ".")
+		if route.Host == "*" {
+			route.Host = ""
+		}
+		if route.Host != "" && !validSNIHost(route.Host) {
+			return nil, fmt.Errorf("路由规则域名无效: %s", fields[0])
+		}
+		if route.Path == "/" {
+			route.Path = ""
+		}
+		if route.Host == "" && route.Path == "" {
+			return nil, fmt.Errorf("路由规则需指定域名或路径: %s", fields[0])
+		}
+		for _, target := range strings.Split(fields[1], ",") {
+			target = strings.TrimSpace(target)
+			if target == "" {
+				continue
+			}
+			if _, _, err := parseTargetAddress(target); err != nil {
+				return nil, fmt.Errorf("路由规则目标地址无效: %s", target)
+			}
+			route.Targets = append(route.Targets, target)
+		}
+		if len(route.Targets) == 0 {
+			return nil, fmt.Errorf("路由规则缺少目标地址: %s", fields[0])
+		}
+		for _, other := range routes {
+			if other.Host == route.Host && other.Path == route.Path {
+				return nil, fmt.Errorf("路由规则重复: %s", fields[0])
+			}
+		}
+		routes = append(routes, route)
+	}
+	if len(routes) > maxHTTPRoutes {
+		return nil, fmt.Errorf("反向代理最多 %d 条路由规则", maxHTTPRoutes)
+	}
+	return routes, nil
+}
+
+func formatHTTPRoutes(routes []httpRoute) string {
+	lines := make([]string, 0, len(routes))
+	for _, route := range routes {
+		match := route.Host + route.Path
+		if route.Host == "" && route.Path == "" {
+			match = "*"
+		}
+		lines = append(lines, match+" "+strings.Join(route.Targets, ","))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validateHTTPForward checks the options a reverse proxy forward cannot
+// use. Requests from many clients share the connections to a target, so a
+// PROXY header towards the targets has no single client to describe.
+func validateHTTPForward(cfg model.ForwardHTTP, protocol string, portCount, proxyOut int) error {
+	if cfg.Mode == "" {
+		return nil
+	}
+	if protocol != "tcp" {
+		return errors.New("反向代理转发只支持 TCP 协议")
+	}
+	if portCount > 1 {
+		return errors.New("反向代理转发不能使用端口段")
+	}
+	if proxyOut > 0 {
+		return errors.New("反向代理转发不能向目标发送 PROXY 协议")
+	}
+	return nil
+}
+
+// checkForwardCertificate makes sure an HTTPS forward of ownerID uses an
+// existing certificate the owner uploaded. Admins may use any certificate.
+func (h *Handler) checkForwardCertificate(cfg model.ForwardHTTP, ownerID int64, actorRole int) error {
+	if cfg.Mode != httpModeTLS {
+		return nil
+	}
+	cert, err := h.repo.GetCertificate(cfg.CertID)
+	if err != nil {
+		return errors.New("证书不存在")
+	}
+	if actorRole != 0 && cert.UserID != ownerID {
+		return errors.New("证书不存在")
+	}
+	return nil
+}
+
+// httpProxyMetadata returns the forward handler metadata that serves the
+// forward as an HTTP reverse proxy, or nil when it is a plain forward.
+func httpProxyMetadata(cfg model.ForwardHTTP) map[string]interface{} {
+	if cfg.Mode == "" {
+		return nil
+	}
+	routes, _ := parseHTTPRoutes(cfg.Routes)
+	items := make([]map[string]interface{}, 0, len(routes))
+	for _, route := range routes {
+		items = append(items, map[string]interface{}{
+			"host":    route.Host,
+			"path":    route.Path,
+			"targets": route.Targets,
+		})
+	}
+	md := map[string]interface{}{
+		"reverseProxy":        true,
+		"reverseProxy.routes": items,
+	}
+	if cfg.Mode == httpModeTLS {
+		md["reverseProxy.certificate"] = certificateName(cfg.CertID)
+	}
+	if cfg.AccessLog == 1 {
+		md["reverseProxy.accessLog"] = true
+	}
+	return md
+}
+
+// parseCertificatePair checks that the PEM certificate chain and key belong
+// together and returns the names and expiry of the leaf certificate.
+func parseCertificatePair(certPEM, keyPEM string) (string, int64, error) {
+	if len(certPEM) > maxCertificateSz || len(keyPEM) > maxCertificateSz {
+		return "", 0, errors.New("证书或私钥过大")
+	}
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return "", 0, errors.New("证书与私钥格式错误或不匹配")
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return "", 0, errors.New("证书格式错误")
+	}
+	names := leaf.DNSNames
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = []string{leaf.Subject.CommonName}
+	}
+	return strings.Join(names, ","), leaf.NotAfter.UnixMilli(), nil
+}
+
+// ensureCertificateOnNode pushes a certificate and its key to an agent. The
+// command travels over the encrypted agent session and the agent keeps the
+// key in a file only it can read.
+func (h *Handler) ensureCertificateOnNode(nodeID int64, cert *model.Certificate) error {
+	payload := map[string]interface{}{
+		"certificates": []map[string]interface{}{{
+			"name": certificateName(cert.ID),
+			"cert": cert.CertPEM,
+			"key":  cert.KeyPEM,
+		}},
+	}
+	_, err := h.sendNodeCommand(nodeID, "SetCertificates", payload, false, false)
+	return err
+}
+
+// pushCertificate sends a replaced certificate to the entry nodes of the
+// forwards using it.
+func (h *Handler) pushCertificate(cert *model.Certificate) {
+	forwards, err := h.repo.ListForwardsByCertificate(cert.ID)
+	if err != nil {
+		return
+	}
+	pushed := make(map[int64]bool)
+	for _, forward := range forwards {
+		ports, err := h.listForwardPorts(forward.ID)
+		if err != nil {
+			continue
+		}
+		for _, fp := range h.forwardServicePorts(forward.TunnelID, ports) {
+			if pushed[fp.NodeID] {
+				continue
+			}
+			pushed[fp.NodeID] = true
+			_ = h.ensureCertificateOnNode(fp.NodeID, cert)
+		}
+	}
+}
+
+// certificateAccess loads a certificate the caller may manage.
+func (h *Handler) certificateAccess(r *http.Request, id int64) (*model.Certificate, error) {
+	userID, roleID, err := userRoleFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := h.repo.GetCertificate(id)
+	if err != nil || (roleID != 0 && cert.UserID != userID) {
+		return nil, errors.New("证书不存在")
+	}
+	return cert, nil
+}
+
+func (h *Handler) certificateList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	userID, roleID, err := userRoleFromRequest(r)
+	if err != nil {
+		response.WriteJSON(w, response.Err(401, "无效的token或token已过期"))
+		return
+	}
+	if roleID == 0 {
+		userID = 0
+	}
+	certs, err := h.repo.ListCertificates(userID)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	items := make([]map[string]interface{}, 0, len(certs))
+	for _, c := range certs {
+		items = append(items, map[string]interface{}{
+			"id": c.ID, "userId": c.UserID, "name": c.Name, "domains": c.Domains,
+			"notAfter": c.NotAfter, "createdTime": c.CreatedTime, "updatedTime": c.UpdatedTime,
+		})
+	}
+	response.WriteJSON(w, response.OK(items))
+}
+
+func (h *Handler) certificateCreate(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	userID, err := userIDFromRequest(r)
+	if err != nil {
+		response.WriteJSON(w, response.Err(401, "无效的token或token已过期"))
+		return
+	}
+	name := strings.TrimSpace(asString(req["name"]))
+	certPEM := strings.TrimSpace(asString(req["cert"]))
+	keyPEM := strings.TrimSpace(asString(req["key"]))
+	if name == "" || certPEM == "" || keyPEM == "" {
+		response.WriteJSON(w, response.ErrDefault("证书名称、证书和私钥不能为空"))
+		return
+	}
+	domains, notAfter, err := parseCertificatePair(certPEM, keyPEM)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	now := time.Now().UnixMilli()
+	cert := &model.Certificate{
+		UserID:      userID,
+		Name:        name,
+		Domains:     domains,
+		CertPEM:     certPEM,
+		KeyPEM:      keyPEM,
+		NotAfter:    notAfter,
+		CreatedTime: now,
+		UpdatedTime: now,
+	}
+	if err := h.repo.CreateCertificate(cert); err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OKEmpty())
+}
+
+func (h *Handler) certificateUpdate(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	cert, err := h.certificateAccess(r, asInt64(req["id"], 0))
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	name := strings.TrimSpace(asString(req["name"]))
+	if name == "" {
+		name = cert.Name
+	}
+	// Leaving the PEM fields empty only renames the certificate.
+	certPEM := strings.TrimSpace(asString(req["cert"]))
+	keyPEM := strings.TrimSpace(asString(req["key"]))
+	replaced := certPEM != "" || keyPEM != ""
+	if replaced {
+		domains, notAfter, err := parseCertificatePair(certPEM, keyPEM)
+		if err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+		cert.CertPEM, cert.KeyPEM, cert.Domains, cert.NotAfter = certPEM, keyPEM, domains, notAfter
+	}
+	if err := h.repo.UpdateCertificate(cert.ID, name, cert.Domains, cert.CertPEM, cert.KeyPEM, cert.NotAfter, time.Now().UnixMilli()); err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	if replaced {
+		h.pushCertificate(cert)
+	}
+	response.WriteJSON(w, response.OKEmpty())
+}
+
+func (h *Handler) certificateDelete(w http.ResponseWriter, r *http.Request) {
+	id := idFromBody(r, w)
+	if id <= 0 {
+		return
+	}
+	cert, err := h.certificateAccess(r, id)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	forwards, err := h.repo.ListForwardsByCertificate(cert.ID)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	if len(forwards) > 0 {
+		response.WriteJSON(w, response.ErrDefault(fmt.Sprintf("证书正在被转发「%s」使用", forwards[0].Name)))
+		return
+	}
+	if err := h.repo.DeleteCertificate(cert.ID); err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	// Agents that served the certificate before drop their copy of the key.
+	payload := map[string]interface{}{"certificates": []string{certificateName(cert.ID)}}
+	for _, nodeID := range h.wsServer.ConnectedNodeIDs() {
+		_, _ = h.sendNodeCommand(nodeID, "DeleteCertificates", payload, false, true)
+	}
+	response.WriteJSON(w, response.OKEmpty())
+}
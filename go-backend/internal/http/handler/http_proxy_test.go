@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestParseForwardHTTP(t *testing.T) {
+	cfg, err := parseForwardHTTP(map[string]interface{}{
+		"httpMode":      "HTTP",
+		"httpRoutes":    "API.example.com/v1  10.0.0.2:8080,10.0.0.3:8080\n\n/static 10.0.0.4:80\n*.example.com 10.0.0.5:80",
+		"httpCertId":    7,
+		"httpAccessLog": true,
+	}, model.ForwardHTTP{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := model.ForwardHTTP{
+		Mode:      "http",
+		Routes:    "api.example.com/v1 10.0.0.2:8080,10.0.0.3:8080\n/static 10.0.0.4:80\n*.example.com 10.0.0.5:80",
+		AccessLog: 1,
+	}
+	if cfg != want {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	if _, err := parseForwardHTTP(map[string]interface{}{"httpMode": "https"}, model.ForwardHTTP{}); err == nil {
+		t.Fatalf("expected https without a certificate to be rejected")
+	}
+	kept, err := parseForwardHTTP(map[string]interface{}{"httpAccessLog": false}, model.ForwardHTTP{Mode: "https", CertID: 3, AccessLog: 1})
+	if err != nil || kept != (model.ForwardHTTP{Mode: "https", CertID: 3}) {
+		t.Fatalf("expected omitted fields to be kept, got %+v (%v)", kept, err)
+	}
+	off, err := parseForwardHTTP(map[string]interface{}{"httpMode": ""}, model.ForwardHTTP{Mode: "https", CertID: 3, Routes: "/a 10.0.0.1:80"})
+	if err != nil || off != (model.ForwardHTTP{}) {
+		t.Fatalf("expected turning the proxy off to clear it, got %+v (%v)", off, err)
+	}
+
+	for _, bad := range []string{"/a", "/a 10.0.0.1", "bad_host 10.0.0.1:80", "* 10.0.0.1:80", "/a 10.0.0.1:80\n/a 10.0.0.2:80"} {
+		if _, err := parseHTTPRoutes(bad); err == nil {
+			t.Fatalf("expected route %q to be rejected", bad)
+		}
+	}
+
+	if err := validateHTTPForward(model.ForwardHTTP{Mode: "http"}, "tcp+udp", 0, 0); err == nil {
+		t.Fatalf("expected udp to be rejected")
+	}
+	if err := validateHTTPForward(model.ForwardHTTP{Mode: "http"}, "tcp", 0, 2); err == nil {
+		t.Fatalf("expected a PROXY header towards the targets to be rejected")
+	}
+}
+
+func TestHTTPForwardServiceMetadata(t *testing.T) {
+	forward := &forwardRecord{ID: 4, UserID: 5, TunnelID: 2, RemoteAddr: "10.0.0.1:80", Protocol: "tcp"}
+	forward.ForwardHTTP = model.ForwardHTTP{Mode: "https", CertID: 9, Routes: "api.example.com/v1 10.0.0.2:8080", AccessLog: 1}
+	node := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+
+	services := buildForwardServiceConfigs("4_5_7", forward, nil, node, 443, "", "", false)
+	if len(services) != 1 {
+		t.Fatalf("expected a single tcp service, got %d", len(services))
+	}
+	md := services[0]["handler"].(map[string]interface{})["metadata"].(map[string]interface{})
+	if md["reverseProxy"] != true || md["reverseProxy.certificate"] != "cert_9" || md["reverseProxy.accessLog"] != true {
+		t.Fatalf("unexpected handler metadata %v", md)
+	}
+	routes := md["reverseProxy.routes"].([]map[string]interface{})
+	want := []map[string]interface{}{{"host": "api.example.com", "path": "/v1", "targets": []string{"10.0.0.2:8080"}}}
+	if !reflect.DeepEqual(routes, want) {
+		t.Fatalf("unexpected routes %v", routes)
+	}
+}
+
+func TestForwardCertificateOwnership(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "cert.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	certPEM, keyPEM := selfSignedPEM(t, "www.example.com")
+	domains, notAfter, err := parseCertificatePair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	if domains != "www.example.com" || notAfter <= time.Now().UnixMilli() {
+		t.Fatalf("unexpected certificate info %q %d", domains, notAfter)
+	}
+	if _, _, err := parseCertificatePair(certPEM, "not a key"); err == nil {
+		t.Fatalf("expected a mismatched key to be rejected")
+	}
+
+	cert := &model.Certificate{UserID: 2, Name: "www", Domains: domains, CertPEM: certPEM, KeyPEM: keyPEM, NotAfter: notAfter}
+	if err := r.CreateCertificate(cert); err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cfg := model.ForwardHTTP{Mode: "https", CertID: cert.ID}
+	if err := h.checkForwardCertificate(cfg, 2, 1); err != nil {
+		t.Fatalf("expected the owner to use the certificate: %v", err)
+	}
+	if err := h.checkForwardCertificate(cfg, 3, 1); err == nil {
+		t.Fatalf("expected another user's certificate to be rejected")
+	}
+	if err := h.checkForwardCertificate(cfg, 3, 0); err != nil {
+		t.Fatalf("expected an admin to use any certificate: %v", err)
+	}
+	if err := h.checkForwardCertificate(model.ForwardHTTP{Mode: "https", CertID: cert.ID + 1}, 2, 1); err == nil {
+		t.Fatalf("expected a missing certificate to be rejected")
+	}
+
+	listed, err := r.ListCertificates(2)
+	if err != nil || len(listed) != 1 || listed[0].KeyPEM != "" {
+		t.Fatalf("expected the list to leave out the key, got %+v (%v)", listed, err)
+	}
+}
+
+func selfSignedPEM(t *testing.T, host string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM)
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ipACLAdmission is a named admission object pushed to entry nodes. An
+// allow list admits only matching sources, a deny list rejects them.
+type ipACLAdmission struct {
+	name      string
+	whitelist bool
+	matchers  []string
+}
+
+func forwardAdmissionName(forwardID int64, kind string) string {
+	return fmt.Sprintf("fwd_%d_%s", forwardID, kind)
+}
+
+func tunnelAdmissionName(tunnelID int64, kind string) string {
+	return fmt.Sprintf("tunnel_%d_%s", tunnelID, kind)
+}
+
+// parseIPACL validates an allow or deny list given as a string separated by
+// commas, whitespace or newlines, or as a JSON array, and returns it in the
+// comma separated form stored on forwards and tunnels.
+func parseIPACL(v interface{}) (string, error) {
+	var raw []string
+	switch val := v.(type) {
+	case nil:
+	case []interface{}:
+		for _, item := range val {
+			raw = append(raw, asString(item))
+		}
+	default:
+		raw = strings.FieldsFunc(asString(val), func(r rune) bool {
+			return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+		})
+	}
+
+	seen := make(map[string]struct{}, len(raw))
+	entries := make([]string, 0, len(raw))
+	for _, item := range raw {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		entry, ok := normalizeIPACLEntry(item)
+		if !ok {
+			return "", fmt.Errorf("IP 列表格式错误: %s", item)
+		}
+		if _, dup := seen[entry]; dup {
+			continue
+		}
+		seen[entry] = struct{}{}
+		entries = append(entries, entry)
+	}
+	return strings.Join(entries, ","), nil
+}
+
+func normalizeIPACLEntry(item string) (string, bool) {
+	if strings.Contains(item, "/") {
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return "", false
+		}
+		return ipNet.String(), true
+	}
+	ip := net.ParseIP(item)
+	if ip == nil {
+		return "", false
+	}
+	return ip.String(), true
+}
+
+func splitIPACL(list string) []string {
+	var out []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func ipACLAdmissions(allowName, denyName, allowIPs, denyIPs string) []ipACLAdmission {
+	var out []ipACLAdmission
+	if allow := splitIPACL(allowIPs); len(allow) > 0 {
+		out = append(out, ipACLAdmission{name: allowName, whitelist: true, matchers: allow})
+	}
+	if deny := splitIPACL(denyIPs); len(deny) > 0 {
+		out = append(out, ipACLAdmission{name: denyName, matchers: deny})
+	}
+	return out
+}
+
+// forwardIPACLAdmissions returns the admissions a forward's services check,
+// tunnel lists first. A source must pass every one of them.
+func forwardIPACLAdmissions(forward *forwardRecord, tunnel *tunnelRecord) []ipACLAdmission {
+	var out []ipACLAdmission
+	if tunnel != nil {
+		out = append(out, ipACLAdmissions(tunnelAdmissionName(tunnel.ID, "allow"), tunnelAdmissionName(tunnel.ID, "deny"), tunnel.AllowIPs, tunnel.DenyIPs)...)
+	}
+	if forward != nil {
+		out = append(out, ipACLAdmissions(forwardAdmissionName(forward.ID, "allow"), forwardAdmissionName(forward.ID, "deny"), forward.AllowIPs, forward.DenyIPs)...)
+	}
+	return out
+}
+
+func admissionNames(admissions []ipACLAdmission) []string {
+	names := make([]string, 0, len(admissions))
+	for _, a := range admissions {
+		names = append(names, a.name)
+	}
+	return names
+}
+
+// staleAdmissionNames lists the admissions of an old allow/deny pair that
+// the new pair no longer needs.
+func staleAdmissionNames(allowName, denyName, oldAllow, oldDeny, newAllow, newDeny string) []string {
+	var stale []string
+	if oldAllow != "" && newAllow == "" {
+		stale = append(stale, allowName)
+	}
+	if oldDeny != "" && newDeny == "" {
+		stale = append(stale, denyName)
+	}
+	return stale
+}
+
+func (h *Handler) ensureAdmissionsOnNode(nodeID int64, admissions []ipACLAdmission) error {
+	for _, a := range admissions {
+		matchers := a.matchers
+		if matchers == nil {
+			matchers = []string{}
+		}
+		payload := map[string]interface{}{
+			"admission": a.name,
+			"data": map[string]interface{}{
+				"name":      a.name,
+				"whitelist": a.whitelist,
+				"matchers":  matchers,
+			},
+		}
+		if _, err := h.sendNodeCommand(nodeID, "UpdateAdmissions", payload, false, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) deleteAdmissionsOnNodes(names []string, ports []forwardPortRecord) {
+	seen := make(map[int64]struct{})
+	for _, fp := range ports {
+		if _, ok := seen[fp.NodeID]; ok {
+			continue
+		}
+		seen[fp.NodeID] = struct{}{}
+		for _, name := range names {
+			_, _ = h.sendNodeCommand(fp.NodeID, "DeleteAdmissions", map[string]interface{}{"admission": name}, false, true)
+		}
+	}
+}
+
+// applyTunnelIPACL rolls a tunnel's allow/deny list change out to the nodes
+// of its forwards. Edited lists take effect in place; active forwards are
+// redeployed only when a list is turned on or off, since that changes the
+// admissions their services reference. A list turned off is left on the
+// nodes as an empty deny list, so services not redeployed, such as paused
+// forwards, keep admitting everyone.
+func (h *Handler) applyTunnelIPACL(old, updated *tunnelRecord) {
+	if h == nil || old == nil || updated == nil {
+		return
+	}
+	if old.AllowIPs == updated.AllowIPs && old.DenyIPs == updated.DenyIPs {
+		return
+	}
+	forwards, err := h.listForwardsByTunnel(updated.ID)
+	if err != nil {
+		return
+	}
+	admissions := forwardIPACLAdmissions(nil, updated)
+	for _, name := range staleAdmissionNames(tunnelAdmissionName(updated.ID, "allow"), tunnelAdmissionName(updated.ID, "deny"), old.AllowIPs, old.DenyIPs, updated.AllowIPs, updated.DenyIPs) {
+		admissions = append(admissions, ipACLAdmission{name: name})
+	}
+	referencesChanged := (old.AllowIPs == "") != (updated.AllowIPs == "") || (old.DenyIPs == "") != (updated.DenyIPs == "")
+
+	seen := make(map[int64]struct{})
+	for i := range forwards {
+		forward := &forwards[i]
+		ports, err := h.listForwardPorts(forward.ID)
+		if err != nil {
+			continue
+		}
+		for _, fp := range h.forwardServicePorts(forward.TunnelID, ports) {
+			if _, ok := seen[fp.NodeID]; ok {
+				continue
+			}
+			seen[fp.NodeID] = struct{}{}
+			_ = h.ensureAdmissionsOnNode(fp.NodeID, admissions)
+		}
+		if referencesChanged && forward.Status == 1 {
+			_ = h.syncForwardServices(forward, "UpdateService", true)
+		}
+	}
+}
+
+func ipACLPayload(allowIPs, denyIPs string) map[string]interface{} {
+	allow := splitIPACL(allowIPs)
+	deny := splitIPACL(denyIPs)
+	if allow == nil {
+		allow = []string{}
+	}
+	if deny == nil {
+		deny = []string{}
+	}
+	return map[string]interface{}{"allow": allow, "deny": deny}
+}
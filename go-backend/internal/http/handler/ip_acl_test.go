@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIPACLNormalizesAndRejectsInvalid(t *testing.T) {
+	got, err := parseIPACL("10.0.0.0/8, 192.168.1.7\n10.1.2.3/8 2001:db8::1")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got != "10.0.0.0/8,192.168.1.7,2001:db8::1" {
+		t.Fatalf("unexpected normalized list %q", got)
+	}
+	if got, err := parseIPACL([]interface{}{"1.1.1.1", " "}); err != nil || got != "1.1.1.1" {
+		t.Fatalf("expected array form to parse, got %q (%v)", got, err)
+	}
+	if _, err := parseIPACL("10.0.0.0/33"); err == nil {
+		t.Fatalf("expected invalid CIDR to be rejected")
+	}
+	if _, err := parseIPACL("example.com"); err == nil {
+		t.Fatalf("expected hostname to be rejected")
+	}
+}
+
+func TestForwardServicesReferenceIPACLAdmissions(t *testing.T) {
+	forward := &forwardRecord{ID: 8, UserID: 5, TunnelID: 2, RemoteAddr: "1.1.1.1:443", DenyIPs: "203.0.113.0/24"}
+	tunnel := &tunnelRecord{ID: 2, Type: 1, AllowIPs: "10.0.0.0/8"}
+	node := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+
+	admissions := forwardIPACLAdmissions(forward, tunnel)
+	if len(admissions) != 2 || !admissions[0].whitelist || admissions[1].whitelist {
+		t.Fatalf("unexpected admissions %+v", admissions)
+	}
+	want := []string{"tunnel_2_allow", "fwd_8_deny"}
+	for _, svc := range buildForwardServiceConfigs("8_5_7", forward, tunnel, node, 10000, "", "", false) {
+		if !reflect.DeepEqual(svc["admissions"], want) {
+			t.Fatalf("service %v: expected admissions %v, got %v", svc["name"], want, svc["admissions"])
+		}
+	}
+
+	if _, ok := buildForwardServiceConfigs("9_5_7", &forwardRecord{ID: 9}, nil, node, 10000, "", "", false)[0]["admissions"]; ok {
+		t.Fatalf("expected no admissions without lists")
+	}
+	if got := staleAdmissionNames("a", "d", "1.1.1.1", "2.2.2.2", "", "3.3.3.3"); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Fatalf("unexpected stale admissions %v", got)
+	}
+}
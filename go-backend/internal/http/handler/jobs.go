@@ -3,6 +3,8 @@ package handler
 import (
 	"context"
 	"time"
+
+	"go-backend/internal/metrics"
 )
 
 func (h *Handler) StartBackgroundJobs() {
@@ -18,11 +20,13 @@ func (h *Handler) StartBackgroundJobs() {
 	ctx, cancel := context.WithCancel(context.Background())
 	h.jobsCancel = cancel
 	h.jobsStarted = true
-	h.jobsWG.Add(2)
+	h.jobsWG.Add(4)
 	h.jobsMu.Unlock()
 
 	go h.runHourlyStatsLoop(ctx)
 	go h.runDailyMaintenanceLoop(ctx)
+	go h.runForwardScheduleLoop(ctx)
+	go h.runClientIPGuardLoop(ctx)
 }
 
 func (h *Handler) StopBackgroundJobs() {
@@ -59,7 +63,9 @@ func (h *Handler) runHourlyStatsLoop(ctx context.Context) {
 			}
 			return
 		case <-timer.C:
-			h.runStatisticsFlowJob(time.Now())
+			start := time.Now()
+			h.runStatisticsFlowJob(start)
+			metrics.ObserveJob("statistics_flow", start)
 		}
 	}
 }
@@ -77,11 +83,58 @@ func (h *Handler) runDailyMaintenanceLoop(ctx context.Context) {
 			}
 			return
 		case <-timer.C:
-			h.runResetAndExpiryJob(time.Now())
+			start := time.Now()
+			h.runResetAndExpiryJob(start)
+			metrics.ObserveJob("reset_and_expiry", start)
+		}
+	}
+}
+
+func (h *Handler) runForwardScheduleLoop(ctx context.Context) {
+	defer h.jobsWG.Done()
+
+	for {
+		wait := durationUntilNextMinute(time.Now())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			if !timer.Stop() {
+				<-timer.C
+			}
+			return
+		case <-timer.C:
+			start := time.Now()
+			h.runForwardScheduleJob(start)
+			metrics.ObserveJob("forward_schedule", start)
+		}
+	}
+}
+
+func (h *Handler) runClientIPGuardLoop(ctx context.Context) {
+	defer h.jobsWG.Done()
+
+	for {
+		wait := durationUntilNextMinute(time.Now())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			if !timer.Stop() {
+				<-timer.C
+			}
+			return
+		case <-timer.C:
+			start := time.Now()
+			h.reevaluateClientIPGuards(start)
+			metrics.ObserveJob("client_ip_guard", start)
 		}
 	}
 }
 
+func durationUntilNextMinute(now time.Time) time.Duration {
+	next := now.Truncate(time.Minute).Add(time.Minute + time.Second)
+	return next.Sub(now)
+}
+
 func durationUntilNextHour(now time.Time) time.Duration {
 	next := now.Truncate(time.Hour).Add(time.Hour)
 	return next.Sub(now)
@@ -103,6 +156,9 @@ func (h *Handler) runStatisticsFlowJob(now time.Time) {
 	nowMs := now.UnixMilli()
 	cutoffMs := nowMs - int64((48*time.Hour)/time.Millisecond)
 	_ = h.repo.PurgeOldStatisticsFlows(cutoffMs)
+	_ = h.repo.PurgeForwardClientIPs(nowMs - clientIPHistory.Milliseconds())
+	_ = h.repo.PurgeExpiredPortDrains(nowMs)
+	h.purgeConnLogs(now)
 
 	hourMark := now.Truncate(time.Hour)
 	hourText := hourMark.Format("15:04")
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/response"
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+type ledgerQueryRequest struct {
+	Period string `json:"period"`
+	UserID int64  `json:"userId"`
+	Format string `json:"format"`
+}
+
+func decodeLedgerQuery(r *http.Request) (ledgerQueryRequest, error) {
+	var req ledgerQueryRequest
+	if err := decodeJSON(r.Body, &req); err != nil && err != io.EOF {
+		return req, err
+	}
+	req.Period = strings.TrimSpace(req.Period)
+	req.Format = strings.ToLower(strings.TrimSpace(req.Format))
+	if req.Period != "" {
+		if _, err := repo.ParseUsagePeriod(req.Period); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+func (h *Handler) ledgerList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+
+	req, err := decodeLedgerQuery(r)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault("账期格式错误，应为YYYY-MM"))
+		return
+	}
+
+	rows, err := h.repo.ListUsageLedgerSummary(req.Period, req.UserID)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OK(rows))
+}
+
+func (h *Handler) ledgerExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+
+	req, err := decodeLedgerQuery(r)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault("账期格式错误，应为YYYY-MM"))
+		return
+	}
+	if req.Period == "" && req.UserID <= 0 {
+		response.WriteJSON(w, response.ErrDefault("请指定账期或用户"))
+		return
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	if req.Format != "csv" && req.Format != "json" {
+		response.WriteJSON(w, response.ErrDefault("导出格式仅支持csv或json"))
+		return
+	}
+
+	rows, err := h.repo.ListUsageLedgerSummary(req.Period, req.UserID)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	filename := "usage"
+	if req.Period != "" {
+		filename += "_" + req.Period
+	}
+	if req.UserID > 0 {
+		filename += "_user" + strconv.FormatInt(req.UserID, 10)
+	}
+
+	if req.Format == "json" {
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename+".json")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rows)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename+".csv")
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"period", "user_id", "user_name", "user_tunnel_id", "tunnel_id", "forward_id", "forward_name", "raw_in", "raw_out", "in_flow", "out_flow"})
+	for _, row := range rows {
+		_ = cw.Write([]string{
+			row.Period,
+			strconv.FormatInt(row.UserID, 10),
+			row.UserName,
+			strconv.FormatInt(row.UserTunnelID, 10),
+			strconv.FormatInt(row.TunnelID, 10),
+			strconv.FormatInt(row.ForwardID, 10),
+			row.ForwardName,
+			strconv.FormatInt(row.RawIn, 10),
+			strconv.FormatInt(row.RawOut, 10),
+			strconv.FormatInt(row.InFlow, 10),
+			strconv.FormatInt(row.OutFlow, 10),
+		})
+	}
+	cw.Flush()
+}
+
+func (h *Handler) ledgerPeriodList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+
+	items, err := h.repo.ListUsagePeriods()
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OK(items))
+}
+
+func (h *Handler) ledgerPeriodClose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+
+	req, err := decodeLedgerQuery(r)
+	if err != nil || req.Period == "" {
+		response.WriteJSON(w, response.ErrDefault("账期格式错误，应为YYYY-MM"))
+		return
+	}
+
+	item, err := h.repo.CloseUsagePeriod(req.Period, time.Now().UnixMilli())
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrUsagePeriodClosed):
+			response.WriteJSON(w, response.ErrDefault("该账期已关闭"))
+		case errors.Is(err, repo.ErrUsagePeriodInvalid):
+			response.WriteJSON(w, response.ErrDefault("只能关闭已结束的账期"))
+		default:
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+		}
+		return
+	}
+	response.WriteJSON(w, response.OK(item))
+}
+
+func (h *Handler) ledgerReconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+
+	items, periods, err := h.repo.ReconcileUsage()
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	mismatches := make([]model.UsageReconcileItem, 0)
+	for _, item := range items {
+		if !item.Matched {
+			mismatches = append(mismatches, item)
+		}
+	}
+	periodMismatches := 0
+	for _, p := range periods {
+		if !p.Matched {
+			periodMismatches++
+		}
+	}
+
+	response.WriteJSON(w, response.OK(map[string]interface{}{
+		"checked":          len(items),
+		"mismatches":       mismatches,
+		"periods":          periods,
+		"periodMismatches": periodMismatches,
+		"ok":               len(mismatches) == 0 && periodMismatches == 0,
+	}))
+}
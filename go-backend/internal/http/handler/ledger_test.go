@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend/internal/metrics"
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestProcessFlowItemAppendsLedgerAndReconciles(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "ledger.db")
+	r, err := repo.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	h := New(r, "secret")
+	nowMs := time.Now().UnixMilli()
+
+	if err := r.DB().Exec(`
+		INSERT INTO user(id, user, pwd, role_id, exp_time, flow, in_flow, out_flow, flow_reset_time, num, created_time, updated_time, status)
+		VALUES(2, 'ledger_user', 'x', 1, ?, 100, 0, 0, 1, 1, ?, ?, 1)
+	`, nowMs+int64(time.Hour/time.Millisecond), nowMs, nowMs).Error; err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	if err := r.DB().Exec(`
+		INSERT INTO tunnel(id, name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, in_ip, inx)
+		VALUES(1, 't1', 2.0, 1, 'tls', 1, ?, ?, 1, NULL, 0)
+	`, nowMs, nowMs).Error; err != nil {
+		t.Fatalf("insert tunnel: %v", err)
+	}
+	if err := r.DB().Exec(`
+		INSERT INTO user_tunnel(id, user_id, tunnel_id, speed_id, num, flow, in_flow, out_flow, flow_reset_time, exp_time, status)
+		VALUES(10, 2, 1, NULL, 1, 100, 0, 0, 1, ?, 1)
+	`, nowMs+int64(time.Hour/time.Millisecond)).Error; err != nil {
+		t.Fatalf("insert user_tunnel: %v", err)
+	}
+	if err := r.DB().Exec(`
+		INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, in_flow, out_flow, created_time, updated_time, status, inx)
+		VALUES(20, 2, 'ledger_user', 'f1', 1, '1.1.1.1:443', 'fifo', 0, 0, ?, ?, 1, 0)
+	`, nowMs, nowMs).Error; err != nil {
+		t.Fatalf("insert forward: %v", err)
+	}
+
+	h.processFlowItem(flowItem{N: "20_2_10_tcp", U: 300, D: 100})
+
+	rows, err := r.ListUsageLedgerSummary(repo.UsagePeriodOf(nowMs), 2)
+	if err != nil {
+		t.Fatalf("list ledger: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 ledger summary row, got %d", len(rows))
+	}
+	got := rows[0]
+	if got.RawIn != 100 || got.RawOut != 300 || got.InFlow != 200 || got.OutFlow != 600 {
+		t.Fatalf("unexpected ledger totals: %+v", got)
+	}
+	if got.ForwardName != "f1" || got.UserName != "ledger_user" || got.UserTunnelID != 10 || got.TunnelID != 1 {
+		t.Fatalf("unexpected ledger identity: %+v", got)
+	}
+
+	assertUsageReconciled(t, r)
+
+	// Manual reset writes a checkpoint so the ledger still agrees.
+	r.ResetUserFlowByUser(2, nowMs)
+	h.processFlowItem(flowItem{N: "20_2_10_tcp", U: 5, D: 5})
+	assertUsageReconciled(t, r)
+
+	if err := r.DB().Exec(`UPDATE forward SET in_flow = in_flow + 1 WHERE id = 20`).Error; err != nil {
+		t.Fatalf("tamper forward counter: %v", err)
+	}
+	items, _, err := r.ReconcileUsage()
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	found := false
+	for _, item := range items {
+		if item.Scope == repo.UsageScopeForward && item.ID == 20 {
+			found = true
+			if item.Matched {
+				t.Fatalf("expected forward counter drift to be reported")
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("forward 20 missing from reconciliation")
+	}
+}
+
+func TestCloseUsagePeriodLocksPeriod(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "ledger-close.db")
+	r, err := repo.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	now := time.Now()
+	past := time.Date(now.Year(), now.Month()-1, 15, 12, 0, 0, 0, time.Local)
+	pastPeriod := repo.UsagePeriodOf(past.UnixMilli())
+
+	if err := r.RecordFlowUsage(model.UsageLedger{UserID: 1, ForwardID: 99, RawIn: 1, RawOut: 2, InFlow: 1, OutFlow: 2, CreatedTime: past.UnixMilli()}); err != nil {
+		t.Fatalf("record flow: %v", err)
+	}
+
+	if _, err := r.CloseUsagePeriod(repo.UsagePeriodOf(now.UnixMilli()), now.UnixMilli()); !errors.Is(err, repo.ErrUsagePeriodInvalid) {
+		t.Fatalf("expected current period close to be rejected, got %v", err)
+	}
+
+	closed, err := r.CloseUsagePeriod(pastPeriod, now.UnixMilli())
+	if err != nil {
+		t.Fatalf("close period: %v", err)
+	}
+	if closed.EntryCount != 1 || closed.InFlow != 1 || closed.OutFlow != 2 {
+		t.Fatalf("unexpected closed totals: %+v", closed)
+	}
+
+	if _, err := r.CloseUsagePeriod(pastPeriod, now.UnixMilli()); !errors.Is(err, repo.ErrUsagePeriodClosed) {
+		t.Fatalf("expected double close to fail, got %v", err)
+	}
+
+	err = r.RecordFlowUsage(model.UsageLedger{UserID: 1, ForwardID: 99, InFlow: 1, CreatedTime: past.UnixMilli()})
+	if !errors.Is(err, repo.ErrUsagePeriodClosed) {
+		t.Fatalf("expected append into closed period to fail, got %v", err)
+	}
+
+	_, periods, err := r.ReconcileUsage()
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(periods) != 1 || !periods[0].Matched {
+		t.Fatalf("expected closed period to reconcile, got %+v", periods)
+	}
+}
+
+func TestProcessFlowItemCountsLostUsage(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "ledger-lost.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	h := New(r, "secret")
+	if err := r.DB().Exec(`DROP TABLE usage_ledger`).Error; err != nil {
+		t.Fatalf("drop ledger: %v", err)
+	}
+	h.processFlowItem(flowItem{N: "20_2_10_tcp", U: 1, D: 1})
+
+	var out strings.Builder
+	metrics.FlowUsageWriteErrors.Expose(&out)
+	if !strings.Contains(out.String(), `flux_flow_usage_write_errors_total{reason="error"}`) {
+		t.Fatalf("expected the failed write to be counted, got %q", out.String())
+	}
+}
+
+func assertUsageReconciled(t *testing.T, r *repo.Repository) {
+	t.Helper()
+	items, _, err := r.ReconcileUsage()
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	for _, item := range items {
+		if !item.Matched {
+			t.Fatalf("unexpected reconciliation mismatch: %+v", item)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// parseNodeListenIPs validates the addresses a node declares for forwards to
+// bind to, given like an IP list, and returns them comma separated. Only
+// specific unicast addresses are accepted, as an empty forward listen IP
+// already stands for the node's wildcard listen address.
+func parseNodeListenIPs(v interface{}) (string, error) {
+	list, err := parseIPACL(v)
+	if err != nil {
+		return "", err
+	}
+	ips := splitIPACL(list)
+	for _, item := range ips {
+		if strings.Contains(item, "/") {
+			return "", fmt.Errorf("监听 IP 不能是网段: %s", item)
+		}
+		if ip := net.ParseIP(item); ip.IsUnspecified() || ip.IsMulticast() {
+			return "", fmt.Errorf("监听 IP 无效: %s", item)
+		}
+	}
+	return strings.Join(ips, ","), nil
+}
+
+// parseForwardListenIP normalizes the address a forward binds to. An empty
+// result keeps the node's listen address.
+func parseForwardListenIP(v interface{}) (string, error) {
+	raw := strings.TrimSpace(asString(v))
+	if raw == "" {
+		return "", nil
+	}
+	ip := net.ParseIP(strings.Trim(raw, "[]"))
+	if ip == nil {
+		return "", fmt.Errorf("监听 IP 无效: %s", raw)
+	}
+	return ip.String(), nil
+}
+
+// checkForwardListenIP makes sure every entry node declares the address a
+// forward binds to.
+func (h *Handler) checkForwardListenIP(listenIP string, entryNodes []int64) error {
+	if listenIP == "" {
+		return nil
+	}
+	for _, nodeID := range entryNodes {
+		node, err := h.getNodeRecord(nodeID)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(splitIPACL(node.ListenIPs), listenIP) {
+			return fmt.Errorf("监听 IP %s 不属于入口节点 %s", listenIP, nodeDisplayName(node))
+		}
+	}
+	return nil
+}
+
+// checkNodeListenIPsInUse keeps an address from being removed from a node
+// while forwards on it still bind to that address.
+func (h *Handler) checkNodeListenIPsInUse(nodeID int64, listenIPs string) error {
+	used, err := h.repo.ListForwardListenIPsOnNode(nodeID)
+	if err != nil {
+		return err
+	}
+	declared := splitIPACL(listenIPs)
+	for _, ip := range used {
+		if !slices.Contains(declared, ip) {
+			return fmt.Errorf("监听 IP %s 仍有转发在使用", ip)
+		}
+	}
+	return nil
+}
+
+// forwardListenHost is the host part of a forward service's address.
+func forwardListenHost(listenIP, nodeAddr string) string {
+	if listenIP == "" {
+		return nodeAddr
+	}
+	if strings.Contains(listenIP, ":") {
+		return "[" + listenIP + "]"
+	}
+	return listenIP
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestParseNodeListenIPs(t *testing.T) {
+	got, err := parseNodeListenIPs("203.0.113.1\n2001:db8::0:1, 203.0.113.1")
+	if err != nil || got != "203.0.113.1,2001:db8::1" {
+		t.Fatalf("unexpected listen ips %q: %v", got, err)
+	}
+	for _, bad := range []string{"203.0.113.0/24", "0.0.0.0", "::", "example.com"} {
+		if _, err := parseNodeListenIPs(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestForwardBindsListenIP(t *testing.T) {
+	forward := &forwardRecord{ID: 1, UserID: 2, TunnelID: 3, RemoteAddr: "10.0.0.1:22", Protocol: "tcp+udp", ListenIP: "2001:db8::1"}
+	node := &nodeRecord{ID: 7, TCPListenAddr: "[::]", UDPListenAddr: "0.0.0.0"}
+
+	services := buildForwardServiceConfigs("1_2_3", forward, &tunnelRecord{ID: 3, Type: 1}, node, 443, "", "", false)
+	for _, svc := range services {
+		if svc["addr"] != "[2001:db8::1]:443" {
+			t.Fatalf("expected %v to bind the listen ip, got %v", svc["name"], svc["addr"])
+		}
+	}
+
+	forward.ListenIP = ""
+	services = buildForwardServiceConfigs("1_2_3", forward, &tunnelRecord{ID: 3, Type: 1}, node, 443, "", "", false)
+	if services[1]["addr"] != "0.0.0.0:443" {
+		t.Fatalf("expected the node listen address without a listen ip, got %v", services[1]["addr"])
+	}
+}
+
+func TestListenIPPortConflicts(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "listen.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	now := time.Now().UnixMilli()
+	if err := r.CreateNode("multi", "s", "203.0.113.1", nil, nil, "1000-65535", nil, nil, 0, 0, 0, now, 1, "[::]", "[::]", "203.0.113.1,203.0.113.2", model.DNSResolver{}, 0, 0, nil, nil, nil); err != nil {
+		t.Fatalf("create node: %v", err)
+	}
+	create := func(name, listenIP string, port int) int64 {
+		t.Helper()
+		id, err := r.CreateForwardTx(model.ForwardRecord{UserID: 1, UserName: "admin", Name: name, TunnelID: 1, RemoteAddr: "10.0.0.1:443", Strategy: "fifo", Protocol: "tcp", ListenIP: listenIP}, now, 0, []int64{1}, port)
+		if err != nil {
+			t.Fatalf("create forward: %v", err)
+		}
+		return id
+	}
+	create("a", "203.0.113.2", 443)
+	create("any", "", 8443)
+
+	used, err := h.getUsedPorts(1, "tcp", "203.0.113.1")
+	if err != nil {
+		t.Fatalf("used ports: %v", err)
+	}
+	if used[443] || !used[8443] {
+		t.Fatalf("expected another address to reuse 443 but not the wildcard port, got %v", used)
+	}
+	for _, listenIP := range []string{"203.0.113.2", ""} {
+		used, _ := h.getUsedPorts(1, "tcp", listenIP)
+		if !used[443] || !used[8443] {
+			t.Fatalf("expected both ports taken for %q, got %v", listenIP, used)
+		}
+	}
+	if err := h.checkSharedPort(0, []int64{1}, 443, "tcp", "203.0.113.1", ""); err != nil {
+		t.Fatalf("expected a forward on another address to own 443: %v", err)
+	}
+
+	if err := h.checkForwardListenIP("203.0.113.2", []int64{1}); err != nil {
+		t.Fatalf("expected a declared address to be accepted: %v", err)
+	}
+	if err := h.checkForwardListenIP("203.0.113.9", []int64{1}); err == nil {
+		t.Fatalf("expected an undeclared address to be rejected")
+	}
+	if err := h.checkNodeListenIPsInUse(1, "203.0.113.1"); err == nil {
+		t.Fatalf("expected removing an address in use to be rejected")
+	}
+
+	forwards, err := r.ListForwards()
+	if err != nil {
+		t.Fatalf("list forwards: %v", err)
+	}
+	if forwards[0]["inIp"] != "203.0.113.2:443" || forwards[1]["inIp"] != "203.0.113.1:8443" {
+		t.Fatalf("unexpected ingress %v and %v", forwards[0]["inIp"], forwards[1]["inIp"])
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-backend/internal/metrics"
+)
+
+// SetMetricsToken enables the /metrics endpoint. An empty token keeps it
+// disabled so a default install never exposes panel internals.
+func (h *Handler) SetMetricsToken(token string) {
+	h.metricsToken = strings.TrimSpace(token)
+}
+
+func (h *Handler) metricsEndpoint(w http.ResponseWriter, r *http.Request) {
+	if h.metricsToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	provided := strings.TrimSpace(r.Header.Get("Authorization"))
+	if strings.HasPrefix(strings.ToLower(provided), "bearer ") {
+		provided = strings.TrimSpace(provided[len("bearer "):])
+	}
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(h.metricsToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	h.exposeStateMetrics(w)
+	metrics.Default.Expose(w)
+}
+
+// exposeStateMetrics writes gauges that are read from the database and the
+// WebSocket server at scrape time rather than tracked incrementally.
+func (h *Handler) exposeStateMetrics(w http.ResponseWriter) {
+	agents := metrics.NewGaugeVec("flux_agents_connected", "Agents with a live WebSocket session.")
+	agents.Set(float64(len(h.wsServer.ConnectedNodeIDs())))
+	agents.Expose(w)
+
+	pending := metrics.NewGaugeVec("flux_ws_pending_commands", "Agent commands awaiting a reply.")
+	pending.Set(float64(h.wsServer.PendingCommandCount()))
+	pending.Expose(w)
+
+	if nodes, err := h.repo.ListNodeMetrics(); err == nil {
+		online := metrics.NewGaugeVec("flux_node_online", "Whether the node is online (1) or offline (0).", "node_id", "node")
+		info := metrics.NewGaugeVec("flux_node_info", "Node agent version, always 1.", "node_id", "node", "version")
+		for _, n := range nodes {
+			id := strconv.FormatInt(n.ID, 10)
+			value := 0.0
+			if n.Status == 1 {
+				value = 1
+			}
+			online.Set(value, id, n.Name)
+			info.Set(1, id, n.Name, n.Version)
+		}
+		online.Expose(w)
+		info.Expose(w)
+	}
+
+	if users, err := h.repo.ListUserQuotaUsage(); err == nil {
+		used := metrics.NewGaugeVec("flux_user_flow_used_bytes", "Flow used by the user in the current reset cycle.", "user_id", "user")
+		quota := metrics.NewGaugeVec("flux_user_flow_quota_bytes", "Flow quota of the user.", "user_id", "user")
+		for _, u := range users {
+			id := strconv.FormatInt(u.UserID, 10)
+			used.Set(float64(u.InFlow+u.OutFlow), id, u.UserName)
+			quota.Set(float64(u.FlowGB*bytesPerGB), id, u.UserName)
+		}
+		used.Expose(w)
+		quota.Expose(w)
+	}
+
+	if items, err := h.repo.ListUserTunnelQuotaUsage(); err == nil {
+		labels := []string{"user_id", "user", "tunnel_id", "tunnel"}
+		used := metrics.NewGaugeVec("flux_user_tunnel_flow_used_bytes", "Flow used by the user on the tunnel in the current reset cycle.", labels...)
+		quota := metrics.NewGaugeVec("flux_user_tunnel_flow_quota_bytes", "Flow quota of the user on the tunnel.", labels...)
+		for _, ut := range items {
+			values := []string{strconv.FormatInt(ut.UserID, 10), ut.UserName, strconv.FormatInt(ut.TunnelID, 10), ut.TunnelName}
+			used.Set(float64(ut.InFlow+ut.OutFlow), values...)
+			quota.Set(float64(ut.FlowGB*bytesPerGB), values...)
+		}
+		used.Expose(w)
+		quota.Expose(w)
+	}
+}
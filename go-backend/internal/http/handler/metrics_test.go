@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-backend/internal/store/repo"
+)
+
+func TestMetricsEndpointRequiresToken(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "metrics.db")
+	r, err := repo.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	h := New(r, "secret")
+
+	rec := httptest.NewRecorder()
+	h.metricsEndpoint(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected disabled endpoint to 404, got %d", rec.Code)
+	}
+
+	h.SetMetricsToken("scrape-token")
+
+	rec = httptest.NewRecorder()
+	h.metricsEndpoint(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected missing token to 401, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.metricsEndpoint(rec, httptest.NewRequest(http.MethodGet, "/metrics?token=scrape-token", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a query string token to be refused, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-token")
+	rec = httptest.NewRecorder()
+	h.metricsEndpoint(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with token, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"flux_agents_connected 0",
+		"flux_ws_pending_commands 0",
+		`flux_user_flow_quota_bytes{user_id="1",user="admin_user"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected metrics output to contain %q, got:\n%s", want, body)
+		}
+	}
+}
@@ -57,10 +57,21 @@ func (h *Handler) userCreate(w http.ResponseWriter, r *http.Request) {
 	num := asInt(req["num"], 10)
 	expTime := asInt64(req["expTime"], time.Now().Add(365*24*time.Hour).UnixMilli())
 	flowResetTime := asInt64(req["flowResetTime"], 1)
+	speed := asInt(req["speed"], 0)
+	if speed < 0 {
+		response.WriteJSON(w, response.ErrDefault("总带宽不能为负数"))
+		return
+	}
+	maxIPs := asInt(req["maxIps"], 0)
+	if maxIPs < 0 {
+		response.WriteJSON(w, response.ErrDefault("IP数限制不能为负数"))
+		return
+	}
+	ipLimitMode := asInt(req["ipLimitMode"], repo.IPLimitModeReject)
 	roleID := 1
 	now := time.Now().UnixMilli()
 
-	if err := h.repo.CreateUser(username, security.MD5(pwd), roleID, expTime, flow, flowResetTime, num, status, now); err != nil {
+	if err := h.repo.CreateUser(username, security.MD5(pwd), roleID, expTime, flow, flowResetTime, num, speed, maxIPs, ipLimitMode, status, now); err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
@@ -117,22 +128,39 @@ func (h *Handler) userUpdate(w http.ResponseWriter, r *http.Request) {
 	expTime := asInt64(req["expTime"], time.Now().Add(365*24*time.Hour).UnixMilli())
 	flowResetTime := asInt64(req["flowResetTime"], 1)
 	status := asInt(req["status"], 1)
+	oldSpeed := h.userSpeed(id)
+	speed := asInt(req["speed"], oldSpeed)
+	if speed < 0 {
+		response.WriteJSON(w, response.ErrDefault("总带宽不能为负数"))
+		return
+	}
+	oldMaxIPs, oldIPLimitMode, _ := h.repo.GetUserIPLimit(id)
+	maxIPs := asInt(req["maxIps"], oldMaxIPs)
+	if maxIPs < 0 {
+		response.WriteJSON(w, response.ErrDefault("IP数限制不能为负数"))
+		return
+	}
+	ipLimitMode := asInt(req["ipLimitMode"], oldIPLimitMode)
 	now := time.Now().UnixMilli()
 
 	pwd := asString(req["pwd"])
 	if strings.TrimSpace(pwd) == "" {
-		if err := h.repo.UpdateUserWithoutPassword(id, username, flow, num, expTime, flowResetTime, status, now); err != nil {
+		if err := h.repo.UpdateUserWithoutPassword(id, username, flow, num, speed, maxIPs, ipLimitMode, expTime, flowResetTime, status, now); err != nil {
 			response.WriteJSON(w, response.Err(-2, err.Error()))
 			return
 		}
 	} else {
-		if err := h.repo.UpdateUserWithPassword(id, username, security.MD5(pwd), flow, num, expTime, flowResetTime, status, now); err != nil {
+		if err := h.repo.UpdateUserWithPassword(id, username, security.MD5(pwd), flow, num, speed, maxIPs, ipLimitMode, expTime, flowResetTime, status, now); err != nil {
 			response.WriteJSON(w, response.Err(-2, err.Error()))
 			return
 		}
 	}
 
 	h.repo.PropagateUserFlowToTunnels(id, flow, num, expTime, flowResetTime)
+	h.applyUserSpeedChange(id, oldSpeed, speed)
+	if maxIPs != oldMaxIPs || ipLimitMode != oldIPLimitMode {
+		h.enforceClientIPLimits(id, now)
+	}
 	response.WriteJSON(w, response.OKEmpty())
 }
 
@@ -208,6 +236,16 @@ func (h *Handler) nodeCreate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.ErrDefault("节点名称和地址不能为空"))
 		return
 	}
+	listenIPs, err := parseNodeListenIPs(req["listenIps"])
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	dns, err := parseDNSResolver(req, model.DNSResolver{})
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 
 	now := time.Now().UnixMilli()
 	inx := h.repo.NextIndex("node")
@@ -227,6 +265,8 @@ func (h *Handler) nodeCreate(w http.ResponseWriter, r *http.Request) {
 		0,
 		defaultString(asString(req["tcpListenAddr"]), "[::]"),
 		defaultString(asString(req["udpListenAddr"]), "[::]"),
+		listenIPs,
+		dns,
 		inx,
 		asInt(req["isRemote"], 0),
 		nullableText(asString(req["remoteUrl"])),
@@ -265,6 +305,26 @@ func (h *Handler) nodeUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	listenIPs, err := parseNodeListenIPs(req["listenIps"])
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := h.checkNodeListenIPsInUse(id, listenIPs); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	current, err := h.getNodeRecord(id)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	dns, err := parseDNSResolver(req, current.DNSResolver)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+
 	newHTTP := asInt(req["http"], currentHTTP)
 	newTLS := asInt(req["tls"], currentTLS)
 	newSocks := asInt(req["socks"], currentSocks)
@@ -288,11 +348,16 @@ func (h *Handler) nodeUpdate(w http.ResponseWriter, r *http.Request) {
 		newSocks,
 		defaultString(asString(req["tcpListenAddr"]), "[::]"),
 		defaultString(asString(req["udpListenAddr"]), "[::]"),
+		listenIPs,
+		dns,
 		now,
 	); err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
+	if currentStatus == 1 {
+		h.applyNodeResolver(id, current.DNSResolver, dns)
+	}
 	response.WriteJSON(w, response.OKEmpty())
 }
 
@@ -419,6 +484,16 @@ func (h *Handler) tunnelCreate(w http.ResponseWriter, r *http.Request) {
 	trafficRatio := asFloat(req["trafficRatio"], 1.0)
 	inIP := asString(req["inIp"])
 	ipPreference := asString(req["ipPreference"])
+	allowIPs, err := parseIPACL(req["allowIps"])
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	denyIPs, err := parseIPACL(req["denyIps"])
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 	now := time.Now().UnixMilli()
 	inx := h.repo.NextIndex("tunnel")
 	localDomain := h.federationLocalDomain()
@@ -504,6 +579,9 @@ func (h *Handler) tunnelCreate(w http.ResponseWriter, r *http.Request) {
 		InIP:         tunnelInIP,
 		Inx:          inx,
 		IPPreference: ipPreference,
+		AllowIPs:     allowIPs,
+		DenyIPs:      denyIPs,
+		RelaySecret:  randomToken(16),
 	}
 	if err := tx.Create(&tunnel).Error; err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
@@ -511,6 +589,7 @@ func (h *Handler) tunnelCreate(w http.ResponseWriter, r *http.Request) {
 	}
 	tunnelID := tunnel.ID
 	runtimeState.TunnelID = tunnelID
+	runtimeState.RelayUsername, runtimeState.RelayPassword = tunnelRelayAuth(tunnelID, tunnel.RelaySecret)
 	var federationBindings []repo.FederationTunnelBinding
 	var federationReleaseRefs []federationRuntimeReleaseRef
 	federationBindings, federationReleaseRefs, err = h.applyFederationRuntime(runtimeState, localDomain)
@@ -534,7 +613,7 @@ func (h *Handler) tunnelCreate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
-	if typeVal == 2 {
+	if typeVal == 2 || typeVal == 3 {
 		createdChains, createdServices, applyErr := h.applyTunnelRuntime(runtimeState)
 		if applyErr != nil {
 			h.rollbackTunnelRuntime(createdChains, createdServices, tunnelID)
@@ -549,13 +628,17 @@ func (h *Handler) tunnelCreate(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) cleanupTunnelRuntime(tunnelID int64) {
 	tunnel, err := h.getTunnelRecord(tunnelID)
-	if err != nil || tunnel.Type != 2 {
+	if err != nil || (tunnel.Type != 2 && tunnel.Type != 3) {
 		return
 	}
 	chainRows, err := h.listChainNodesForTunnel(tunnelID)
 	if err != nil {
 		return
 	}
+	if tunnel.Type == 3 {
+		h.cleanupReverseTunnelRuntime(tunnelID, chainRows)
+		return
+	}
 
 	serviceName := fmt.Sprintf("%d_tls", tunnelID)
 	chainName := fmt.Sprintf("chains_%d", tunnelID)
@@ -610,12 +693,35 @@ func (h *Handler) tunnelUpdate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.ErrDefault("隧道ID不能为空"))
 		return
 	}
+	oldTunnel, err := h.getTunnelRecord(id)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault("隧道不存在"))
+		return
+	}
+	allowIPs, denyIPs := oldTunnel.AllowIPs, oldTunnel.DenyIPs
+	if v, ok := req["allowIps"]; ok {
+		if allowIPs, err = parseIPACL(v); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+	}
+	if v, ok := req["denyIps"]; ok {
+		if denyIPs, err = parseIPACL(v); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+	}
+
+	typeVal := asInt(req["type"], 1)
+	var movedForwards []forwardRecord
+	if oldTunnel.Type == 3 || typeVal == 3 {
+		movedForwards = h.detachReverseTunnelForwards(id)
+	}
 
 	h.cleanupTunnelRuntime(id)
 	h.cleanupFederationRuntime(id)
 
 	now := time.Now().UnixMilli()
-	typeVal := asInt(req["type"], 1)
 	ipPreference := asString(req["ipPreference"])
 	localDomain := h.federationLocalDomain()
 
@@ -655,6 +761,8 @@ func (h *Handler) tunnelUpdate(w http.ResponseWriter, r *http.Request) {
 		asInt(req["status"], 1),
 		inIp,
 		ipPreference,
+		allowIPs,
+		denyIPs,
 		now,
 	); err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
@@ -681,13 +789,20 @@ func (h *Handler) tunnelUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if typeVal == 2 {
+	if typeVal == 2 || typeVal == 3 {
+		if err := h.loadTunnelRelayAuth(runtimeState); err != nil {
+			h.releaseFederationRuntimeRefs(federationReleaseRefs)
+			_ = h.repo.DeleteFederationTunnelBindingsByTunnel(id)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
 		createdChains, createdServices, applyErr := h.applyTunnelRuntime(runtimeState)
 		if applyErr != nil {
 			h.rollbackTunnelRuntime(createdChains, createdServices, id)
 			h.releaseFederationRuntimeRefs(federationReleaseRefs)
 			_ = h.repo.DeleteFederationTunnelBindingsByTunnel(id)
 			if len(federationReleaseRefs) == 0 && shouldDeferTunnelRuntimeApplyError(applyErr) {
+				h.attachReverseTunnelForwards(movedForwards)
 				response.WriteJSON(w, response.OKEmpty())
 				return
 			}
@@ -695,6 +810,10 @@ func (h *Handler) tunnelUpdate(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	if updatedTunnel, err := h.getTunnelRecord(id); err == nil {
+		h.applyTunnelIPACL(oldTunnel, updatedTunnel)
+	}
+	h.attachReverseTunnelForwards(movedForwards)
 
 	response.WriteJSON(w, response.OKEmpty())
 }
@@ -808,8 +927,10 @@ func (h *Handler) reconstructTunnelState(tunnelID int64) (*tunnelCreateState, er
 		state.InNodes = append(state.InNodes, tunnelRuntimeNode{
 			NodeID:    r.NodeID,
 			Protocol:  r.Protocol,
+			Options:   decodeTunnelTransportOptions(r.Options),
 			Strategy:  r.Strategy,
 			ChainType: 1,
+			Port:      r.Port,
 		})
 		state.NodeIDList = append(state.NodeIDList, r.NodeID)
 	}
@@ -818,6 +939,7 @@ func (h *Handler) reconstructTunnelState(tunnelID int64) (*tunnelCreateState, er
 		state.OutNodes = append(state.OutNodes, tunnelRuntimeNode{
 			NodeID:    r.NodeID,
 			Protocol:  r.Protocol,
+			Options:   decodeTunnelTransportOptions(r.Options),
 			Strategy:  r.Strategy,
 			ChainType: 3,
 			Port:      r.Port,
@@ -831,6 +953,7 @@ func (h *Handler) reconstructTunnelState(tunnelID int64) (*tunnelCreateState, er
 			stateHop = append(stateHop, tunnelRuntimeNode{
 				NodeID:    r.NodeID,
 				Protocol:  r.Protocol,
+				Options:   decodeTunnelTransportOptions(r.Options),
 				Strategy:  r.Strategy,
 				ChainType: 2,
 				Inx:       int(r.Inx),
@@ -865,74 +988,69 @@ func (h *Handler) tunnelBatchRedeploy(w http.ResponseWriter, r *http.Request) {
 	success := 0
 	fail := 0
 	for _, tunnelID := range ids {
-		tunnel, err := h.getTunnelRecord(tunnelID)
-		if err != nil {
+		if h.redeployTunnel(tunnelID) {
+			success++
+		} else {
 			fail++
-			continue
 		}
+	}
+	response.WriteJSON(w, response.OK(map[string]interface{}{"successCount": success, "failCount": fail}))
+}
 
-		if tunnel.Type == 2 {
-			h.cleanupTunnelRuntime(tunnelID)
-			h.cleanupFederationRuntime(tunnelID)
-			state, err := h.reconstructTunnelState(tunnelID)
-			if err != nil {
-				fail++
-				continue
-			}
-			federationBindings, federationReleaseRefs, fedErr := h.applyFederationRuntime(state, h.federationLocalDomain())
-			if fedErr != nil {
-				fail++
-				continue
-			}
-			tx := h.repo.BeginTx()
-			if tx.Error != nil {
-				h.releaseFederationRuntimeRefs(federationReleaseRefs)
-				fail++
-				continue
-			}
-			if replaceErr := h.repo.ReplaceFederationTunnelBindingsTx(tx, tunnelID, federationBindings); replaceErr != nil {
-				tx.Rollback()
-				h.releaseFederationRuntimeRefs(federationReleaseRefs)
-				fail++
-				continue
-			}
-			if commitErr := tx.Commit().Error; commitErr != nil {
-				h.releaseFederationRuntimeRefs(federationReleaseRefs)
-				fail++
-				continue
-			}
-			_, _, applyErr := h.applyTunnelRuntime(state)
-			if applyErr != nil {
-				h.releaseFederationRuntimeRefs(federationReleaseRefs)
-				_ = h.repo.DeleteFederationTunnelBindingsByTunnel(tunnelID)
-				fail++
-				continue
-			}
-		}
+// redeployTunnel rebuilds the runtime of a tunnel from the database and
+// resyncs its forwards. Tunnels without relay credentials get them here.
+func (h *Handler) redeployTunnel(tunnelID int64) bool {
+	tunnel, err := h.getTunnelRecord(tunnelID)
+	if err != nil {
+		return false
+	}
 
-		forwards, err := h.listForwardsByTunnel(tunnelID)
+	if tunnel.Type == 2 || tunnel.Type == 3 {
+		h.cleanupTunnelRuntime(tunnelID)
+		h.cleanupFederationRuntime(tunnelID)
+		state, err := h.reconstructTunnelState(tunnelID)
 		if err != nil {
-			fail++
-			continue
+			return false
 		}
-		if len(forwards) == 0 {
-			success++
-			continue
+		if err := h.loadTunnelRelayAuth(state); err != nil {
+			return false
 		}
-		ok := true
-		for i := range forwards {
-			if err := h.syncForwardServices(&forwards[i], "UpdateService", true); err != nil {
-				ok = false
-				break
-			}
+		federationBindings, federationReleaseRefs, fedErr := h.applyFederationRuntime(state, h.federationLocalDomain())
+		if fedErr != nil {
+			return false
 		}
-		if ok {
-			success++
-		} else {
-			fail++
+		tx := h.repo.BeginTx()
+		if tx.Error != nil {
+			h.releaseFederationRuntimeRefs(federationReleaseRefs)
+			return false
+		}
+		if replaceErr := h.repo.ReplaceFederationTunnelBindingsTx(tx, tunnelID, federationBindings); replaceErr != nil {
+			tx.Rollback()
+			h.releaseFederationRuntimeRefs(federationReleaseRefs)
+			return false
+		}
+		if commitErr := tx.Commit().Error; commitErr != nil {
+			h.releaseFederationRuntimeRefs(federationReleaseRefs)
+			return false
+		}
+		_, _, applyErr := h.applyTunnelRuntime(state)
+		if applyErr != nil {
+			h.releaseFederationRuntimeRefs(federationReleaseRefs)
+			_ = h.repo.DeleteFederationTunnelBindingsByTunnel(tunnelID)
+			return false
 		}
 	}
-	response.WriteJSON(w, response.OK(map[string]interface{}{"successCount": success, "failCount": fail}))
+
+	forwards, err := h.listForwardsByTunnel(tunnelID)
+	if err != nil {
+		return false
+	}
+	for i := range forwards {
+		if err := h.syncForwardServices(&forwards[i], "UpdateService", true); err != nil {
+			return false
+		}
+	}
+	return true
 }
 
 func (h *Handler) userTunnelAssign(w http.ResponseWriter, r *http.Request) {
@@ -996,13 +1114,47 @@ func (h *Handler) userTunnelUpdate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.ErrDefault("权限ID不能为空"))
 		return
 	}
+	maxIPs := asInt(req["maxIps"], 0)
+	if maxIPs < 0 {
+		response.WriteJSON(w, response.ErrDefault("IP数限制不能为负数"))
+		return
+	}
+	schedule, err := parseSchedule(req, "scheduleOn", "scheduleOff", model.Schedule{})
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	interfaceName, err := parseEgress(req["interfaceName"])
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if interfaceName != "" {
+		_, tunnelID, err := h.repo.GetUserTunnelUserAndTunnel(id)
+		if err != nil {
+			response.WriteJSON(w, response.ErrDefault("隧道权限不存在"))
+			return
+		}
+		tunnel, err := h.getTunnelRecord(tunnelID)
+		if err != nil {
+			response.WriteJSON(w, response.ErrDefault("隧道不存在"))
+			return
+		}
+		if err := h.checkForwardEgress(interfaceName, tunnel); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+	}
 	if err := h.repo.UpdateUserTunnel(id,
 		asInt64(req["flow"], 0),
 		asInt(req["num"], 0),
+		maxIPs,
 		asInt64(req["expTime"], time.Now().Add(365*24*time.Hour).UnixMilli()),
 		asInt64(req["flowResetTime"], 1),
 		nullableInt(asAnyToInt64Ptr(req["speedId"])),
 		asInt(req["status"], 1),
+		interfaceName,
+		schedule,
 	); err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
@@ -1011,6 +1163,7 @@ func (h *Handler) userTunnelUpdate(w http.ResponseWriter, r *http.Request) {
 	userID, tunnelID, utErr := h.repo.GetUserTunnelUserAndTunnel(id)
 	if utErr == nil {
 		h.syncUserTunnelForwards(userID, tunnelID)
+		h.enforceClientIPLimits(userID, time.Now().UnixMilli())
 	}
 
 	response.WriteJSON(w, response.OKEmpty())
@@ -1027,70 +1180,192 @@ func (h *Handler) forwardCreate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.Err(401, "无效的token或token已过期"))
 		return
 	}
+	if _, err := h.createForward(req, userID, roleID, roleID); err != nil {
+		var se storeError
+		if errors.As(err, &se) {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OKEmpty())
+}
+
+// storeError marks a failure of the panel's own storage rather than of the
+// request, which handlers report with code -2.
+type storeError struct{ error }
+
+// createForward validates a forward request and deploys the forward for
+// userID, who needs a permission on its tunnel unless roleID is an admin's.
+// actorRole is the role of whoever asked, which decides the certificates an
+// HTTPS forward may use.
+func (h *Handler) createForward(req map[string]interface{}, userID int64, roleID, actorRole int) (int64, error) {
 	tunnelID := asInt64(req["tunnelId"], 0)
 	if tunnelID <= 0 {
-		response.WriteJSON(w, response.ErrDefault("隧道ID不能为空"))
-		return
+		return 0, errors.New("隧道ID不能为空")
 	}
 	if err := h.ensureTunnelPermission(userID, roleID, tunnelID); err != nil {
-		response.WriteJSON(w, response.ErrDefault(err.Error()))
-		return
+		return 0, err
 	}
 	tunnel, err := h.getTunnelRecord(tunnelID)
 	if err != nil {
-		response.WriteJSON(w, response.ErrDefault("隧道不存在"))
-		return
+		return 0, errors.New("隧道不存在")
 	}
 	if tunnel.Status != 1 {
-		response.WriteJSON(w, response.ErrDefault("隧道已禁用，无法创建转发"))
-		return
+		return 0, errors.New("隧道已禁用，无法创建转发")
 	}
 	name := asString(req["name"])
 	remoteAddr := asString(req["remoteAddr"])
 	if name == "" || remoteAddr == "" {
-		response.WriteJSON(w, response.ErrDefault("转发名称和目标地址不能为空"))
-		return
+		return 0, errors.New("转发名称和目标地址不能为空")
+	}
+	strategy, ok := parseLoadBalanceStrategy(req["strategy"], "fifo")
+	if !ok {
+		return 0, errLoadBalanceStrategy
+	}
+	maxConns := asInt(req["maxConns"], 0)
+	maxIPConns := asInt(req["maxIpConns"], 0)
+	if maxConns < 0 || maxIPConns < 0 {
+		return 0, errors.New("连接数限制不能为负数")
+	}
+	protocol, ok := parseForwardProtocol(req["protocol"], repo.ForwardProtocolBoth)
+	if !ok {
+		return 0, errors.New("转发协议只能是 tcp、udp 或 tcp+udp")
+	}
+	proxyIn, inOK := parseProxyProtocolVersion(req["proxyIn"], 0)
+	proxyOut, outOK := parseProxyProtocolVersion(req["proxyOut"], 0)
+	if !inOK || !outOK {
+		return 0, errors.New("PROXY 协议版本只能是 0、1 或 2")
+	}
+	allowIPs, err := parseIPACL(req["allowIps"])
+	if err != nil {
+		return 0, err
+	}
+	denyIPs, err := parseIPACL(req["denyIps"])
+	if err != nil {
+		return 0, err
+	}
+	sniHosts, err := parseSNIHosts(req["sniHosts"])
+	if err != nil {
+		return 0, err
+	}
+	connLog := parseConnLog(req, 0)
+	listenIP, err := parseForwardListenIP(req["listenIp"])
+	if err != nil {
+		return 0, err
+	}
+	interfaceName, err := parseEgress(req["interfaceName"])
+	if err != nil {
+		return 0, err
+	}
+	healthCheck, err := parseForwardHealthCheck(req, model.ForwardHealthCheck{})
+	if err != nil {
+		return 0, err
+	}
+	schedule, err := parseSchedule(req, "scheduleOn", "scheduleOff", model.Schedule{})
+	if err != nil {
+		return 0, err
+	}
+	httpCfg, err := parseForwardHTTP(req, model.ForwardHTTP{})
+	if err != nil {
+		return 0, err
+	}
+	dns, err := parseDNSResolver(req, model.DNSResolver{})
+	if err != nil {
+		return 0, err
 	}
 	port := asInt(req["inPort"], 0)
+	portCount, err := parseForwardPortCount(req, port, 0)
+	if err != nil {
+		return 0, err
+	}
+	if err := validateForwardTargets(remoteAddr, portCount); err != nil {
+		return 0, err
+	}
+	if err := validateSNIForward(sniHosts, protocol, portCount, proxyIn); err != nil {
+		return 0, err
+	}
+	if err := validateReverseTunnelForward(tunnel, sniHosts, portCount); err != nil {
+		return 0, err
+	}
+	if err := validateHTTPForward(httpCfg, protocol, portCount, proxyOut); err != nil {
+		return 0, err
+	}
+	if err := h.checkForwardCertificate(httpCfg, userID, actorRole); err != nil {
+		return 0, err
+	}
+	entryNodes, _ := h.tunnelEntryNodeIDs(tunnelID)
+	if err := h.checkForwardListenIP(listenIP, entryNodes); err != nil {
+		return 0, err
+	}
+	if err := h.checkForwardEgress(interfaceName, tunnel); err != nil {
+		return 0, err
+	}
 	if port <= 0 {
-		port = h.pickTunnelPort(tunnelID)
+		port = h.pickTunnelPort(tunnelID, protocol, listenIP, portCount)
 	}
 	if port <= 0 {
 		port = 10000
 	}
-	entryNodes, _ := h.tunnelEntryNodeIDs(tunnelID)
 	for _, nodeID := range entryNodes {
 		node, nodeErr := h.getNodeRecord(nodeID)
 		if nodeErr != nil {
 			continue
 		}
-		if err := validateRemoteNodePort(node, port); err != nil {
-			response.WriteJSON(w, response.ErrDefault(err.Error()))
-			return
+		if err := validateRemoteNodePortRange(node, port, portCount); err != nil {
+			return 0, err
 		}
 	}
+	if err := h.checkSharedPort(0, entryNodes, port, protocol, listenIP, sniHosts); err != nil {
+		return 0, err
+	}
+	if err := h.checkDrainingPort(entryNodes, port, portCount, protocol, listenIP); err != nil {
+		return 0, err
+	}
 	now := time.Now().UnixMilli()
 	inx := h.repo.NextIndex("forward")
 	userName := h.repo.GetUsernameByID(userID)
 	if userName == "" {
 		userName = "user"
 	}
-	forwardID, err := h.repo.CreateForwardTx(userID, userName, name, tunnelID, remoteAddr, defaultString(asString(req["strategy"]), "fifo"), now, inx, entryNodes, port)
+	forwardID, err := h.repo.CreateForwardTx(model.ForwardRecord{
+		UserID:        userID,
+		UserName:      userName,
+		Name:          name,
+		TunnelID:      tunnelID,
+		RemoteAddr:    remoteAddr,
+		Strategy:      strategy,
+		MaxConns:      maxConns,
+		MaxIPConns:    maxIPConns,
+		Protocol:      protocol,
+		PortCount:     portCount,
+		ProxyIn:       proxyIn,
+		ProxyOut:      proxyOut,
+		AllowIPs:      allowIPs,
+		DenyIPs:       denyIPs,
+		SNIHosts:      sniHosts,
+		ConnLog:       connLog,
+		ListenIP:      listenIP,
+		InterfaceName: interfaceName,
+
+		ForwardHealthCheck: healthCheck,
+		Schedule:           schedule,
+		ForwardHTTP:        httpCfg,
+		DNSResolver:        dns,
+	}, now, inx, entryNodes, port)
 	if err != nil {
-		response.WriteJSON(w, response.Err(-2, err.Error()))
-		return
+		return 0, storeError{err}
 	}
 	createdForward, err := h.getForwardRecord(forwardID)
 	if err != nil {
-		response.WriteJSON(w, response.Err(-2, err.Error()))
-		return
+		return 0, storeError{err}
 	}
 	if err := h.syncForwardServices(createdForward, "AddService", false); err != nil {
 		_ = h.deleteForwardByID(forwardID)
-		response.WriteJSON(w, response.ErrDefault(err.Error()))
-		return
+		return 0, err
 	}
-	response.WriteJSON(w, response.OKEmpty())
+	return forwardID, nil
 }
 
 func (h *Handler) forwardUpdate(w http.ResponseWriter, r *http.Request) {
@@ -1146,9 +1421,87 @@ func (h *Handler) forwardUpdate(w http.ResponseWriter, r *http.Request) {
 	if remoteAddr == "" {
 		remoteAddr = forward.RemoteAddr
 	}
-	strategy := strings.TrimSpace(asString(req["strategy"]))
-	if strategy == "" {
-		strategy = forward.Strategy
+	strategy, ok := parseLoadBalanceStrategy(req["strategy"], defaultString(forward.Strategy, "fifo"))
+	if !ok {
+		response.WriteJSON(w, response.ErrDefault(errLoadBalanceStrategy.Error()))
+		return
+	}
+	maxConns := asInt(req["maxConns"], forward.MaxConns)
+	maxIPConns := asInt(req["maxIpConns"], forward.MaxIPConns)
+	if maxConns < 0 || maxIPConns < 0 {
+		response.WriteJSON(w, response.ErrDefault("连接数限制不能为负数"))
+		return
+	}
+	protocol, ok := parseForwardProtocol(req["protocol"], forward.Protocol)
+	if !ok {
+		response.WriteJSON(w, response.ErrDefault("转发协议只能是 tcp、udp 或 tcp+udp"))
+		return
+	}
+	proxyIn, inOK := parseProxyProtocolVersion(req["proxyIn"], forward.ProxyIn)
+	proxyOut, outOK := parseProxyProtocolVersion(req["proxyOut"], forward.ProxyOut)
+	if !inOK || !outOK {
+		response.WriteJSON(w, response.ErrDefault("PROXY 协议版本只能是 0、1 或 2"))
+		return
+	}
+	allowIPs, denyIPs := forward.AllowIPs, forward.DenyIPs
+	if v, ok := req["allowIps"]; ok {
+		if allowIPs, err = parseIPACL(v); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+	}
+	if v, ok := req["denyIps"]; ok {
+		if denyIPs, err = parseIPACL(v); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+	}
+	sniHosts := forward.SNIHosts
+	if v, ok := req["sniHosts"]; ok {
+		if sniHosts, err = parseSNIHosts(v); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+	}
+	connLog := parseConnLog(req, forward.ConnLog)
+	listenIP := forward.ListenIP
+	if v, ok := req["listenIp"]; ok {
+		if listenIP, err = parseForwardListenIP(v); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+	}
+	interfaceName := forward.InterfaceName
+	if v, ok := req["interfaceName"]; ok {
+		if interfaceName, err = parseEgress(v); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+	}
+	healthCheck, err := parseForwardHealthCheck(req, forward.ForwardHealthCheck)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	schedule, err := parseSchedule(req, "scheduleOn", "scheduleOff", forward.Schedule)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	httpCfg, err := parseForwardHTTP(req, forward.ForwardHTTP)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	dns, err := parseDNSResolver(req, forward.DNSResolver)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	portDrain, err := parseForwardPortDrain(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
 	}
 
 	port := asInt(req["inPort"], 0)
@@ -1157,26 +1510,89 @@ func (h *Handler) forwardUpdate(w http.ResponseWriter, r *http.Request) {
 		if minPort.Valid {
 			port = int(minPort.Int64)
 		}
-		if port <= 0 {
-			port = h.pickTunnelPort(tunnelID)
-		}
+	}
+	portCount, err := parseForwardPortCount(req, port, forward.PortCount)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := validateForwardTargets(remoteAddr, portCount); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := validateSNIForward(sniHosts, protocol, portCount, proxyIn); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := validateReverseTunnelForward(tunnel, sniHosts, portCount); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := validateHTTPForward(httpCfg, protocol, portCount, proxyOut); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := h.checkForwardCertificate(httpCfg, forward.UserID, actorRole); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
 	}
 	fwdEntryNodes, _ := h.tunnelEntryNodeIDs(tunnelID)
+	if err := h.checkForwardListenIP(listenIP, fwdEntryNodes); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := h.checkForwardEgress(interfaceName, tunnel); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if port <= 0 {
+		port = h.pickTunnelPort(tunnelID, protocol, listenIP, portCount)
+	}
 	for _, nodeID := range fwdEntryNodes {
 		node, nodeErr := h.getNodeRecord(nodeID)
 		if nodeErr != nil {
 			continue
 		}
-		if err := validateRemoteNodePort(node, port); err != nil {
+		if err := validateRemoteNodePortRange(node, port, portCount); err != nil {
 			response.WriteJSON(w, response.ErrDefault(err.Error()))
 			return
 		}
 	}
+	if err := h.checkSharedPort(id, fwdEntryNodes, port, protocol, listenIP, sniHosts); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := h.checkDrainingPort(fwdEntryNodes, port, portCount, protocol, listenIP); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 	now := time.Now().UnixMilli()
-	if err := h.repo.UpdateForward(id, name, tunnelID, remoteAddr, strategy, now); err != nil {
+	updated := *forward
+	updated.Name = name
+	updated.TunnelID = tunnelID
+	updated.RemoteAddr = remoteAddr
+	updated.Strategy = strategy
+	updated.MaxConns = maxConns
+	updated.MaxIPConns = maxIPConns
+	updated.Protocol = protocol
+	updated.PortCount = portCount
+	updated.ProxyIn = proxyIn
+	updated.ProxyOut = proxyOut
+	updated.AllowIPs = allowIPs
+	updated.DenyIPs = denyIPs
+	updated.SNIHosts = sniHosts
+	updated.ConnLog = connLog
+	updated.ListenIP = listenIP
+	updated.InterfaceName = interfaceName
+	updated.ForwardHealthCheck = healthCheck
+	updated.Schedule = schedule
+	updated.ForwardHTTP = httpCfg
+	updated.DNSResolver = dns
+	if err := h.repo.UpdateForward(updated, now); err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
+	h.detachForwardFromReverseTunnel(forward, tunnelID)
 	if err := h.replaceForwardPorts(id, tunnelID, port); err != nil {
 		h.rollbackForwardMutation(forward, oldPorts)
 		response.WriteJSON(w, response.Err(-2, err.Error()))
@@ -1188,11 +1604,33 @@ func (h *Handler) forwardUpdate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
-	if err := h.syncForwardServices(updatedForward, "UpdateService", true); err != nil {
+	drain := forwardPortDrain(forward, oldPorts, tunnelID, listenIP, port, portCount, portDrain)
+	if err := h.syncForwardServicesDrain(updatedForward, "UpdateService", true, drain); err != nil {
 		h.rollbackForwardMutation(forward, oldPorts)
 		response.WriteJSON(w, response.ErrDefault(err.Error()))
 		return
 	}
+	if drain > 0 {
+		expireTime := now + int64(drain)*int64(time.Second/time.Millisecond)
+		_ = h.repo.ReserveDrainingPorts(*forward, oldPorts, expireTime)
+	}
+	if len(forwardConnLimits(forward.MaxConns, forward.MaxIPConns)) > 0 {
+		oldServicePorts := h.forwardServicePorts(forward.TunnelID, oldPorts)
+		if len(forwardConnLimits(maxConns, maxIPConns)) == 0 {
+			h.deleteConnLimiterOnNodes(connLimiterName(id), oldServicePorts)
+		} else if newPorts, err := h.listForwardPorts(id); err == nil {
+			h.deleteConnLimiterOnNodes(connLimiterName(id), staleNodePorts(oldServicePorts, h.forwardServicePorts(tunnelID, newPorts)))
+		}
+	}
+	if forward.DNSResolver.Servers != "" && dns.Servers == "" {
+		h.deleteResolverOnNodes(forwardResolverName(id), h.forwardServicePorts(forward.TunnelID, oldPorts))
+	}
+	if stale := staleAdmissionNames(forwardAdmissionName(id, "allow"), forwardAdmissionName(id, "deny"), forward.AllowIPs, forward.DenyIPs, allowIPs, denyIPs); len(stale) > 0 {
+		h.deleteAdmissionsOnNodes(stale, h.forwardServicePorts(forward.TunnelID, oldPorts))
+	}
+	if healthCheck != forward.ForwardHealthCheck || remoteAddr != forward.RemoteAddr {
+		h.clearTargetHealth(id)
+	}
 	response.WriteJSON(w, response.OKEmpty())
 }
 
@@ -1214,6 +1652,7 @@ func (h *Handler) forwardDelete(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.ErrDefault(err.Error()))
 		return
 	}
+	h.deleteForwardConnLimiter(forward)
 	if err := h.deleteForwardByID(id); err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
@@ -1334,6 +1773,7 @@ func (h *Handler) forwardBatchDelete(w http.ResponseWriter, r *http.Request) {
 			f++
 			continue
 		}
+		h.deleteForwardConnLimiter(forward)
 		if err := h.deleteForwardByID(id); err != nil {
 			f++
 		} else {
@@ -1474,6 +1914,19 @@ func (h *Handler) forwardBatchChangeTunnel(w http.ResponseWriter, r *http.Reques
 			fail++
 			continue
 		}
+		if validateReverseTunnelForward(targetTunnel, forward.SNIHosts, forward.PortCount) != nil {
+			fail++
+			continue
+		}
+		bctEntryNodes, _ := h.tunnelEntryNodeIDs(req.TargetTunnelID)
+		if h.checkForwardListenIP(forward.ListenIP, bctEntryNodes) != nil {
+			fail++
+			continue
+		}
+		if h.checkForwardEgress(forward.InterfaceName, targetTunnel) != nil {
+			fail++
+			continue
+		}
 		oldPorts, listPortsErr := h.listForwardPorts(id)
 		if listPortsErr != nil {
 			fail++
@@ -1489,16 +1942,15 @@ func (h *Handler) forwardBatchChangeTunnel(w http.ResponseWriter, r *http.Reques
 			p = int(port.Int64)
 		}
 		if p <= 0 {
-			p = h.pickTunnelPort(req.TargetTunnelID)
+			p = h.pickTunnelPort(req.TargetTunnelID, forward.Protocol, forward.ListenIP, forward.PortCount)
 		}
-		bctEntryNodes, _ := h.tunnelEntryNodeIDs(req.TargetTunnelID)
 		portRangeOk := true
 		for _, nid := range bctEntryNodes {
 			nd, ndErr := h.getNodeRecord(nid)
 			if ndErr != nil {
 				continue
 			}
-			if validateRemoteNodePort(nd, p) != nil {
+			if validateRemoteNodePortRange(nd, p, forward.PortCount) != nil {
 				portRangeOk = false
 				break
 			}
@@ -1507,6 +1959,7 @@ func (h *Handler) forwardBatchChangeTunnel(w http.ResponseWriter, r *http.Reques
 			fail++
 			continue
 		}
+		h.detachForwardFromReverseTunnel(forward, req.TargetTunnelID)
 		if err := h.replaceForwardPorts(id, req.TargetTunnelID, p); err != nil {
 			h.rollbackForwardMutation(forward, oldPorts)
 			fail++
@@ -1551,12 +2004,18 @@ func (h *Handler) speedLimitCreate(w http.ResponseWriter, r *http.Request) {
 	}
 	now := time.Now().UnixMilli()
 	speed := asInt(req["speed"], 100)
-	id, err := h.repo.CreateSpeedLimit(name, speed, tunnelID, tunnelName, now, asInt(req["status"], 1))
+	connSpeed := asInt(req["connSpeed"], 0)
+	ipSpeed := asInt(req["ipSpeed"], 0)
+	if connSpeed < 0 || ipSpeed < 0 {
+		response.WriteJSON(w, response.ErrDefault("限速值不能为负数"))
+		return
+	}
+	id, err := h.repo.CreateSpeedLimit(name, speed, connSpeed, ipSpeed, tunnelID, tunnelName, now, asInt(req["status"], 1))
 	if err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
-	_ = h.sendLimiterConfig(id, speed, tunnelID)
+	_ = h.sendLimiterConfig(id, speedLimitLimits(speed, connSpeed, ipSpeed), tunnelID)
 	response.WriteJSON(w, response.OKEmpty())
 }
 
@@ -1578,11 +2037,17 @@ func (h *Handler) speedLimitUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	speed := asInt(req["speed"], 100)
-	if err := h.repo.UpdateSpeedLimit(id, asString(req["name"]), speed, tunnelID, tunnelName, asInt(req["status"], 1), time.Now().UnixMilli()); err != nil {
+	connSpeed := asInt(req["connSpeed"], 0)
+	ipSpeed := asInt(req["ipSpeed"], 0)
+	if connSpeed < 0 || ipSpeed < 0 {
+		response.WriteJSON(w, response.ErrDefault("限速值不能为负数"))
+		return
+	}
+	if err := h.repo.UpdateSpeedLimit(id, asString(req["name"]), speed, connSpeed, ipSpeed, tunnelID, tunnelName, asInt(req["status"], 1), time.Now().UnixMilli()); err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
-	_ = h.sendLimiterConfig(id, speed, tunnelID)
+	_ = h.sendLimiterConfig(id, speedLimitLimits(speed, connSpeed, ipSpeed), tunnelID)
 	response.WriteJSON(w, response.OKEmpty())
 }
 
@@ -1836,6 +2301,7 @@ func (h *Handler) syncPermissionsByTunnelGroup(tunnelGroupID int64) error {
 type tunnelRuntimeNode struct {
 	NodeID    int64
 	Protocol  string
+	Options   tunnelTransportOptions
 	Strategy  string
 	Inx       int
 	ChainType int
@@ -1851,6 +2317,10 @@ type tunnelCreateState struct {
 	OutNodes     []tunnelRuntimeNode
 	Nodes        map[int64]*nodeRecord
 	NodeIDList   []int64
+	// RelayUsername and RelayPassword guard the tunnel's relay services;
+	// empty leaves them open.
+	RelayUsername string
+	RelayPassword string
 }
 
 func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface{}, tunnelType int, excludeTunnelID int64) (*tunnelCreateState, error) {
@@ -1868,11 +2338,20 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 		if nodeID <= 0 {
 			continue
 		}
+		strategy, ok := parseLoadBalanceStrategy(item["strategy"], "round")
+		if !ok {
+			return nil, errLoadBalanceStrategy
+		}
+		protocol, opts, err := parseTunnelTransportItem(item)
+		if err != nil {
+			return nil, err
+		}
 		nodeIDs = append(nodeIDs, nodeID)
 		state.InNodes = append(state.InNodes, tunnelRuntimeNode{
 			NodeID:    nodeID,
-			Protocol:  defaultString(asString(item["protocol"]), "tls"),
-			Strategy:  defaultString(asString(item["strategy"]), "round"),
+			Protocol:  protocol,
+			Options:   opts,
+			Strategy:  strategy,
 			ChainType: 1,
 		})
 	}
@@ -1880,6 +2359,14 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 		return nil, errors.New("入口不能为空")
 	}
 
+	if tunnelType == 3 {
+		exitID, err := h.prepareReverseTunnelState(tx, req, state, excludeTunnelID)
+		if err != nil {
+			return nil, err
+		}
+		nodeIDs = append(nodeIDs, exitID)
+	}
+
 	if tunnelType == 2 {
 		outNodesRaw := asMapSlice(req["outNodeId"])
 		if len(outNodesRaw) == 0 {
@@ -1892,6 +2379,14 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 			if nodeID <= 0 {
 				continue
 			}
+			strategy, ok := parseLoadBalanceStrategy(item["strategy"], "round")
+			if !ok {
+				return nil, errLoadBalanceStrategy
+			}
+			protocol, opts, err := parseTunnelTransportItem(item)
+			if err != nil {
+				return nil, err
+			}
 			nodeIDs = append(nodeIDs, nodeID)
 			port := asInt(item["port"], 0)
 			if port <= 0 {
@@ -1900,7 +2395,6 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 					return nil, remoteErr
 				}
 				if !isRemote {
-					var err error
 					port, err = h.repo.PickNodePortTx(tx, nodeID, allocated, excludeTunnelID)
 					if err != nil {
 						return nil, err
@@ -1909,8 +2403,9 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 			}
 			state.OutNodes = append(state.OutNodes, tunnelRuntimeNode{
 				NodeID:    nodeID,
-				Protocol:  defaultString(asString(item["protocol"]), "tls"),
-				Strategy:  defaultString(asString(item["strategy"]), "round"),
+				Protocol:  protocol,
+				Options:   opts,
+				Strategy:  strategy,
 				ChainType: 3,
 				Port:      port,
 			})
@@ -1926,6 +2421,14 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 				if nodeID <= 0 {
 					continue
 				}
+				strategy, ok := parseLoadBalanceStrategy(item["strategy"], "round")
+				if !ok {
+					return nil, errLoadBalanceStrategy
+				}
+				protocol, opts, err := parseTunnelTransportItem(item)
+				if err != nil {
+					return nil, err
+				}
 				nodeIDs = append(nodeIDs, nodeID)
 				port := asInt(item["port"], 0)
 				if port <= 0 {
@@ -1934,7 +2437,6 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 						return nil, remoteErr
 					}
 					if !isRemote {
-						var err error
 						port, err = h.repo.PickNodePortTx(tx, nodeID, allocated, excludeTunnelID)
 						if err != nil {
 							return nil, err
@@ -1943,8 +2445,9 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 				}
 				hop = append(hop, tunnelRuntimeNode{
 					NodeID:    nodeID,
-					Protocol:  defaultString(asString(item["protocol"]), "tls"),
-					Strategy:  defaultString(asString(item["strategy"]), "round"),
+					Protocol:  protocol,
+					Options:   opts,
+					Strategy:  strategy,
 					Inx:       hopIdx + 1,
 					ChainType: 2,
 					Port:      port,
@@ -1978,6 +2481,9 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 		}
 		state.Nodes[nodeID] = node
 	}
+	if err := validateRemoteTunnelTransport(state); err != nil {
+		return nil, err
+	}
 
 	for _, outNode := range state.OutNodes {
 		if err := validateRemoteNodePort(state.Nodes[outNode.NodeID], outNode.Port); err != nil {
@@ -2041,6 +2547,17 @@ func applyTunnelPortsToRequest(req map[string]interface{}, state *tunnelCreateSt
 	if req == nil || state == nil {
 		return
 	}
+	inPorts := make(map[int64]int)
+	for _, n := range state.InNodes {
+		inPorts[n.NodeID] = n.Port
+	}
+	for _, item := range asMapSlice(req["inNodeId"]) {
+		nodeID := asInt64(item["nodeId"], 0)
+		if port, ok := inPorts[nodeID]; ok && port > 0 {
+			item["port"] = port
+		}
+	}
+
 	outPorts := make(map[int64]int)
 	for _, n := range state.OutNodes {
 		outPorts[n.NodeID] = n.Port
@@ -2343,6 +2860,9 @@ func (h *Handler) applyTunnelRuntime(state *tunnelCreateState) ([]int64, []int64
 	}
 	createdChains := make([]int64, 0)
 	createdServices := make([]int64, 0)
+	if state.Type == 3 {
+		return h.applyReverseTunnelRuntime(state)
+	}
 	if state.Type != 2 {
 		return createdChains, createdServices, nil
 	}
@@ -2357,6 +2877,7 @@ func (h *Handler) applyTunnelRuntime(state *tunnelCreateState) ([]int64, []int64
 		if err != nil {
 			return createdChains, createdServices, err
 		}
+		setRelayChainAuth(chainData, state.RelayUsername, state.RelayPassword)
 		if _, err := h.sendNodeCommand(inNode.NodeID, "AddChains", chainData, true, false); err != nil {
 			if node != nil && node.IsRemote == 1 && shouldDeferTunnelRuntimeApplyError(err) {
 				continue
@@ -2371,6 +2892,7 @@ func (h *Handler) applyTunnelRuntime(state *tunnelCreateState) ([]int64, []int64
 		if i+1 < len(state.ChainHops) {
 			nextTargets = state.ChainHops[i+1]
 		}
+		openRelay := i > 0 && hasRemoteRelayNode(state.ChainHops[i-1], state.Nodes)
 		for _, chainNode := range hop {
 			if node := state.Nodes[chainNode.NodeID]; node != nil && node.IsRemote == 1 {
 				continue
@@ -2379,12 +2901,16 @@ func (h *Handler) applyTunnelRuntime(state *tunnelCreateState) ([]int64, []int64
 			if err != nil {
 				return createdChains, createdServices, err
 			}
+			setRelayChainAuth(chainData, state.RelayUsername, state.RelayPassword)
 			if _, err := h.sendNodeCommand(chainNode.NodeID, "AddChains", chainData, true, false); err != nil {
 				return createdChains, createdServices, fmt.Errorf("转发链节点 %s 下发转发链失败: %w", nodeDisplayName(state.Nodes[chainNode.NodeID]), err)
 			}
 			createdChains = append(createdChains, chainNode.NodeID)
 
 			serviceData := buildTunnelChainServiceConfig(state.TunnelID, chainNode, state.Nodes[chainNode.NodeID])
+			if !openRelay {
+				setRelayServiceAuth(serviceData, state.RelayUsername, state.RelayPassword)
+			}
 			if _, err := h.sendNodeCommand(chainNode.NodeID, "AddService", serviceData, true, false); err != nil {
 				return createdChains, createdServices, fmt.Errorf("转发链节点 %s 下发服务失败: %w", nodeDisplayName(state.Nodes[chainNode.NodeID]), err)
 			}
@@ -2392,11 +2918,15 @@ func (h *Handler) applyTunnelRuntime(state *tunnelCreateState) ([]int64, []int64
 		}
 	}
 
+	openRelay := len(state.ChainHops) > 0 && hasRemoteRelayNode(state.ChainHops[len(state.ChainHops)-1], state.Nodes)
 	for _, outNode := range state.OutNodes {
 		if node := state.Nodes[outNode.NodeID]; node != nil && node.IsRemote == 1 {
 			continue
 		}
 		serviceData := buildTunnelChainServiceConfig(state.TunnelID, outNode, state.Nodes[outNode.NodeID])
+		if !openRelay {
+			setRelayServiceAuth(serviceData, state.RelayUsername, state.RelayPassword)
+		}
 		if _, err := h.sendNodeCommand(outNode.NodeID, "AddService", serviceData, true, false); err != nil {
 			return createdChains, createdServices, fmt.Errorf("出口节点 %s 下发服务失败: %w", nodeDisplayName(state.Nodes[outNode.NodeID]), err)
 		}
@@ -2483,9 +3013,7 @@ func buildTunnelChainConfig(tunnelID int64, fromNodeID int64, targets []tunnelRu
 			"name":      fmt.Sprintf("node_%d", idx+1),
 			"addr":      processServerAddress(fmt.Sprintf("%s:%d", host, port)),
 			"connector": connector,
-			"dialer": map[string]interface{}{
-				"type": protocol,
-			},
+			"dialer":    tunnelDialerConfig(protocol, target.Options),
 		})
 	}
 
@@ -2521,12 +3049,10 @@ func buildTunnelChainServiceConfig(tunnelID int64, chainNode tunnelRuntimeNode,
 		handlerCfg["metadata"] = map[string]interface{}{"nodelay": true}
 	}
 	service := map[string]interface{}{
-		"name":    fmt.Sprintf("%d_tls", tunnelID),
-		"addr":    fmt.Sprintf("%s:%d", node.TCPListenAddr, chainNode.Port),
-		"handler": handlerCfg,
-		"listener": map[string]interface{}{
-			"type": protocol,
-		},
+		"name":     fmt.Sprintf("%d_tls", tunnelID),
+		"addr":     fmt.Sprintf("%s:%d", node.TCPListenAddr, chainNode.Port),
+		"handler":  handlerCfg,
+		"listener": tunnelListenerConfig(protocol, chainNode.Options),
 	}
 	if chainNode.ChainType == 2 {
 		service["handler"].(map[string]interface{})["chain"] = fmt.Sprintf("chains_%d", tunnelID)
@@ -2666,15 +3192,21 @@ func (h *Handler) replaceTunnelChainsTx(tx *gorm.DB, tunnelID int64, req map[str
 		if nodeID <= 0 {
 			continue
 		}
+		// Only a reverse tunnel's entry node runs a relay service.
+		var port sql.NullInt64
+		if asInt(req["type"], 1) == 3 && asInt(n["port"], 0) > 0 {
+			port = sql.NullInt64{Int64: int64(asInt(n["port"], 0)), Valid: true}
+		}
 		if err := h.repo.CreateChainTunnelTx(
 			tx,
 			tunnelID,
 			"1",
 			nodeID,
-			sql.NullInt64{},
+			port,
 			defaultString(asString(n["strategy"]), "round"),
 			0,
 			defaultString(asString(n["protocol"]), "tls"),
+			asString(n["options"]),
 		); err != nil {
 			return err
 		}
@@ -2701,6 +3233,7 @@ func (h *Handler) replaceTunnelChainsTx(tx *gorm.DB, tunnelID int64, req map[str
 			defaultString(asString(n["strategy"]), "round"),
 			0,
 			defaultString(asString(n["protocol"]), "tls"),
+			asString(n["options"]),
 		); err != nil {
 			return err
 		}
@@ -2729,6 +3262,7 @@ func (h *Handler) replaceTunnelChainsTx(tx *gorm.DB, tunnelID int64, req map[str
 				defaultString(asString(n["strategy"]), "round"),
 				i+1,
 				defaultString(asString(n["protocol"]), "tls"),
+				asString(n["options"]),
 			); err != nil {
 				return err
 			}
@@ -2746,7 +3280,24 @@ func (h *Handler) deleteTunnelByID(id int64) error {
 }
 
 func (h *Handler) deleteForwardByID(id int64) error {
-	return h.repo.DeleteForwardCascade(id)
+	if err := h.repo.DeleteForwardCascade(id); err != nil {
+		return err
+	}
+	h.clearTargetHealth(id)
+	return nil
+}
+
+// deleteForwardConnLimiter removes a deleted forward's conn limiter from
+// the nodes that ran it.
+func (h *Handler) deleteForwardConnLimiter(forward *forwardRecord) {
+	if len(forwardConnLimits(forward.MaxConns, forward.MaxIPConns)) == 0 {
+		return
+	}
+	ports, err := h.listForwardPorts(forward.ID)
+	if err != nil {
+		return
+	}
+	h.deleteConnLimiterOnNodes(connLimiterName(forward.ID), h.forwardServicePorts(forward.TunnelID, ports))
 }
 
 func (h *Handler) batchForwardDelete(ids []int64) (int, int) {
@@ -2770,7 +3321,10 @@ func (h *Handler) tunnelEntryNodeIDs(tunnelID int64) ([]int64, error) {
 	return h.repo.TunnelEntryNodeIDs(tunnelID)
 }
 
-func (h *Handler) pickTunnelPort(tunnelID int64) int {
+// pickTunnelPort returns a free port on every entry node of a tunnel for a
+// forward bound to listenIP. For a port range forward it returns the first
+// port of count free ports.
+func (h *Handler) pickTunnelPort(tunnelID int64, protocol, listenIP string, count int) int {
 	entryNodes, err := h.tunnelEntryNodeIDs(tunnelID)
 	if err != nil || len(entryNodes) == 0 {
 		return 10000
@@ -2793,7 +3347,7 @@ func (h *Handler) pickTunnelPort(tunnelID int64) int {
 			continue
 		}
 
-		used, err := h.getUsedPorts(nodeID)
+		used, err := h.getUsedPorts(nodeID, protocol, listenIP)
 		if err != nil {
 			continue
 		}
@@ -2827,6 +3381,7 @@ func (h *Handler) pickTunnelPort(tunnelID int64) int {
 		}
 	}
 
+	commonAvailable = portRangeStarts(commonAvailable, count)
 	if len(commonAvailable) > 0 {
 		idx, _ := rand.Int(rand.Reader, big.NewInt(int64(len(commonAvailable))))
 		return commonAvailable[idx.Int64()]
@@ -2835,8 +3390,8 @@ func (h *Handler) pickTunnelPort(tunnelID int64) int {
 	return 10000
 }
 
-func (h *Handler) getUsedPorts(nodeID int64) (map[int]bool, error) {
-	return h.repo.GetUsedPortsOnNodeAsMap(nodeID)
+func (h *Handler) getUsedPorts(nodeID int64, protocol, listenIP string) (map[int]bool, error) {
+	return h.repo.GetUsedPortsOnNodeAsMap(nodeID, protocol, listenIP)
 }
 
 func parsePorts(portRange string) ([]int, error) {
@@ -2908,11 +3463,7 @@ func (h *Handler) rollbackForwardMutation(oldForward *forwardRecord, oldPorts []
 		return
 	}
 
-	h.repo.RollbackForwardFields(
-		oldForward.ID, oldForward.UserID, oldForward.UserName, oldForward.Name,
-		oldForward.TunnelID, oldForward.RemoteAddr, oldForward.Strategy, oldForward.Status,
-		time.Now().UnixMilli(),
-	)
+	h.repo.RollbackForwardFields(*oldForward, time.Now().UnixMilli())
 
 	if err := h.replaceForwardPortsWithRecords(oldForward.ID, oldPorts); err != nil {
 		return
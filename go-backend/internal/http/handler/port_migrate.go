@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxForwardPortDrain caps how long, in seconds, an old entry port keeps
+// serving after a forward moves to a new one.
+const maxForwardPortDrain = 3600
+
+// parseForwardPortDrain reads how long the old entry port of a forward keeps
+// serving when an update moves it to another port. Zero replaces the
+// services in place.
+func parseForwardPortDrain(req map[string]interface{}) (int, error) {
+	drain := asInt(req["portDrain"], 0)
+	if drain < 0 || drain > maxForwardPortDrain {
+		return 0, fmt.Errorf("旧端口保留时间须在 0-%d 秒之间", maxForwardPortDrain)
+	}
+	return drain, nil
+}
+
+// forwardPortDrain returns the drain window to migrate a forward's services
+// with, or 0 when the update does not only move its entry port. Both
+// listeners must be up on the same nodes at once, so the tunnel and listen
+// IP have to stay, and the new port range must not overlap the old one.
+func forwardPortDrain(old *forwardRecord, oldPorts []forwardPortRecord, tunnelID int64, listenIP string, port, portCount, drain int) int {
+	if drain <= 0 || old == nil || len(oldPorts) == 0 {
+		return 0
+	}
+	if tunnelID != old.TunnelID || listenIP != old.ListenIP {
+		return 0
+	}
+	oldPort := oldPorts[0].Port
+	for _, fp := range oldPorts[1:] {
+		oldPort = min(oldPort, fp.Port)
+	}
+	oldEnd := oldPort + max(old.PortCount, 1) - 1
+	newEnd := port + max(portCount, 1) - 1
+	if port <= oldEnd && oldPort <= newEnd {
+		return 0
+	}
+	return drain
+}
+
+// checkDrainingPort refuses a port range that an old listener still holds
+// on one of the entry nodes after its forward migrated away.
+func (h *Handler) checkDrainingPort(entryNodes []int64, port, portCount int, protocol, listenIP string) error {
+	if port <= 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	for _, nodeID := range entryNodes {
+		draining, err := h.repo.IsPortDraining(nodeID, port, portCount, protocol, listenIP, now)
+		if err != nil {
+			return err
+		}
+		if draining {
+			return fmt.Errorf("端口 %d 仍被迁移中的旧端口占用，请稍后再试或更换端口", port)
+		}
+	}
+	return nil
+}
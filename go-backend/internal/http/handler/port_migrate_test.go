@@ -0,0 +1,29 @@
+package handler
+
+import "testing"
+
+func TestForwardPortDrainOnlyForPortMoves(t *testing.T) {
+	old := &forwardRecord{ID: 1, TunnelID: 2, ListenIP: "10.0.0.1", PortCount: 10}
+	ports := []forwardPortRecord{{NodeID: 3, Port: 20000}, {NodeID: 4, Port: 20000}}
+
+	cases := []struct {
+		name      string
+		tunnelID  int64
+		listenIP  string
+		port      int
+		portCount int
+		drain     int
+		want      int
+	}{
+		{"moved range", 2, "10.0.0.1", 20010, 10, 30, 30},
+		{"overlapping range", 2, "10.0.0.1", 20009, 10, 30, 0},
+		{"other tunnel", 5, "10.0.0.1", 21000, 10, 30, 0},
+		{"other listen ip", 2, "", 21000, 10, 30, 0},
+		{"no drain", 2, "10.0.0.1", 21000, 10, 0, 0},
+	}
+	for _, tc := range cases {
+		if got := forwardPortDrain(old, ports, tc.tunnelID, tc.listenIP, tc.port, tc.portCount, tc.drain); got != tc.want {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.want, got)
+		}
+	}
+}
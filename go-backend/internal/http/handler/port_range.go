@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxForwardPortCount caps the size of a port range forward. Every port is
+// a listener on each entry node, so the cap keeps one forward from taking a
+// node's whole port range.
+const maxForwardPortCount = 1000
+
+// parseForwardPortCount reads the size of a forward's entry port range.
+// inPortEnd, when set, is the last port of a range starting at port;
+// otherwise portCount is used, falling back to def. A single port is 0.
+func parseForwardPortCount(req map[string]interface{}, port, def int) (int, error) {
+	count := asInt(req["portCount"], def)
+	if end := asInt(req["inPortEnd"], 0); end > 0 {
+		if port <= 0 {
+			return 0, errors.New("端口段转发需要指定起始端口")
+		}
+		if end < port {
+			return 0, errors.New("结束端口不能小于起始端口")
+		}
+		count = end - port + 1
+	}
+	if count < 0 || count > maxForwardPortCount {
+		return 0, fmt.Errorf("端口段最多 %d 个端口", maxForwardPortCount)
+	}
+	if count <= 1 {
+		return 0, nil
+	}
+	if port > 0 && port+count-1 > 65535 {
+		return 0, errors.New("端口段超出 65535")
+	}
+	return count, nil
+}
+
+// validateForwardTargets checks a forward's targets against its entry port
+// range. Targets of a range forward either all name a port range of the same
+// size, mapped one to one, or all name a single port shared by the range.
+func validateForwardTargets(remoteAddr string, portCount int) error {
+	targets, err := parseRemoteTargets(remoteAddr)
+	if err != nil {
+		return err
+	}
+	ranged := 0
+	for _, target := range targets {
+		if target.ports == 0 {
+			continue
+		}
+		if portCount <= 1 {
+			return errors.New("只有端口段转发的目标可以使用端口段")
+		}
+		if target.ports != portCount {
+			return fmt.Errorf("目标端口段需与入口端口段长度一致（%d 个端口）", portCount)
+		}
+		ranged++
+	}
+	if ranged > 0 && ranged < len(targets) {
+		return errors.New("多个目标需同时使用端口段或同时使用单个端口")
+	}
+	return nil
+}
+
+// parsePortSpan parses a "first-last" port range.
+func parsePortSpan(s string) (int, int, bool) {
+	a, b, found := strings.Cut(s, "-")
+	if !found {
+		return 0, 0, false
+	}
+	first, err1 := strconv.Atoi(strings.TrimSpace(a))
+	last, err2 := strconv.Atoi(strings.TrimSpace(b))
+	if err1 != nil || err2 != nil || first < 1 || last > 65535 || last <= first {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+// forwardListenPorts formats the port part of a forward service address.
+// The agent serves a range such as 20000-20100 with a single service.
+func forwardListenPorts(port, portCount int) string {
+	if portCount > 1 {
+		return fmt.Sprintf("%d-%d", port, port+portCount-1)
+	}
+	return strconv.Itoa(port)
+}
+
+// portRangeStarts returns the ports of available that start a run of count
+// consecutive available ports.
+func portRangeStarts(available []int, count int) []int {
+	if count <= 1 {
+		return available
+	}
+	sorted := slices.Compact(slices.Sorted(slices.Values(available)))
+
+	var starts []int
+	runStart := 0
+	for i := range sorted {
+		if i > 0 && sorted[i] != sorted[i-1]+1 {
+			runStart = i
+		}
+		if i-runStart+1 >= count {
+			starts = append(starts, sorted[i-count+1])
+		}
+	}
+	return starts
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestParseForwardPortCount(t *testing.T) {
+	if got, err := parseForwardPortCount(map[string]interface{}{"inPortEnd": 20100}, 20000, 0); err != nil || got != 101 {
+		t.Fatalf("expected 101 ports, got %d (%v)", got, err)
+	}
+	if got, err := parseForwardPortCount(map[string]interface{}{}, 20000, 101); err != nil || got != 101 {
+		t.Fatalf("expected the stored range to be kept, got %d (%v)", got, err)
+	}
+	if got, err := parseForwardPortCount(map[string]interface{}{"inPortEnd": 20000}, 20000, 101); err != nil || got != 0 {
+		t.Fatalf("expected a one port range to become a single port, got %d (%v)", got, err)
+	}
+	if got, err := parseForwardPortCount(map[string]interface{}{"portCount": 50}, 0, 0); err != nil || got != 50 {
+		t.Fatalf("expected a range to be allowed without a start port, got %d (%v)", got, err)
+	}
+
+	for _, req := range []map[string]interface{}{
+		{"inPortEnd": 19999},
+		{"portCount": maxForwardPortCount + 1},
+		{"inPortEnd": 65536},
+	} {
+		if _, err := parseForwardPortCount(req, 20000, 0); err == nil {
+			t.Fatalf("expected %v to be rejected", req)
+		}
+	}
+}
+
+func TestValidateForwardTargetsForPortRanges(t *testing.T) {
+	valid := []struct {
+		remoteAddr string
+		portCount  int
+	}{
+		{"10.0.0.1:30000-30100,10.0.0.2:40000-40100", 101},
+		{"10.0.0.1:3478", 101},
+		{"10.0.0.1:80", 0},
+	}
+	for _, tc := range valid {
+		if err := validateForwardTargets(tc.remoteAddr, tc.portCount); err != nil {
+			t.Fatalf("%q with %d ports: %v", tc.remoteAddr, tc.portCount, err)
+		}
+	}
+
+	invalid := []struct {
+		remoteAddr string
+		portCount  int
+	}{
+		{"10.0.0.1:30000-30100", 0},
+		{"10.0.0.1:30000-30050", 101},
+		{"10.0.0.1:30000-30100,10.0.0.2:80", 101},
+		{"10.0.0.1:30100-30000", 101},
+	}
+	for _, tc := range invalid {
+		if err := validateForwardTargets(tc.remoteAddr, tc.portCount); err == nil {
+			t.Fatalf("expected %q with %d ports to be rejected", tc.remoteAddr, tc.portCount)
+		}
+	}
+}
+
+func TestPortRangeForwardUsesOneServicePerProtocol(t *testing.T) {
+	forward := &forwardRecord{ID: 4, UserID: 5, TunnelID: 2, RemoteAddr: "10.0.0.1:30000-30100#weight=2", PortCount: 101}
+	node := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "0.0.0.0"}
+
+	services := buildForwardServiceConfigs("4_5_7", forward, nil, node, 20000, "", "", false)
+	if len(services) != 2 {
+		t.Fatalf("expected tcp and udp services, got %d", len(services))
+	}
+	for _, svc := range services {
+		want := "[::]:20000-20100"
+		if svc["name"] == "4_5_7_udp" {
+			want = "0.0.0.0:20000-20100"
+		}
+		if svc["addr"] != want {
+			t.Fatalf("expected %s, got %v", want, svc["addr"])
+		}
+		md, _ := svc["handler"].(map[string]interface{})["metadata"].(map[string]interface{})
+		if md["portMap"] != true {
+			t.Fatalf("expected one to one port mapping on %v: %v", svc["name"], md)
+		}
+		nodes := svc["forwarder"].(map[string]interface{})["nodes"].([]map[string]interface{})
+		if len(nodes) != 1 || nodes[0]["addr"] != "10.0.0.1:30000" {
+			t.Fatalf("expected the target to start at its first port, got %v", nodes)
+		}
+	}
+
+	forward.RemoteAddr = "10.0.0.1:3478"
+	for _, svc := range buildForwardServiceConfigs("4_5_7", forward, nil, node, 20000, "", "", false) {
+		if md, _ := svc["handler"].(map[string]interface{})["metadata"].(map[string]interface{}); md["portMap"] != nil {
+			t.Fatalf("single port target should not map ports: %v", md)
+		}
+	}
+}
+
+func TestPortRangeForwardHoldsEveryPort(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "port_range.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	now := time.Now().UnixMilli()
+	if _, err := r.CreateForwardTx(model.ForwardRecord{UserID: 1, UserName: "admin", Name: "game", TunnelID: 1, RemoteAddr: "10.0.0.1:30000-30009", Strategy: "fifo", Protocol: "tcp+udp", PortCount: 10}, now, 0, []int64{7}, 20000); err != nil {
+		t.Fatalf("create forward: %v", err)
+	}
+	used, err := r.GetUsedPortsOnNodeAsMap(7, "tcp", "")
+	if err != nil {
+		t.Fatalf("used ports: %v", err)
+	}
+	for p := 20000; p <= 20009; p++ {
+		if !used[p] {
+			t.Fatalf("expected port %d to be used", p)
+		}
+	}
+	if used[20010] {
+		t.Fatalf("port after the range should be free")
+	}
+	if ports, err := r.ListUsedPortsOnNode(7); err != nil || len(ports) != 10 {
+		t.Fatalf("expected 10 used ports, got %v (%v)", ports, err)
+	}
+
+	starts := portRangeStarts([]int{1000, 1001, 1002, 1005, 1006, 1007, 1008}, 3)
+	if !reflect.DeepEqual(starts, []int{1000, 1005, 1006}) {
+		t.Fatalf("unexpected range starts: %v", starts)
+	}
+}
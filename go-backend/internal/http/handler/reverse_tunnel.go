@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// A reverse tunnel (type 3) exposes services of a node behind NAT. The exit
+// node dials out to a relay service on the entry node and binds the forward
+// ports there, so the entry node sends every accepted connection back over
+// that link. The forward services run on the exit node, where they are
+// accounted like any other forward.
+
+// prepareReverseTunnelState adds the single exit node of a reverse tunnel
+// to state and picks the entry node port its relay service listens on. It
+// returns the exit node ID.
+func (h *Handler) prepareReverseTunnelState(tx *gorm.DB, req map[string]interface{}, state *tunnelCreateState, excludeTunnelID int64) (int64, error) {
+	if len(state.InNodes) != 1 {
+		return 0, errors.New("反向隧道只能有一个入口")
+	}
+	for _, item := range asMapSlice(req["outNodeId"]) {
+		nodeID := asInt64(item["nodeId"], 0)
+		if nodeID <= 0 {
+			continue
+		}
+		protocol, opts, err := parseTunnelTransportItem(item)
+		if err != nil {
+			return 0, err
+		}
+		state.OutNodes = append(state.OutNodes, tunnelRuntimeNode{
+			NodeID:    nodeID,
+			Protocol:  protocol,
+			Options:   opts,
+			Strategy:  "round",
+			ChainType: 3,
+		})
+	}
+	if len(state.OutNodes) == 0 {
+		return 0, errors.New("出口不能为空")
+	}
+	if len(state.OutNodes) > 1 {
+		return 0, errors.New("反向隧道只能有一个出口")
+	}
+
+	entry := &state.InNodes[0]
+	exitID := state.OutNodes[0].NodeID
+	for _, nodeID := range []int64{entry.NodeID, exitID} {
+		isRemote, err := h.repo.IsRemoteNodeTx(tx, nodeID)
+		if err != nil {
+			return 0, err
+		}
+		if isRemote {
+			return 0, errors.New("反向隧道不支持远程节点")
+		}
+	}
+
+	// The exit node picks the protocol it dials the entry node with, which
+	// the entry node's relay service listens on.
+	entry.Protocol = state.OutNodes[0].Protocol
+	entry.Options = state.OutNodes[0].Options
+	port := 0
+	for _, item := range asMapSlice(req["inNodeId"]) {
+		if asInt64(item["nodeId"], 0) == entry.NodeID {
+			item["protocol"] = entry.Protocol
+			item["options"] = encodeTunnelTransportOptions(entry.Options)
+			port = asInt(item["port"], 0)
+		}
+	}
+	if port <= 0 {
+		var err error
+		port, err = h.repo.PickNodePortTx(tx, entry.NodeID, map[int64]int{}, excludeTunnelID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	entry.Port = port
+	return exitID, nil
+}
+
+// applyReverseTunnelRuntime starts the relay service on the entry node and
+// the chain the exit node reaches it through.
+func (h *Handler) applyReverseTunnelRuntime(state *tunnelCreateState) ([]int64, []int64, error) {
+	createdChains := make([]int64, 0)
+	createdServices := make([]int64, 0)
+	if len(state.InNodes) == 0 || len(state.OutNodes) == 0 {
+		return createdChains, createdServices, errors.New("隧道配置不完整")
+	}
+	entry := state.InNodes[0]
+	exit := state.OutNodes[0]
+	serviceData := buildReverseTunnelServiceConfig(state.TunnelID, entry, state.Nodes[entry.NodeID], state.RelayUsername, state.RelayPassword)
+	if _, err := h.sendNodeCommand(entry.NodeID, "AddService", serviceData, true, false); err != nil {
+		return createdChains, createdServices, fmt.Errorf("入口节点 %s 下发服务失败: %w", nodeDisplayName(state.Nodes[entry.NodeID]), err)
+	}
+	createdServices = append(createdServices, entry.NodeID)
+
+	chainData, err := buildReverseTunnelChainConfig(state.TunnelID, exit.NodeID, entry, state.Nodes, state.IPPreference, state.RelayUsername, state.RelayPassword)
+	if err != nil {
+		return createdChains, createdServices, err
+	}
+	if _, err := h.sendNodeCommand(exit.NodeID, "AddChains", chainData, true, false); err != nil {
+		return createdChains, createdServices, fmt.Errorf("出口节点 %s 下发转发链失败: %w", nodeDisplayName(state.Nodes[exit.NodeID]), err)
+	}
+	createdChains = append(createdChains, exit.NodeID)
+	return createdChains, createdServices, nil
+}
+
+func (h *Handler) cleanupReverseTunnelRuntime(tunnelID int64, chainRows []chainNodeRecord) {
+	serviceName := fmt.Sprintf("%d_tls", tunnelID)
+	chainName := fmt.Sprintf("chains_%d", tunnelID)
+	for _, row := range chainRows {
+		switch row.ChainType {
+		case 1:
+			_, _ = h.sendNodeCommand(row.NodeID, "DeleteService", map[string]interface{}{"services": []string{serviceName}}, false, true)
+		case 3:
+			_, _ = h.sendNodeCommand(row.NodeID, "DeleteChains", map[string]interface{}{"chain": chainName}, false, true)
+		}
+	}
+}
+
+// buildReverseTunnelServiceConfig is the entry node's relay service, which
+// accepts port binds from the exit node only.
+func buildReverseTunnelServiceConfig(tunnelID int64, entry tunnelRuntimeNode, node *nodeRecord, username, password string) []map[string]interface{} {
+	services := buildTunnelChainServiceConfig(tunnelID, entry, node)
+	for _, service := range services {
+		handlerCfg := service["handler"].(map[string]interface{})
+		metadata, _ := handlerCfg["metadata"].(map[string]interface{})
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+		}
+		metadata["bind"] = true
+		handlerCfg["metadata"] = metadata
+	}
+	setRelayServiceAuth(services, username, password)
+	return services
+}
+
+// buildReverseTunnelChainConfig is the exit node's chain to the entry
+// node's relay service, used by the forward listeners to bind their ports.
+func buildReverseTunnelChainConfig(tunnelID int64, exitNodeID int64, entry tunnelRuntimeNode, nodes map[int64]*nodeRecord, ipPreference, username, password string) (map[string]interface{}, error) {
+	chain, err := buildTunnelChainConfig(tunnelID, exitNodeID, []tunnelRuntimeNode{entry}, nodes, ipPreference)
+	if err != nil {
+		return nil, err
+	}
+	setRelayChainAuth(chain, username, password)
+	return chain, nil
+}
+
+// reverseTunnelExitNodeID returns the exit node of a reverse tunnel, or 0
+// for any other tunnel.
+func (h *Handler) reverseTunnelExitNodeID(tunnelID int64) int64 {
+	tunnel, err := h.getTunnelRecord(tunnelID)
+	if err != nil || tunnel.Type != 3 {
+		return 0
+	}
+	rows, err := h.listChainNodesForTunnel(tunnelID)
+	if err != nil {
+		return 0
+	}
+	for _, row := range rows {
+		if row.ChainType == 3 {
+			return row.NodeID
+		}
+	}
+	return 0
+}
+
+// forwardServicePorts maps a forward's entry ports to the nodes running
+// their services: the entry node itself, or a reverse tunnel's exit node.
+func (h *Handler) forwardServicePorts(tunnelID int64, ports []forwardPortRecord) []forwardPortRecord {
+	exitNodeID := h.reverseTunnelExitNodeID(tunnelID)
+	if exitNodeID <= 0 {
+		return ports
+	}
+	mapped := make([]forwardPortRecord, 0, len(ports))
+	for _, fp := range ports {
+		mapped = append(mapped, forwardPortRecord{NodeID: exitNodeID, Port: fp.Port})
+	}
+	return mapped
+}
+
+// validateReverseTunnelForward rejects the forward options a reverse tunnel
+// cannot serve: the exit node binds exactly one port per service, and the
+// entry node has no listener to route by hostname.
+func validateReverseTunnelForward(tunnel *tunnelRecord, sniHosts string, portCount int) error {
+	if tunnel == nil || tunnel.Type != 3 {
+		return nil
+	}
+	if portCount > 1 {
+		return errors.New("反向隧道的转发不能使用端口段")
+	}
+	if sniHosts != "" {
+		return errors.New("反向隧道的转发不能按域名共享端口")
+	}
+	return nil
+}
+
+// detachReverseTunnelForwards removes the services of a tunnel's forwards
+// ahead of an update that moves them between nodes, which is the case
+// whenever a reverse tunnel is involved. It returns the forwards to attach
+// again once the tunnel is updated.
+func (h *Handler) detachReverseTunnelForwards(tunnelID int64) []forwardRecord {
+	forwards, err := h.listForwardsByTunnel(tunnelID)
+	if err != nil {
+		return nil
+	}
+	for i := range forwards {
+		_ = h.controlForwardServices(&forwards[i], "DeleteService", true)
+	}
+	return forwards
+}
+
+func (h *Handler) attachReverseTunnelForwards(forwards []forwardRecord) {
+	for i := range forwards {
+		_ = h.syncForwardServices(&forwards[i], "UpdateService", true)
+	}
+}
+
+// detachForwardFromReverseTunnel removes a forward's services before it
+// moves to another tunnel when either tunnel is a reverse tunnel, as its
+// services then change nodes.
+func (h *Handler) detachForwardFromReverseTunnel(forward *forwardRecord, tunnelID int64) {
+	if forward.TunnelID == tunnelID {
+		return
+	}
+	if h.reverseTunnelExitNodeID(forward.TunnelID) <= 0 && h.reverseTunnelExitNodeID(tunnelID) <= 0 {
+		return
+	}
+	_ = h.controlForwardServices(forward, "DeleteService", true)
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestReverseTunnelForwardBindsEntryPort(t *testing.T) {
+	forward := &forwardRecord{ID: 4, UserID: 5, TunnelID: 7, RemoteAddr: "192.168.1.10:22", Protocol: "tcp+udp"}
+	tunnel := &tunnelRecord{ID: 7, Type: 3}
+	entry := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "0.0.0.0"}
+
+	services := buildForwardServiceConfigs("4_5_9", forward, tunnel, entry, 10022, "", "", true)
+	if len(services) != 2 {
+		t.Fatalf("expected tcp and udp services, got %d", len(services))
+	}
+	for _, svc := range services {
+		ln := svc["listener"].(map[string]interface{})
+		if ln["chain"] != "chains_7" {
+			t.Fatalf("expected %v to bind through the tunnel chain, got %v", svc["name"], ln["chain"])
+		}
+		if _, ok := svc["handler"].(map[string]interface{})["chain"]; ok {
+			t.Fatalf("expected %v to reach its targets directly", svc["name"])
+		}
+	}
+	if ln := services[0]["listener"].(map[string]interface{}); ln["type"] != "rtcp" || services[0]["addr"] != "[::]:10022" {
+		t.Fatalf("unexpected tcp listener %v at %v", ln["type"], services[0]["addr"])
+	}
+	if ln := services[1]["listener"].(map[string]interface{}); ln["type"] != "rudp" || services[1]["addr"] != "0.0.0.0:10022" {
+		t.Fatalf("unexpected udp listener %v at %v", ln["type"], services[1]["addr"])
+	}
+
+	if err := validateReverseTunnelForward(tunnel, "", 3); err == nil {
+		t.Fatalf("expected a port range to be rejected")
+	}
+	if err := validateReverseTunnelForward(tunnel, "a.example.com", 0); err == nil {
+		t.Fatalf("expected shared port hosts to be rejected")
+	}
+	if err := validateReverseTunnelForward(&tunnelRecord{Type: 1}, "", 3); err != nil {
+		t.Fatalf("unexpected error for a port forward tunnel: %v", err)
+	}
+}
+
+func TestReverseTunnelRelayAuth(t *testing.T) {
+	username, password := tunnelRelayAuth(7, "s1")
+	if other, _ := tunnelRelayAuth(7, "s2"); other != username {
+		t.Fatalf("expected the username to depend on the tunnel only")
+	}
+	if _, p := tunnelRelayAuth(8, "s1"); p == password {
+		t.Fatalf("expected tunnels to get distinct passwords")
+	}
+	if _, p := tunnelRelayAuth(7, "s2"); p == password {
+		t.Fatalf("expected a new secret to rotate the password")
+	}
+
+	entry := tunnelRuntimeNode{NodeID: 1, Protocol: "tls", ChainType: 1, Port: 20000}
+	nodes := map[int64]*nodeRecord{
+		1: {ID: 1, ServerIP: "203.0.113.1", ServerIPv4: "203.0.113.1", TCPListenAddr: "[::]"},
+		2: {ID: 2, ServerIP: "192.168.1.2", ServerIPv4: "192.168.1.2", TCPListenAddr: "[::]"},
+	}
+
+	service := buildReverseTunnelServiceConfig(7, entry, nodes[1], username, password)[0]
+	handlerCfg := service["handler"].(map[string]interface{})
+	if service["addr"] != "[::]:20000" || handlerCfg["metadata"].(map[string]interface{})["bind"] != true {
+		t.Fatalf("expected a relay service accepting binds on the entry port, got %v", service)
+	}
+
+	chain, err := buildReverseTunnelChainConfig(7, 2, entry, nodes, "", username, password)
+	if err != nil {
+		t.Fatalf("build chain: %v", err)
+	}
+	node := chain["hops"].([]map[string]interface{})[0]["nodes"].([]map[string]interface{})[0]
+	if node["addr"] != "203.0.113.1:20000" {
+		t.Fatalf("expected the exit node to dial the entry node, got %v", node["addr"])
+	}
+	auth := node["connector"].(map[string]interface{})["auth"]
+	if auth == nil || auth.(map[string]interface{})["password"] != handlerCfg["auth"].(map[string]interface{})["password"] {
+		t.Fatalf("expected the chain to present the relay service's credentials")
+	}
+}
+
+func TestReverseTunnelServicesRunOnExitNode(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "reverse.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	tx := r.BeginTx()
+	tunnels := []model.Tunnel{{Name: "reverse", Type: 3, Protocol: "tls", Status: 1}, {Name: "direct", Type: 1, Protocol: "tls", Status: 1}}
+	for i := range tunnels {
+		if err := tx.Create(&tunnels[i]).Error; err != nil {
+			t.Fatalf("create tunnel: %v", err)
+		}
+	}
+	reverseID, directID := tunnels[0].ID, tunnels[1].ID
+	if err := r.CreateChainTunnelTx(tx, reverseID, "1", 3, sql.NullInt64{Int64: 20000, Valid: true}, "round", 0, "tls", ""); err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	if err := r.CreateChainTunnelTx(tx, reverseID, "3", 5, sql.NullInt64{}, "round", 0, "tls", ""); err != nil {
+		t.Fatalf("create exit: %v", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	ports := []forwardPortRecord{{NodeID: 3, Port: 10022}}
+	if got := h.forwardServicePorts(reverseID, ports); len(got) != 1 || got[0].NodeID != 5 || got[0].Port != 10022 {
+		t.Fatalf("expected the exit node to run the services, got %+v", got)
+	}
+	if got := h.forwardServicePorts(directID, ports); got[0].NodeID != 3 {
+		t.Fatalf("expected a port forward to keep its entry node, got %+v", got)
+	}
+}
@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/store/model"
+)
+
+// forwardStatusScheduled marks a forward paused by its schedule. Manual and
+// quota pauses use status 0, which the schedule job never resumes.
+const forwardStatusScheduled = 2
+
+// cronSearchLimit bounds how far a cron expression is searched for a match,
+// so an expression that never fires (such as "0 0 31 2 *") terminates.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronExpr is a parsed five field cron expression: minute, hour, day of
+// month, month and day of week. Each field is a bit set of allowed values.
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronFieldBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// parseCron parses a five field cron expression. Fields accept *, single
+// values, ranges, comma lists and /step; day of week 7 is Sunday.
+func parseCron(s string) (*cronExpr, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("计划 %q 需为 5 段 cron 表达式（分 时 日 月 周）", s)
+	}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFieldBounds[i][0], cronFieldBounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("计划 %q 无效：%v", s, err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cronExpr{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("步长 %q 无效", stepStr)
+			}
+			step = n
+		}
+		first, last := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			n, err := strconv.Atoi(a)
+			if err != nil {
+				return 0, fmt.Errorf("取值 %q 无效", part)
+			}
+			first, last = n, n
+			if isRange {
+				if last, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("取值 %q 无效", part)
+				}
+			} else if hasStep {
+				last = hi
+			}
+		}
+		if first < lo || last > hi || first > last {
+			return 0, fmt.Errorf("取值 %q 超出 %d-%d", part, lo, hi)
+		}
+		for v := first; v <= last; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// dayMatches follows cron semantics: when both day of month and day of week
+// are restricted, a day matching either one matches.
+func (c *cronExpr) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first minute after t the expression fires at, or the
+// zero time when it does not fire within cronSearchLimit.
+func (c *cronExpr) next(t time.Time) time.Time {
+	limit := t.Add(cronSearchLimit)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// prev returns the last minute at or before t the expression fired at, or
+// the zero time when it did not fire within cronSearchLimit.
+func (c *cronExpr) prev(t time.Time) time.Time {
+	limit := t.Add(-cronSearchLimit)
+	t = t.Truncate(time.Minute)
+	for t.After(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Add(-time.Minute)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(-time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseSchedule reads a schedule from the on and off request fields,
+// falling back to def for fields that are absent.
+func parseSchedule(req map[string]interface{}, onKey, offKey string, def model.Schedule) (model.Schedule, error) {
+	s := def
+	if v, ok := req[onKey]; ok {
+		s.On = strings.Join(strings.Fields(asString(v)), " ")
+	}
+	if v, ok := req[offKey]; ok {
+		s.Off = strings.Join(strings.Fields(asString(v)), " ")
+	}
+	if s.On == "" && s.Off == "" {
+		return s, nil
+	}
+	if s.On == "" || s.Off == "" {
+		return s, errors.New("启用计划和停用计划需同时设置")
+	}
+	if _, err := parseCron(s.On); err != nil {
+		return s, err
+	}
+	if _, err := parseCron(s.Off); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// scheduleWindow is a parsed schedule. A nil window is always active.
+type scheduleWindow struct {
+	on, off *cronExpr
+}
+
+func compileSchedule(s model.Schedule) *scheduleWindow {
+	if s.On == "" || s.Off == "" {
+		return nil
+	}
+	on, err := parseCron(s.On)
+	if err != nil {
+		return nil
+	}
+	off, err := parseCron(s.Off)
+	if err != nil {
+		return nil
+	}
+	return &scheduleWindow{on: on, off: off}
+}
+
+// activeAt reports whether the window is open at t: the on expression fired
+// no earlier than the off expression. A window neither side ever fired in
+// is open.
+func (w *scheduleWindow) activeAt(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	return !w.on.prev(t).Before(w.off.prev(t))
+}
+
+// forwardSchedule is the combined schedule of a forward and its user
+// tunnel. The forward runs only while both windows are open.
+type forwardSchedule []*scheduleWindow
+
+func newForwardSchedule(schedules ...model.Schedule) forwardSchedule {
+	var fs forwardSchedule
+	for _, s := range schedules {
+		if w := compileSchedule(s); w != nil {
+			fs = append(fs, w)
+		}
+	}
+	return fs
+}
+
+func (fs forwardSchedule) activeAt(t time.Time) bool {
+	for _, w := range fs {
+		if !w.activeAt(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// nextTransition returns when the forward next switches between running
+// and paused after now, or the zero time when it never does.
+func (fs forwardSchedule) nextTransition(now time.Time) time.Time {
+	if len(fs) == 0 {
+		return time.Time{}
+	}
+	active := fs.activeAt(now)
+	t := now
+	for i := 0; i < 64; i++ {
+		var fire time.Time
+		for _, w := range fs {
+			for _, c := range []*cronExpr{w.on, w.off} {
+				if n := c.next(t); !n.IsZero() && (fire.IsZero() || n.Before(fire)) {
+					fire = n
+				}
+			}
+		}
+		if fire.IsZero() {
+			return time.Time{}
+		}
+		if fs.activeAt(fire) != active {
+			return fire
+		}
+		t = fire
+	}
+	return time.Time{}
+}
+
+// runForwardScheduleJob pauses forwards whose window has closed and resumes
+// schedule-paused forwards whose window has opened. A forward whose user or
+// user tunnel is over quota is not resumed but moved to the regular paused
+// status, the same as the flow policy would have done.
+func (h *Handler) runForwardScheduleJob(now time.Time) {
+	forwards, err := h.repo.ListScheduledForwards()
+	if err != nil {
+		return
+	}
+	nowMs := now.UnixMilli()
+	for _, f := range forwards {
+		active := newForwardSchedule(f.Schedule, f.TunnelSchedule).activeAt(now)
+		switch {
+		case f.Status == 1 && !active:
+			forward, err := h.getForwardRecord(f.ID)
+			if err != nil || forward == nil {
+				continue
+			}
+			if err := h.controlForwardServices(forward, "PauseService", false); err != nil {
+				continue
+			}
+			_, _ = h.repo.SwapForwardStatus(f.ID, 1, forwardStatusScheduled, nowMs)
+		case f.Status == forwardStatusScheduled && active:
+			if h.shouldPauseUser(f.UserID, nowMs) || h.userTunnelOverQuota(f.UserTunnelID, nowMs) {
+				_, _ = h.repo.SwapForwardStatus(f.ID, forwardStatusScheduled, 0, nowMs)
+				continue
+			}
+			forward, err := h.getForwardRecord(f.ID)
+			if err != nil || forward == nil {
+				continue
+			}
+			if err := h.controlForwardServices(forward, "ResumeService", false); err != nil {
+				continue
+			}
+			_, _ = h.repo.SwapForwardStatus(f.ID, forwardStatusScheduled, 1, nowMs)
+		}
+	}
+}
+
+func (h *Handler) userTunnelOverQuota(userTunnelID int64, now int64) bool {
+	policy, err := h.getUserTunnelPolicy(userTunnelID)
+	if err != nil {
+		return false
+	}
+	return shouldPauseUserTunnel(policy, now)
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestCronNextAndPrev(t *testing.T) {
+	saturday := time.Date(2026, 3, 14, 12, 0, 30, 0, time.UTC)
+
+	open, err := parseCron("0 9 * * 1-5")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got, want := open.next(saturday), time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected next weekday open at %v, got %v", want, got)
+	}
+	if got, want := open.prev(saturday), time.Date(2026, 3, 13, 9, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected previous open at %v, got %v", want, got)
+	}
+
+	every, err := parseCron("*/15 8-10 1,15 * 7")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	// Day of month and day of week are both restricted, so Sunday the 15th
+	// and any Sunday match.
+	if got, want := every.next(saturday), time.Date(2026, 3, 15, 8, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	never, err := parseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !never.next(saturday).IsZero() || !never.prev(saturday).IsZero() {
+		t.Fatalf("expected an impossible date to never fire")
+	}
+
+	for _, expr := range []string{"* * *", "60 * * * *", "0 9 * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Fatalf("expected %q to be rejected", expr)
+		}
+	}
+}
+
+func TestParseScheduleRequiresBothSides(t *testing.T) {
+	s, err := parseSchedule(map[string]interface{}{"scheduleOn": " 0  9 * * 1-5 ", "scheduleOff": "0 18 * * 1-5"}, "scheduleOn", "scheduleOff", model.Schedule{})
+	if err != nil || s.On != "0 9 * * 1-5" {
+		t.Fatalf("expected a normalized schedule, got %+v (%v)", s, err)
+	}
+	if kept, err := parseSchedule(map[string]interface{}{}, "scheduleOn", "scheduleOff", s); err != nil || kept != s {
+		t.Fatalf("expected absent fields to be kept, got %+v (%v)", kept, err)
+	}
+	if cleared, err := parseSchedule(map[string]interface{}{"scheduleOn": "", "scheduleOff": ""}, "scheduleOn", "scheduleOff", s); err != nil || cleared != (model.Schedule{}) {
+		t.Fatalf("expected the schedule to be cleared, got %+v (%v)", cleared, err)
+	}
+	if _, err := parseSchedule(map[string]interface{}{"scheduleOn": "0 9 * * *"}, "scheduleOn", "scheduleOff", model.Schedule{}); err == nil {
+		t.Fatalf("expected a schedule without an off expression to be rejected")
+	}
+}
+
+func TestForwardScheduleNextTransition(t *testing.T) {
+	saturday := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	schedule := newForwardSchedule(
+		model.Schedule{On: "0 9 * * 1-5", Off: "0 18 * * 1-5"},
+		model.Schedule{On: "0 10 * * *", Off: "0 17 * * *"},
+	)
+	if schedule.activeAt(saturday) {
+		t.Fatalf("expected the forward to be off on a weekend")
+	}
+	// The forward window opens at 09:00 but the user tunnel window only at
+	// 10:00, so that is when the forward starts.
+	if got, want := schedule.nextTransition(saturday), time.Date(2026, 3, 16, 10, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected next transition at %v, got %v", want, got)
+	}
+	monday := time.Date(2026, 3, 16, 11, 0, 0, 0, time.UTC)
+	if got, want := schedule.nextTransition(monday), time.Date(2026, 3, 16, 17, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected next transition at %v, got %v", want, got)
+	}
+	if !newForwardSchedule(model.Schedule{}).nextTransition(saturday).IsZero() {
+		t.Fatalf("expected an unscheduled forward to have no transition")
+	}
+}
+
+func TestForwardScheduleJobRespectsManualAndQuotaPauses(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "schedule.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	h := New(r, "secret")
+	saturday := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	nowMs := saturday.UnixMilli()
+	future := saturday.Add(30 * 24 * time.Hour).UnixMilli()
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if err := r.DB().Exec(query, args...).Error; err != nil {
+			t.Fatalf("exec %q: %v", query, err)
+		}
+	}
+	exec(`INSERT INTO user(id, user, pwd, role_id, exp_time, flow, in_flow, out_flow, flow_reset_time, num, created_time, updated_time, status)
+		VALUES(2, 'ok', 'x', 1, ?, 100, 0, 0, 1, 10, ?, ?, 1), (3, 'over', 'x', 1, ?, 1, 2147483648, 0, 1, 10, ?, ?, 1)`,
+		future, nowMs, nowMs, future, nowMs, nowMs)
+	exec(`INSERT INTO tunnel(id, name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, in_ip, inx)
+		VALUES(1, 't1', 1.0, 1, 'tls', 1, ?, ?, 1, NULL, 0)`, nowMs, nowMs)
+	exec(`INSERT INTO user_tunnel(id, user_id, tunnel_id, speed_id, num, flow, in_flow, out_flow, flow_reset_time, exp_time, status)
+		VALUES(10, 2, 1, NULL, 10, 100, 0, 0, 1, ?, 1), (11, 3, 1, NULL, 10, 100, 0, 0, 1, ?, 1)`, future, future)
+
+	insertForward := func(id, userID int64, status int, on, off string) {
+		t.Helper()
+		exec(`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, in_flow, out_flow, created_time, updated_time, status, inx, schedule_on, schedule_off)
+			VALUES(?, ?, 'u', 'f', 1, '1.1.1.1:443', 'fifo', 0, 0, ?, ?, ?, 0, ?, ?)`, id, userID, nowMs, nowMs, status, on, off)
+	}
+	insertForward(30, 2, 1, "0 9 * * 1-5", "0 18 * * 1-5")
+	insertForward(31, 2, forwardStatusScheduled, "0 9 * * *", "0 18 * * *")
+	insertForward(32, 3, forwardStatusScheduled, "0 9 * * *", "0 18 * * *")
+	insertForward(33, 2, 0, "0 9 * * 1-5", "0 18 * * 1-5")
+	insertForward(34, 2, 0, "0 9 * * *", "0 18 * * *")
+
+	h.runForwardScheduleJob(saturday)
+
+	for id, want := range map[int64]int{
+		30: forwardStatusScheduled, // window closed
+		31: 1,                      // window open
+		32: 0,                      // window open but the user is over quota
+		33: 0,                      // manual pause is left alone
+		34: 0,
+	} {
+		if got := mustQueryInt(t, r, `SELECT status FROM forward WHERE id = ?`, id); got != want {
+			t.Fatalf("forward %d: expected status %d, got %d", id, want, got)
+		}
+	}
+
+	exec(`UPDATE user_tunnel SET schedule_on = '0 0 * * 1', schedule_off = '0 0 * * 6' WHERE id = 10`)
+	h.runForwardScheduleJob(saturday.Add(time.Minute))
+	if got := mustQueryInt(t, r, `SELECT status FROM forward WHERE id = 31`); got != forwardStatusScheduled {
+		t.Fatalf("expected the user tunnel schedule to pause forward 31, got status %d", got)
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// maxSNIHosts caps the hostnames of one shared port forward.
+const maxSNIHosts = 32
+
+// parseSNIHosts normalizes the hostnames a shared port forward is routed
+// by. Hostnames are separated by commas or whitespace and may start with a
+// "*." wildcard label. An empty result means the forward owns its port.
+func parseSNIHosts(v interface{}) (string, error) {
+	fields := strings.FieldsFunc(asString(v), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+	hosts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		host := strings.TrimSuffix(strings.ToLower(field), ".")
+		if !validSNIHost(host) {
+			return "", fmt.Errorf("域名 %q 无效", field)
+		}
+		if !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) > maxSNIHosts {
+		return "", fmt.Errorf("共享端口转发最多 %d 个域名", maxSNIHosts)
+	}
+	return strings.Join(hosts, ","), nil
+}
+
+func validSNIHost(host string) bool {
+	host = strings.TrimPrefix(host, "*.")
+	if host == "" || len(host) > 253 || !strings.Contains(host, ".") {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func splitSNIHosts(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// validateSNIForward checks the options a shared port forward cannot use.
+// The agent routes by reading the start of each TCP stream, so the forward
+// is TCP only, serves a single port and cannot accept a PROXY header.
+func validateSNIForward(sniHosts, protocol string, portCount, proxyIn int) error {
+	if sniHosts == "" {
+		return nil
+	}
+	if protocol != "tcp" {
+		return errors.New("按域名共享端口的转发只支持 TCP 协议")
+	}
+	if portCount > 1 {
+		return errors.New("按域名共享端口的转发不能使用端口段")
+	}
+	if proxyIn > 0 {
+		return errors.New("按域名共享端口的转发不能接收入口 PROXY 协议")
+	}
+	return nil
+}
+
+// checkSharedPort makes sure a forward can listen on port of every entry
+// node: a shared port forward only next to other shared port forwards with
+// different hostnames, and a regular TCP forward never on a shared port.
+// Forwards bound to different addresses of a node do not share a port.
+func (h *Handler) checkSharedPort(forwardID int64, entryNodes []int64, port int, protocol, listenIP, sniHosts string) error {
+	if port <= 0 || !slices.Contains(forwardServiceProtocols(protocol), "tcp") {
+		return nil
+	}
+	hosts := splitSNIHosts(sniHosts)
+	for _, nodeID := range entryNodes {
+		others, err := h.repo.ListTCPForwardsOnNodePort(nodeID, port, listenIP, forwardID)
+		if err != nil {
+			return err
+		}
+		for _, other := range others {
+			otherHosts := splitSNIHosts(other.SNIHosts)
+			switch {
+			case len(hosts) > 0 && len(otherHosts) == 0:
+				return fmt.Errorf("端口 %d 已被转发「%s」独占，无法按域名共享", port, other.Name)
+			case len(hosts) == 0 && len(otherHosts) > 0:
+				return fmt.Errorf("端口 %d 已用于按域名共享的转发，请填写域名", port)
+			}
+			for _, host := range hosts {
+				if slices.Contains(otherHosts, host) {
+					return fmt.Errorf("域名 %s 已被同一入口端口上的转发「%s」使用", host, other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
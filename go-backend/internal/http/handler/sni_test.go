@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestParseSNIHosts(t *testing.T) {
+	got, err := parseSNIHosts("A.example.com, *.b.example.com\napi.example.com. a.example.com")
+	if err != nil || got != "a.example.com,*.b.example.com,api.example.com" {
+		t.Fatalf("unexpected hosts %q (%v)", got, err)
+	}
+	if got, err := parseSNIHosts(""); err != nil || got != "" {
+		t.Fatalf("expected no hosts, got %q (%v)", got, err)
+	}
+	for _, bad := range []string{"localhost", "a..example.com", "-a.example.com", "a_b.example.com", "*.", "a.*.example.com"} {
+		if _, err := parseSNIHosts(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+	many := make([]string, maxSNIHosts+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("h%d.example.com", i)
+	}
+	if _, err := parseSNIHosts(strings.Join(many, ",")); err == nil {
+		t.Fatalf("expected too many hosts to be rejected")
+	}
+
+	if err := validateSNIForward("a.example.com", "tcp+udp", 0, 0); err == nil {
+		t.Fatalf("expected udp to be rejected")
+	}
+	if err := validateSNIForward("a.example.com", "tcp", 0, 1); err == nil {
+		t.Fatalf("expected an entry PROXY header to be rejected")
+	}
+	if err := validateSNIForward("a.example.com", "tcp", 0, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSNIForwardUsesSharedListener(t *testing.T) {
+	forward := &forwardRecord{ID: 4, UserID: 5, TunnelID: 2, RemoteAddr: "10.0.0.1:443", Protocol: "tcp", SNIHosts: "a.example.com,*.b.example.com"}
+	node := &nodeRecord{ID: 3, TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+
+	services := buildForwardServiceConfigs("4_5_7", forward, nil, node, 443, "", "", false)
+	if len(services) != 1 {
+		t.Fatalf("expected a single tcp service, got %d", len(services))
+	}
+	svc := services[0]
+	if svc["name"] != "4_5_7_tcp" || svc["addr"] != "[::]:443" {
+		t.Fatalf("unexpected service %v at %v", svc["name"], svc["addr"])
+	}
+	ln := svc["listener"].(map[string]interface{})
+	if ln["type"] != "sni" {
+		t.Fatalf("expected the sni listener, got %v", ln["type"])
+	}
+	hosts := ln["metadata"].(map[string]interface{})["sni.hosts"]
+	if !reflect.DeepEqual(hosts, []string{"a.example.com", "*.b.example.com"}) {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+}
+
+func TestSharedPortRequiresDistinctHosts(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "sni.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	now := time.Now().UnixMilli()
+	create := func(name, protocol, hosts string, port int) int64 {
+		t.Helper()
+		id, err := r.CreateForwardTx(model.ForwardRecord{UserID: 1, UserName: "admin", Name: name, TunnelID: 1, RemoteAddr: "10.0.0.1:443", Strategy: "fifo", Protocol: protocol, SNIHosts: hosts}, now, 0, []int64{7}, port)
+		if err != nil {
+			t.Fatalf("create forward: %v", err)
+		}
+		return id
+	}
+	shared := create("a", "tcp", "a.example.com", 443)
+	create("dns", "udp", "", 443)
+	create("plain", "tcp", "", 8443)
+
+	if err := h.checkSharedPort(0, []int64{7}, 443, "tcp", "", "b.example.com"); err != nil {
+		t.Fatalf("expected a new host to share the port: %v", err)
+	}
+	if err := h.checkSharedPort(0, []int64{7}, 443, "tcp", "", "b.example.com,a.example.com"); err == nil {
+		t.Fatalf("expected a duplicate host on the same port to be rejected")
+	}
+	if err := h.checkSharedPort(shared, []int64{7}, 443, "tcp", "", "a.example.com"); err != nil {
+		t.Fatalf("expected a forward to keep its own hosts: %v", err)
+	}
+	if err := h.checkSharedPort(0, []int64{8}, 443, "tcp", "", "a.example.com"); err != nil {
+		t.Fatalf("expected hosts to be unique per node only: %v", err)
+	}
+	if err := h.checkSharedPort(0, []int64{7}, 443, "tcp", "", ""); err == nil {
+		t.Fatalf("expected a regular forward on a shared port to be rejected")
+	}
+	if err := h.checkSharedPort(0, []int64{7}, 8443, "tcp", "", "a.example.com"); err == nil {
+		t.Fatalf("expected a shared forward on a regular forward's port to be rejected")
+	}
+	if err := h.checkSharedPort(0, []int64{7}, 443, "udp", "", ""); err != nil {
+		t.Fatalf("expected a udp forward to ignore tcp sharing: %v", err)
+	}
+}
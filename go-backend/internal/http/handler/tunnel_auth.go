@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-backend/internal/http/response"
+)
+
+// The relay services a tunnel runs on its chain, exit and (for reverse
+// tunnels) entry nodes only serve clients that present the tunnel's
+// credentials, so a discovered port cannot be used as an open relay. The
+// credentials are derived only from a per-tunnel secret stored on the
+// tunnel, so changing the panel's session secret does not break running
+// relays; replacing the tunnel secret rotates them.
+
+// tunnelRelayAuth derives the credentials of a tunnel's relay services.
+func tunnelRelayAuth(tunnelID int64, secret string) (string, string) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("tunnel-relay:" + strconv.FormatInt(tunnelID, 10)))
+	return fmt.Sprintf("t%d", tunnelID), hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// loadTunnelRelayAuth fills in the relay credentials of state. Tunnels
+// created before relay authentication get their secret here, on their next
+// deployment.
+func (h *Handler) loadTunnelRelayAuth(state *tunnelCreateState) error {
+	secret, err := h.repo.EnsureTunnelRelaySecret(state.TunnelID, randomToken(16))
+	if err != nil {
+		return err
+	}
+	state.RelayUsername, state.RelayPassword = tunnelRelayAuth(state.TunnelID, secret)
+	return nil
+}
+
+func relayAuthConfig(username, password string) map[string]interface{} {
+	return map[string]interface{}{
+		"username": username,
+		"password": password,
+	}
+}
+
+// setRelayServiceAuth makes the relay services accept only the given
+// credentials. Without a username the services are left open.
+func setRelayServiceAuth(services []map[string]interface{}, username, password string) {
+	if username == "" {
+		return
+	}
+	for _, service := range services {
+		service["handler"].(map[string]interface{})["auth"] = relayAuthConfig(username, password)
+	}
+}
+
+// setRelayChainAuth makes every node of chain present the given
+// credentials to the relay service it dials.
+func setRelayChainAuth(chain map[string]interface{}, username, password string) {
+	if username == "" {
+		return
+	}
+	for _, hop := range chain["hops"].([]map[string]interface{}) {
+		for _, node := range hop["nodes"].([]map[string]interface{}) {
+			node["connector"].(map[string]interface{})["auth"] = relayAuthConfig(username, password)
+		}
+	}
+}
+
+// hasRemoteRelayNode reports whether a hop contains a remote node. Its
+// chain is built by the remote panel, which does not know the tunnel's
+// credentials, so the hop after it has to stay open.
+func hasRemoteRelayNode(hop []tunnelRuntimeNode, nodes map[int64]*nodeRecord) bool {
+	for _, n := range hop {
+		if node := nodes[n.NodeID]; node != nil && node.IsRemote == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// tunnelBatchRotateAuth replaces the relay credentials of the given
+// tunnels and redeploys them, so both ends switch over together. Every
+// relay service restarts, which drops the tunnel's live connections.
+func (h *Handler) tunnelBatchRotateAuth(w http.ResponseWriter, r *http.Request) {
+	ids := idsFromBody(r, w)
+	if ids == nil {
+		return
+	}
+	success := 0
+	fail := 0
+	for _, tunnelID := range ids {
+		if h.rotateTunnelRelayAuth(tunnelID) {
+			success++
+		} else {
+			fail++
+		}
+	}
+	response.WriteJSON(w, response.OK(map[string]interface{}{"successCount": success, "failCount": fail}))
+}
+
+// rotateTunnelRelayAuth redeploys a tunnel with a new relay secret. When the
+// redeploy fails part of the nodes may still run the old credentials, so the
+// old secret is restored and deployed again to keep both ends in step.
+func (h *Handler) rotateTunnelRelayAuth(tunnelID int64) bool {
+	tunnel, err := h.getTunnelRecord(tunnelID)
+	if err != nil || (tunnel.Type != 2 && tunnel.Type != 3) {
+		return false
+	}
+	oldSecret, err := h.repo.EnsureTunnelRelaySecret(tunnelID, randomToken(16))
+	if err != nil {
+		return false
+	}
+	if err := h.repo.UpdateTunnelRelaySecret(tunnelID, randomToken(16), time.Now().UnixMilli()); err != nil {
+		return false
+	}
+	if h.redeployTunnel(tunnelID) {
+		return true
+	}
+	if err := h.repo.UpdateTunnelRelaySecret(tunnelID, oldSecret, time.Now().UnixMilli()); err != nil {
+		log.Printf("restore tunnel relay secret failed: tunnel=%d: %v", tunnelID, err)
+		return false
+	}
+	h.redeployTunnel(tunnelID)
+	return false
+}
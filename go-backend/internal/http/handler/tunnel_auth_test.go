@@ -0,0 +1,46 @@
+package handler
+
+import "testing"
+
+func TestTunnelRelayAuthConfigs(t *testing.T) {
+	username, password := tunnelRelayAuth(9, "s1")
+
+	hop := tunnelRuntimeNode{NodeID: 2, Protocol: "tls", ChainType: 2, Port: 30000}
+	exit := tunnelRuntimeNode{NodeID: 3, Protocol: "tls", ChainType: 3, Port: 31000}
+	nodes := map[int64]*nodeRecord{
+		1: {ID: 1, ServerIP: "10.0.0.1", ServerIPv4: "10.0.0.1", TCPListenAddr: "[::]"},
+		2: {ID: 2, ServerIP: "10.0.0.2", ServerIPv4: "10.0.0.2", TCPListenAddr: "[::]"},
+		3: {ID: 3, ServerIP: "10.0.0.3", ServerIPv4: "10.0.0.3", TCPListenAddr: "[::]"},
+	}
+
+	chain, err := buildTunnelChainConfig(9, 1, []tunnelRuntimeNode{hop}, nodes, "")
+	if err != nil {
+		t.Fatalf("build chain: %v", err)
+	}
+	setRelayChainAuth(chain, username, password)
+	services := buildTunnelChainServiceConfig(9, hop, nodes[2])
+	setRelayServiceAuth(services, username, password)
+
+	connector := chain["hops"].([]map[string]interface{})[0]["nodes"].([]map[string]interface{})[0]["connector"].(map[string]interface{})
+	handlerCfg := services[0]["handler"].(map[string]interface{})
+	if connector["auth"] == nil || connector["auth"].(map[string]interface{})["password"] != password {
+		t.Fatalf("expected the chain to carry the tunnel credentials, got %v", connector)
+	}
+	if handlerCfg["auth"] == nil || handlerCfg["auth"].(map[string]interface{})["username"] != username {
+		t.Fatalf("expected the relay service to require the tunnel credentials, got %v", handlerCfg)
+	}
+
+	open := buildTunnelChainServiceConfig(9, exit, nodes[3])
+	setRelayServiceAuth(open, "", "")
+	if _, ok := open[0]["handler"].(map[string]interface{})["auth"]; ok {
+		t.Fatalf("expected a service without credentials to stay open")
+	}
+
+	if hasRemoteRelayNode([]tunnelRuntimeNode{hop}, nodes) {
+		t.Fatalf("unexpected remote node")
+	}
+	nodes[2].IsRemote = 1
+	if !hasRemoteRelayNode([]tunnelRuntimeNode{hop}, nodes) {
+		t.Fatalf("expected the remote hop to be detected")
+	}
+}
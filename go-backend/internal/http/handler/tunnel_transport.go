@@ -0,0 +1,453 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// tunnelTransport lists what a tunnel protocol can be tuned with. The same
+// protocol and options build the dialer of the node reaching a hop and the
+// listener of the hop itself, so both ends always agree.
+type tunnelTransport struct {
+	tls       bool // SNI and ALPN
+	path      bool
+	host      bool
+	keepalive bool
+	mux       bool
+	kcp       bool
+	udp       bool // runs over UDP, so a TCP probe cannot reach it
+}
+
+var tunnelTransports = map[string]tunnelTransport{
+	"tls":   {tls: true},
+	"tcp":   {},
+	"mtls":  {tls: true, mux: true},
+	"mtcp":  {mux: true},
+	"ws":    {path: true, host: true, keepalive: true},
+	"wss":   {tls: true, path: true, host: true, keepalive: true},
+	"mws":   {path: true, host: true, mux: true},
+	"mwss":  {tls: true, path: true, host: true, mux: true},
+	"grpc":  {tls: true, path: true, host: true, keepalive: true},
+	"h2":    {tls: true, path: true, host: true},
+	"ohttp": {host: true},
+	"otls":  {host: true},
+	"kcp":   {kcp: true, udp: true, keepalive: true},
+	"quic":  {tls: true, udp: true, keepalive: true},
+}
+
+const (
+	maxTransportKeepalive = 3600
+	maxTransportALPN      = 4
+	maxMuxBuffer          = 64 << 20
+)
+
+var kcpModes = []string{"normal", "fast", "fast2", "fast3"}
+
+var kcpCrypts = []string{"aes", "aes-128", "aes-192", "salsa20", "blowfish", "twofish", "cast5", "3des", "tea", "xtea", "xor", "sm4", "none"}
+
+// tunnelTransportOptions are the per-hop settings of a tunnel protocol.
+// Durations are in seconds and zero keeps the agent default.
+type tunnelTransportOptions struct {
+	Path      string            `json:"path,omitempty"`
+	Host      string            `json:"host,omitempty"`
+	SNI       string            `json:"sni,omitempty"`
+	ALPN      []string          `json:"alpn,omitempty"`
+	Keepalive int               `json:"keepalive,omitempty"`
+	Mux       *tunnelMuxOptions `json:"mux,omitempty"`
+	KCP       *tunnelKCPOptions `json:"kcp,omitempty"`
+}
+
+type tunnelMuxOptions struct {
+	Version           int `json:"version,omitempty"`
+	KeepaliveInterval int `json:"keepaliveInterval,omitempty"`
+	KeepaliveTimeout  int `json:"keepaliveTimeout,omitempty"`
+	MaxFrameSize      int `json:"maxFrameSize,omitempty"`
+	MaxReceiveBuffer  int `json:"maxReceiveBuffer,omitempty"`
+	MaxStreamBuffer   int `json:"maxStreamBuffer,omitempty"`
+}
+
+type tunnelKCPOptions struct {
+	Mode   string `json:"mode,omitempty"`
+	Crypt  string `json:"crypt,omitempty"`
+	Key    string `json:"key,omitempty"`
+	MTU    int    `json:"mtu,omitempty"`
+	SndWnd int    `json:"sndwnd,omitempty"`
+	RcvWnd int    `json:"rcvwnd,omitempty"`
+	NoComp bool   `json:"nocomp,omitempty"`
+}
+
+func (o tunnelTransportOptions) isZero() bool {
+	return o.Path == "" && o.Host == "" && o.SNI == "" && len(o.ALPN) == 0 &&
+		o.Keepalive == 0 && o.Mux == nil && o.KCP == nil
+}
+
+// parseTunnelTransportItem validates the protocol and options of a tunnel
+// node item and writes the normalized values back, so the chain rows saved
+// afterwards match the config the nodes were given.
+func parseTunnelTransportItem(item map[string]interface{}) (string, tunnelTransportOptions, error) {
+	protocol := strings.ToLower(defaultString(asString(item["protocol"]), "tls"))
+	if _, ok := tunnelTransports[protocol]; !ok {
+		return "", tunnelTransportOptions{}, fmt.Errorf("不支持的隧道协议 %s", protocol)
+	}
+	opts, err := parseTunnelTransportOptions(item["options"])
+	if err != nil {
+		return "", tunnelTransportOptions{}, err
+	}
+	if err := opts.validate(protocol); err != nil {
+		return "", tunnelTransportOptions{}, err
+	}
+	item["protocol"] = protocol
+	item["options"] = encodeTunnelTransportOptions(opts)
+	return protocol, opts, nil
+}
+
+// parseTunnelTransportOptions accepts the options as an object from a
+// request or as the JSON text stored on a chain row.
+func parseTunnelTransportOptions(v interface{}) (tunnelTransportOptions, error) {
+	var opts tunnelTransportOptions
+	var raw []byte
+	switch val := v.(type) {
+	case nil:
+		return opts, nil
+	case string:
+		if strings.TrimSpace(val) == "" {
+			return opts, nil
+		}
+		raw = []byte(val)
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return opts, errors.New("传输参数格式错误")
+		}
+		raw = b
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&opts); err != nil {
+		return opts, errors.New("传输参数格式错误")
+	}
+	return opts, nil
+}
+
+// decodeTunnelTransportOptions reads stored options, which were validated
+// when saved.
+func decodeTunnelTransportOptions(s string) tunnelTransportOptions {
+	opts, _ := parseTunnelTransportOptions(s)
+	return opts
+}
+
+func encodeTunnelTransportOptions(opts tunnelTransportOptions) string {
+	if opts.isZero() {
+		return ""
+	}
+	b, _ := json.Marshal(opts)
+	return string(b)
+}
+
+func (o *tunnelTransportOptions) validate(protocol string) error {
+	t := tunnelTransports[protocol]
+
+	o.Path = strings.TrimSpace(o.Path)
+	if o.Path != "" {
+		if !t.path {
+			return fmt.Errorf("协议 %s 不支持设置路径", protocol)
+		}
+		if !strings.HasPrefix(o.Path, "/") || len(o.Path) > 128 || strings.ContainsAny(o.Path, " \t?#") {
+			return errors.New("路径须以 / 开头，不含空格、? 或 #，且不超过 128 个字符")
+		}
+	}
+
+	o.Host = strings.ToLower(strings.TrimSpace(o.Host))
+	if o.Host != "" {
+		if !t.host {
+			return fmt.Errorf("协议 %s 不支持设置 Host", protocol)
+		}
+		if strings.HasPrefix(o.Host, "*") || !validSNIHost(o.Host) {
+			return fmt.Errorf("Host %q 无效", o.Host)
+		}
+	}
+
+	o.SNI = strings.ToLower(strings.TrimSpace(o.SNI))
+	if o.SNI != "" {
+		if !t.tls {
+			return fmt.Errorf("协议 %s 不使用 TLS，不能设置 SNI", protocol)
+		}
+		if strings.HasPrefix(o.SNI, "*") || !validSNIHost(o.SNI) {
+			return fmt.Errorf("SNI %q 无效", o.SNI)
+		}
+	}
+
+	alpn := make([]string, 0, len(o.ALPN))
+	for _, p := range o.ALPN {
+		if p = strings.TrimSpace(p); p != "" && !slices.Contains(alpn, p) {
+			alpn = append(alpn, p)
+		}
+	}
+	o.ALPN = nil
+	if len(alpn) > 0 {
+		if !t.tls {
+			return fmt.Errorf("协议 %s 不使用 TLS，不能设置 ALPN", protocol)
+		}
+		if len(alpn) > maxTransportALPN {
+			return fmt.Errorf("ALPN 最多 %d 项", maxTransportALPN)
+		}
+		for _, p := range alpn {
+			if len(p) > 32 || strings.ContainsAny(p, " \t,") {
+				return fmt.Errorf("ALPN %q 无效", p)
+			}
+		}
+		o.ALPN = alpn
+	}
+
+	if o.Keepalive < 0 || o.Keepalive > maxTransportKeepalive {
+		return fmt.Errorf("保活间隔须在 0-%d 秒之间", maxTransportKeepalive)
+	}
+	if o.Keepalive > 0 && !t.keepalive {
+		if t.mux {
+			return fmt.Errorf("协议 %s 的保活在多路复用参数中设置", protocol)
+		}
+		return fmt.Errorf("协议 %s 不支持设置保活", protocol)
+	}
+
+	if o.Mux != nil && *o.Mux == (tunnelMuxOptions{}) {
+		o.Mux = nil
+	}
+	if o.Mux != nil {
+		if !t.mux {
+			return fmt.Errorf("协议 %s 不是多路复用协议", protocol)
+		}
+		if err := o.Mux.validate(); err != nil {
+			return err
+		}
+	}
+
+	if o.KCP != nil {
+		o.KCP.Mode = strings.ToLower(strings.TrimSpace(o.KCP.Mode))
+		o.KCP.Crypt = strings.ToLower(strings.TrimSpace(o.KCP.Crypt))
+		if *o.KCP == (tunnelKCPOptions{}) {
+			o.KCP = nil
+		}
+	}
+	if o.KCP != nil {
+		if !t.kcp {
+			return fmt.Errorf("协议 %s 不能设置 KCP 参数", protocol)
+		}
+		if err := o.KCP.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *tunnelMuxOptions) validate() error {
+	if m.Version != 0 && m.Version != 1 && m.Version != 2 {
+		return errors.New("多路复用版本只能是 1 或 2")
+	}
+	if m.KeepaliveInterval < 0 || m.KeepaliveInterval > maxTransportKeepalive ||
+		m.KeepaliveTimeout < 0 || m.KeepaliveTimeout > maxTransportKeepalive {
+		return fmt.Errorf("多路复用保活时间须在 0-%d 秒之间", maxTransportKeepalive)
+	}
+	if m.KeepaliveInterval > 0 && m.KeepaliveTimeout > 0 && m.KeepaliveTimeout <= m.KeepaliveInterval {
+		return errors.New("多路复用保活超时须大于保活间隔")
+	}
+	if m.MaxFrameSize < 0 || m.MaxFrameSize > 65535 {
+		return errors.New("多路复用最大帧须在 0-65535 字节之间")
+	}
+	if m.MaxReceiveBuffer < 0 || m.MaxReceiveBuffer > maxMuxBuffer ||
+		m.MaxStreamBuffer < 0 || m.MaxStreamBuffer > maxMuxBuffer {
+		return fmt.Errorf("多路复用缓冲区不能超过 %d 字节", maxMuxBuffer)
+	}
+	if m.MaxReceiveBuffer > 0 && m.MaxStreamBuffer > m.MaxReceiveBuffer {
+		return errors.New("多路复用单流缓冲区不能大于总接收缓冲区")
+	}
+	return nil
+}
+
+func (k *tunnelKCPOptions) validate() error {
+	if k.Mode != "" && !slices.Contains(kcpModes, k.Mode) {
+		return fmt.Errorf("KCP 模式只能是 %s", strings.Join(kcpModes, "、"))
+	}
+	if k.Crypt != "" && !slices.Contains(kcpCrypts, k.Crypt) {
+		return fmt.Errorf("KCP 加密方式 %s 不支持", k.Crypt)
+	}
+	if len(k.Key) > 64 {
+		return errors.New("KCP 密钥不能超过 64 个字符")
+	}
+	if k.MTU != 0 && (k.MTU < 576 || k.MTU > 1500) {
+		return errors.New("KCP MTU 须在 576-1500 之间")
+	}
+	if k.SndWnd < 0 || k.SndWnd > 65535 || k.RcvWnd < 0 || k.RcvWnd > 65535 {
+		return errors.New("KCP 窗口须在 0-65535 之间")
+	}
+	return nil
+}
+
+// validateRemoteTunnelTransport rejects transport options on a tunnel with
+// remote nodes. A remote panel builds its side from the protocol alone, so
+// its ends could not match the options.
+func validateRemoteTunnelTransport(state *tunnelCreateState) error {
+	remote := false
+	for _, node := range state.Nodes {
+		if node != nil && node.IsRemote == 1 {
+			remote = true
+			break
+		}
+	}
+	if !remote {
+		return nil
+	}
+	groups := append([][]tunnelRuntimeNode{state.InNodes, state.OutNodes}, state.ChainHops...)
+	for _, group := range groups {
+		for _, n := range group {
+			if !n.Options.isZero() {
+				return errors.New("包含远程节点的隧道不支持自定义传输参数")
+			}
+		}
+	}
+	return nil
+}
+
+// tunnelTransportMetadata is the agent metadata shared by both ends of a
+// hop. Keys only the dialing side reads, such as the Host header, are
+// included for the dialer only. Numbers are sent as strings, the form the
+// agent's metadata helpers parse after JSON decoding.
+func tunnelTransportMetadata(protocol string, opts tunnelTransportOptions, dialer bool) map[string]interface{} {
+	md := map[string]interface{}{}
+	switch protocol {
+	case "ws", "wss", "mws", "mwss":
+		if opts.Path != "" {
+			md["ws.path"] = opts.Path
+		}
+		if dialer && opts.Host != "" {
+			md["ws.host"] = opts.Host
+		}
+		if opts.Keepalive > 0 {
+			md["ws.keepalive"] = true
+			md["ttl"] = fmt.Sprintf("%ds", opts.Keepalive)
+		}
+	case "grpc":
+		if opts.Path != "" {
+			md["grpc.path"] = opts.Path
+		}
+		if dialer && opts.Host != "" {
+			md["grpc.authority"] = opts.Host
+		}
+		if opts.Keepalive > 0 {
+			md["grpc.keepalive"] = true
+			md["grpc.keepalive.time"] = fmt.Sprintf("%ds", opts.Keepalive)
+		}
+	case "h2":
+		if opts.Path != "" {
+			md["path"] = opts.Path
+		}
+		if dialer && opts.Host != "" {
+			md["host"] = opts.Host
+		}
+	case "ohttp", "otls":
+		if dialer && opts.Host != "" {
+			md["host"] = opts.Host
+		}
+	case "quic":
+		if opts.Keepalive > 0 {
+			md["keepAlive"] = true
+			md["ttl"] = fmt.Sprintf("%ds", opts.Keepalive)
+		}
+	case "kcp":
+		if opts.Keepalive > 0 {
+			md["kcp.keepalive"] = strconv.Itoa(opts.Keepalive)
+		}
+	}
+
+	if m := opts.Mux; m != nil {
+		if m.Version > 0 {
+			md["mux.version"] = strconv.Itoa(m.Version)
+		}
+		if m.KeepaliveInterval > 0 {
+			md["mux.keepaliveInterval"] = fmt.Sprintf("%ds", m.KeepaliveInterval)
+		}
+		if m.KeepaliveTimeout > 0 {
+			md["mux.keepaliveTimeout"] = fmt.Sprintf("%ds", m.KeepaliveTimeout)
+		}
+		if m.MaxFrameSize > 0 {
+			md["mux.maxFrameSize"] = strconv.Itoa(m.MaxFrameSize)
+		}
+		if m.MaxReceiveBuffer > 0 {
+			md["mux.maxReceiveBuffer"] = strconv.Itoa(m.MaxReceiveBuffer)
+		}
+		if m.MaxStreamBuffer > 0 {
+			md["mux.maxStreamBuffer"] = strconv.Itoa(m.MaxStreamBuffer)
+		}
+	}
+
+	if k := opts.KCP; k != nil {
+		if k.Mode != "" {
+			md["kcp.mode"] = k.Mode
+		}
+		if k.Crypt != "" {
+			md["kcp.crypt"] = k.Crypt
+		}
+		if k.Key != "" {
+			md["kcp.key"] = k.Key
+		}
+		if k.MTU > 0 {
+			md["kcp.mtu"] = strconv.Itoa(k.MTU)
+		}
+		if k.SndWnd > 0 {
+			md["kcp.sndwnd"] = strconv.Itoa(k.SndWnd)
+		}
+		if k.RcvWnd > 0 {
+			md["kcp.rcvwnd"] = strconv.Itoa(k.RcvWnd)
+		}
+		if k.NoComp {
+			md["kcp.nocomp"] = true
+		}
+	}
+	return md
+}
+
+// tunnelDialerConfig is the dialer a node uses to reach a hop.
+func tunnelDialerConfig(protocol string, opts tunnelTransportOptions) map[string]interface{} {
+	dialer := map[string]interface{}{
+		"type": protocol,
+	}
+	if md := tunnelTransportMetadata(protocol, opts, true); len(md) > 0 {
+		dialer["metadata"] = md
+	}
+	if opts.SNI != "" || len(opts.ALPN) > 0 {
+		tlsCfg := map[string]interface{}{}
+		if opts.SNI != "" {
+			tlsCfg["serverName"] = opts.SNI
+		}
+		if len(opts.ALPN) > 0 {
+			tlsCfg["options"] = map[string]interface{}{"alpn": opts.ALPN}
+		}
+		dialer["tls"] = tlsCfg
+	}
+	return dialer
+}
+
+// tunnelListenerConfig is the listener of the hop's relay service.
+func tunnelListenerConfig(protocol string, opts tunnelTransportOptions) map[string]interface{} {
+	listener := map[string]interface{}{
+		"type": protocol,
+	}
+	if md := tunnelTransportMetadata(protocol, opts, false); len(md) > 0 {
+		listener["metadata"] = md
+	}
+	if len(opts.ALPN) > 0 {
+		listener["tls"] = map[string]interface{}{
+			"options": map[string]interface{}{"alpn": opts.ALPN},
+		}
+	}
+	return listener
+}
+
+// isUDPTunnelProtocol reports whether a tunnel protocol runs over UDP.
+func isUDPTunnelProtocol(protocol string) bool {
+	return tunnelTransports[strings.ToLower(strings.TrimSpace(protocol))].udp
+}
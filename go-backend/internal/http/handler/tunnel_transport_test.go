@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTunnelTransportItem(t *testing.T) {
+	item := map[string]interface{}{
+		"protocol": "MWSS",
+		"options": map[string]interface{}{
+			"path": " /tunnel ",
+			"host": "CDN.example.com",
+			"sni":  "cdn.example.com",
+			"alpn": []interface{}{"h2", "http/1.1", "h2"},
+			"mux":  map[string]interface{}{"version": 2, "keepaliveInterval": 10, "keepaliveTimeout": 30},
+		},
+	}
+	protocol, opts, err := parseTunnelTransportItem(item)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if protocol != "mwss" || opts.Path != "/tunnel" || opts.Host != "cdn.example.com" {
+		t.Fatalf("unexpected transport %s %+v", protocol, opts)
+	}
+	if !reflect.DeepEqual(opts.ALPN, []string{"h2", "http/1.1"}) {
+		t.Fatalf("unexpected alpn %v", opts.ALPN)
+	}
+	if item["protocol"] != "mwss" {
+		t.Fatalf("expected the normalized protocol to be written back, got %v", item["protocol"])
+	}
+	stored, ok := item["options"].(string)
+	if !ok || !reflect.DeepEqual(decodeTunnelTransportOptions(stored), opts) {
+		t.Fatalf("expected the options to be stored as they were parsed, got %v", item["options"])
+	}
+
+	bad := []map[string]interface{}{
+		{"protocol": "socks5"},
+		{"protocol": "tcp", "options": map[string]interface{}{"sni": "a.example.com"}},
+		{"protocol": "tls", "options": map[string]interface{}{"mux": map[string]interface{}{"version": 2}}},
+		{"protocol": "mtls", "options": map[string]interface{}{"keepalive": 10}},
+		{"protocol": "ws", "options": map[string]interface{}{"path": "tunnel"}},
+		{"protocol": "kcp", "options": map[string]interface{}{"kcp": map[string]interface{}{"mtu": 100}}},
+		{"protocol": "kcp", "options": map[string]interface{}{"kcp": map[string]interface{}{"crypt": "rot13"}}},
+		{"protocol": "mtcp", "options": map[string]interface{}{"mux": map[string]interface{}{"keepaliveInterval": 30, "keepaliveTimeout": 10}}},
+		{"protocol": "grpc", "options": map[string]interface{}{"unknown": true}},
+	}
+	for _, item := range bad {
+		if _, _, err := parseTunnelTransportItem(item); err == nil {
+			t.Fatalf("expected %v to be rejected", item)
+		}
+	}
+
+	empty := map[string]interface{}{"protocol": "tls", "options": map[string]interface{}{"mux": map[string]interface{}{}, "alpn": []interface{}{}}}
+	if _, opts, err := parseTunnelTransportItem(empty); err != nil || !opts.isZero() || empty["options"] != "" {
+		t.Fatalf("expected empty options to be dropped, got %+v %v (%v)", opts, empty["options"], err)
+	}
+}
+
+func TestTunnelTransportBothEndsMatch(t *testing.T) {
+	kcp := tunnelRuntimeNode{
+		NodeID:    2,
+		Protocol:  "kcp",
+		ChainType: 3,
+		Port:      30000,
+		Options: tunnelTransportOptions{
+			Keepalive: 15,
+			KCP:       &tunnelKCPOptions{Mode: "fast2", Crypt: "aes", Key: "secret", MTU: 1350},
+		},
+	}
+	nodes := map[int64]*nodeRecord{
+		1: {ID: 1, ServerIP: "10.0.0.1", TCPListenAddr: "[::]"},
+		2: {ID: 2, ServerIP: "10.0.0.2", TCPListenAddr: "[::]"},
+	}
+
+	chain, err := buildTunnelChainConfig(7, 1, []tunnelRuntimeNode{kcp}, nodes, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dialer := chain["hops"].([]map[string]interface{})[0]["nodes"].([]map[string]interface{})[0]["dialer"].(map[string]interface{})
+	listener := buildTunnelChainServiceConfig(7, kcp, nodes[2])[0]["listener"].(map[string]interface{})
+	if dialer["type"] != "kcp" || listener["type"] != "kcp" {
+		t.Fatalf("unexpected transport types %v / %v", dialer["type"], listener["type"])
+	}
+	want := map[string]interface{}{
+		"kcp.keepalive": "15",
+		"kcp.mode":      "fast2",
+		"kcp.crypt":     "aes",
+		"kcp.key":       "secret",
+		"kcp.mtu":       "1350",
+	}
+	if !reflect.DeepEqual(dialer["metadata"], want) || !reflect.DeepEqual(listener["metadata"], want) {
+		t.Fatalf("expected both ends to share %v, got %v / %v", want, dialer["metadata"], listener["metadata"])
+	}
+
+	wss := tunnelTransportOptions{Path: "/t", Host: "cdn.example.com", SNI: "cdn.example.com", ALPN: []string{"http/1.1"}}
+	dialer = tunnelDialerConfig("wss", wss)
+	listener = tunnelListenerConfig("wss", wss)
+	if md := dialer["metadata"].(map[string]interface{}); md["ws.path"] != "/t" || md["ws.host"] != "cdn.example.com" {
+		t.Fatalf("unexpected dialer metadata %v", md)
+	}
+	if md := listener["metadata"].(map[string]interface{}); md["ws.path"] != "/t" || md["ws.host"] != nil {
+		t.Fatalf("unexpected listener metadata %v", md)
+	}
+	if tls := dialer["tls"].(map[string]interface{}); tls["serverName"] != "cdn.example.com" {
+		t.Fatalf("expected the dialer to send the SNI, got %v", tls)
+	}
+	if _, ok := listener["tls"].(map[string]interface{})["serverName"]; ok {
+		t.Fatalf("the listener must not get a server name")
+	}
+
+	if plain := tunnelDialerConfig("tls", tunnelTransportOptions{}); len(plain) != 1 {
+		t.Fatalf("expected a bare dialer without options, got %v", plain)
+	}
+	if !isUDPTunnelProtocol("QUIC") || isUDPTunnelProtocol("mwss") {
+		t.Fatalf("unexpected udp transport detection")
+	}
+}
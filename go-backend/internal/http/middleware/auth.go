@@ -121,6 +121,15 @@ func requiresAdmin(path string) bool {
 		return true
 	}
 
+	if strings.HasPrefix(path, "/api/v1/ledger/") {
+		return true
+	}
+
+	// Templates and clones create forwards for other users.
+	if strings.HasPrefix(path, "/api/v1/forward/template/") || path == "/api/v1/forward/clone" {
+		return true
+	}
+
 	if strings.HasPrefix(path, "/api/v1/api/v1/backup/") {
 		return true
 	}
@@ -6,7 +6,11 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"go-backend/internal/metrics"
 )
 
 type statusWriter struct {
@@ -47,11 +51,47 @@ func (w *statusWriter) Push(target string, opts *http.PushOptions) error {
 	return http.ErrNotSupported
 }
 
-func RequestLog(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
-		start := time.Now()
-		next.ServeHTTP(sw, r)
-		log.Printf("%s %s -> %d (%s)", r.Method, r.URL.Path, sw.status, time.Since(start).String())
-	})
+// RequestLog logs every request and records its metrics. Requests are
+// labelled by the pattern they match on routes, so arbitrary paths and
+// methods sent by clients cannot create new metric series.
+func RequestLog(routes *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			start := time.Now()
+			next.ServeHTTP(sw, r)
+			elapsed := time.Since(start)
+			log.Printf("%s %s -> %d (%s)", r.Method, r.URL.Path, sw.status, elapsed.String())
+
+			method := metricsMethod(r.Method)
+			path := metricsRoute(routes, r)
+			metrics.HTTPRequests.Inc(method, path, strconv.Itoa(sw.status))
+			// WebSocket sessions last for hours and would swamp the latency buckets.
+			if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+				metrics.HTTPRequestDuration.Observe(elapsed.Seconds(), method, path)
+			}
+		})
+	}
+}
+
+// metricsRoute returns the registered pattern r matches, or "other" for
+// anything that matches no route.
+func metricsRoute(routes *http.ServeMux, r *http.Request) string {
+	if routes == nil {
+		return "other"
+	}
+	if _, pattern := routes.Handler(r); pattern != "" && pattern != "/" {
+		return pattern
+	}
+	return "other"
+}
+
+// metricsMethod folds non-standard methods into "OTHER".
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
 }
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsLabelsAreBounded(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/user/list", func(http.ResponseWriter, *http.Request) {})
+	mux.HandleFunc("/flow/upload", func(http.ResponseWriter, *http.Request) {})
+
+	cases := map[string]string{
+		"/api/v1/user/list":     "/api/v1/user/list",
+		"/flow/upload?secret=x": "/flow/upload",
+		"/api/v1/random-1234":   "other",
+		"/flow/anything":        "other",
+		"/assets/index.js":      "other",
+	}
+	for target, want := range cases {
+		r := httptest.NewRequest(http.MethodPost, target, nil)
+		if got := metricsRoute(mux, r); got != want {
+			t.Errorf("metricsRoute(%q) = %q, want %q", target, got, want)
+		}
+	}
+
+	if got := metricsMethod("POST"); got != "POST" {
+		t.Errorf("expected POST to be kept, got %q", got)
+	}
+	if got := metricsMethod("X-SCAN-42"); got != "OTHER" {
+		t.Errorf("expected a custom method to be folded, got %q", got)
+	}
+}
@@ -14,7 +14,7 @@ func NewRouter(h *handler.Handler, jwtSecret string) http.Handler {
 
 	wrapped := middleware.Recover(mux)
 	wrapped = middleware.JWT(middleware.AuthOptions{JWTSecret: jwtSecret})(wrapped)
-	wrapped = middleware.RequestLog(wrapped)
+	wrapped = middleware.RequestLog(mux)(wrapped)
 	wrapped = middleware.CORS(wrapped)
 	return wrapped
 }
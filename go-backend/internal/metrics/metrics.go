@@ -0,0 +1,229 @@
+// Package metrics is a small Prometheus text-format registry for the panel.
+// It only implements what the panel needs (labelled counters, gauges and
+// histograms) so the backend does not pull in the full client library.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds collectors in registration order.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// Collector writes one metric family in the Prometheus text format.
+type Collector interface {
+	Expose(w io.Writer)
+}
+
+// Default is the process-wide registry served by the /metrics endpoint.
+var Default = &Registry{}
+
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mu.Unlock()
+}
+
+func (r *Registry) Expose(w io.Writer) {
+	r.mu.Lock()
+	items := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, c := range items {
+		c.Expose(w)
+	}
+}
+
+// DefBuckets mirrors the Prometheus client default latency buckets.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type series struct {
+	values  []string
+	value   float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newFamily(name, help, kind string, buckets []float64, labels []string) *family {
+	return &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+}
+
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		padded := make([]string, len(f.labels))
+		copy(padded, values)
+		values = padded
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if f.kind == "histogram" {
+			s.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) Expose(w io.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.series) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+	bw.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+	for _, k := range keys {
+		s := f.series[k]
+		if f.kind != "histogram" {
+			writeSample(bw, f.name, f.labels, s.values, "", "", s.value)
+			continue
+		}
+		for i, upper := range f.buckets {
+			writeSample(bw, f.name+"_bucket", f.labels, s.values, "le", formatFloat(upper), float64(s.buckets[i]))
+		}
+		writeSample(bw, f.name+"_bucket", f.labels, s.values, "le", "+Inf", float64(s.count))
+		writeSample(bw, f.name+"_sum", f.labels, s.values, "", "", s.sum)
+		writeSample(bw, f.name+"_count", f.labels, s.values, "", "", float64(s.count))
+	}
+	_ = bw.Flush()
+}
+
+// CounterVec is a monotonically increasing labelled counter.
+type CounterVec struct{ *family }
+
+// GaugeVec is a labelled value that can go up and down.
+type GaugeVec struct{ *family }
+
+// HistogramVec tracks labelled observations in cumulative buckets.
+type HistogramVec struct{ *family }
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newFamily(name, help, "counter", nil, labels)}
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newFamily(name, help, "gauge", nil, labels)}
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	return &HistogramVec{newFamily(name, help, "histogram", buckets, labels)}
+}
+
+func (c *CounterVec) Inc(values ...string) { c.Add(1, values...) }
+
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if c == nil || delta < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.get(values).value += delta
+	c.mu.Unlock()
+}
+
+func (g *GaugeVec) Set(v float64, values ...string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	g.get(values).value = v
+	g.mu.Unlock()
+}
+
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	s := h.get(values)
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.buckets[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+	h.mu.Unlock()
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		first := true
+		for i, l := range labels {
+			if !first {
+				w.WriteByte(',')
+			}
+			first = false
+			w.WriteString(l + `="` + escapeLabel(values[i]) + `"`)
+		}
+		if extraLabel != "" {
+			if !first {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(v string) string { return labelEscaper.Replace(v) }
+func escapeHelp(v string) string  { return helpEscaper.Replace(v) }
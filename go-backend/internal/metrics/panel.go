@@ -0,0 +1,46 @@
+package metrics
+
+import "time"
+
+// Panel-wide instruments. Scrape-time gauges (node status, quotas) are
+// built by the /metrics handler from the database instead of living here.
+var (
+	HTTPRequests = register(NewCounterVec("flux_http_requests_total",
+		"HTTP requests handled by the panel.", "method", "path", "status"))
+	HTTPRequestDuration = register(NewHistogramVec("flux_http_request_duration_seconds",
+		"HTTP request latency.", DefBuckets, "method", "path"))
+
+	WSCommands = register(NewCounterVec("flux_ws_commands_total",
+		"Commands sent to agents over WebSocket, by result (ok, failed, timeout, offline, error).", "type", "result"))
+	WSCommandDuration = register(NewHistogramVec("flux_ws_command_duration_seconds",
+		"Round-trip latency of agent commands.", []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 15}, "type"))
+
+	FlowUploads = register(NewCounterVec("flux_flow_uploads_total",
+		"Flow upload requests received from agents.", "node_id"))
+	FlowUploadItems = register(NewCounterVec("flux_flow_upload_items_total",
+		"Service flow items received from agents.", "node_id"))
+	FlowUploadBytes = register(NewCounterVec("flux_flow_upload_bytes_total",
+		"Raw bytes reported by agents before traffic ratio scaling.", "node_id", "direction"))
+
+	FlowUsageWriteErrors = register(NewCounterVec("flux_flow_usage_write_errors_total",
+		"Flow usage writes that failed and were lost, by reason (period_closed, error).", "reason"))
+
+	ClientIPLimitExceeded = register(NewCounterVec("flux_client_ip_limit_exceeded_total",
+		"Times a user or user tunnel went over its distinct source IP limit.", "scope", "mode"))
+
+	JobDuration = register(NewHistogramVec("flux_job_duration_seconds",
+		"Background job run time.", []float64{.1, .5, 1, 5, 10, 30, 60, 300}, "job"))
+	JobLastRun = register(NewGaugeVec("flux_job_last_run_timestamp_seconds",
+		"Unix time the background job last finished.", "job"))
+)
+
+func register[T Collector](c T) T {
+	Default.Register(c)
+	return c
+}
+
+// ObserveJob records a finished background job run.
+func ObserveJob(job string, start time.Time) {
+	JobDuration.Observe(time.Since(start).Seconds(), job)
+	JobLastRun.Set(float64(time.Now().Unix()), job)
+}
@@ -20,6 +20,9 @@ type User struct {
 	OutFlow       int64         `gorm:"column:out_flow;not null;default:0"`
 	FlowResetTime int64         `gorm:"column:flow_reset_time;not null"`
 	Num           int           `gorm:"not null"`
+	Speed         int           `gorm:"not null;default:0"`
+	MaxIPs        int           `gorm:"column:max_ips;not null;default:0"`
+	IPLimitMode   int           `gorm:"column:ip_limit_mode;not null;default:0"`
 	CreatedTime   int64         `gorm:"column:created_time;not null"`
 	UpdatedTime   sql.NullInt64 `gorm:"column:updated_time"`
 	Status        int           `gorm:"not null"`
@@ -29,23 +32,80 @@ func (User) TableName() string { return "user" }
 
 // Forward maps to the "forward" table.
 type Forward struct {
-	ID          int64  `gorm:"primaryKey;autoIncrement"`
-	UserID      int64  `gorm:"column:user_id;not null"`
-	UserName    string `gorm:"column:user_name;type:varchar(100);not null"`
-	Name        string `gorm:"type:varchar(100);not null"`
-	TunnelID    int64  `gorm:"column:tunnel_id;not null"`
-	RemoteAddr  string `gorm:"column:remote_addr;type:text;not null"`
-	Strategy    string `gorm:"type:varchar(100);not null;default:'fifo'"`
-	InFlow      int64  `gorm:"column:in_flow;not null;default:0"`
-	OutFlow     int64  `gorm:"column:out_flow;not null;default:0"`
-	CreatedTime int64  `gorm:"column:created_time;not null"`
-	UpdatedTime int64  `gorm:"column:updated_time;not null"`
-	Status      int    `gorm:"not null"`
-	Inx         int    `gorm:"not null;default:0"`
+	ID            int64  `gorm:"primaryKey;autoIncrement"`
+	UserID        int64  `gorm:"column:user_id;not null"`
+	UserName      string `gorm:"column:user_name;type:varchar(100);not null"`
+	Name          string `gorm:"type:varchar(100);not null"`
+	TunnelID      int64  `gorm:"column:tunnel_id;not null"`
+	RemoteAddr    string `gorm:"column:remote_addr;type:text;not null"`
+	Strategy      string `gorm:"type:varchar(100);not null;default:'fifo'"`
+	MaxConns      int    `gorm:"column:max_conns;not null;default:0"`
+	MaxIPConns    int    `gorm:"column:max_ip_conns;not null;default:0"`
+	Protocol      string `gorm:"type:varchar(10);not null;default:'tcp+udp'"`
+	PortCount     int    `gorm:"column:port_count;not null;default:0"`
+	ProxyIn       int    `gorm:"column:proxy_in;not null;default:0"`
+	ProxyOut      int    `gorm:"column:proxy_out;not null;default:0"`
+	AllowIPs      string `gorm:"column:allow_ips;type:text;default:''"`
+	DenyIPs       string `gorm:"column:deny_ips;type:text;default:''"`
+	SNIHosts      string `gorm:"column:sni_hosts;type:text;default:''"`
+	ConnLog       int    `gorm:"column:conn_log;not null;default:0"`
+	ListenIP      string `gorm:"column:listen_ip;type:varchar(64);default:''"`
+	InterfaceName string `gorm:"column:interface_name;type:varchar(200);default:''"`
+	InFlow        int64  `gorm:"column:in_flow;not null;default:0"`
+	OutFlow       int64  `gorm:"column:out_flow;not null;default:0"`
+	CreatedTime   int64  `gorm:"column:created_time;not null"`
+	UpdatedTime   int64  `gorm:"column:updated_time;not null"`
+	Status        int    `gorm:"not null"`
+	Inx           int    `gorm:"not null;default:0"`
+
+	ForwardHealthCheck `gorm:"embedded"`
+	Schedule           `gorm:"embedded"`
+	ForwardHTTP        `gorm:"embedded"`
+	DNSResolver        `gorm:"embedded"`
 }
 
 func (Forward) TableName() string { return "forward" }
 
+// ForwardHealthCheck is the active health check the entry nodes run against
+// a forward's targets. An empty Type disables it.
+type ForwardHealthCheck struct {
+	Type               string `gorm:"column:health_check;type:varchar(10);default:''" json:"type"`
+	Interval           int    `gorm:"column:health_interval;not null;default:0" json:"interval,omitempty"`
+	Path               string `gorm:"column:health_path;type:varchar(255);default:''" json:"path,omitempty"`
+	HealthyThreshold   int    `gorm:"column:healthy_threshold;not null;default:0" json:"healthyThreshold,omitempty"`
+	UnhealthyThreshold int    `gorm:"column:unhealthy_threshold;not null;default:0" json:"unhealthyThreshold,omitempty"`
+}
+
+// Schedule is the active window of a forward or user tunnel, as a pair of
+// five field cron expressions in server local time. On opens the window and
+// Off closes it; both empty means always active.
+type Schedule struct {
+	On  string `gorm:"column:schedule_on;type:varchar(100);default:''" json:"on"`
+	Off string `gorm:"column:schedule_off;type:varchar(100);default:''" json:"off"`
+}
+
+// ForwardHTTP turns a TCP forward into an HTTP reverse proxy. An empty Mode
+// keeps it a plain TCP forward; "https" terminates TLS at the entry node
+// with the certificate CertID. Routes holds one "host/path targets" rule
+// per line, tried before the forward's own targets.
+type ForwardHTTP struct {
+	Mode      string `gorm:"column:http_mode;type:varchar(10);default:''" json:"mode"`
+	Routes    string `gorm:"column:http_routes;type:text;default:''" json:"routes,omitempty"`
+	CertID    int64  `gorm:"column:http_cert_id;not null;default:0" json:"certId,omitempty"`
+	AccessLog int    `gorm:"column:http_access_log;not null;default:0" json:"accessLog,omitempty"`
+}
+
+// DNSResolver is how a forward's services, or all services of a node,
+// resolve domain targets. Servers holds one nameserver per line, such as
+// "8.8.8.8", "tls://1.1.1.1:853" or "https://dns.google/dns-query"; empty
+// keeps the system resolver. Prefer picks "ipv4" or "ipv6" records first and
+// TTL, in seconds, replaces the records' own cache time when positive.
+type DNSResolver struct {
+	Servers string `gorm:"column:dns_servers;type:text;default:''" json:"servers"`
+	Prefer  string `gorm:"column:dns_prefer;type:varchar(10);default:''" json:"prefer,omitempty"`
+	TTL     int    `gorm:"column:dns_ttl;not null;default:0" json:"ttl,omitempty"`
+}
+
 type ForwardPort struct {
 	ID        int64 `gorm:"primaryKey;autoIncrement"`
 	ForwardID int64 `gorm:"column:forward_id;not null"`
@@ -73,11 +133,15 @@ type Node struct {
 	Status        int            `gorm:"not null"`
 	TCPListenAddr string         `gorm:"column:tcp_listen_addr;type:varchar(100);not null;default:'[::]'"`
 	UDPListenAddr string         `gorm:"column:udp_listen_addr;type:varchar(100);not null;default:'[::]'"`
+	ListenIPs     string         `gorm:"column:listen_ips;type:text;default:''"`
+	Interfaces    string         `gorm:"column:interfaces;type:text;default:''"`
 	Inx           int            `gorm:"not null;default:0"`
 	IsRemote      int            `gorm:"column:is_remote;default:0"`
 	RemoteURL     sql.NullString `gorm:"column:remote_url;type:text"`
 	RemoteToken   sql.NullString `gorm:"column:remote_token;type:text"`
 	RemoteConfig  sql.NullString `gorm:"column:remote_config;type:text"`
+
+	DNSResolver `gorm:"embedded"`
 }
 
 func (Node) TableName() string { return "node" }
@@ -86,6 +150,8 @@ type SpeedLimit struct {
 	ID          int64         `gorm:"primaryKey;autoIncrement"`
 	Name        string        `gorm:"type:varchar(100);not null"`
 	Speed       int           `gorm:"not null"`
+	ConnSpeed   int           `gorm:"column:conn_speed;not null;default:0"`
+	IPSpeed     int           `gorm:"column:ip_speed;not null;default:0"`
 	TunnelID    int64         `gorm:"column:tunnel_id;not null"`
 	TunnelName  string        `gorm:"column:tunnel_name;type:varchar(100);not null"`
 	CreatedTime int64         `gorm:"column:created_time;not null"`
@@ -119,6 +185,11 @@ type Tunnel struct {
 	InIP         sql.NullString `gorm:"column:in_ip;type:text"`
 	Inx          int            `gorm:"not null;default:0"`
 	IPPreference string         `gorm:"column:ip_preference;type:varchar(10);not null;default:''"`
+	AllowIPs     string         `gorm:"column:allow_ips;type:text;default:''"`
+	DenyIPs      string         `gorm:"column:deny_ips;type:text;default:''"`
+	// RelaySecret seeds the credentials of the tunnel's relay services.
+	// Replacing it rotates them; it is left out of backups on purpose.
+	RelaySecret string `gorm:"column:relay_secret;type:varchar(64);not null;default:''"`
 }
 
 func (Tunnel) TableName() string { return "tunnel" }
@@ -132,6 +203,9 @@ type ChainTunnel struct {
 	Strategy  sql.NullString `gorm:"type:varchar(10)"`
 	Inx       sql.NullInt64  `gorm:"column:inx"`
 	Protocol  sql.NullString `gorm:"type:varchar(10)"`
+	// Options holds the JSON transport options of the protocol, shared by
+	// this node's listener and the dialers reaching it.
+	Options sql.NullString `gorm:"column:options;type:text"`
 }
 
 func (ChainTunnel) TableName() string { return "chain_tunnel" }
@@ -142,12 +216,16 @@ type UserTunnel struct {
 	TunnelID      int64         `gorm:"column:tunnel_id;not null;uniqueIndex:idx_user_tunnel_unique"`
 	SpeedID       sql.NullInt64 `gorm:"column:speed_id"`
 	Num           int           `gorm:"not null"`
+	MaxIPs        int           `gorm:"column:max_ips;not null;default:0"`
 	Flow          int64         `gorm:"not null"`
 	InFlow        int64         `gorm:"column:in_flow;not null;default:0"`
 	OutFlow       int64         `gorm:"column:out_flow;not null;default:0"`
 	FlowResetTime int64         `gorm:"column:flow_reset_time;not null"`
 	ExpTime       int64         `gorm:"column:exp_time;not null"`
 	Status        int           `gorm:"not null"`
+	InterfaceName string        `gorm:"column:interface_name;type:varchar(200);default:''"`
+
+	Schedule `gorm:"embedded"`
 }
 
 func (UserTunnel) TableName() string { return "user_tunnel" }
@@ -229,6 +307,35 @@ type Announcement struct {
 
 func (Announcement) TableName() string { return "announcement" }
 
+// Certificate is a TLS certificate a user uploads for HTTPS forwards. The
+// private key is only ever sent to the agents, never back to the browser.
+type Certificate struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement"`
+	UserID      int64  `gorm:"column:user_id;not null;index"`
+	Name        string `gorm:"type:varchar(100);not null"`
+	Domains     string `gorm:"type:text;not null;default:''"`
+	CertPEM     string `gorm:"column:cert_pem;type:text;not null"`
+	KeyPEM      string `gorm:"column:key_pem;type:text;not null"`
+	NotAfter    int64  `gorm:"column:not_after;not null;default:0"`
+	CreatedTime int64  `gorm:"column:created_time;not null"`
+	UpdatedTime int64  `gorm:"column:updated_time;not null"`
+}
+
+func (Certificate) TableName() string { return "certificate" }
+
+// ForwardTemplate keeps the settings of a forward for admins to create it
+// for many users and tunnels at once. Config is the JSON of the forward
+// request fields it carries; the owner, tunnel and port are picked per use.
+type ForwardTemplate struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement"`
+	Name        string `gorm:"type:varchar(100);not null"`
+	Config      string `gorm:"type:text;not null"`
+	CreatedTime int64  `gorm:"column:created_time;not null"`
+	UpdatedTime int64  `gorm:"column:updated_time;not null"`
+}
+
+func (ForwardTemplate) TableName() string { return "forward_template" }
+
 type SchemaVersion struct {
 	Version int `gorm:"not null;default:0"`
 }
@@ -293,6 +400,99 @@ type FederationTunnelBinding struct {
 
 func (FederationTunnelBinding) TableName() string { return "federation_tunnel_binding" }
 
+// ─── Usage Ledger ────────────────────────────────────────────────────
+
+// UsageLedger is the append-only billing ledger. Every flow report adds a
+// "flow" entry carrying both raw and TrafficRatio-scaled bytes. Counter
+// resets and imports add a "checkpoint" entry holding the counter value
+// the following flow entries build on, which is what reconciliation uses.
+// Rows are never updated or deleted.
+type UsageLedger struct {
+	ID           int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	Period       string `gorm:"type:varchar(7);not null;index:idx_usage_ledger_period_user" json:"period"`
+	Kind         string `gorm:"type:varchar(20);not null;default:'flow'" json:"kind"`
+	UserID       int64  `gorm:"column:user_id;not null;index:idx_usage_ledger_period_user" json:"userId"`
+	UserTunnelID int64  `gorm:"column:user_tunnel_id;not null;default:0" json:"userTunnelId"`
+	ForwardID    int64  `gorm:"column:forward_id;not null;default:0;index:idx_usage_ledger_forward" json:"forwardId"`
+	TunnelID     int64  `gorm:"column:tunnel_id;not null;default:0" json:"tunnelId"`
+	RawIn        int64  `gorm:"column:raw_in;not null;default:0" json:"rawIn"`
+	RawOut       int64  `gorm:"column:raw_out;not null;default:0" json:"rawOut"`
+	InFlow       int64  `gorm:"column:in_flow;not null;default:0" json:"inFlow"`
+	OutFlow      int64  `gorm:"column:out_flow;not null;default:0" json:"outFlow"`
+	CreatedTime  int64  `gorm:"column:created_time;not null" json:"createdTime"`
+}
+
+func (UsageLedger) TableName() string { return "usage_ledger" }
+
+// ForwardClientIP is a source IP an agent admitted for a forward. LastSeen
+// moves forward on every report carrying the IP, so rows older than the
+// tracking window no longer count towards the owner's IP limit.
+type ForwardClientIP struct {
+	ID           int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	ForwardID    int64  `gorm:"column:forward_id;not null;uniqueIndex:idx_forward_client_ip_unique" json:"forwardId"`
+	NodeID       int64  `gorm:"column:node_id;not null;uniqueIndex:idx_forward_client_ip_unique" json:"nodeId"`
+	IP           string `gorm:"column:ip;type:varchar(64);not null;uniqueIndex:idx_forward_client_ip_unique" json:"ip"`
+	UserID       int64  `gorm:"column:user_id;not null;index:idx_forward_client_ip_user" json:"userId"`
+	UserTunnelID int64  `gorm:"column:user_tunnel_id;not null;default:0" json:"userTunnelId"`
+	FirstSeen    int64  `gorm:"column:first_seen;not null" json:"firstSeen"`
+	LastSeen     int64  `gorm:"column:last_seen;not null;index:idx_forward_client_ip_user" json:"lastSeen"`
+}
+
+func (ForwardClientIP) TableName() string { return "forward_client_ip" }
+
+// ForwardPortDrain is an entry port range a forward moved away from while
+// its old listener keeps serving. The port stays taken until ExpireTime so
+// it is not handed to another forward before the listener is gone.
+type ForwardPortDrain struct {
+	ID         int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	ForwardID  int64  `gorm:"column:forward_id;not null" json:"forwardId"`
+	NodeID     int64  `gorm:"column:node_id;not null;index:idx_forward_port_drain_node" json:"nodeId"`
+	Port       int    `gorm:"not null" json:"port"`
+	PortCount  int    `gorm:"column:port_count;not null;default:0" json:"portCount"`
+	Protocol   string `gorm:"type:varchar(10);not null;default:'tcp+udp'" json:"protocol"`
+	ListenIP   string `gorm:"column:listen_ip;type:varchar(64);default:''" json:"listenIp"`
+	ExpireTime int64  `gorm:"column:expire_time;not null;index:idx_forward_port_drain_node" json:"expireTime"`
+}
+
+func (ForwardPortDrain) TableName() string { return "forward_port_drain" }
+
+// ForwardConnLog is one connection an agent logged for a forward with
+// connection logging on. Times are unix milliseconds; InBytes is what the
+// client sent and OutBytes what it received.
+type ForwardConnLog struct {
+	ID         int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	ForwardID  int64  `gorm:"column:forward_id;not null;index:idx_forward_conn_log_forward" json:"forwardId"`
+	UserID     int64  `gorm:"column:user_id;not null;index:idx_forward_conn_log_user" json:"userId"`
+	NodeID     int64  `gorm:"column:node_id;not null" json:"nodeId"`
+	Network    string `gorm:"type:varchar(10);not null;default:''" json:"network"`
+	ClientAddr string `gorm:"column:client_addr;type:varchar(64);not null;default:''" json:"clientAddr"`
+	EntryAddr  string `gorm:"column:entry_addr;type:varchar(64);not null;default:''" json:"entryAddr"`
+	TargetAddr string `gorm:"column:target_addr;type:varchar(255);not null;default:''" json:"targetAddr"`
+	StartTime  int64  `gorm:"column:start_time;not null;index:idx_forward_conn_log_forward;index:idx_forward_conn_log_user;index" json:"startTime"`
+	EndTime    int64  `gorm:"column:end_time;not null" json:"endTime"`
+	InBytes    int64  `gorm:"column:in_bytes;not null;default:0" json:"inBytes"`
+	OutBytes   int64  `gorm:"column:out_bytes;not null;default:0" json:"outBytes"`
+	Reason     string `gorm:"type:varchar(255);not null;default:''" json:"reason"`
+}
+
+func (ForwardConnLog) TableName() string { return "forward_conn_log" }
+
+// UsagePeriod marks a billing period (YYYY-MM) as closed. The totals are
+// captured at close time so later reconciliation can prove the period's
+// ledger rows were left untouched.
+type UsagePeriod struct {
+	ID         int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	Period     string `gorm:"type:varchar(7);not null;uniqueIndex" json:"period"`
+	EntryCount int64  `gorm:"column:entry_count;not null;default:0" json:"entryCount"`
+	RawIn      int64  `gorm:"column:raw_in;not null;default:0" json:"rawIn"`
+	RawOut     int64  `gorm:"column:raw_out;not null;default:0" json:"rawOut"`
+	InFlow     int64  `gorm:"column:in_flow;not null;default:0" json:"inFlow"`
+	OutFlow    int64  `gorm:"column:out_flow;not null;default:0" json:"outFlow"`
+	ClosedTime int64  `gorm:"column:closed_time;not null" json:"closedTime"`
+}
+
+func (UsagePeriod) TableName() string { return "usage_period" }
+
 // ─── Backup / Import-Export Structs ──────────────────────────────────
 // These are not GORM models; they define the JSON wire format for the
 // backup/restore API and MUST keep their existing json tags unchanged.
@@ -324,34 +524,39 @@ type UserBackup struct {
 	OutFlow       int64  `json:"outFlow"`
 	FlowResetTime int64  `json:"flowResetTime"`
 	Num           int    `json:"num"`
+	Speed         int    `json:"speed,omitempty"`
+	MaxIPs        int    `json:"maxIps,omitempty"`
+	IPLimitMode   int    `json:"ipLimitMode,omitempty"`
 	CreatedTime   int64  `json:"createdTime"`
 	UpdatedTime   int64  `json:"updatedTime,omitempty"`
 	Status        int    `json:"status"`
 }
 
 type NodeBackup struct {
-	ID            int64  `json:"id"`
-	Name          string `json:"name"`
-	Secret        string `json:"secret"`
-	ServerIP      string `json:"serverIp"`
-	ServerIPv4    string `json:"serverIpV4,omitempty"`
-	ServerIPv6    string `json:"serverIpV6,omitempty"`
-	Port          string `json:"port"`
-	InterfaceName string `json:"interfaceName,omitempty"`
-	Version       string `json:"version,omitempty"`
-	HTTP          int    `json:"http"`
-	TLS           int    `json:"tls"`
-	Socks         int    `json:"socks"`
-	CreatedTime   int64  `json:"createdTime"`
-	UpdatedTime   int64  `json:"updatedTime,omitempty"`
-	Status        int    `json:"status"`
-	TCPListenAddr string `json:"tcpListenAddr"`
-	UDPListenAddr string `json:"udpListenAddr"`
-	Inx           int    `json:"inx"`
-	IsRemote      int    `json:"isRemote"`
-	RemoteURL     string `json:"remoteUrl,omitempty"`
-	RemoteToken   string `json:"remoteToken,omitempty"`
-	RemoteConfig  string `json:"remoteConfig,omitempty"`
+	ID            int64        `json:"id"`
+	Name          string       `json:"name"`
+	Secret        string       `json:"secret"`
+	ServerIP      string       `json:"serverIp"`
+	ServerIPv4    string       `json:"serverIpV4,omitempty"`
+	ServerIPv6    string       `json:"serverIpV6,omitempty"`
+	Port          string       `json:"port"`
+	InterfaceName string       `json:"interfaceName,omitempty"`
+	Version       string       `json:"version,omitempty"`
+	HTTP          int          `json:"http"`
+	TLS           int          `json:"tls"`
+	Socks         int          `json:"socks"`
+	CreatedTime   int64        `json:"createdTime"`
+	UpdatedTime   int64        `json:"updatedTime,omitempty"`
+	Status        int          `json:"status"`
+	TCPListenAddr string       `json:"tcpListenAddr"`
+	UDPListenAddr string       `json:"udpListenAddr"`
+	ListenIPs     string       `json:"listenIps,omitempty"`
+	Inx           int          `json:"inx"`
+	IsRemote      int          `json:"isRemote"`
+	RemoteURL     string       `json:"remoteUrl,omitempty"`
+	RemoteToken   string       `json:"remoteToken,omitempty"`
+	RemoteConfig  string       `json:"remoteConfig,omitempty"`
+	DNS           *DNSResolver `json:"dns,omitempty"`
 }
 
 type TunnelBackup struct {
@@ -367,6 +572,8 @@ type TunnelBackup struct {
 	InIP         string              `json:"inIp,omitempty"`
 	Inx          int                 `json:"inx"`
 	IPPreference string              `json:"ipPreference,omitempty"`
+	AllowIPs     string              `json:"allowIps,omitempty"`
+	DenyIPs      string              `json:"denyIps,omitempty"`
 	ChainTunnels []ChainTunnelBackup `json:"chainTunnels,omitempty"`
 }
 
@@ -379,23 +586,40 @@ type ChainTunnelBackup struct {
 	Strategy  string `json:"strategy,omitempty"`
 	Inx       int    `json:"inx,omitempty"`
 	Protocol  string `json:"protocol,omitempty"`
+	Options   string `json:"options,omitempty"`
 }
 
 type ForwardBackup struct {
-	ID           int64                `json:"id"`
-	UserID       int64                `json:"userId"`
-	UserName     string               `json:"userName"`
-	Name         string               `json:"name"`
-	TunnelID     int64                `json:"tunnelId"`
-	RemoteAddr   string               `json:"remoteAddr"`
-	Strategy     string               `json:"strategy"`
-	InFlow       int64                `json:"inFlow"`
-	OutFlow      int64                `json:"outFlow"`
-	CreatedTime  int64                `json:"createdTime"`
-	UpdatedTime  int64                `json:"updatedTime"`
-	Status       int                  `json:"status"`
-	Inx          int                  `json:"inx"`
-	ForwardPorts *[]ForwardPortBackup `json:"forwardPorts,omitempty"`
+	ID            int64                `json:"id"`
+	UserID        int64                `json:"userId"`
+	UserName      string               `json:"userName"`
+	Name          string               `json:"name"`
+	TunnelID      int64                `json:"tunnelId"`
+	RemoteAddr    string               `json:"remoteAddr"`
+	Strategy      string               `json:"strategy"`
+	MaxConns      int                  `json:"maxConns,omitempty"`
+	MaxIPConns    int                  `json:"maxIpConns,omitempty"`
+	Protocol      string               `json:"protocol,omitempty"`
+	PortCount     int                  `json:"portCount,omitempty"`
+	ProxyIn       int                  `json:"proxyIn,omitempty"`
+	ProxyOut      int                  `json:"proxyOut,omitempty"`
+	AllowIPs      string               `json:"allowIps,omitempty"`
+	DenyIPs       string               `json:"denyIps,omitempty"`
+	SNIHosts      string               `json:"sniHosts,omitempty"`
+	ConnLog       int                  `json:"connLog,omitempty"`
+	ListenIP      string               `json:"listenIp,omitempty"`
+	InterfaceName string               `json:"interfaceName,omitempty"`
+	HealthCheck   *ForwardHealthCheck  `json:"healthCheck,omitempty"`
+	Schedule      *Schedule            `json:"schedule,omitempty"`
+	HTTP          *ForwardHTTP         `json:"http,omitempty"`
+	DNS           *DNSResolver         `json:"dns,omitempty"`
+	InFlow        int64                `json:"inFlow"`
+	OutFlow       int64                `json:"outFlow"`
+	CreatedTime   int64                `json:"createdTime"`
+	UpdatedTime   int64                `json:"updatedTime"`
+	Status        int                  `json:"status"`
+	Inx           int                  `json:"inx"`
+	ForwardPorts  *[]ForwardPortBackup `json:"forwardPorts,omitempty"`
 }
 
 type ForwardPortBackup struct {
@@ -404,23 +628,28 @@ type ForwardPortBackup struct {
 }
 
 type UserTunnelBackup struct {
-	ID            int64 `json:"id"`
-	UserID        int64 `json:"userId"`
-	TunnelID      int64 `json:"tunnelId"`
-	SpeedID       int64 `json:"speedId,omitempty"`
-	Num           int   `json:"num"`
-	Flow          int64 `json:"flow"`
-	InFlow        int64 `json:"inFlow"`
-	OutFlow       int64 `json:"outFlow"`
-	FlowResetTime int64 `json:"flowResetTime"`
-	ExpTime       int64 `json:"expTime"`
-	Status        int   `json:"status"`
+	ID            int64     `json:"id"`
+	UserID        int64     `json:"userId"`
+	TunnelID      int64     `json:"tunnelId"`
+	SpeedID       int64     `json:"speedId,omitempty"`
+	Num           int       `json:"num"`
+	MaxIPs        int       `json:"maxIps,omitempty"`
+	Flow          int64     `json:"flow"`
+	InFlow        int64     `json:"inFlow"`
+	OutFlow       int64     `json:"outFlow"`
+	FlowResetTime int64     `json:"flowResetTime"`
+	ExpTime       int64     `json:"expTime"`
+	Status        int       `json:"status"`
+	InterfaceName string    `json:"interfaceName,omitempty"`
+	Schedule      *Schedule `json:"schedule,omitempty"`
 }
 
 type SpeedLimitBackup struct {
 	ID          int64  `json:"id"`
 	Name        string `json:"name"`
 	Speed       int64  `json:"speed"`
+	ConnSpeed   int    `json:"connSpeed,omitempty"`
+	IPSpeed     int    `json:"ipSpeed,omitempty"`
 	TunnelID    int64  `json:"tunnelId"`
 	TunnelName  string `json:"tunnelName"`
 	CreatedTime int64  `json:"createdTime"`
@@ -484,14 +713,44 @@ type ImportResult struct {
 
 // ForwardRecord is a minimal forward view used by control plane and flow policy.
 type ForwardRecord struct {
-	ID         int64
-	UserID     int64
-	UserName   string
-	Name       string
-	TunnelID   int64
-	RemoteAddr string
-	Strategy   string
-	Status     int
+	ID            int64
+	UserID        int64
+	UserName      string
+	Name          string
+	TunnelID      int64
+	RemoteAddr    string
+	Strategy      string
+	MaxConns      int
+	MaxIPConns    int
+	Protocol      string
+	PortCount     int
+	ProxyIn       int
+	ProxyOut      int
+	AllowIPs      string
+	DenyIPs       string
+	SNIHosts      string
+	ConnLog       int
+	ListenIP      string
+	InterfaceName string
+	Status        int
+
+	ForwardHealthCheck
+	Schedule
+	ForwardHTTP
+	DNSResolver
+}
+
+// ScheduledForward is a forward together with the schedule of the user
+// tunnel it runs under, as read by the schedule job.
+type ScheduledForward struct {
+	ID           int64
+	UserID       int64
+	TunnelID     int64
+	UserTunnelID int64
+	Status       int
+
+	Schedule       Schedule `gorm:"embedded"`
+	TunnelSchedule Schedule `gorm:"embedded;embeddedPrefix:tunnel_"`
 }
 
 // TunnelRecord is a minimal tunnel view used by control plane.
@@ -501,6 +760,8 @@ type TunnelRecord struct {
 	Status       int
 	Flow         int64
 	TrafficRatio float64
+	AllowIPs     string
+	DenyIPs      string
 }
 
 // ForwardPortRecord is a forward port mapping used by control plane.
@@ -520,11 +781,15 @@ type NodeRecord struct {
 	PortRange     string
 	TCPListenAddr string
 	UDPListenAddr string
+	ListenIPs     string
+	Interfaces    string
 	InterfaceName string
 	IsRemote      int
 	RemoteURL     string
 	RemoteToken   string
 	RemoteConfig  string
+
+	DNSResolver
 }
 
 type ChainNodeRecord struct {
@@ -535,12 +800,22 @@ type ChainNodeRecord struct {
 	NodeName  string
 	Protocol  string
 	Strategy  string
+	Options   string
+}
+
+// NodeInterface is a network interface and its addresses as reported by a
+// node's agent.
+type NodeInterface struct {
+	Name  string   `json:"name"`
+	Addrs []string `json:"addrs"`
 }
 
 type UserTunnelLimiterInfo struct {
 	UserTunnelID int64
 	LimiterID    *int64
 	Speed        *int
+	ConnSpeed    int
+	IPSpeed      int
 }
 
 // UserFlowSnapshot holds a user's current flow counters (used by stats job).
@@ -557,6 +832,69 @@ type ExpiredUserTunnel struct {
 	TunnelID int64
 }
 
+// UsageLedgerSummary is the per-period, per-forward aggregate of ledger
+// flow entries used by the ledger list and billing export.
+type UsageLedgerSummary struct {
+	Period       string `json:"period"`
+	UserID       int64  `json:"userId"`
+	UserName     string `json:"userName"`
+	UserTunnelID int64  `json:"userTunnelId"`
+	TunnelID     int64  `json:"tunnelId"`
+	ForwardID    int64  `json:"forwardId"`
+	ForwardName  string `json:"forwardName"`
+	RawIn        int64  `json:"rawIn"`
+	RawOut       int64  `json:"rawOut"`
+	InFlow       int64  `json:"inFlow"`
+	OutFlow      int64  `json:"outFlow"`
+}
+
+// UsageReconcileItem compares a live flow counter with the value the
+// ledger says it should hold (last checkpoint + later flow entries).
+type UsageReconcileItem struct {
+	Scope         string `json:"scope"`
+	ID            int64  `json:"id"`
+	UserID        int64  `json:"userId"`
+	CounterIn     int64  `json:"counterIn"`
+	CounterOut    int64  `json:"counterOut"`
+	LedgerIn      int64  `json:"ledgerIn"`
+	LedgerOut     int64  `json:"ledgerOut"`
+	HasCheckpoint bool   `json:"hasCheckpoint"`
+	Matched       bool   `json:"matched"`
+}
+
+// UsagePeriodCheck verifies a closed period's ledger totals against the
+// totals captured when it was closed.
+type UsagePeriodCheck struct {
+	Period      string `json:"period"`
+	ClosedIn    int64  `json:"closedIn"`
+	ClosedOut   int64  `json:"closedOut"`
+	LedgerIn    int64  `json:"ledgerIn"`
+	LedgerOut   int64  `json:"ledgerOut"`
+	ClosedCount int64  `json:"closedCount"`
+	LedgerCount int64  `json:"ledgerCount"`
+	Matched     bool   `json:"matched"`
+}
+
+// NodeMetricsRow is the node view exported on the /metrics endpoint.
+type NodeMetricsRow struct {
+	ID      int64
+	Name    string
+	Status  int
+	Version string
+}
+
+// QuotaUsageRow holds used bytes against a flow quota (in GB) for a user
+// or a user-tunnel assignment, exported on the /metrics endpoint.
+type QuotaUsageRow struct {
+	UserID     int64
+	UserName   string
+	TunnelID   int64
+	TunnelName string
+	FlowGB     int64
+	InFlow     int64
+	OutFlow    int64
+}
+
 // UserTunnelDetail is a joined view of user_tunnel + tunnel + speed_limit.
 type UserTunnelDetail struct {
 	ID            int64
@@ -568,11 +906,15 @@ type UserTunnelDetail struct {
 	InFlow        int64
 	OutFlow       int64
 	Num           int
+	MaxIPs        int
 	FlowResetTime int64
 	ExpTime       int64
 	SpeedID       sql.NullInt64
 	SpeedLimit    sql.NullString
 	Speed         sql.NullInt64
+	InterfaceName string
+
+	Schedule
 }
 
 // UserForwardDetail is a joined view of forward + tunnel.
@@ -2,12 +2,15 @@ package repo
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -174,7 +177,14 @@ func autoMigrateAll(db *gorm.DB) error {
 		&model.PeerShare{},
 		&model.PeerShareRuntime{},
 		&model.FederationTunnelBinding{},
+		&model.UsageLedger{},
+		&model.UsagePeriod{},
+		&model.ForwardClientIP{},
+		&model.ForwardPortDrain{},
+		&model.ForwardConnLog{},
 		&model.Announcement{},
+		&model.Certificate{},
+		&model.ForwardTemplate{},
 		&model.SchemaVersion{},
 	}
 
@@ -223,7 +233,7 @@ func prepareSQLiteLegacyColumns(db *gorm.DB) error {
 	}
 
 	if m.HasTable(&model.Tunnel{}) {
-		for _, field := range []string{"Inx", "IPPreference"} {
+		for _, field := range []string{"Inx", "IPPreference", "AllowIPs", "DenyIPs", "RelaySecret"} {
 			if m.HasColumn(&model.Tunnel{}, field) {
 				continue
 			}
@@ -399,7 +409,7 @@ func (r *Repository) GetUserPackageTunnels(userID int64) ([]model.UserTunnelDeta
 	}
 	var items []model.UserTunnelDetail
 	err := r.db.Model(&model.UserTunnel{}).
-		Select("user_tunnel.id, user_tunnel.user_id, user_tunnel.tunnel_id, tunnel.name AS tunnel_name, tunnel.flow AS tunnel_flow, user_tunnel.flow, user_tunnel.in_flow, user_tunnel.out_flow, user_tunnel.num, user_tunnel.flow_reset_time, user_tunnel.exp_time, user_tunnel.speed_id, speed_limit.name AS speed_limit, speed_limit.speed").
+		Select("user_tunnel.id, user_tunnel.user_id, user_tunnel.tunnel_id, tunnel.name AS tunnel_name, tunnel.flow AS tunnel_flow, user_tunnel.flow, user_tunnel.in_flow, user_tunnel.out_flow, user_tunnel.num, user_tunnel.max_ips, user_tunnel.flow_reset_time, user_tunnel.exp_time, user_tunnel.speed_id, speed_limit.name AS speed_limit, speed_limit.speed, COALESCE(user_tunnel.interface_name, '') AS interface_name, COALESCE(user_tunnel.schedule_on, '') AS schedule_on, COALESCE(user_tunnel.schedule_off, '') AS schedule_off").
 		Joins("LEFT JOIN tunnel ON tunnel.id = user_tunnel.tunnel_id").
 		Joins("LEFT JOIN speed_limit ON speed_limit.id = user_tunnel.speed_id").
 		Where("user_tunnel.user_id = ?", userID).
@@ -425,6 +435,7 @@ func (r *Repository) GetUserPackageForwards(userID int64) ([]model.UserForwardDe
 		TunnelID   int64
 		TunnelName string
 		RemoteAddr string
+		ListenIP   string
 		InFlow     int64
 		OutFlow    int64
 		Status     int
@@ -433,7 +444,7 @@ func (r *Repository) GetUserPackageForwards(userID int64) ([]model.UserForwardDe
 
 	var rows []fwdRow
 	err := r.db.Model(&model.Forward{}).
-		Select("forward.id, forward.name, forward.tunnel_id, COALESCE(tunnel.name, '') AS tunnel_name, forward.remote_addr, forward.in_flow, forward.out_flow, forward.status, forward.created_time AS created_at").
+		Select("forward.id, forward.name, forward.tunnel_id, COALESCE(tunnel.name, '') AS tunnel_name, forward.remote_addr, COALESCE(forward.listen_ip, '') AS listen_ip, forward.in_flow, forward.out_flow, forward.status, forward.created_time AS created_at").
 		Joins("LEFT JOIN tunnel ON tunnel.id = forward.tunnel_id").
 		Where("forward.user_id = ?", userID).
 		Order("forward.id ASC").
@@ -444,7 +455,7 @@ func (r *Repository) GetUserPackageForwards(userID int64) ([]model.UserForwardDe
 
 	items := make([]model.UserForwardDetail, 0, len(rows))
 	for _, row := range rows {
-		inIP, inPort, err := resolveForwardIngress(r.db, row.ID, row.TunnelID)
+		inIP, inPort, err := resolveForwardIngress(r.db, row.ID, row.TunnelID, row.ListenIP)
 		if err != nil {
 			return nil, err
 		}
@@ -538,38 +549,42 @@ func (r *Repository) UpdateNodeStatus(nodeID int64, status int) error {
 	}).Error
 }
 
-// ─── Flow ────────────────────────────────────────────────────────────
-
-func (r *Repository) AddFlow(forwardID, userID int64, userTunnelID int64, inFlow, outFlow int64) error {
+// UpdateNodeInterfaces stores the interfaces and addresses a node's agent
+// reported, encoded as JSON.
+func (r *Repository) UpdateNodeInterfaces(nodeID int64, interfaces string) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
 	}
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Model(&model.Forward{}).Where("id = ?", forwardID).
-			UpdateColumns(map[string]interface{}{
-				"in_flow":  gorm.Expr("in_flow + ?", inFlow),
-				"out_flow": gorm.Expr("out_flow + ?", outFlow),
-			}).Error; err != nil {
-			return err
-		}
-		if err := tx.Model(&model.User{}).Where("id = ?", userID).
+	return r.db.Model(&model.Node{}).Where("id = ?", nodeID).Update("interfaces", interfaces).Error
+}
+
+// ─── Flow ────────────────────────────────────────────────────────────
+
+func addFlowCounters(tx *gorm.DB, forwardID, userID int64, userTunnelID int64, inFlow, outFlow int64) error {
+	if err := tx.Model(&model.Forward{}).Where("id = ?", forwardID).
+		UpdateColumns(map[string]interface{}{
+			"in_flow":  gorm.Expr("in_flow + ?", inFlow),
+			"out_flow": gorm.Expr("out_flow + ?", outFlow),
+		}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&model.User{}).Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{
+			"in_flow":  gorm.Expr("in_flow + ?", inFlow),
+			"out_flow": gorm.Expr("out_flow + ?", outFlow),
+		}).Error; err != nil {
+		return err
+	}
+	if userTunnelID > 0 {
+		if err := tx.Model(&model.UserTunnel{}).Where("id = ?", userTunnelID).
 			UpdateColumns(map[string]interface{}{
 				"in_flow":  gorm.Expr("in_flow + ?", inFlow),
 				"out_flow": gorm.Expr("out_flow + ?", outFlow),
 			}).Error; err != nil {
 			return err
 		}
-		if userTunnelID > 0 {
-			if err := tx.Model(&model.UserTunnel{}).Where("id = ?", userTunnelID).
-				UpdateColumns(map[string]interface{}{
-					"in_flow":  gorm.Expr("in_flow + ?", inFlow),
-					"out_flow": gorm.Expr("out_flow + ?", outFlow),
-				}).Error; err != nil {
-				return err
-			}
-		}
-		return nil
-	})
+	}
+	return nil
 }
 
 // ─── List Methods (return map[string]interface{}) ────────────────────
@@ -592,9 +607,12 @@ func (r *Repository) ListNodes() ([]map[string]interface{}, error) {
 			"port":          n.Port,
 			"tcpListenAddr": n.TCPListenAddr,
 			"udpListenAddr": n.UDPListenAddr,
+			"listenIps":     n.ListenIPs,
+			"interfaces":    nodeInterfaces(n.Interfaces),
 			"version":       nullableString(n.Version),
 			"http":          n.HTTP, "tls": n.TLS, "socks": n.Socks,
 			"status": n.Status, "isRemote": n.IsRemote,
+			"dnsServers": n.Servers, "dnsPrefer": n.Prefer, "dnsTtl": n.TTL,
 			"remoteUrl":    nullableString(n.RemoteURL),
 			"remoteToken":  nullableString(n.RemoteToken),
 			"remoteConfig": nullableString(n.RemoteConfig),
@@ -620,6 +638,7 @@ func (r *Repository) ListUsers() ([]map[string]interface{}, error) {
 			"flowResetTime": u.FlowResetTime, "createdTime": u.CreatedTime,
 			"updatedTime": nullableInt64(u.UpdatedTime),
 			"inFlow":      u.InFlow, "outFlow": u.OutFlow,
+			"speed": u.Speed, "maxIps": u.MaxIPs, "ipLimitMode": u.IPLimitMode,
 		})
 	}
 	return items, nil
@@ -638,6 +657,7 @@ func (r *Repository) ListSpeedLimits() ([]map[string]interface{}, error) {
 		items = append(items, map[string]interface{}{
 			"id": sl.ID, "name": sl.Name, "speed": sl.Speed,
 			"tunnelId": sl.TunnelID, "tunnelName": sl.TunnelName,
+			"connSpeed": sl.ConnSpeed, "ipSpeed": sl.IPSpeed,
 			"status": sl.Status, "createdTime": sl.CreatedTime,
 			"updatedTime": nullableInt64(sl.UpdatedTime),
 		})
@@ -651,25 +671,44 @@ func (r *Repository) ListForwards() ([]map[string]interface{}, error) {
 	}
 
 	type fwdRow struct {
-		ID          int64
-		UserID      int64
-		UserName    string
-		Name        string
-		TunnelID    int64
-		TunnelName  string
-		RemoteAddr  string
-		Strategy    string
-		InFlow      int64
-		OutFlow     int64
-		CreatedTime int64
-		Status      int
-		Inx         int
+		ID            int64
+		UserID        int64
+		UserName      string
+		Name          string
+		TunnelID      int64
+		TunnelName    string
+		RemoteAddr    string
+		Strategy      string
+		MaxConns      int
+		MaxIPConns    int `gorm:"column:max_ip_conns"`
+		Protocol      string
+		PortCount     int
+		ProxyIn       int
+		ProxyOut      int
+		AllowIPs      string `gorm:"column:allow_ips"`
+		DenyIPs       string `gorm:"column:deny_ips"`
+		SNIHosts      string `gorm:"column:sni_hosts"`
+		ConnLog       int    `gorm:"column:conn_log"`
+		ListenIP      string `gorm:"column:listen_ip"`
+		InterfaceName string `gorm:"column:interface_name"`
+		InFlow        int64
+		OutFlow       int64
+		CreatedTime   int64
+		Status        int
+		Inx           int
+
+		model.ForwardHealthCheck
+		model.Schedule
+		model.ForwardHTTP
+		model.DNSResolver
+		TunnelSchedule model.Schedule `gorm:"embedded;embeddedPrefix:tunnel_"`
 	}
 
 	var rows []fwdRow
 	err := r.db.Model(&model.Forward{}).
-		Select("forward.id, forward.user_id, forward.user_name, forward.name, forward.tunnel_id, COALESCE(tunnel.name, '') AS tunnel_name, forward.remote_addr, COALESCE(forward.strategy, 'fifo') AS strategy, forward.in_flow, forward.out_flow, forward.created_time, forward.status, forward.inx").
+		Select("forward.id, forward.user_id, forward.user_name, forward.name, forward.tunnel_id, COALESCE(tunnel.name, '') AS tunnel_name, forward.remote_addr, COALESCE(forward.strategy, 'fifo') AS strategy, forward.max_conns, forward.max_ip_conns, forward.protocol, forward.port_count, forward.proxy_in, forward.proxy_out, COALESCE(forward.allow_ips, '') AS allow_ips, COALESCE(forward.deny_ips, '') AS deny_ips, COALESCE(forward.sni_hosts, '') AS sni_hosts, forward.conn_log, COALESCE(forward.listen_ip, '') AS listen_ip, COALESCE(forward.interface_name, '') AS interface_name, COALESCE(forward.health_check, '') AS health_check, forward.health_interval, COALESCE(forward.health_path, '') AS health_path, forward.healthy_threshold, forward.unhealthy_threshold, COALESCE(forward.schedule_on, '') AS schedule_on, COALESCE(forward.schedule_off, '') AS schedule_off, COALESCE(user_tunnel.schedule_on, '') AS tunnel_schedule_on, COALESCE(user_tunnel.schedule_off, '') AS tunnel_schedule_off, COALESCE(forward.http_mode, '') AS http_mode, COALESCE(forward.http_routes, '') AS http_routes, forward.http_cert_id, forward.http_access_log, COALESCE(forward.dns_servers, '') AS dns_servers, COALESCE(forward.dns_prefer, '') AS dns_prefer, forward.dns_ttl, forward.in_flow, forward.out_flow, forward.created_time, forward.status, forward.inx").
 		Joins("LEFT JOIN tunnel ON tunnel.id = forward.tunnel_id").
+		Joins("LEFT JOIN user_tunnel ON user_tunnel.user_id = forward.user_id AND user_tunnel.tunnel_id = forward.tunnel_id").
 		Order("forward.inx ASC, forward.id ASC").
 		Find(&rows).Error
 	if err != nil {
@@ -678,7 +717,7 @@ func (r *Repository) ListForwards() ([]map[string]interface{}, error) {
 
 	items := make([]map[string]interface{}, 0, len(rows))
 	for _, row := range rows {
-		inIP, inPort, err := resolveForwardIngress(r.db, row.ID, row.TunnelID)
+		inIP, inPort, err := resolveForwardIngress(r.db, row.ID, row.TunnelID, row.ListenIP)
 		if err != nil {
 			return nil, err
 		}
@@ -686,7 +725,16 @@ func (r *Repository) ListForwards() ([]map[string]interface{}, error) {
 			"id": row.ID, "userId": row.UserID, "userName": row.UserName,
 			"name": row.Name, "tunnelId": row.TunnelID, "tunnelName": row.TunnelName,
 			"inIp": nullableForwardIngress(inIP), "inPort": nullableInt64(inPort),
-			"remoteAddr": row.RemoteAddr, "strategy": row.Strategy,
+			"remoteAddr": row.RemoteAddr, "strategy": row.Strategy, "protocol": NormalizeForwardProtocol(row.Protocol),
+			"portCount": row.PortCount, "maxConns": row.MaxConns, "maxIpConns": row.MaxIPConns,
+			"proxyIn": row.ProxyIn, "proxyOut": row.ProxyOut,
+			"allowIps": row.AllowIPs, "denyIps": row.DenyIPs, "sniHosts": row.SNIHosts, "connLog": row.ConnLog,
+			"listenIp": row.ListenIP, "interfaceName": row.InterfaceName, "healthCheck": row.Type, "healthInterval": row.Interval, "healthPath": row.Path,
+			"healthyThreshold": row.HealthyThreshold, "unhealthyThreshold": row.UnhealthyThreshold,
+			"scheduleOn": row.On, "scheduleOff": row.Off,
+			"tunnelScheduleOn": row.TunnelSchedule.On, "tunnelScheduleOff": row.TunnelSchedule.Off,
+			"httpMode": row.Mode, "httpRoutes": row.Routes, "httpCertId": row.CertID, "httpAccessLog": row.AccessLog,
+			"dnsServers": row.Servers, "dnsPrefer": row.Prefer, "dnsTtl": row.TTL,
 			"inFlow": row.InFlow, "outFlow": row.OutFlow,
 			"createdTime": row.CreatedTime, "status": row.Status, "inx": int64(row.Inx),
 		})
@@ -713,9 +761,13 @@ func (r *Repository) ListUserAccessibleTunnels(userID int64) ([]map[string]inter
 	if err != nil {
 		return nil, err
 	}
+	listenIPs, err := tunnelListenIPs(r.db)
+	if err != nil {
+		return nil, err
+	}
 	items := make([]map[string]interface{}, 0, len(rows))
 	for _, r := range rows {
-		items = append(items, map[string]interface{}{"id": r.ID, "name": r.Name})
+		items = append(items, map[string]interface{}{"id": r.ID, "name": r.Name, "listenIps": listenIPs[r.ID]})
 	}
 	return items, nil
 }
@@ -734,13 +786,62 @@ func (r *Repository) ListEnabledTunnelSummaries() ([]map[string]interface{}, err
 	if err != nil {
 		return nil, err
 	}
+	listenIPs, err := tunnelListenIPs(r.db)
+	if err != nil {
+		return nil, err
+	}
 	items := make([]map[string]interface{}, 0, len(rows))
 	for _, r := range rows {
-		items = append(items, map[string]interface{}{"id": r.ID, "name": r.Name})
+		items = append(items, map[string]interface{}{"id": r.ID, "name": r.Name, "listenIps": listenIPs[r.ID]})
 	}
 	return items, nil
 }
 
+// tunnelListenIPs returns, per tunnel, the listen IPs declared by every one
+// of its entry nodes, which are the addresses its forwards can bind to.
+func tunnelListenIPs(db *gorm.DB) (map[int64][]string, error) {
+	var rows []struct {
+		TunnelID  int64
+		NodeID    int64
+		ListenIPs string
+	}
+	err := db.Model(&model.ChainTunnel{}).
+		Select("chain_tunnel.tunnel_id, chain_tunnel.node_id, COALESCE(node.listen_ips, '') AS listen_ips").
+		Joins("JOIN node ON node.id = chain_tunnel.node_id").
+		Where("chain_tunnel.chain_type = ?", "1").
+		Order("chain_tunnel.tunnel_id ASC, chain_tunnel.inx ASC, chain_tunnel.id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int64][]string)
+	seen := make(map[int64]bool)
+	for _, row := range rows {
+		var ips []string
+		for _, ip := range strings.Split(row.ListenIPs, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				ips = append(ips, ip)
+			}
+		}
+		if !seen[row.TunnelID] {
+			seen[row.TunnelID] = true
+			result[row.TunnelID] = ips
+			continue
+		}
+		common := make([]string, 0, len(result[row.TunnelID]))
+		for _, ip := range result[row.TunnelID] {
+			for _, other := range ips {
+				if ip == other {
+					common = append(common, ip)
+					break
+				}
+			}
+		}
+		result[row.TunnelID] = common
+	}
+	return result, nil
+}
+
 func (r *Repository) ListTunnels() ([]map[string]interface{}, error) {
 	if r == nil || r.db == nil {
 		return nil, errors.New("repository not initialized")
@@ -761,6 +862,8 @@ func (r *Repository) ListTunnels() ([]map[string]interface{}, error) {
 			"status": t.Status, "createdTime": t.CreatedTime,
 			"inIp":         nullableString(t.InIP),
 			"ipPreference": t.IPPreference,
+			"allowIps":     t.AllowIPs,
+			"denyIps":      t.DenyIPs,
 			"inNodeId":     make([]map[string]interface{}, 0),
 			"outNodeId":    make([]map[string]interface{}, 0),
 			"chainNodes":   make([][]map[string]interface{}, 0),
@@ -811,6 +914,12 @@ func (r *Repository) ListTunnels() ([]map[string]interface{}, error) {
 		if c.Strategy.Valid {
 			nodeObj["strategy"] = c.Strategy.String
 		}
+		if c.Options.Valid {
+			var opts map[string]interface{}
+			if json.Unmarshal([]byte(c.Options.String), &opts) == nil {
+				nodeObj["options"] = opts
+			}
+		}
 
 		switch chainTypeInt {
 		case 1:
@@ -1423,7 +1532,8 @@ func (r *Repository) exportUsers() ([]model.UserBackup, error) {
 		b := model.UserBackup{
 			ID: u.ID, User: u.User, Pwd: u.Pwd, RoleID: u.RoleID,
 			ExpTime: u.ExpTime, Flow: u.Flow, InFlow: u.InFlow, OutFlow: u.OutFlow,
-			FlowResetTime: u.FlowResetTime, Num: u.Num,
+			FlowResetTime: u.FlowResetTime, Num: u.Num, Speed: u.Speed,
+			MaxIPs: u.MaxIPs, IPLimitMode: u.IPLimitMode,
 			CreatedTime: u.CreatedTime, Status: u.Status,
 		}
 		if u.UpdatedTime.Valid {
@@ -1446,7 +1556,7 @@ func (r *Repository) exportNodes() ([]model.NodeBackup, error) {
 			Port: n.Port, HTTP: n.HTTP, TLS: n.TLS, Socks: n.Socks,
 			CreatedTime: n.CreatedTime, Status: n.Status,
 			TCPListenAddr: n.TCPListenAddr, UDPListenAddr: n.UDPListenAddr,
-			Inx: n.Inx, IsRemote: n.IsRemote,
+			ListenIPs: n.ListenIPs, Inx: n.Inx, IsRemote: n.IsRemote,
 		}
 		if n.UpdatedTime.Valid {
 			b.UpdatedTime = n.UpdatedTime.Int64
@@ -1472,6 +1582,10 @@ func (r *Repository) exportNodes() ([]model.NodeBackup, error) {
 		if n.RemoteConfig.Valid {
 			b.RemoteConfig = n.RemoteConfig.String
 		}
+		if n.DNSResolver.Servers != "" {
+			dns := n.DNSResolver
+			b.DNS = &dns
+		}
 		out = append(out, b)
 	}
 	return out, nil
@@ -1489,6 +1603,7 @@ func (r *Repository) exportTunnels() ([]model.TunnelBackup, error) {
 			Type: t.Type, Protocol: t.Protocol, Flow: t.Flow,
 			CreatedTime: t.CreatedTime, UpdatedTime: t.UpdatedTime,
 			Status: t.Status, Inx: t.Inx, IPPreference: t.IPPreference,
+			AllowIPs: t.AllowIPs, DenyIPs: t.DenyIPs,
 		}
 		if t.InIP.Valid {
 			b.InIP = t.InIP.String
@@ -1525,6 +1640,9 @@ func (r *Repository) exportChainTunnels(tunnelID int64) ([]model.ChainTunnelBack
 		if c.Protocol.Valid {
 			b.Protocol = c.Protocol.String
 		}
+		if c.Options.Valid {
+			b.Options = c.Options.String
+		}
 		out = append(out, b)
 	}
 	return out, nil
@@ -1540,9 +1658,28 @@ func (r *Repository) exportForwards() ([]model.ForwardBackup, error) {
 		b := model.ForwardBackup{
 			ID: f.ID, UserID: f.UserID, UserName: f.UserName, Name: f.Name,
 			TunnelID: f.TunnelID, RemoteAddr: f.RemoteAddr, Strategy: f.Strategy,
-			InFlow: f.InFlow, OutFlow: f.OutFlow, CreatedTime: f.CreatedTime,
+			MaxConns: f.MaxConns, MaxIPConns: f.MaxIPConns, Protocol: f.Protocol,
+			PortCount: f.PortCount, ProxyIn: f.ProxyIn, ProxyOut: f.ProxyOut,
+			AllowIPs: f.AllowIPs, DenyIPs: f.DenyIPs, SNIHosts: f.SNIHosts, ConnLog: f.ConnLog,
+			ListenIP: f.ListenIP, InterfaceName: f.InterfaceName, InFlow: f.InFlow, OutFlow: f.OutFlow, CreatedTime: f.CreatedTime,
 			UpdatedTime: f.UpdatedTime, Status: f.Status, Inx: f.Inx,
 		}
+		if f.ForwardHealthCheck.Type != "" {
+			hc := f.ForwardHealthCheck
+			b.HealthCheck = &hc
+		}
+		if f.Schedule != (model.Schedule{}) {
+			sc := f.Schedule
+			b.Schedule = &sc
+		}
+		if f.ForwardHTTP.Mode != "" {
+			hp := f.ForwardHTTP
+			b.HTTP = &hp
+		}
+		if f.DNSResolver.Servers != "" {
+			dns := f.DNSResolver
+			b.DNS = &dns
+		}
 		ports, err := r.exportForwardPorts(f.ID)
 		if err != nil {
 			return nil, err
@@ -1575,12 +1712,17 @@ func (r *Repository) exportUserTunnels() ([]model.UserTunnelBackup, error) {
 	for _, ut := range uts {
 		b := model.UserTunnelBackup{
 			ID: ut.ID, UserID: ut.UserID, TunnelID: ut.TunnelID,
-			Num: ut.Num, Flow: ut.Flow, InFlow: ut.InFlow, OutFlow: ut.OutFlow,
+			Num: ut.Num, MaxIPs: ut.MaxIPs, Flow: ut.Flow, InFlow: ut.InFlow, OutFlow: ut.OutFlow,
 			FlowResetTime: ut.FlowResetTime, ExpTime: ut.ExpTime, Status: ut.Status,
+			InterfaceName: ut.InterfaceName,
 		}
 		if ut.SpeedID.Valid {
 			b.SpeedID = ut.SpeedID.Int64
 		}
+		if ut.Schedule != (model.Schedule{}) {
+			sc := ut.Schedule
+			b.Schedule = &sc
+		}
 		out = append(out, b)
 	}
 	return out, nil
@@ -1595,6 +1737,7 @@ func (r *Repository) exportSpeedLimits() ([]model.SpeedLimitBackup, error) {
 	for _, sl := range sls {
 		b := model.SpeedLimitBackup{
 			ID: sl.ID, Name: sl.Name, Speed: int64(sl.Speed),
+			ConnSpeed: sl.ConnSpeed, IPSpeed: sl.IPSpeed,
 			TunnelID: sl.TunnelID, TunnelName: sl.TunnelName,
 			CreatedTime: sl.CreatedTime, Status: sl.Status,
 		}
@@ -1751,6 +1894,11 @@ func (r *Repository) Import(backup *model.BackupData, types []string) (*model.Im
 			}
 			result.ConfigsImported = count
 		}
+		if result.UsersImported > 0 || result.ForwardsImported > 0 || result.UserTunnelsImported > 0 {
+			if err := checkpointAllUsageCounters(tx, now); err != nil {
+				return fmt.Errorf("checkpoint usage counters failed: %w", err)
+			}
+		}
 		return nil
 	})
 	if err != nil {
@@ -1773,6 +1921,9 @@ func importUsers(tx *gorm.DB, users []model.UserBackup, now int64) (int, error)
 			OutFlow:       u.OutFlow,
 			FlowResetTime: u.FlowResetTime,
 			Num:           u.Num,
+			Speed:         u.Speed,
+			MaxIPs:        u.MaxIPs,
+			IPLimitMode:   u.IPLimitMode,
 			CreatedTime:   u.CreatedTime,
 			UpdatedTime:   sql.NullInt64{Int64: now, Valid: true},
 			Status:        u.Status,
@@ -1781,7 +1932,7 @@ func importUsers(tx *gorm.DB, users []model.UserBackup, now int64) (int, error)
 			Columns: []clause.Column{{Name: "id"}},
 			DoUpdates: clause.AssignmentColumns([]string{
 				"user", "pwd", "role_id", "exp_time", "flow", "in_flow", "out_flow",
-				"flow_reset_time", "num", "updated_time", "status",
+				"flow_reset_time", "num", "speed", "max_ips", "ip_limit_mode", "updated_time", "status",
 			}),
 		}).Create(&item).Error
 		if err != nil {
@@ -1813,18 +1964,23 @@ func importNodes(tx *gorm.DB, nodes []model.NodeBackup, now int64) (int, error)
 			Status:        n.Status,
 			TCPListenAddr: n.TCPListenAddr,
 			UDPListenAddr: n.UDPListenAddr,
+			ListenIPs:     n.ListenIPs,
 			Inx:           n.Inx,
 			IsRemote:      n.IsRemote,
 			RemoteURL:     sql.NullString{String: n.RemoteURL, Valid: true},
 			RemoteToken:   sql.NullString{String: n.RemoteToken, Valid: true},
 			RemoteConfig:  sql.NullString{String: n.RemoteConfig, Valid: true},
 		}
+		if n.DNS != nil {
+			item.DNSResolver = *n.DNS
+		}
 		err := tx.Clauses(clause.OnConflict{
 			Columns: []clause.Column{{Name: "id"}},
 			DoUpdates: clause.AssignmentColumns([]string{
 				"name", "secret", "server_ip", "server_ip_v4", "server_ip_v6", "port", "interface_name", "version",
 				"http", "tls", "socks", "updated_time", "status", "tcp_listen_addr", "udp_listen_addr",
-				"inx", "is_remote", "remote_url", "remote_token", "remote_config",
+				"listen_ips", "inx", "is_remote", "remote_url", "remote_token", "remote_config",
+				"dns_servers", "dns_prefer", "dns_ttl",
 			}),
 		}).Create(&item).Error
 		if err != nil {
@@ -1851,11 +2007,13 @@ func importTunnels(tx *gorm.DB, tunnels []model.TunnelBackup, now int64) (int, e
 			InIP:         sql.NullString{String: t.InIP, Valid: true},
 			Inx:          t.Inx,
 			IPPreference: t.IPPreference,
+			AllowIPs:     t.AllowIPs,
+			DenyIPs:      t.DenyIPs,
 		}
 		err := tx.Clauses(clause.OnConflict{
 			Columns: []clause.Column{{Name: "id"}},
 			DoUpdates: clause.AssignmentColumns([]string{
-				"name", "traffic_ratio", "type", "protocol", "flow", "updated_time", "status", "in_ip", "inx", "ip_preference",
+				"name", "traffic_ratio", "type", "protocol", "flow", "updated_time", "status", "in_ip", "inx", "ip_preference", "allow_ips", "deny_ips",
 			}),
 		}).Create(&item).Error
 		if err != nil {
@@ -1871,11 +2029,12 @@ func importTunnels(tx *gorm.DB, tunnels []model.TunnelBackup, now int64) (int, e
 				Strategy:  sql.NullString{String: ct.Strategy, Valid: true},
 				Inx:       sql.NullInt64{Int64: int64(ct.Inx), Valid: true},
 				Protocol:  sql.NullString{String: ct.Protocol, Valid: true},
+				Options:   nullStringFromInterface(ct.Options),
 			}
 			err = tx.Clauses(clause.OnConflict{
 				Columns: []clause.Column{{Name: "id"}},
 				DoUpdates: clause.AssignmentColumns([]string{
-					"chain_type", "node_id", "port", "strategy", "inx", "protocol",
+					"chain_type", "node_id", "port", "strategy", "inx", "protocol", "options",
 				}),
 			}).Create(&chainItem).Error
 			if err != nil {
@@ -1891,25 +2050,53 @@ func importForwards(tx *gorm.DB, forwards []model.ForwardBackup, now int64) (int
 	count := 0
 	for _, f := range forwards {
 		item := model.Forward{
-			ID:          f.ID,
-			UserID:      f.UserID,
-			UserName:    f.UserName,
-			Name:        f.Name,
-			TunnelID:    f.TunnelID,
-			RemoteAddr:  f.RemoteAddr,
-			Strategy:    f.Strategy,
-			InFlow:      f.InFlow,
-			OutFlow:     f.OutFlow,
-			CreatedTime: f.CreatedTime,
-			UpdatedTime: now,
-			Status:      f.Status,
-			Inx:         f.Inx,
+			ID:            f.ID,
+			UserID:        f.UserID,
+			UserName:      f.UserName,
+			Name:          f.Name,
+			TunnelID:      f.TunnelID,
+			RemoteAddr:    f.RemoteAddr,
+			Strategy:      f.Strategy,
+			MaxConns:      f.MaxConns,
+			MaxIPConns:    f.MaxIPConns,
+			Protocol:      NormalizeForwardProtocol(f.Protocol),
+			PortCount:     f.PortCount,
+			ProxyIn:       f.ProxyIn,
+			ProxyOut:      f.ProxyOut,
+			AllowIPs:      f.AllowIPs,
+			DenyIPs:       f.DenyIPs,
+			SNIHosts:      f.SNIHosts,
+			ConnLog:       f.ConnLog,
+			ListenIP:      f.ListenIP,
+			InterfaceName: f.InterfaceName,
+			InFlow:        f.InFlow,
+			OutFlow:       f.OutFlow,
+			CreatedTime:   f.CreatedTime,
+			UpdatedTime:   now,
+			Status:        f.Status,
+			Inx:           f.Inx,
+		}
+		if f.HealthCheck != nil {
+			item.ForwardHealthCheck = *f.HealthCheck
+		}
+		if f.Schedule != nil {
+			item.Schedule = *f.Schedule
+		}
+		if f.HTTP != nil {
+			item.ForwardHTTP = *f.HTTP
+		}
+		if f.DNS != nil {
+			item.DNSResolver = *f.DNS
 		}
 		err := tx.Clauses(clause.OnConflict{
 			Columns: []clause.Column{{Name: "id"}},
 			DoUpdates: clause.AssignmentColumns([]string{
 				"user_id", "user_name", "name", "tunnel_id", "remote_addr", "strategy",
-				"in_flow", "out_flow", "updated_time", "status", "inx",
+				"max_conns", "max_ip_conns", "protocol", "port_count", "proxy_in", "proxy_out", "allow_ips", "deny_ips", "sni_hosts", "conn_log", "listen_ip", "interface_name", "in_flow", "out_flow", "updated_time", "status", "inx",
+				"health_check", "health_interval", "health_path", "healthy_threshold", "unhealthy_threshold",
+				"schedule_on", "schedule_off",
+				"http_mode", "http_routes", "http_cert_id", "http_access_log",
+				"dns_servers", "dns_prefer", "dns_ttl",
 			}),
 		}).Create(&item).Error
 		if err != nil {
@@ -1939,18 +2126,23 @@ func importUserTunnels(tx *gorm.DB, userTunnels []model.UserTunnelBackup, _ int6
 			TunnelID:      ut.TunnelID,
 			SpeedID:       sql.NullInt64{Int64: ut.SpeedID, Valid: ut.SpeedID > 0},
 			Num:           ut.Num,
+			MaxIPs:        ut.MaxIPs,
 			Flow:          ut.Flow,
 			InFlow:        ut.InFlow,
 			OutFlow:       ut.OutFlow,
 			FlowResetTime: ut.FlowResetTime,
 			ExpTime:       ut.ExpTime,
 			Status:        ut.Status,
+			InterfaceName: ut.InterfaceName,
+		}
+		if ut.Schedule != nil {
+			item.Schedule = *ut.Schedule
 		}
 		err := tx.Clauses(clause.OnConflict{
 			Columns: []clause.Column{{Name: "id"}},
 			DoUpdates: clause.AssignmentColumns([]string{
-				"user_id", "tunnel_id", "speed_id", "num", "flow", "in_flow", "out_flow",
-				"flow_reset_time", "exp_time", "status",
+				"user_id", "tunnel_id", "speed_id", "num", "max_ips", "flow", "in_flow", "out_flow",
+				"flow_reset_time", "exp_time", "status", "interface_name", "schedule_on", "schedule_off",
 			}),
 		}).Create(&item).Error
 		if err != nil {
@@ -1968,6 +2160,8 @@ func importSpeedLimits(tx *gorm.DB, speedLimits []model.SpeedLimitBackup, now in
 			ID:          sl.ID,
 			Name:        sl.Name,
 			Speed:       int(sl.Speed),
+			ConnSpeed:   sl.ConnSpeed,
+			IPSpeed:     sl.IPSpeed,
 			TunnelID:    sl.TunnelID,
 			TunnelName:  sl.TunnelName,
 			CreatedTime: sl.CreatedTime,
@@ -1977,7 +2171,7 @@ func importSpeedLimits(tx *gorm.DB, speedLimits []model.SpeedLimitBackup, now in
 		err := tx.Clauses(clause.OnConflict{
 			Columns: []clause.Column{{Name: "id"}},
 			DoUpdates: clause.AssignmentColumns([]string{
-				"name", "speed", "tunnel_id", "tunnel_name", "updated_time", "status",
+				"name", "speed", "conn_speed", "ip_speed", "tunnel_id", "tunnel_name", "updated_time", "status",
 			}),
 		}).Create(&item).Error
 		if err != nil {
@@ -2155,30 +2349,52 @@ func (r *Repository) ResetUserMonthlyFlow(day int, lastDay int) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
 	}
-	updates := map[string]interface{}{"in_flow": 0, "out_flow": 0}
-	if day == lastDay {
-		return r.db.Model(&model.User{}).
-			Where("flow_reset_time != 0 AND (flow_reset_time = ? OR flow_reset_time > ?)", day, lastDay).
-			Updates(updates).Error
-	}
-	return r.db.Model(&model.User{}).
-		Where("flow_reset_time != 0 AND flow_reset_time = ?", day).
-		Updates(updates).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&model.User{})
+		if day == lastDay {
+			query = query.Where("flow_reset_time != 0 AND (flow_reset_time = ? OR flow_reset_time > ?)", day, lastDay)
+		} else {
+			query = query.Where("flow_reset_time != 0 AND flow_reset_time = ?", day)
+		}
+		var ids []int64
+		if err := query.Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.Model(&model.User{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"in_flow": 0, "out_flow": 0}).Error; err != nil {
+			return err
+		}
+		return checkpointUserCounters(tx, ids, unixMilliNow())
+	})
 }
 
 func (r *Repository) ResetUserTunnelMonthlyFlow(day int, lastDay int) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
 	}
-	updates := map[string]interface{}{"in_flow": 0, "out_flow": 0}
-	if day == lastDay {
-		return r.db.Model(&model.UserTunnel{}).
-			Where("flow_reset_time != 0 AND (flow_reset_time = ? OR flow_reset_time > ?)", day, lastDay).
-			Updates(updates).Error
-	}
-	return r.db.Model(&model.UserTunnel{}).
-		Where("flow_reset_time != 0 AND flow_reset_time = ?", day).
-		Updates(updates).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&model.UserTunnel{})
+		if day == lastDay {
+			query = query.Where("flow_reset_time != 0 AND (flow_reset_time = ? OR flow_reset_time > ?)", day, lastDay)
+		} else {
+			query = query.Where("flow_reset_time != 0 AND flow_reset_time = ?", day)
+		}
+		var ids []int64
+		if err := query.Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.Model(&model.UserTunnel{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"in_flow": 0, "out_flow": 0}).Error; err != nil {
+			return err
+		}
+		return checkpointUserTunnelCounters(tx, ids, unixMilliNow())
+	})
 }
 
 func (r *Repository) ListExpiredActiveUserIDs(nowMs int64) ([]int64, error) {
@@ -2242,7 +2458,7 @@ func (r *Repository) GetUserTunnelByID(id int64) (*model.UserTunnel, error) {
 
 // ─── Migration ───────────────────────────────────────────────────────
 
-const currentSchemaVersion = 2
+const currentSchemaVersion = 3
 
 var ensurePostgresIDDefaultsFn = ensurePostgresIDDefaults
 
@@ -2296,6 +2512,13 @@ func migrateSchema(db *gorm.DB) error {
 		return err
 	}
 
+	// Usage ledger baseline: counters accumulated before the ledger existed
+	if ver < 3 {
+		if err := checkpointAllUsageCounters(db, unixMilliNow()); err != nil {
+			return fmt.Errorf("checkpoint usage counters: %w", err)
+		}
+	}
+
 	setSchemaVersion(db, currentSchemaVersion)
 	return nil
 }
@@ -2429,7 +2652,10 @@ func quoteSQLLiteral(value string) string {
 
 // ─── Helper Functions ────────────────────────────────────────────────
 
-func resolveForwardIngress(db *gorm.DB, forwardID int64, tunnelID int64) (string, sql.NullInt64, error) {
+// resolveForwardIngress returns the addresses users reach a forward at: the
+// forward's listen IP when it is bound to one, otherwise the tunnel's
+// ingress IPs or the entry nodes' addresses.
+func resolveForwardIngress(db *gorm.DB, forwardID int64, tunnelID int64, listenIP string) (string, sql.NullInt64, error) {
 	var tunnelInIP sql.NullString
 	db.Model(&model.Tunnel{}).Select("in_ip").Where("id = ?", tunnelID).Limit(1).Scan(&tunnelInIP)
 
@@ -2477,7 +2703,11 @@ func resolveForwardIngress(db *gorm.DB, forwardID int64, tunnelID int64) (string
 	inPort := sql.NullInt64{Int64: ports[0], Valid: true}
 
 	entries := make([]string, 0)
-	if tunnelInIP.Valid && strings.TrimSpace(tunnelInIP.String) != "" {
+	if listenIP != "" {
+		for _, port := range ports {
+			entries = append(entries, net.JoinHostPort(listenIP, strconv.FormatInt(port, 10)))
+		}
+	} else if tunnelInIP.Valid && strings.TrimSpace(tunnelInIP.String) != "" {
 		tunnelIPs := strings.Split(tunnelInIP.String, ",")
 		seen := make(map[string]struct{})
 		for _, ip := range tunnelIPs {
@@ -2500,6 +2730,15 @@ func resolveForwardIngress(db *gorm.DB, forwardID int64, tunnelID int64) (string
 	return strings.Join(entries, ","), inPort, nil
 }
 
+// nodeInterfaces decodes the interfaces a node's agent reported.
+func nodeInterfaces(raw string) []model.NodeInterface {
+	ifaces := make([]model.NodeInterface, 0)
+	if raw != "" {
+		_ = json.Unmarshal([]byte(raw), &ifaces)
+	}
+	return ifaces
+}
+
 func nullableString(v sql.NullString) interface{} {
 	if v.Valid {
 		return v.String
@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"errors"
+
+	"go-backend/internal/store/model"
+)
+
+// ListCertificates returns the certificates of a user, or of every user
+// when userID is 0, without their private keys.
+func (r *Repository) ListCertificates(userID int64) ([]model.Certificate, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	q := r.db.Model(&model.Certificate{}).
+		Select("id, user_id, name, domains, not_after, created_time, updated_time")
+	if userID > 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	var rows []model.Certificate
+	err := q.Order("id ASC").Find(&rows).Error
+	return rows, err
+}
+
+func (r *Repository) GetCertificate(id int64) (*model.Certificate, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var c model.Certificate
+	if err := r.db.Where("id = ?", id).First(&c).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *Repository) CreateCertificate(c *model.Certificate) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Create(c).Error
+}
+
+func (r *Repository) UpdateCertificate(id int64, name, domains, certPEM, keyPEM string, notAfter, now int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Certificate{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"name":         name,
+			"domains":      domains,
+			"cert_pem":     certPEM,
+			"key_pem":      keyPEM,
+			"not_after":    notAfter,
+			"updated_time": now,
+		}).Error
+}
+
+func (r *Repository) DeleteCertificate(id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Where("id = ?", id).Delete(&model.Certificate{}).Error
+}
+
+// ListForwardsByCertificate returns the HTTPS forwards terminating TLS with
+// a certificate.
+func (r *Repository) ListForwardsByCertificate(certID int64) ([]model.ForwardRecord, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var rows []model.ForwardRecord
+	err := r.db.Model(&model.Forward{}).
+		Select("id, user_id, name, tunnel_id, status").
+		Where("http_mode = ? AND http_cert_id = ?", "https", certID).
+		Order("id ASC").
+		Scan(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"errors"
+
+	"gorm.io/gorm/clause"
+
+	"go-backend/internal/store/model"
+)
+
+const (
+	// IPLimitModeReject stops admitting new source IPs once a limit is reached.
+	IPLimitModeReject = 0
+	// IPLimitModeAlert only records that the limit was exceeded.
+	IPLimitModeAlert = 1
+)
+
+// ClientIPCount is one distinct source IP inside an IP-limit scope, with
+// the earliest time any of the scope's forwards saw it.
+type ClientIPCount struct {
+	IP        string
+	FirstSeen int64
+}
+
+// TouchForwardClientIPs records IPs an agent reported for a forward on a
+// node, refreshing last_seen for IPs already known.
+func (r *Repository) TouchForwardClientIPs(forwardID, userID, userTunnelID, nodeID int64, ips []string, now int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+	rows := make([]model.ForwardClientIP, 0, len(ips))
+	for _, ip := range ips {
+		if ip == "" || len(ip) > 64 {
+			continue
+		}
+		rows = append(rows, model.ForwardClientIP{
+			ForwardID:    forwardID,
+			NodeID:       nodeID,
+			IP:           ip,
+			UserID:       userID,
+			UserTunnelID: userTunnelID,
+			FirstSeen:    now,
+			LastSeen:     now,
+		})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "forward_id"}, {Name: "node_id"}, {Name: "ip"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "user_tunnel_id", "last_seen"}),
+	}).Create(&rows).Error
+}
+
+// ListActiveClientIPs returns the distinct source IPs seen since the given
+// time across a user's forwards, oldest first. A positive userTunnelID
+// narrows the scope to that user tunnel.
+func (r *Repository) ListActiveClientIPs(userID, userTunnelID, since int64) ([]ClientIPCount, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	q := r.db.Model(&model.ForwardClientIP{}).
+		Select("ip, MIN(first_seen) AS first_seen").
+		Where("user_id = ? AND last_seen >= ?", userID, since)
+	if userTunnelID > 0 {
+		q = q.Where("user_tunnel_id = ?", userTunnelID)
+	}
+	var rows []ClientIPCount
+	if err := q.Group("ip").Order("first_seen ASC, ip ASC").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ListForwardClientIPs returns the per-node source IP rows of a forward seen
+// since the given time, most recent first.
+func (r *Repository) ListForwardClientIPs(forwardID, since int64) ([]model.ForwardClientIP, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var rows []model.ForwardClientIP
+	err := r.db.Where("forward_id = ? AND last_seen >= ?", forwardID, since).
+		Order("last_seen DESC, id ASC").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = make([]model.ForwardClientIP, 0)
+	}
+	return rows, nil
+}
+
+// PurgeForwardClientIPs drops rows not refreshed since the cutoff.
+func (r *Repository) PurgeForwardClientIPs(before int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Where("last_seen < ?", before).Delete(&model.ForwardClientIP{}).Error
+}
+
+// GetUserIPLimit returns the user's source IP limit (0 means none) and how
+// an excess is handled.
+func (r *Repository) GetUserIPLimit(userID int64) (maxIPs, mode int, err error) {
+	if r == nil || r.db == nil {
+		return 0, 0, errors.New("repository not initialized")
+	}
+	var user model.User
+	if err := r.db.Select("max_ips", "ip_limit_mode").Where("id = ?", userID).First(&user).Error; err != nil {
+		return 0, 0, normalizeNotFoundErr(err)
+	}
+	return user.MaxIPs, user.IPLimitMode, nil
+}
+
+// ListUserTunnelIPLimits maps the user's tunnel permissions that carry a
+// source IP limit to that limit.
+func (r *Repository) ListUserTunnelIPLimits(userID int64) (map[int64]int, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var uts []model.UserTunnel
+	err := r.db.Select("id", "max_ips").
+		Where("user_id = ? AND max_ips > 0", userID).
+		Find(&uts).Error
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int64]int, len(uts))
+	for _, ut := range uts {
+		out[ut.ID] = ut.MaxIPs
+	}
+	return out, nil
+}
@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"errors"
+
+	"go-backend/internal/store/model"
+)
+
+// ConnLogQuery filters a connection log search. Zero values leave a field
+// unfiltered; a positive UserID limits the search to that user's forwards.
+type ConnLogQuery struct {
+	UserID    int64
+	ForwardID int64
+	NodeID    int64
+	Client    string
+	Target    string
+	// Failed keeps only connections closed with an error.
+	Failed bool
+	Since  int64
+	Until  int64
+	Offset int
+	Limit  int
+}
+
+// InsertForwardConnLogs stores a batch of connection logs.
+func (r *Repository) InsertForwardConnLogs(rows []model.ForwardConnLog) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return r.db.CreateInBatches(rows, 200).Error
+}
+
+// SearchForwardConnLogs returns the connection logs matching q, newest
+// first, with the total number of matches.
+func (r *Repository) SearchForwardConnLogs(q ConnLogQuery) ([]model.ForwardConnLog, int64, error) {
+	if r == nil || r.db == nil {
+		return nil, 0, errors.New("repository not initialized")
+	}
+	tx := r.db.Model(&model.ForwardConnLog{})
+	if q.UserID > 0 {
+		tx = tx.Where("user_id = ?", q.UserID)
+	}
+	if q.ForwardID > 0 {
+		tx = tx.Where("forward_id = ?", q.ForwardID)
+	}
+	if q.NodeID > 0 {
+		tx = tx.Where("node_id = ?", q.NodeID)
+	}
+	if q.Client != "" {
+		tx = tx.Where("client_addr LIKE ?", q.Client+"%")
+	}
+	if q.Target != "" {
+		tx = tx.Where("target_addr LIKE ?", q.Target+"%")
+	}
+	if q.Failed {
+		tx = tx.Where("reason <> ''")
+	}
+	if q.Since > 0 {
+		tx = tx.Where("start_time >= ?", q.Since)
+	}
+	if q.Until > 0 {
+		tx = tx.Where("start_time < ?", q.Until)
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	rows := make([]model.ForwardConnLog, 0)
+	err := tx.Order("start_time DESC, id DESC").Offset(q.Offset).Limit(q.Limit).Find(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
+
+// PurgeForwardConnLogs drops connection logs started before the cutoff and,
+// beyond that, the oldest rows over maxRows.
+func (r *Repository) PurgeForwardConnLogs(before int64, maxRows int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	if err := r.db.Where("start_time < ?", before).Delete(&model.ForwardConnLog{}).Error; err != nil {
+		return err
+	}
+	if maxRows <= 0 {
+		return nil
+	}
+	var cutoff model.ForwardConnLog
+	err := r.db.Select("id").Order("id DESC").Offset(int(maxRows)).Limit(1).Find(&cutoff).Error
+	if err != nil || cutoff.ID == 0 {
+		return err
+	}
+	return r.db.Where("id <= ?", cutoff.ID).Delete(&model.ForwardConnLog{}).Error
+}
@@ -38,20 +38,38 @@ func (r *Repository) ListForwardsByTunnel(tunnelID int64) ([]model.ForwardRecord
 	rows := make([]model.ForwardRecord, 0, len(forwards))
 	for _, f := range forwards {
 		rows = append(rows, model.ForwardRecord{
-			ID:         f.ID,
-			UserID:     f.UserID,
-			UserName:   f.UserName,
-			Name:       f.Name,
-			TunnelID:   f.TunnelID,
-			RemoteAddr: f.RemoteAddr,
-			Strategy:   f.Strategy,
-			Status:     f.Status,
+			ID:            f.ID,
+			UserID:        f.UserID,
+			UserName:      f.UserName,
+			Name:          f.Name,
+			TunnelID:      f.TunnelID,
+			RemoteAddr:    f.RemoteAddr,
+			Strategy:      f.Strategy,
+			MaxConns:      f.MaxConns,
+			MaxIPConns:    f.MaxIPConns,
+			Protocol:      f.Protocol,
+			PortCount:     f.PortCount,
+			ProxyIn:       f.ProxyIn,
+			ProxyOut:      f.ProxyOut,
+			AllowIPs:      f.AllowIPs,
+			DenyIPs:       f.DenyIPs,
+			SNIHosts:      f.SNIHosts,
+			ConnLog:       f.ConnLog,
+			ListenIP:      f.ListenIP,
+			InterfaceName: f.InterfaceName,
+			Status:        f.Status,
+
+			ForwardHealthCheck: f.ForwardHealthCheck,
+			Schedule:           f.Schedule,
+			ForwardHTTP:        f.ForwardHTTP,
+			DNSResolver:        f.DNSResolver,
 		})
 	}
 	for i := range rows {
 		if strings.TrimSpace(rows[i].Strategy) == "" {
 			rows[i].Strategy = "fifo"
 		}
+		rows[i].Protocol = NormalizeForwardProtocol(rows[i].Protocol)
 	}
 	return rows, nil
 }
@@ -72,6 +90,25 @@ func (r *Repository) ListForwardPorts(forwardID int64) ([]model.ForwardPortRecor
 	return rows, nil
 }
 
+// ListActiveForwardIDsOnNode returns the active forwards running services on
+// a node: those entering there, and those of the reverse tunnels it exits.
+func (r *Repository) ListActiveForwardIDsOnNode(nodeID int64) ([]int64, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	entering := r.db.Model(&model.ForwardPort{}).Select("forward_id").Where("node_id = ?", nodeID)
+	exiting := r.db.Model(&model.ChainTunnel{}).
+		Select("chain_tunnel.tunnel_id").
+		Joins("JOIN tunnel ON tunnel.id = chain_tunnel.tunnel_id").
+		Where("chain_tunnel.chain_type = ? AND chain_tunnel.node_id = ? AND tunnel.type = 3", "3", nodeID)
+	var ids []int64
+	err := r.db.Model(&model.Forward{}).
+		Where("status = 1 AND (id IN (?) OR tunnel_id IN (?))", entering, exiting).
+		Order("id ASC").
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
 func (r *Repository) GetTunnelOutProtocol(tunnelID int64) (string, error) {
 	if r == nil || r.db == nil {
 		return "", errors.New("repository not initialized")
@@ -134,7 +171,8 @@ func nodeRecordFromModel(n *model.Node) *model.NodeRecord {
 		Status:        n.Status,
 		PortRange:     n.Port,
 		TCPListenAddr: n.TCPListenAddr, UDPListenAddr: n.UDPListenAddr,
-		IsRemote: n.IsRemote,
+		ListenIPs: n.ListenIPs, Interfaces: n.Interfaces,
+		IsRemote: n.IsRemote, DNSResolver: n.DNSResolver,
 	}
 	if n.ServerIPV4.Valid {
 		rec.ServerIPv4 = strings.TrimSpace(n.ServerIPV4.String)
@@ -174,10 +212,12 @@ func (r *Repository) ResolveUserTunnelAndLimiter(userID, tunnelID int64) (*model
 		UserTunnelID int64         `gorm:"column:user_tunnel_id"`
 		LimiterID    sql.NullInt64 `gorm:"column:limiter_id"`
 		Speed        sql.NullInt64 `gorm:"column:speed"`
+		ConnSpeed    sql.NullInt64 `gorm:"column:conn_speed"`
+		IPSpeed      sql.NullInt64 `gorm:"column:ip_speed"`
 	}
 	var rec row
 	err := r.db.Model(&model.UserTunnel{}).
-		Select("user_tunnel.id AS user_tunnel_id, speed_limit.id AS limiter_id, speed_limit.speed AS speed").
+		Select("user_tunnel.id AS user_tunnel_id, speed_limit.id AS limiter_id, speed_limit.speed AS speed, speed_limit.conn_speed AS conn_speed, speed_limit.ip_speed AS ip_speed").
 		Joins("LEFT JOIN speed_limit ON speed_limit.id = user_tunnel.speed_id").
 		Where("user_tunnel.user_id = ? AND user_tunnel.tunnel_id = ?", userID, tunnelID).
 		Order("user_tunnel.id ASC").
@@ -195,10 +235,30 @@ func (r *Repository) ResolveUserTunnelAndLimiter(userID, tunnelID int64) (*model
 		info.LimiterID = &v
 		s := int(rec.Speed.Int64)
 		info.Speed = &s
+		info.ConnSpeed = int(rec.ConnSpeed.Int64)
+		info.IPSpeed = int(rec.IPSpeed.Int64)
 	}
 	return info, nil
 }
 
+// GetUserTunnelInterface returns the egress a user tunnel sets for the
+// forwards of its user on the tunnel.
+func (r *Repository) GetUserTunnelInterface(userID, tunnelID int64) (string, error) {
+	if r == nil || r.db == nil {
+		return "", errors.New("repository not initialized")
+	}
+	var names []string
+	err := r.db.Model(&model.UserTunnel{}).
+		Where("user_id = ? AND tunnel_id = ?", userID, tunnelID).
+		Order("id ASC").
+		Limit(1).
+		Pluck("COALESCE(interface_name, '')", &names).Error
+	if err != nil || len(names) == 0 {
+		return "", err
+	}
+	return names[0], nil
+}
+
 func (r *Repository) ListUserTunnelIDs(userID, tunnelID int64) ([]int64, error) {
 	if r == nil || r.db == nil {
 		return nil, errors.New("repository not initialized")
@@ -227,6 +287,18 @@ func (r *Repository) ListUserTunnelIDsByUser(userID int64) ([]int64, error) {
 	return ids, nil
 }
 
+func (r *Repository) GetUserSpeed(userID int64) (int, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("repository not initialized")
+	}
+	var user model.User
+	err := r.db.Select("speed").Where("id = ?", userID).First(&user).Error
+	if err != nil {
+		return 0, normalizeNotFoundErr(err)
+	}
+	return user.Speed, nil
+}
+
 func (r *Repository) GetTunnelName(tunnelID int64) (string, error) {
 	if r == nil || r.db == nil {
 		return "", errors.New("repository not initialized")
@@ -254,10 +326,11 @@ func (r *Repository) ListChainNodesForTunnel(tunnelID int64) ([]model.ChainNodeR
 		Name      sql.NullString
 		Protocol  sql.NullString
 		Strategy  sql.NullString
+		Options   sql.NullString
 	}
 	var rows []row
 	err := r.db.Model(&model.ChainTunnel{}).
-		Select("chain_tunnel.chain_type, chain_tunnel.inx, chain_tunnel.node_id, chain_tunnel.port, node.name, chain_tunnel.protocol, chain_tunnel.strategy").
+		Select("chain_tunnel.chain_type, chain_tunnel.inx, chain_tunnel.node_id, chain_tunnel.port, node.name, chain_tunnel.protocol, chain_tunnel.strategy, chain_tunnel.options").
 		Joins("LEFT JOIN node ON node.id = chain_tunnel.node_id").
 		Where("chain_tunnel.tunnel_id = ?", tunnelID).
 		Order("chain_tunnel.chain_type ASC, chain_tunnel.inx ASC, chain_tunnel.id ASC").
@@ -302,6 +375,7 @@ func (r *Repository) ListChainNodesForTunnel(tunnelID int64) ([]model.ChainNodeR
 		} else {
 			item.Strategy = row.Strategy.String
 		}
+		item.Options = row.Options.String
 		result = append(result, item)
 	}
 	return result, nil
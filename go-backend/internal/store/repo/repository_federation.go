@@ -160,10 +160,7 @@ func (r *Repository) ListUsedPortsOnNode(nodeID int64) ([]int, error) {
 		}
 	}
 
-	var forwardPorts []int
-	err = r.db.Model(&model.ForwardPort{}).
-		Where("node_id = ? AND port > 0", nodeID).
-		Pluck("port", &forwardPorts).Error
+	forwardPorts, err := forwardPortsTaken(r.db.Model(&model.ForwardPort{}).Where("forward_port.node_id = ?", nodeID))
 	if err != nil {
 		return nil, err
 	}
@@ -18,6 +18,35 @@ func (r *Repository) UpdateForwardStatus(forwardID int64, status int, now int64)
 	}).Error
 }
 
+// SwapForwardStatus moves a forward from one status to another and reports
+// whether it was still in the from status.
+func (r *Repository) SwapForwardStatus(forwardID int64, from, to int, now int64) (bool, error) {
+	if r == nil || r.db == nil {
+		return false, errors.New("repository not initialized")
+	}
+	res := r.db.Model(&model.Forward{}).Where("id = ? AND status = ?", forwardID, from).Updates(map[string]interface{}{
+		"status": to, "updated_time": now,
+	})
+	return res.RowsAffected > 0, res.Error
+}
+
+// ListScheduledForwards returns the running and schedule-paused forwards
+// that have a schedule of their own or through their user tunnel, plus any
+// schedule-paused forward whose schedule has since been cleared.
+func (r *Repository) ListScheduledForwards() ([]model.ScheduledForward, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var rows []model.ScheduledForward
+	err := r.db.Model(&model.Forward{}).
+		Select("forward.id, forward.user_id, forward.tunnel_id, COALESCE(user_tunnel.id, 0) AS user_tunnel_id, forward.status, COALESCE(forward.schedule_on, '') AS schedule_on, COALESCE(forward.schedule_off, '') AS schedule_off, COALESCE(user_tunnel.schedule_on, '') AS tunnel_schedule_on, COALESCE(user_tunnel.schedule_off, '') AS tunnel_schedule_off").
+		Joins("LEFT JOIN user_tunnel ON user_tunnel.user_id = forward.user_id AND user_tunnel.tunnel_id = forward.tunnel_id").
+		Where("forward.status = 2 OR (forward.status = 1 AND (COALESCE(forward.schedule_on, '') != '' OR COALESCE(user_tunnel.schedule_on, '') != ''))").
+		Order("forward.id ASC").
+		Find(&rows).Error
+	return rows, err
+}
+
 func (r *Repository) ListActiveForwardsByUser(userID int64) ([]model.ForwardRecord, error) {
 	if r == nil || r.db == nil {
 		return nil, errors.New("repository not initialized")
@@ -30,20 +59,38 @@ func (r *Repository) ListActiveForwardsByUser(userID int64) ([]model.ForwardReco
 	rows := make([]model.ForwardRecord, 0, len(forwards))
 	for _, f := range forwards {
 		rows = append(rows, model.ForwardRecord{
-			ID:         f.ID,
-			UserID:     f.UserID,
-			UserName:   f.UserName,
-			Name:       f.Name,
-			TunnelID:   f.TunnelID,
-			RemoteAddr: f.RemoteAddr,
-			Strategy:   f.Strategy,
-			Status:     f.Status,
+			ID:            f.ID,
+			UserID:        f.UserID,
+			UserName:      f.UserName,
+			Name:          f.Name,
+			TunnelID:      f.TunnelID,
+			RemoteAddr:    f.RemoteAddr,
+			Strategy:      f.Strategy,
+			MaxConns:      f.MaxConns,
+			MaxIPConns:    f.MaxIPConns,
+			Protocol:      f.Protocol,
+			PortCount:     f.PortCount,
+			ProxyIn:       f.ProxyIn,
+			ProxyOut:      f.ProxyOut,
+			AllowIPs:      f.AllowIPs,
+			DenyIPs:       f.DenyIPs,
+			SNIHosts:      f.SNIHosts,
+			ConnLog:       f.ConnLog,
+			ListenIP:      f.ListenIP,
+			InterfaceName: f.InterfaceName,
+			Status:        f.Status,
+
+			ForwardHealthCheck: f.ForwardHealthCheck,
+			Schedule:           f.Schedule,
+			ForwardHTTP:        f.ForwardHTTP,
+			DNSResolver:        f.DNSResolver,
 		})
 	}
 	for i := range rows {
 		if strings.TrimSpace(rows[i].Strategy) == "" {
 			rows[i].Strategy = "fifo"
 		}
+		rows[i].Protocol = NormalizeForwardProtocol(rows[i].Protocol)
 	}
 	return rows, nil
 }
@@ -60,20 +107,38 @@ func (r *Repository) ListActiveForwardsByUserTunnel(userID, tunnelID int64) ([]m
 	rows := make([]model.ForwardRecord, 0, len(forwards))
 	for _, f := range forwards {
 		rows = append(rows, model.ForwardRecord{
-			ID:         f.ID,
-			UserID:     f.UserID,
-			UserName:   f.UserName,
-			Name:       f.Name,
-			TunnelID:   f.TunnelID,
-			RemoteAddr: f.RemoteAddr,
-			Strategy:   f.Strategy,
-			Status:     f.Status,
+			ID:            f.ID,
+			UserID:        f.UserID,
+			UserName:      f.UserName,
+			Name:          f.Name,
+			TunnelID:      f.TunnelID,
+			RemoteAddr:    f.RemoteAddr,
+			Strategy:      f.Strategy,
+			MaxConns:      f.MaxConns,
+			MaxIPConns:    f.MaxIPConns,
+			Protocol:      f.Protocol,
+			PortCount:     f.PortCount,
+			ProxyIn:       f.ProxyIn,
+			ProxyOut:      f.ProxyOut,
+			AllowIPs:      f.AllowIPs,
+			DenyIPs:       f.DenyIPs,
+			SNIHosts:      f.SNIHosts,
+			ConnLog:       f.ConnLog,
+			ListenIP:      f.ListenIP,
+			InterfaceName: f.InterfaceName,
+			Status:        f.Status,
+
+			ForwardHealthCheck: f.ForwardHealthCheck,
+			Schedule:           f.Schedule,
+			ForwardHTTP:        f.ForwardHTTP,
+			DNSResolver:        f.DNSResolver,
 		})
 	}
 	for i := range rows {
 		if strings.TrimSpace(rows[i].Strategy) == "" {
 			rows[i].Strategy = "fifo"
 		}
+		rows[i].Protocol = NormalizeForwardProtocol(rows[i].Protocol)
 	}
 	return rows, nil
 }
@@ -91,15 +156,33 @@ func (r *Repository) GetForwardRecord(forwardID int64) (*model.ForwardRecord, er
 		return nil, err
 	}
 	fr := model.ForwardRecord{
-		ID:         f.ID,
-		UserID:     f.UserID,
-		UserName:   f.UserName,
-		Name:       f.Name,
-		TunnelID:   f.TunnelID,
-		RemoteAddr: f.RemoteAddr,
-		Strategy:   f.Strategy,
-		Status:     f.Status,
+		ID:            f.ID,
+		UserID:        f.UserID,
+		UserName:      f.UserName,
+		Name:          f.Name,
+		TunnelID:      f.TunnelID,
+		RemoteAddr:    f.RemoteAddr,
+		Strategy:      f.Strategy,
+		MaxConns:      f.MaxConns,
+		MaxIPConns:    f.MaxIPConns,
+		Protocol:      f.Protocol,
+		PortCount:     f.PortCount,
+		ProxyIn:       f.ProxyIn,
+		ProxyOut:      f.ProxyOut,
+		AllowIPs:      f.AllowIPs,
+		DenyIPs:       f.DenyIPs,
+		SNIHosts:      f.SNIHosts,
+		ConnLog:       f.ConnLog,
+		ListenIP:      f.ListenIP,
+		InterfaceName: f.InterfaceName,
+		Status:        f.Status,
+
+		ForwardHealthCheck: f.ForwardHealthCheck,
+		Schedule:           f.Schedule,
+		ForwardHTTP:        f.ForwardHTTP,
+		DNSResolver:        f.DNSResolver,
 	}
+	fr.Protocol = NormalizeForwardProtocol(fr.Protocol)
 	if strings.TrimSpace(fr.Strategy) == "" {
 		fr.Strategy = "fifo"
 	}
@@ -124,6 +207,8 @@ func (r *Repository) GetTunnelRecord(tunnelID int64) (*model.TunnelRecord, error
 		Status:       t.Status,
 		Flow:         t.Flow,
 		TrafficRatio: t.TrafficRatio,
+		AllowIPs:     t.AllowIPs,
+		DenyIPs:      t.DenyIPs,
 	}
 	if tr.Flow <= 0 {
 		tr.Flow = 1
@@ -169,3 +254,35 @@ func (r *Repository) SpeedLimitExists(id int64) (bool, error) {
 	}
 	return count > 0, nil
 }
+
+const (
+	ForwardProtocolTCP  = "tcp"
+	ForwardProtocolUDP  = "udp"
+	ForwardProtocolBoth = "tcp+udp"
+)
+
+// NormalizeForwardProtocol maps a stored forward protocol to one of the
+// known values; rows written before the column existed carry both.
+func NormalizeForwardProtocol(protocol string) string {
+	switch strings.ToLower(strings.TrimSpace(protocol)) {
+	case ForwardProtocolTCP:
+		return ForwardProtocolTCP
+	case ForwardProtocolUDP:
+		return ForwardProtocolUDP
+	default:
+		return ForwardProtocolBoth
+	}
+}
+
+// ForwardProtocolsSharingPort lists the forward protocols that cannot share
+// a listen port with the given one.
+func ForwardProtocolsSharingPort(protocol string) []string {
+	switch NormalizeForwardProtocol(protocol) {
+	case ForwardProtocolTCP:
+		return []string{ForwardProtocolTCP, ForwardProtocolBoth}
+	case ForwardProtocolUDP:
+		return []string{ForwardProtocolUDP, ForwardProtocolBoth}
+	default:
+		return []string{ForwardProtocolTCP, ForwardProtocolUDP, ForwardProtocolBoth}
+	}
+}
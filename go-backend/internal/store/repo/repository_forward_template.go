@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"errors"
+
+	"go-backend/internal/store/model"
+)
+
+func (r *Repository) ListForwardTemplates() ([]model.ForwardTemplate, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var rows []model.ForwardTemplate
+	err := r.db.Order("id ASC").Find(&rows).Error
+	return rows, err
+}
+
+func (r *Repository) GetForwardTemplate(id int64) (*model.ForwardTemplate, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var t model.ForwardTemplate
+	if err := r.db.Where("id = ?", id).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *Repository) CreateForwardTemplate(t *model.ForwardTemplate) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Create(t).Error
+}
+
+func (r *Repository) UpdateForwardTemplate(id int64, name, config string, now int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.ForwardTemplate{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"name":         name,
+			"config":       config,
+			"updated_time": now,
+		}).Error
+}
+
+func (r *Repository) DeleteForwardTemplate(id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Where("id = ?", id).Delete(&model.ForwardTemplate{}).Error
+}
+
+// ListForwardIDsByUser returns the IDs of a user's forwards in list order.
+func (r *Repository) ListForwardIDsByUser(userID int64) ([]int64, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var ids []int64
+	err := r.db.Model(&model.Forward{}).
+		Where("user_id = ?", userID).
+		Order("inx ASC, id ASC").
+		Pluck("id", &ids).Error
+	return ids, err
+}
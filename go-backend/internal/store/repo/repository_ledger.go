@@ -0,0 +1,419 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-backend/internal/store/model"
+)
+
+const (
+	UsageLedgerKindFlow       = "flow"
+	UsageLedgerKindCheckpoint = "checkpoint"
+
+	UsageScopeUser       = "user"
+	UsageScopeUserTunnel = "userTunnel"
+	UsageScopeForward    = "forward"
+)
+
+var (
+	ErrUsagePeriodClosed  = errors.New("usage period closed")
+	ErrUsagePeriodInvalid = errors.New("usage period invalid")
+)
+
+type usageSums struct {
+	Count   int64
+	RawIn   int64
+	RawOut  int64
+	InFlow  int64
+	OutFlow int64
+}
+
+// UsagePeriodOf returns the billing period (YYYY-MM, server local time)
+// that a millisecond timestamp belongs to.
+func UsagePeriodOf(ms int64) string {
+	return time.UnixMilli(ms).Format("2006-01")
+}
+
+// ParseUsagePeriod validates a YYYY-MM period string.
+func ParseUsagePeriod(period string) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01", period, time.Local)
+	if err != nil {
+		return time.Time{}, ErrUsagePeriodInvalid
+	}
+	return t, nil
+}
+
+// RecordFlowUsage increments the forward, user and user-tunnel counters and
+// appends the matching ledger entry in one transaction, so counters never
+// move without a ledger trail.
+func (r *Repository) RecordFlowUsage(entry model.UsageLedger) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	if entry.CreatedTime <= 0 {
+		entry.CreatedTime = unixMilliNow()
+	}
+	entry.ID = 0
+	entry.Kind = UsageLedgerKindFlow
+	entry.Period = UsagePeriodOf(entry.CreatedTime)
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		closed, err := usagePeriodClosed(tx, entry.Period)
+		if err != nil {
+			return err
+		}
+		if closed {
+			return ErrUsagePeriodClosed
+		}
+		if err := addFlowCounters(tx, entry.ForwardID, entry.UserID, entry.UserTunnelID, entry.InFlow, entry.OutFlow); err != nil {
+			return err
+		}
+		return tx.Create(&entry).Error
+	})
+}
+
+func usagePeriodClosed(tx *gorm.DB, period string) (bool, error) {
+	var count int64
+	if err := tx.Model(&model.UsagePeriod{}).Where("period = ?", period).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ─── Checkpoints ─────────────────────────────────────────────────────
+
+func checkpointUserCounters(tx *gorm.DB, userIDs []int64, now int64) error {
+	query := tx.Model(&model.User{})
+	if userIDs != nil {
+		if len(userIDs) == 0 {
+			return nil
+		}
+		query = query.Where("id IN ?", userIDs)
+	}
+	var users []model.User
+	if err := query.Order("id ASC").Find(&users).Error; err != nil {
+		return err
+	}
+	entries := make([]model.UsageLedger, 0, len(users))
+	for _, u := range users {
+		entries = append(entries, newUsageCheckpoint(u.ID, 0, 0, 0, u.InFlow, u.OutFlow, now))
+	}
+	return createUsageEntries(tx, entries)
+}
+
+func checkpointUserTunnelCounters(tx *gorm.DB, userTunnelIDs []int64, now int64) error {
+	query := tx.Model(&model.UserTunnel{})
+	if userTunnelIDs != nil {
+		if len(userTunnelIDs) == 0 {
+			return nil
+		}
+		query = query.Where("id IN ?", userTunnelIDs)
+	}
+	var uts []model.UserTunnel
+	if err := query.Order("id ASC").Find(&uts).Error; err != nil {
+		return err
+	}
+	entries := make([]model.UsageLedger, 0, len(uts))
+	for _, ut := range uts {
+		entries = append(entries, newUsageCheckpoint(ut.UserID, ut.ID, 0, ut.TunnelID, ut.InFlow, ut.OutFlow, now))
+	}
+	return createUsageEntries(tx, entries)
+}
+
+func checkpointForwardCounters(tx *gorm.DB, now int64) error {
+	var forwards []model.Forward
+	if err := tx.Order("id ASC").Find(&forwards).Error; err != nil {
+		return err
+	}
+	entries := make([]model.UsageLedger, 0, len(forwards))
+	for _, f := range forwards {
+		entries = append(entries, newUsageCheckpoint(f.UserID, 0, f.ID, f.TunnelID, f.InFlow, f.OutFlow, now))
+	}
+	return createUsageEntries(tx, entries)
+}
+
+// checkpointAllUsageCounters records the current value of every counter.
+// It is used when counters change outside the flow path (schema upgrade,
+// backup import) so reconciliation starts from a known baseline.
+func checkpointAllUsageCounters(tx *gorm.DB, now int64) error {
+	if err := checkpointUserCounters(tx, nil, now); err != nil {
+		return err
+	}
+	if err := checkpointUserTunnelCounters(tx, nil, now); err != nil {
+		return err
+	}
+	return checkpointForwardCounters(tx, now)
+}
+
+func newUsageCheckpoint(userID, userTunnelID, forwardID, tunnelID, inFlow, outFlow, now int64) model.UsageLedger {
+	return model.UsageLedger{
+		Period:       UsagePeriodOf(now),
+		Kind:         UsageLedgerKindCheckpoint,
+		UserID:       userID,
+		UserTunnelID: userTunnelID,
+		ForwardID:    forwardID,
+		TunnelID:     tunnelID,
+		InFlow:       inFlow,
+		OutFlow:      outFlow,
+		CreatedTime:  now,
+	}
+}
+
+func createUsageEntries(tx *gorm.DB, entries []model.UsageLedger) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(&entries, 200).Error
+}
+
+// ─── Queries ─────────────────────────────────────────────────────────
+
+func (r *Repository) ListUsageLedgerSummary(period string, userID int64) ([]model.UsageLedgerSummary, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	query := r.db.Table("usage_ledger AS l").
+		Select(`l.period, l.user_id, COALESCE(u."user", '') AS user_name, l.user_tunnel_id, l.tunnel_id, l.forward_id,
+			COALESCE(f.name, '') AS forward_name,
+			SUM(l.raw_in) AS raw_in, SUM(l.raw_out) AS raw_out, SUM(l.in_flow) AS in_flow, SUM(l.out_flow) AS out_flow`).
+		Joins(`LEFT JOIN "user" u ON u.id = l.user_id`).
+		Joins(`LEFT JOIN forward f ON f.id = l.forward_id`).
+		Where("l.kind = ?", UsageLedgerKindFlow)
+	if period != "" {
+		query = query.Where("l.period = ?", period)
+	}
+	if userID > 0 {
+		query = query.Where("l.user_id = ?", userID)
+	}
+	var rows []model.UsageLedgerSummary
+	err := query.
+		Group(`l.period, l.user_id, u."user", l.user_tunnel_id, l.tunnel_id, l.forward_id, f.name`).
+		Order("l.period ASC, l.user_id ASC, l.forward_id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = []model.UsageLedgerSummary{}
+	}
+	return rows, nil
+}
+
+func (r *Repository) ListUsagePeriods() ([]map[string]interface{}, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var totals []struct {
+		Period  string
+		Count   int64
+		InFlow  int64
+		OutFlow int64
+	}
+	err := r.db.Model(&model.UsageLedger{}).
+		Select("period, COUNT(1) AS count, SUM(in_flow) AS in_flow, SUM(out_flow) AS out_flow").
+		Where("kind = ?", UsageLedgerKindFlow).
+		Group("period").Order("period DESC").
+		Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+	var closed []model.UsagePeriod
+	if err := r.db.Find(&closed).Error; err != nil {
+		return nil, err
+	}
+	closedByPeriod := make(map[string]model.UsagePeriod, len(closed))
+	for _, p := range closed {
+		closedByPeriod[p.Period] = p
+	}
+
+	out := make([]map[string]interface{}, 0, len(totals))
+	for _, t := range totals {
+		item := map[string]interface{}{
+			"period":     t.Period,
+			"entryCount": t.Count,
+			"inFlow":     t.InFlow,
+			"outFlow":    t.OutFlow,
+			"closed":     false,
+			"closedTime": nil,
+		}
+		if p, ok := closedByPeriod[t.Period]; ok {
+			item["closed"] = true
+			item["closedTime"] = p.ClosedTime
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+// CloseUsagePeriod locks a finished period. Only periods strictly before
+// the current one can be closed, so live flow is never rejected.
+func (r *Repository) CloseUsagePeriod(period string, now int64) (*model.UsagePeriod, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	if _, err := ParseUsagePeriod(period); err != nil {
+		return nil, err
+	}
+	if period >= UsagePeriodOf(now) {
+		return nil, fmt.Errorf("%w: period %s has not ended", ErrUsagePeriodInvalid, period)
+	}
+
+	var item model.UsagePeriod
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		closed, err := usagePeriodClosed(tx, period)
+		if err != nil {
+			return err
+		}
+		if closed {
+			return ErrUsagePeriodClosed
+		}
+		sums, err := sumUsageFlow(tx.Where("period = ?", period))
+		if err != nil {
+			return err
+		}
+		item = model.UsagePeriod{
+			Period:     period,
+			EntryCount: sums.Count,
+			RawIn:      sums.RawIn,
+			RawOut:     sums.RawOut,
+			InFlow:     sums.InFlow,
+			OutFlow:    sums.OutFlow,
+			ClosedTime: now,
+		}
+		return tx.Create(&item).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func sumUsageFlow(query *gorm.DB) (usageSums, error) {
+	var sums usageSums
+	err := query.Model(&model.UsageLedger{}).
+		Select(`COUNT(1) AS count, COALESCE(SUM(raw_in), 0) AS raw_in, COALESCE(SUM(raw_out), 0) AS raw_out,
+			COALESCE(SUM(in_flow), 0) AS in_flow, COALESCE(SUM(out_flow), 0) AS out_flow`).
+		Where("kind = ?", UsageLedgerKindFlow).
+		Scan(&sums).Error
+	return sums, err
+}
+
+// expectedCounter returns what a counter should hold according to the
+// ledger: its latest checkpoint plus every flow entry appended after it.
+func (r *Repository) expectedCounter(checkpointScope func(*gorm.DB) *gorm.DB, flowScope func(*gorm.DB) *gorm.DB) (int64, int64, bool, error) {
+	var cp model.UsageLedger
+	hasCheckpoint := true
+	err := checkpointScope(r.db.Where("kind = ?", UsageLedgerKindCheckpoint)).Order("id DESC").First(&cp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		hasCheckpoint = false
+	} else if err != nil {
+		return 0, 0, false, err
+	}
+
+	sums, err := sumUsageFlow(flowScope(r.db.Where("id > ?", cp.ID)))
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return cp.InFlow + sums.InFlow, cp.OutFlow + sums.OutFlow, hasCheckpoint, nil
+}
+
+// ReconcileUsage compares every live counter with the ledger and verifies
+// each closed period still adds up to the totals captured at close time.
+func (r *Repository) ReconcileUsage() ([]model.UsageReconcileItem, []model.UsagePeriodCheck, error) {
+	if r == nil || r.db == nil {
+		return nil, nil, errors.New("repository not initialized")
+	}
+	items := make([]model.UsageReconcileItem, 0)
+
+	var users []model.User
+	if err := r.db.Order("id ASC").Find(&users).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, u := range users {
+		userID := u.ID
+		in, out, hasCP, err := r.expectedCounter(
+			func(db *gorm.DB) *gorm.DB {
+				return db.Where("user_id = ? AND user_tunnel_id = 0 AND forward_id = 0", userID)
+			},
+			func(db *gorm.DB) *gorm.DB { return db.Where("user_id = ?", userID) },
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, newReconcileItem(UsageScopeUser, userID, userID, u.InFlow, u.OutFlow, in, out, hasCP))
+	}
+
+	var uts []model.UserTunnel
+	if err := r.db.Order("id ASC").Find(&uts).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, ut := range uts {
+		utID := ut.ID
+		in, out, hasCP, err := r.expectedCounter(
+			func(db *gorm.DB) *gorm.DB {
+				return db.Where("user_tunnel_id = ? AND forward_id = 0", utID)
+			},
+			func(db *gorm.DB) *gorm.DB { return db.Where("user_tunnel_id = ?", utID) },
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, newReconcileItem(UsageScopeUserTunnel, utID, ut.UserID, ut.InFlow, ut.OutFlow, in, out, hasCP))
+	}
+
+	var forwards []model.Forward
+	if err := r.db.Order("id ASC").Find(&forwards).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, f := range forwards {
+		forwardID := f.ID
+		scope := func(db *gorm.DB) *gorm.DB { return db.Where("forward_id = ?", forwardID) }
+		in, out, hasCP, err := r.expectedCounter(scope, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, newReconcileItem(UsageScopeForward, forwardID, f.UserID, f.InFlow, f.OutFlow, in, out, hasCP))
+	}
+
+	var closed []model.UsagePeriod
+	if err := r.db.Order("period ASC").Find(&closed).Error; err != nil {
+		return nil, nil, err
+	}
+	checks := make([]model.UsagePeriodCheck, 0, len(closed))
+	for _, p := range closed {
+		sums, err := sumUsageFlow(r.db.Where("period = ?", p.Period))
+		if err != nil {
+			return nil, nil, err
+		}
+		checks = append(checks, model.UsagePeriodCheck{
+			Period:      p.Period,
+			ClosedIn:    p.InFlow,
+			ClosedOut:   p.OutFlow,
+			LedgerIn:    sums.InFlow,
+			LedgerOut:   sums.OutFlow,
+			ClosedCount: p.EntryCount,
+			LedgerCount: sums.Count,
+			Matched:     p.InFlow == sums.InFlow && p.OutFlow == sums.OutFlow && p.EntryCount == sums.Count,
+		})
+	}
+
+	return items, checks, nil
+}
+
+func newReconcileItem(scope string, id, userID, counterIn, counterOut, ledgerIn, ledgerOut int64, hasCheckpoint bool) model.UsageReconcileItem {
+	return model.UsageReconcileItem{
+		Scope:         scope,
+		ID:            id,
+		UserID:        userID,
+		CounterIn:     counterIn,
+		CounterOut:    counterOut,
+		LedgerIn:      ledgerIn,
+		LedgerOut:     ledgerOut,
+		HasCheckpoint: hasCheckpoint,
+		Matched:       counterIn == ledgerIn && counterOut == ledgerOut,
+	}
+}
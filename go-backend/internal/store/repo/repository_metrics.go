@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"errors"
+
+	"go-backend/internal/store/model"
+)
+
+func (r *Repository) ListNodeMetrics() ([]model.NodeMetricsRow, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var nodes []model.Node
+	if err := r.db.Order("id ASC").Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	rows := make([]model.NodeMetricsRow, 0, len(nodes))
+	for _, n := range nodes {
+		rows = append(rows, model.NodeMetricsRow{
+			ID:      n.ID,
+			Name:    n.Name,
+			Status:  n.Status,
+			Version: n.Version.String,
+		})
+	}
+	return rows, nil
+}
+
+func (r *Repository) ListUserQuotaUsage() ([]model.QuotaUsageRow, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var users []model.User
+	if err := r.db.Order("id ASC").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	rows := make([]model.QuotaUsageRow, 0, len(users))
+	for _, u := range users {
+		rows = append(rows, model.QuotaUsageRow{
+			UserID:   u.ID,
+			UserName: u.User,
+			FlowGB:   u.Flow,
+			InFlow:   u.InFlow,
+			OutFlow:  u.OutFlow,
+		})
+	}
+	return rows, nil
+}
+
+func (r *Repository) ListUserTunnelQuotaUsage() ([]model.QuotaUsageRow, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var rows []model.QuotaUsageRow
+	err := r.db.Table("user_tunnel AS ut").
+		Select(`ut.user_id, COALESCE(u."user", '') AS user_name, ut.tunnel_id, COALESCE(t.name, '') AS tunnel_name,
+			ut.flow AS flow_gb, ut.in_flow, ut.out_flow`).
+		Joins(`LEFT JOIN "user" u ON u.id = ut.user_id`).
+		Joins(`LEFT JOIN tunnel t ON t.id = ut.tunnel_id`).
+		Order("ut.id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
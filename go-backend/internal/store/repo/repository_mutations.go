@@ -34,7 +34,7 @@ func (r *Repository) UserExistsExcluding(username string, excludeID int64) (bool
 	return cnt > 0, err
 }
 
-func (r *Repository) CreateUser(username, pwdHash string, roleID int, expTime, flow, flowResetTime int64, num, status int, now int64) error {
+func (r *Repository) CreateUser(username, pwdHash string, roleID int, expTime, flow, flowResetTime int64, num, speed, maxIPs, ipLimitMode, status int, now int64) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
 	}
@@ -48,6 +48,9 @@ func (r *Repository) CreateUser(username, pwdHash string, roleID int, expTime, f
 		OutFlow:       0,
 		FlowResetTime: flowResetTime,
 		Num:           num,
+		Speed:         speed,
+		MaxIPs:        maxIPs,
+		IPLimitMode:   ipLimitMode,
 		CreatedTime:   now,
 		UpdatedTime:   sql.NullInt64{Int64: now, Valid: true},
 		Status:        status,
@@ -67,7 +70,7 @@ func (r *Repository) GetUserRoleID(userID int64) (int, error) {
 	return user.RoleID, nil
 }
 
-func (r *Repository) UpdateUserWithPassword(id int64, username, pwdHash string, flow int64, num int, expTime, flowResetTime int64, status int, now int64) error {
+func (r *Repository) UpdateUserWithPassword(id int64, username, pwdHash string, flow int64, num, speed, maxIPs, ipLimitMode int, expTime, flowResetTime int64, status int, now int64) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
 	}
@@ -78,6 +81,9 @@ func (r *Repository) UpdateUserWithPassword(id int64, username, pwdHash string,
 			"pwd":             pwdHash,
 			"flow":            flow,
 			"num":             num,
+			"speed":           speed,
+			"max_ips":         maxIPs,
+			"ip_limit_mode":   ipLimitMode,
 			"exp_time":        expTime,
 			"flow_reset_time": flowResetTime,
 			"status":          status,
@@ -85,7 +91,7 @@ func (r *Repository) UpdateUserWithPassword(id int64, username, pwdHash string,
 		}).Error
 }
 
-func (r *Repository) UpdateUserWithoutPassword(id int64, username string, flow int64, num int, expTime, flowResetTime int64, status int, now int64) error {
+func (r *Repository) UpdateUserWithoutPassword(id int64, username string, flow int64, num, speed, maxIPs, ipLimitMode int, expTime, flowResetTime int64, status int, now int64) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
 	}
@@ -95,6 +101,9 @@ func (r *Repository) UpdateUserWithoutPassword(id int64, username string, flow i
 			"user":            username,
 			"flow":            flow,
 			"num":             num,
+			"speed":           speed,
+			"max_ips":         maxIPs,
+			"ip_limit_mode":   ipLimitMode,
 			"exp_time":        expTime,
 			"flow_reset_time": flowResetTime,
 			"status":          status,
@@ -149,25 +158,44 @@ func (r *Repository) ResetUserFlowByUser(userID int64, now int64) {
 	if r == nil || r.db == nil {
 		return
 	}
-	_ = r.db.Model(&model.User{}).
-		Where("id = ?", userID).
-		Updates(map[string]interface{}{
-			"in_flow":      0,
-			"out_flow":     0,
-			"updated_time": sql.NullInt64{Int64: now, Valid: true},
-		}).Error
-	_ = r.db.Model(&model.UserTunnel{}).
-		Where("user_id = ?", userID).
-		Updates(map[string]interface{}{"in_flow": 0, "out_flow": 0}).Error
+	_ = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"in_flow":      0,
+				"out_flow":     0,
+				"updated_time": sql.NullInt64{Int64: now, Valid: true},
+			}).Error; err != nil {
+			return err
+		}
+		var utIDs []int64
+		if err := tx.Model(&model.UserTunnel{}).Where("user_id = ?", userID).Pluck("id", &utIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.UserTunnel{}).
+			Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"in_flow": 0, "out_flow": 0}).Error; err != nil {
+			return err
+		}
+		if err := checkpointUserCounters(tx, []int64{userID}, now); err != nil {
+			return err
+		}
+		return checkpointUserTunnelCounters(tx, utIDs, now)
+	})
 }
 
 func (r *Repository) ResetUserFlowByUserTunnel(userTunnelID int64) {
 	if r == nil || r.db == nil {
 		return
 	}
-	_ = r.db.Model(&model.UserTunnel{}).
-		Where("id = ?", userTunnelID).
-		Updates(map[string]interface{}{"in_flow": 0, "out_flow": 0}).Error
+	_ = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.UserTunnel{}).
+			Where("id = ?", userTunnelID).
+			Updates(map[string]interface{}{"in_flow": 0, "out_flow": 0}).Error; err != nil {
+			return err
+		}
+		return checkpointUserTunnelCounters(tx, []int64{userTunnelID}, unixMilliNow())
+	})
 }
 
 func (r *Repository) GetUsernameByID(userID int64) string {
@@ -193,7 +221,7 @@ func (r *Repository) GetUserDefaultsForTunnel(userID int64) (flow int64, num int
 	return user.Flow, user.Num, user.ExpTime, user.FlowResetTime, nil
 }
 
-func (r *Repository) CreateNode(name, secret, serverIP string, serverIPV4, serverIPV6, port, interfaceName, version interface{}, httpFlag, tlsFlag, socksFlag int, now int64, status int, tcpAddr, udpAddr string, inx, isRemote int, remoteURL, remoteToken, remoteConfig interface{}) error {
+func (r *Repository) CreateNode(name, secret, serverIP string, serverIPV4, serverIPV6, port, interfaceName, version interface{}, httpFlag, tlsFlag, socksFlag int, now int64, status int, tcpAddr, udpAddr, listenIPs string, dns model.DNSResolver, inx, isRemote int, remoteURL, remoteToken, remoteConfig interface{}) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
 	}
@@ -214,11 +242,13 @@ func (r *Repository) CreateNode(name, secret, serverIP string, serverIPV4, serve
 		Status:        status,
 		TCPListenAddr: tcpAddr,
 		UDPListenAddr: udpAddr,
+		ListenIPs:     listenIPs,
 		Inx:           inx,
 		IsRemote:      isRemote,
 		RemoteURL:     nullStringFromInterface(remoteURL),
 		RemoteToken:   nullStringFromInterface(remoteToken),
 		RemoteConfig:  nullStringFromInterface(remoteConfig),
+		DNSResolver:   dns,
 	}
 	return r.db.Create(&node).Error
 }
@@ -235,7 +265,7 @@ func (r *Repository) GetNodeStatusFields(nodeID int64) (status, httpFlag, tlsFla
 	return node.Status, node.HTTP, node.TLS, node.Socks, nil
 }
 
-func (r *Repository) UpdateNode(id int64, name, serverIP string, serverIPV4, serverIPV6, port, interfaceName interface{}, httpFlag, tlsFlag, socksFlag int, tcpAddr, udpAddr string, now int64) error {
+func (r *Repository) UpdateNode(id int64, name, serverIP string, serverIPV4, serverIPV6, port, interfaceName interface{}, httpFlag, tlsFlag, socksFlag int, tcpAddr, udpAddr, listenIPs string, dns model.DNSResolver, now int64) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
 	}
@@ -253,6 +283,10 @@ func (r *Repository) UpdateNode(id int64, name, serverIP string, serverIPV4, ser
 			"socks":           socksFlag,
 			"tcp_listen_addr": tcpAddr,
 			"udp_listen_addr": udpAddr,
+			"listen_ips":      listenIPs,
+			"dns_servers":     dns.Servers,
+			"dns_prefer":      dns.Prefer,
+			"dns_ttl":         dns.TTL,
 			"updated_time":    sql.NullInt64{Int64: now, Valid: true},
 		}).Error
 }
@@ -367,7 +401,7 @@ func (r *Repository) UpdateTunnelOrder(tunnelID int64, inx int, now int64) {
 		Updates(map[string]interface{}{"inx": inx, "updated_time": now}).Error
 }
 
-func (r *Repository) UpdateTunnelTx(tx *gorm.DB, tunnelID int64, name string, typeVal int, flow int64, trafficRatio float64, status int, inIP, ipPreference string, now int64) error {
+func (r *Repository) UpdateTunnelTx(tx *gorm.DB, tunnelID int64, name string, typeVal int, flow int64, trafficRatio float64, status int, inIP, ipPreference, allowIPs, denyIPs string, now int64) error {
 	if tx == nil {
 		return errors.New("database unavailable")
 	}
@@ -381,6 +415,8 @@ func (r *Repository) UpdateTunnelTx(tx *gorm.DB, tunnelID int64, name string, ty
 			"status":        status,
 			"in_ip":         nullStringFromInterface(inIP),
 			"ip_preference": ipPreference,
+			"allow_ips":     allowIPs,
+			"deny_ips":      denyIPs,
 			"updated_time":  now,
 		}).Error
 }
@@ -392,7 +428,7 @@ func (r *Repository) DeleteChainTunnelsByTunnelTx(tx *gorm.DB, tunnelID int64) e
 	return tx.Where("tunnel_id = ?", tunnelID).Delete(&model.ChainTunnel{}).Error
 }
 
-func (r *Repository) CreateChainTunnelTx(tx *gorm.DB, tunnelID int64, chainType string, nodeID int64, port sql.NullInt64, strategy string, inx int, protocol string) error {
+func (r *Repository) CreateChainTunnelTx(tx *gorm.DB, tunnelID int64, chainType string, nodeID int64, port sql.NullInt64, strategy string, inx int, protocol, options string) error {
 	if tx == nil {
 		return errors.New("database unavailable")
 	}
@@ -404,6 +440,7 @@ func (r *Repository) CreateChainTunnelTx(tx *gorm.DB, tunnelID int64, chainType
 		Strategy:  nullStringFromInterface(strategy),
 		Inx:       nullInt64FromInterface(inx),
 		Protocol:  nullStringFromInterface(protocol),
+		Options:   nullStringFromInterface(options),
 	}
 	return tx.Create(&ct).Error
 }
@@ -467,10 +504,8 @@ func (r *Repository) PickNodePortTx(tx *gorm.DB, nodeID int64, allocated map[int
 		}
 	}
 
-	var forwardPorts []int
-	if err := tx.Model(&model.ForwardPort{}).
-		Where("node_id = ? AND port > 0", nodeID).
-		Pluck("port", &forwardPorts).Error; err != nil {
+	forwardPorts, err := forwardPortsTaken(tx.Model(&model.ForwardPort{}).Where("forward_port.node_id = ?", nodeID))
+	if err != nil {
 		return 0, err
 	}
 	for _, p := range forwardPorts {
@@ -504,6 +539,33 @@ func (r *Repository) GetTunnelIPPreference(tunnelID int64) string {
 	return tunnel.IPPreference
 }
 
+// EnsureTunnelRelaySecret stores secret for a tunnel that has none yet and
+// returns the secret the tunnel ends up with.
+func (r *Repository) EnsureTunnelRelaySecret(tunnelID int64, secret string) (string, error) {
+	if r == nil || r.db == nil {
+		return "", errors.New("repository not initialized")
+	}
+	if err := r.db.Model(&model.Tunnel{}).
+		Where("id = ? AND (relay_secret = '' OR relay_secret IS NULL)", tunnelID).
+		Update("relay_secret", secret).Error; err != nil {
+		return "", err
+	}
+	var tunnel model.Tunnel
+	if err := r.db.Select("relay_secret").Where("id = ?", tunnelID).First(&tunnel).Error; err != nil {
+		return "", err
+	}
+	return tunnel.RelaySecret, nil
+}
+
+func (r *Repository) UpdateTunnelRelaySecret(tunnelID int64, secret string, now int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Tunnel{}).
+		Where("id = ?", tunnelID).
+		Updates(map[string]interface{}{"relay_secret": secret, "updated_time": now}).Error
+}
+
 func (r *Repository) DeleteTunnelCascade(tunnelID int64) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
@@ -565,7 +627,7 @@ func (r *Repository) DeleteUserTunnel(id int64) error {
 	return r.db.Where("id = ?", id).Delete(&model.UserTunnel{}).Error
 }
 
-func (r *Repository) UpdateUserTunnel(id int64, flow int64, num int, expTime, flowResetTime int64, speedID interface{}, status int) error {
+func (r *Repository) UpdateUserTunnel(id int64, flow int64, num, maxIPs int, expTime, flowResetTime int64, speedID interface{}, status int, interfaceName string, schedule model.Schedule) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
 	}
@@ -574,10 +636,14 @@ func (r *Repository) UpdateUserTunnel(id int64, flow int64, num int, expTime, fl
 		Updates(map[string]interface{}{
 			"flow":            flow,
 			"num":             num,
+			"max_ips":         maxIPs,
 			"exp_time":        expTime,
 			"flow_reset_time": flowResetTime,
 			"speed_id":        nullInt64FromInterface(speedID),
 			"status":          status,
+			"interface_name":  interfaceName,
+			"schedule_on":     schedule.On,
+			"schedule_off":    schedule.Off,
 		}).Error
 }
 
@@ -654,19 +720,54 @@ func (r *Repository) GetMinForwardPort(forwardID int64) sql.NullInt64 {
 	return p
 }
 
-func (r *Repository) UpdateForward(id int64, name string, tunnelID int64, remoteAddr, strategy string, now int64) error {
+// UpdateForward stores the editable settings of fwd. The owner and status
+// are left alone; RollbackForwardFields restores those too.
+func (r *Repository) UpdateForward(fwd model.ForwardRecord, now int64) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
 	}
+	fields := forwardSettingColumns(fwd)
+	fields["updated_time"] = now
 	return r.db.Model(&model.Forward{}).
-		Where("id = ?", id).
-		Updates(map[string]interface{}{
-			"name":         name,
-			"tunnel_id":    tunnelID,
-			"remote_addr":  remoteAddr,
-			"strategy":     strategy,
-			"updated_time": now,
-		}).Error
+		Where("id = ?", fwd.ID).
+		Updates(fields).Error
+}
+
+// forwardSettingColumns maps the user editable settings of a forward to
+// their columns.
+func forwardSettingColumns(fwd model.ForwardRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"name":                fwd.Name,
+		"tunnel_id":           fwd.TunnelID,
+		"remote_addr":         fwd.RemoteAddr,
+		"strategy":            fwd.Strategy,
+		"protocol":            fwd.Protocol,
+		"port_count":          fwd.PortCount,
+		"proxy_in":            fwd.ProxyIn,
+		"proxy_out":           fwd.ProxyOut,
+		"max_conns":           fwd.MaxConns,
+		"max_ip_conns":        fwd.MaxIPConns,
+		"allow_ips":           fwd.AllowIPs,
+		"deny_ips":            fwd.DenyIPs,
+		"sni_hosts":           fwd.SNIHosts,
+		"conn_log":            fwd.ConnLog,
+		"listen_ip":           fwd.ListenIP,
+		"interface_name":      fwd.InterfaceName,
+		"health_check":        fwd.ForwardHealthCheck.Type,
+		"health_interval":     fwd.ForwardHealthCheck.Interval,
+		"health_path":         fwd.ForwardHealthCheck.Path,
+		"healthy_threshold":   fwd.ForwardHealthCheck.HealthyThreshold,
+		"unhealthy_threshold": fwd.ForwardHealthCheck.UnhealthyThreshold,
+		"schedule_on":         fwd.Schedule.On,
+		"schedule_off":        fwd.Schedule.Off,
+		"http_mode":           fwd.ForwardHTTP.Mode,
+		"http_routes":         fwd.ForwardHTTP.Routes,
+		"http_cert_id":        fwd.ForwardHTTP.CertID,
+		"http_access_log":     fwd.ForwardHTTP.AccessLog,
+		"dns_servers":         fwd.DNSResolver.Servers,
+		"dns_prefer":          fwd.DNSResolver.Prefer,
+		"dns_ttl":             fwd.DNSResolver.TTL,
+	}
 }
 
 func (r *Repository) UpdateForwardOrder(forwardID int64, inx int, now int64) {
@@ -695,6 +796,9 @@ func (r *Repository) DeleteForwardCascade(forwardID int64) error {
 		if err := tx.Where("forward_id = ?", forwardID).Delete(&model.ForwardPort{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("forward_id = ?", forwardID).Delete(&model.ForwardConnLog{}).Error; err != nil {
+			return err
+		}
 		return tx.Where("id = ?", forwardID).Delete(&model.Forward{}).Error
 	})
 }
@@ -721,36 +825,112 @@ func (r *Repository) ReplaceForwardPorts(forwardID int64, entries []struct {
 	})
 }
 
-func (r *Repository) RollbackForwardFields(id, userID int64, userName, name string, tunnelID int64, remoteAddr, strategy string, status int, now int64) {
+func (r *Repository) RollbackForwardFields(fwd model.ForwardRecord, now int64) {
 	if r == nil || r.db == nil {
 		return
 	}
+	fields := forwardSettingColumns(fwd)
+	fields["user_id"] = fwd.UserID
+	fields["user_name"] = fwd.UserName
+	fields["status"] = fwd.Status
+	fields["updated_time"] = now
 	_ = r.db.Model(&model.Forward{}).
-		Where("id = ?", id).
-		Updates(map[string]interface{}{
-			"user_id":      userID,
-			"user_name":    userName,
-			"name":         name,
-			"tunnel_id":    tunnelID,
-			"remote_addr":  remoteAddr,
-			"strategy":     strategy,
-			"status":       status,
-			"updated_time": now,
-		}).Error
+		Where("id = ?", fwd.ID).
+		Updates(fields).Error
+}
+
+// forwardPortsTaken returns the ports held by the forward_port rows q
+// selects. A port range forward holds port_count ports from its start port.
+func forwardPortsTaken(q *gorm.DB) ([]int, error) {
+	var rows []struct {
+		Port      int
+		PortCount int
+	}
+	if err := q.Joins("LEFT JOIN forward ON forward.id = forward_port.forward_id").
+		Select("forward_port.port AS port, COALESCE(forward.port_count, 0) AS port_count").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	ports := make([]int, 0, len(rows))
+	for _, row := range rows {
+		if row.Port <= 0 {
+			continue
+		}
+		for i := 0; i < max(row.PortCount, 1); i++ {
+			ports = append(ports, row.Port+i)
+		}
+	}
+	return ports, nil
+}
+
+// listenIPOverlaps matches the forwards whose listen address collides with
+// listenIP. The node's wildcard address collides with every address.
+func listenIPOverlaps(listenIP string) clause.Expr {
+	if listenIP == "" {
+		return gorm.Expr("1 = 1")
+	}
+	return gorm.Expr("COALESCE(forward.listen_ip, '') IN ?", []string{"", listenIP})
+}
+
+// ListTCPForwardsOnNodePort returns the forwards other than excludeID that
+// listen for TCP on port of a node, counting port range forwards whose
+// range covers it. Forwards bound to an address other than listenIP are
+// left out.
+func (r *Repository) ListTCPForwardsOnNodePort(nodeID int64, port int, listenIP string, excludeID int64) ([]model.ForwardRecord, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var rows []model.ForwardRecord
+	err := r.db.Model(&model.ForwardPort{}).
+		Select("DISTINCT forward.id, forward.name, forward.port_count, COALESCE(forward.sni_hosts, '') AS sni_hosts, COALESCE(forward.listen_ip, '') AS listen_ip").
+		Joins("JOIN forward ON forward.id = forward_port.forward_id").
+		Where("forward_port.node_id = ? AND forward.id != ? AND forward.protocol IN ?", nodeID, excludeID, ForwardProtocolsSharingPort("tcp")).
+		Where("forward_port.port <= ? AND forward_port.port + CASE WHEN forward.port_count > 1 THEN forward.port_count ELSE 1 END > ?", port, port).
+		Where(listenIPOverlaps(listenIP)).
+		Order("forward.id ASC").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// ListForwardListenIPsOnNode returns the specific addresses forwards on a
+// node bind to.
+func (r *Repository) ListForwardListenIPsOnNode(nodeID int64) ([]string, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var ips []string
+	err := r.db.Model(&model.ForwardPort{}).
+		Distinct("forward.listen_ip").
+		Joins("JOIN forward ON forward.id = forward_port.forward_id").
+		Where("forward_port.node_id = ? AND COALESCE(forward.listen_ip, '') != ''", nodeID).
+		Pluck("forward.listen_ip", &ips).Error
+	return ips, err
 }
 
-func (r *Repository) GetUsedPortsOnNodeAsMap(nodeID int64) (map[int]bool, error) {
+// GetUsedPortsOnNodeAsMap returns the ports taken on a node for a forward
+// of the given protocol bound to listenIP: ports of forwards listening on an
+// overlapping protocol and address, plus every chain port.
+func (r *Repository) GetUsedPortsOnNodeAsMap(nodeID int64, protocol, listenIP string) (map[int]bool, error) {
 	if r == nil || r.db == nil {
 		return nil, errors.New("repository not initialized")
 	}
 	used := make(map[int]bool)
-	var forwardPorts []int
-	if err := r.db.Model(&model.ForwardPort{}).Where("node_id = ?", nodeID).Pluck("port", &forwardPorts).Error; err != nil {
+	forwardPorts, err := forwardPortsTaken(r.db.Model(&model.ForwardPort{}).
+		Where("forward_port.node_id = ? AND forward.protocol IN ?", nodeID, ForwardProtocolsSharingPort(protocol)).
+		Where(listenIPOverlaps(listenIP)))
+	if err != nil {
 		return nil, err
 	}
 	for _, p := range forwardPorts {
 		used[p] = true
 	}
+	drainingPorts, err := r.drainingPortsTaken(nodeID, protocol, listenIP, time.Now().UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range drainingPorts {
+		used[p] = true
+	}
 	var chainPorts []int
 	if err := r.db.Model(&model.ChainTunnel{}).Where("node_id = ? AND port > 0", nodeID).Pluck("port", &chainPorts).Error; err != nil {
 		return nil, err
@@ -761,13 +941,15 @@ func (r *Repository) GetUsedPortsOnNodeAsMap(nodeID int64) (map[int]bool, error)
 	return used, nil
 }
 
-func (r *Repository) CreateSpeedLimit(name string, speed int, tunnelID int64, tunnelName string, now int64, status int) (int64, error) {
+func (r *Repository) CreateSpeedLimit(name string, speed, connSpeed, ipSpeed int, tunnelID int64, tunnelName string, now int64, status int) (int64, error) {
 	if r == nil || r.db == nil {
 		return 0, errors.New("repository not initialized")
 	}
 	sl := model.SpeedLimit{
 		Name:        name,
 		Speed:       speed,
+		ConnSpeed:   connSpeed,
+		IPSpeed:     ipSpeed,
 		TunnelID:    tunnelID,
 		TunnelName:  tunnelName,
 		CreatedTime: now,
@@ -780,7 +962,7 @@ func (r *Repository) CreateSpeedLimit(name string, speed int, tunnelID int64, tu
 	return sl.ID, nil
 }
 
-func (r *Repository) UpdateSpeedLimit(id int64, name string, speed int, tunnelID int64, tunnelName string, status int, now int64) error {
+func (r *Repository) UpdateSpeedLimit(id int64, name string, speed, connSpeed, ipSpeed int, tunnelID int64, tunnelName string, status int, now int64) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
 	}
@@ -789,6 +971,8 @@ func (r *Repository) UpdateSpeedLimit(id int64, name string, speed int, tunnelID
 		Updates(map[string]interface{}{
 			"name":        name,
 			"speed":       speed,
+			"conn_speed":  connSpeed,
+			"ip_speed":    ipSpeed,
 			"tunnel_id":   tunnelID,
 			"tunnel_name": tunnelName,
 			"status":      status,
@@ -1187,30 +1371,49 @@ func (r *Repository) EnsureUserTunnelGrant(userID, tunnelID int64) (int64, bool,
 	return ut.ID, true, nil
 }
 
-func (r *Repository) CreateForwardTx(userID int64, userName, name string, tunnelID int64, remoteAddr, strategy string, now int64, inx int, entryNodeIDs []int64, port int) (int64, error) {
+// CreateForwardTx inserts an active forward with the settings and owner of
+// fwd, holding port on each entry node.
+func (r *Repository) CreateForwardTx(fwd model.ForwardRecord, now int64, inx int, entryNodeIDs []int64, port int) (int64, error) {
 	if r == nil || r.db == nil {
 		return 0, errors.New("repository not initialized")
 	}
 	var forwardID int64
 	err := r.db.Transaction(func(tx *gorm.DB) error {
-		fwd := model.Forward{
-			UserID:      userID,
-			UserName:    userName,
-			Name:        name,
-			TunnelID:    tunnelID,
-			RemoteAddr:  remoteAddr,
-			Strategy:    strategy,
-			InFlow:      0,
-			OutFlow:     0,
-			CreatedTime: now,
-			UpdatedTime: now,
-			Status:      1,
-			Inx:         inx,
+		row := model.Forward{
+			UserID:        fwd.UserID,
+			UserName:      fwd.UserName,
+			Name:          fwd.Name,
+			TunnelID:      fwd.TunnelID,
+			RemoteAddr:    fwd.RemoteAddr,
+			Strategy:      fwd.Strategy,
+			Protocol:      fwd.Protocol,
+			PortCount:     fwd.PortCount,
+			ProxyIn:       fwd.ProxyIn,
+			ProxyOut:      fwd.ProxyOut,
+			MaxConns:      fwd.MaxConns,
+			MaxIPConns:    fwd.MaxIPConns,
+			AllowIPs:      fwd.AllowIPs,
+			DenyIPs:       fwd.DenyIPs,
+			SNIHosts:      fwd.SNIHosts,
+			ConnLog:       fwd.ConnLog,
+			ListenIP:      fwd.ListenIP,
+			InterfaceName: fwd.InterfaceName,
+			InFlow:        0,
+			OutFlow:       0,
+			CreatedTime:   now,
+			UpdatedTime:   now,
+			Status:        1,
+			Inx:           inx,
+
+			ForwardHealthCheck: fwd.ForwardHealthCheck,
+			Schedule:           fwd.Schedule,
+			ForwardHTTP:        fwd.ForwardHTTP,
+			DNSResolver:        fwd.DNSResolver,
 		}
-		if err := tx.Create(&fwd).Error; err != nil {
+		if err := tx.Create(&row).Error; err != nil {
 			return err
 		}
-		forwardID = fwd.ID
+		forwardID = row.ID
 		for _, nodeID := range entryNodeIDs {
 			fp := model.ForwardPort{
 				ForwardID: forwardID,
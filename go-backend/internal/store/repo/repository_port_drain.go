@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"errors"
+
+	"go-backend/internal/store/model"
+)
+
+// ReserveDrainingPorts keeps the entry ports fwd listened on taken until
+// expireTime, while the old listeners drain after the forward moved to
+// another port.
+func (r *Repository) ReserveDrainingPorts(fwd model.ForwardRecord, ports []model.ForwardPortRecord, expireTime int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	if len(ports) == 0 {
+		return nil
+	}
+	rows := make([]model.ForwardPortDrain, 0, len(ports))
+	for _, fp := range ports {
+		rows = append(rows, model.ForwardPortDrain{
+			ForwardID:  fwd.ID,
+			NodeID:     fp.NodeID,
+			Port:       fp.Port,
+			PortCount:  fwd.PortCount,
+			Protocol:   NormalizeForwardProtocol(fwd.Protocol),
+			ListenIP:   fwd.ListenIP,
+			ExpireTime: expireTime,
+		})
+	}
+	return r.db.Create(&rows).Error
+}
+
+// IsPortDraining reports whether any port of the range starting at port is
+// still held by a draining listener on the node that would clash with a
+// forward of the given protocol and listen IP.
+func (r *Repository) IsPortDraining(nodeID int64, port, portCount int, protocol, listenIP string, now int64) (bool, error) {
+	taken, err := r.drainingPortsTaken(nodeID, protocol, listenIP, now)
+	if err != nil {
+		return false, err
+	}
+	end := port + max(portCount, 1)
+	for _, p := range taken {
+		if p >= port && p < end {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PurgeExpiredPortDrains drops reservations whose drain window has ended.
+func (r *Repository) PurgeExpiredPortDrains(now int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Where("expire_time <= ?", now).Delete(&model.ForwardPortDrain{}).Error
+}
+
+// drainingPortsTaken returns the ports of a node still held by draining
+// listeners that clash with the given protocol and listen IP.
+func (r *Repository) drainingPortsTaken(nodeID int64, protocol, listenIP string, now int64) ([]int, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	q := r.db.Model(&model.ForwardPortDrain{}).
+		Where("node_id = ? AND expire_time > ? AND protocol IN ?", nodeID, now, ForwardProtocolsSharingPort(protocol))
+	if listenIP != "" {
+		q = q.Where("COALESCE(listen_ip, '') IN ?", []string{"", listenIP})
+	}
+	var rows []model.ForwardPortDrain
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	var ports []int
+	for _, row := range rows {
+		for i := 0; i < max(row.PortCount, 1); i++ {
+			ports = append(ports, row.Port+i)
+		}
+	}
+	return ports, nil
+}
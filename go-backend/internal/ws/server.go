@@ -14,6 +14,7 @@ import (
 	"github.com/gorilla/websocket"
 
 	"go-backend/internal/auth"
+	"go-backend/internal/metrics"
 	"go-backend/internal/security"
 	"go-backend/internal/store/repo"
 )
@@ -212,9 +213,15 @@ func (s *Server) handleNode(w http.ResponseWriter, r *http.Request, nodeID int64
 		s.tryResolvePending(nodeID, msg)
 
 		var parsed struct {
-			Type string `json:"type"`
+			Type       string          `json:"type"`
+			Interfaces json.RawMessage `json:"interfaces"`
 		}
-		if json.Unmarshal([]byte(msg), &parsed) == nil && parsed.Type == "UpgradeProgress" {
+		if json.Unmarshal([]byte(msg), &parsed) == nil && parsed.Type == "" && len(parsed.Interfaces) > 0 {
+			// Agents include their interfaces in the system info after
+			// connecting and whenever they change.
+			_ = s.repo.UpdateNodeInterfaces(nodeID, string(parsed.Interfaces))
+		}
+		if parsed.Type == "UpgradeProgress" {
 			s.broadcastTyped(nodeID, "upgrade_progress", msg)
 		} else {
 			s.broadcastInfo(nodeID, msg)
@@ -233,11 +240,48 @@ func (s *Server) SendCommand(nodeID int64, cmdType string, data interface{}, tim
 		timeout = 10 * time.Second
 	}
 
+	start := time.Now()
+	result, outcome, err := s.sendCommand(nodeID, cmdType, data, timeout)
+	metrics.WSCommands.Inc(cmdType, outcome)
+	if outcome != "offline" && outcome != "error" {
+		metrics.WSCommandDuration.Observe(time.Since(start).Seconds(), cmdType)
+	}
+	return result, err
+}
+
+// PendingCommandCount returns the number of commands awaiting an agent reply.
+func (s *Server) PendingCommandCount() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.pending)
+}
+
+// ConnectedNodeIDs returns the IDs of agents with a live WebSocket session.
+func (s *Server) ConnectedNodeIDs() []int64 {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]int64, 0, len(s.nodes))
+	for id := range s.nodes {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// sendCommand performs the round trip and reports an outcome label for
+// metrics: ok, failed (agent replied with an error), timeout, offline or
+// error (local failure before the agent saw the command).
+func (s *Server) sendCommand(nodeID int64, cmdType string, data interface{}, timeout time.Duration) (CommandResult, string, error) {
 	s.mu.RLock()
 	ns, ok := s.nodes[nodeID]
 	s.mu.RUnlock()
 	if !ok || ns == nil || ns.conn == nil || ns.conn.conn == nil {
-		return CommandResult{}, errors.New("节点不在线")
+		return CommandResult{}, "offline", errors.New("节点不在线")
 	}
 
 	requestID := fmt.Sprintf("%d_%d", nodeID, time.Now().UnixNano())
@@ -264,7 +308,7 @@ func (s *Server) SendCommand(nodeID int64, cmdType string, data interface{}, tim
 	rawCmd, err := json.Marshal(cmdPayload)
 	if err != nil {
 		cleanup()
-		return CommandResult{}, err
+		return CommandResult{}, "error", err
 	}
 
 	messageData := rawCmd
@@ -272,12 +316,12 @@ func (s *Server) SendCommand(nodeID int64, cmdType string, data interface{}, tim
 		crypto, err := security.NewAESCrypto(ns.secret)
 		if err != nil {
 			cleanup()
-			return CommandResult{}, err
+			return CommandResult{}, "error", err
 		}
 		encrypted, err := crypto.Encrypt(rawCmd)
 		if err != nil {
 			cleanup()
-			return CommandResult{}, err
+			return CommandResult{}, "error", err
 		}
 		wrapper := map[string]interface{}{
 			"encrypted": true,
@@ -287,7 +331,7 @@ func (s *Server) SendCommand(nodeID int64, cmdType string, data interface{}, tim
 		messageData, err = json.Marshal(wrapper)
 		if err != nil {
 			cleanup()
-			return CommandResult{}, err
+			return CommandResult{}, "error", err
 		}
 	}
 
@@ -298,24 +342,24 @@ func (s *Server) SendCommand(nodeID int64, cmdType string, data interface{}, tim
 	ns.conn.mu.Unlock()
 	if err != nil {
 		cleanup()
-		return CommandResult{}, err
+		return CommandResult{}, "error", err
 	}
 
 	select {
 	case result, ok := <-ch:
 		if !ok {
-			return CommandResult{}, errors.New("命令通道已关闭")
+			return CommandResult{}, "failed", errors.New("命令通道已关闭")
 		}
 		if !result.Success {
 			if strings.TrimSpace(result.Message) == "" {
 				result.Message = "命令执行失败"
 			}
-			return result, errors.New(result.Message)
+			return result, "failed", errors.New(result.Message)
 		}
-		return result, nil
+		return result, "ok", nil
 	case <-time.After(timeout):
 		cleanup()
-		return CommandResult{}, errors.New("等待节点响应超时")
+		return CommandResult{}, "timeout", errors.New("等待节点响应超时")
 	}
 }
 
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -471,6 +472,102 @@ func TestUserTunnelReassignmentKeepsStableID(t *testing.T) {
 	}
 }
 
+func TestForwardPortChangeMigratesWithDrain(t *testing.T) {
+	secret := "contract-jwt-secret"
+	router, repo := setupContractRouter(t, secret)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	now := time.Now().UnixMilli()
+
+	if err := repo.DB().Exec(`
+		INSERT INTO tunnel(name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, in_ip, inx)
+		VALUES('drain-tunnel', 1.0, 1, 'tls', 99999, ?, ?, 1, NULL, 0)
+	`, now, now).Error; err != nil {
+		t.Fatalf("insert tunnel: %v", err)
+	}
+	tunnelID := mustLastInsertID(t, repo, "drain-tunnel")
+	nodeID := insertContractNode(t, repo, "drain-node", "10.13.0.1", "26000-26010", "drain-node-secret", 0)
+	if err := repo.DB().Exec(`INSERT INTO chain_tunnel(tunnel_id, chain_type, node_id, port, strategy, inx, protocol) VALUES(?, 1, ?, 26000, 'round', 1, 'tls')`, tunnelID, nodeID).Error; err != nil {
+		t.Fatalf("insert chain_tunnel: %v", err)
+	}
+
+	var commandMu sync.Mutex
+	var commands []string
+	stop := startMockNodeSessionWithHook(t, server.URL, "drain-node-secret", func(cmdType string) {
+		commandMu.Lock()
+		commands = append(commands, cmdType)
+		commandMu.Unlock()
+	})
+	defer stop()
+	waitNodeStatus(t, repo, nodeID, 1)
+	takeCommands := func() []string {
+		commandMu.Lock()
+		defer commandMu.Unlock()
+		out := commands
+		commands = nil
+		return out
+	}
+	hasCommand := func(list []string, want string) bool {
+		for _, cmd := range list {
+			if cmd == want {
+				return true
+			}
+		}
+		return false
+	}
+
+	adminToken, err := auth.GenerateToken(1, "admin_user", 0, secret)
+	if err != nil {
+		t.Fatalf("generate admin token: %v", err)
+	}
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", adminToken)
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	assertCode(t, post("/api/v1/forward/create", `{"name":"drain","tunnelId":`+jsonNumber(tunnelID)+`,"remoteAddr":"10.0.0.1:80","inPort":26001}`), 0)
+	forwardID := mustQueryInt64(t, repo, `SELECT id FROM forward WHERE name = 'drain'`)
+	takeCommands()
+
+	assertCodeMsg(t, post("/api/v1/forward/update", `{"id":`+jsonNumber(forwardID)+`,"inPort":26002,"portDrain":5000}`), -1, "旧端口保留时间须在 0-3600 秒之间")
+
+	assertCode(t, post("/api/v1/forward/update", `{"id":`+jsonNumber(forwardID)+`,"inPort":26002,"portDrain":30}`), 0)
+	if got := takeCommands(); !hasCommand(got, "MigrateService") || hasCommand(got, "UpdateService") {
+		t.Fatalf("expected the port change to migrate the services, got %v", got)
+	}
+	if port := mustQueryInt(t, repo, `SELECT port FROM forward_port WHERE forward_id = ?`, forwardID); port != 26002 {
+		t.Fatalf("expected forward on port 26002, got %d", port)
+	}
+
+	// The old port keeps serving for the drain window, so it must not be
+	// handed to another forward meanwhile.
+	used, err := repo.GetUsedPortsOnNodeAsMap(nodeID, "tcp+udp", "")
+	if err != nil {
+		t.Fatalf("used ports: %v", err)
+	}
+	if !used[26001] {
+		t.Fatalf("expected the draining port 26001 to stay taken, got %v", used)
+	}
+	assertCodeMsg(t, post("/api/v1/forward/create", `{"name":"reuse","tunnelId":`+jsonNumber(tunnelID)+`,"remoteAddr":"10.0.0.1:80","inPort":26001}`), -1, "端口 26001 仍被迁移中的旧端口占用，请稍后再试或更换端口")
+	if err := repo.PurgeExpiredPortDrains(time.Now().Add(time.Minute).UnixMilli()); err != nil {
+		t.Fatalf("purge port drains: %v", err)
+	}
+	if used, _ := repo.GetUsedPortsOnNodeAsMap(nodeID, "tcp+udp", ""); used[26001] {
+		t.Fatalf("expected port 26001 to be free after the drain window")
+	}
+	takeCommands()
+
+	// Without a port change there is nothing to drain.
+	assertCode(t, post("/api/v1/forward/update", `{"id":`+jsonNumber(forwardID)+`,"remoteAddr":"10.0.0.2:80","portDrain":30}`), 0)
+	if got := takeCommands(); hasCommand(got, "MigrateService") || !hasCommand(got, "UpdateService") {
+		t.Fatalf("expected an in-place update, got %v", got)
+	}
+}
+
 func jsonNumber(v int64) string {
 	return strconv.FormatInt(v, 10)
 }
@@ -0,0 +1,122 @@
+package contract_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-backend/internal/auth"
+	"go-backend/internal/http/response"
+)
+
+func TestForwardTemplateApplyAndCloneContracts(t *testing.T) {
+	secret := "contract-jwt-secret"
+	router, repo := setupContractRouter(t, secret)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	now := time.Now().UnixMilli()
+
+	for _, user := range []struct {
+		id   int64
+		name string
+	}{{2, "template_user"}, {3, "other_user"}} {
+		if err := repo.DB().Exec(`
+			INSERT INTO user(id, user, pwd, role_id, exp_time, flow, in_flow, out_flow, flow_reset_time, num, created_time, updated_time, status)
+			VALUES(?, ?, '3c85cdebade1c51cf64ca9f3c09d182d', 1, 2727251700000, 99999, 0, 0, 1, 99999, ?, ?, 1)
+		`, user.id, user.name, now, now).Error; err != nil {
+			t.Fatalf("insert user %s: %v", user.name, err)
+		}
+	}
+	if err := repo.DB().Exec(`
+		INSERT INTO tunnel(name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, in_ip, inx)
+		VALUES('template-tunnel', 1.0, 1, 'tls', 99999, ?, ?, 1, NULL, 0)
+	`, now, now).Error; err != nil {
+		t.Fatalf("insert tunnel: %v", err)
+	}
+	tunnelID := mustLastInsertID(t, repo, "template-tunnel")
+	nodeID := insertContractNode(t, repo, "template-node", "10.12.0.1", "25000-25010", "template-node-secret", 0)
+	if err := repo.DB().Exec(`INSERT INTO chain_tunnel(tunnel_id, chain_type, node_id, port, strategy, inx, protocol) VALUES(?, 1, ?, 25000, 'round', 1, 'tls')`, tunnelID, nodeID).Error; err != nil {
+		t.Fatalf("insert chain_tunnel: %v", err)
+	}
+	if err := repo.DB().Exec(`INSERT INTO user_tunnel(id, user_id, tunnel_id, speed_id, num, flow, in_flow, out_flow, flow_reset_time, exp_time, status) VALUES(30, 2, ?, NULL, 999, 99999, 0, 0, 1, 2727251700000, 1)`, tunnelID).Error; err != nil {
+		t.Fatalf("insert user_tunnel: %v", err)
+	}
+
+	stop := startMockNodeSession(t, server.URL, "template-node-secret")
+	defer stop()
+	waitNodeStatus(t, repo, nodeID, 1)
+
+	adminToken, err := auth.GenerateToken(1, "admin_user", 0, secret)
+	if err != nil {
+		t.Fatalf("generate admin token: %v", err)
+	}
+	userToken, err := auth.GenerateToken(2, "template_user", 1, secret)
+	if err != nil {
+		t.Fatalf("generate user token: %v", err)
+	}
+	post := func(path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", token)
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+	decode := func(res *httptest.ResponseRecorder) map[string]interface{} {
+		t.Helper()
+		var out response.R
+		if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if out.Code != 0 {
+			t.Fatalf("expected code 0, got %d (%s)", out.Code, out.Msg)
+		}
+		data, _ := out.Data.(map[string]interface{})
+		return data
+	}
+
+	assertCode(t, post("/api/v1/forward/template/list", userToken, `{}`), 403)
+	assertCodeMsg(t, post("/api/v1/forward/template/create", adminToken, `{"name":"bad","remoteAddr":"10.0.0.1:80","protocol":"sctp"}`), -1, "转发协议只能是 tcp、udp 或 tcp+udp")
+
+	created := decode(post("/api/v1/forward/template/create", adminToken, `{"name":"web","remoteAddr":"10.0.0.1:80","protocol":"tcp","maxConns":10,"tunnelId":99}`))
+	templateID := int64(valueAsInt(created["id"]))
+
+	applied := decode(post("/api/v1/forward/template/apply", adminToken, `{"id":`+jsonNumber(templateID)+`,"userIds":[2,3],"tunnelIds":[`+jsonNumber(tunnelID)+`]}`))
+	if valueAsInt(applied["successCount"]) != 1 || valueAsInt(applied["failCount"]) != 1 {
+		t.Fatalf("expected one forward created and one refused, got %v", applied)
+	}
+	results, _ := applied["results"].([]interface{})
+	first, _ := results[0].(map[string]interface{})
+	second, _ := results[1].(map[string]interface{})
+	if !valueAsBool(first["success"]) || valueAsString(second["message"]) != "用户没有该隧道的权限" {
+		t.Fatalf("unexpected per-item results %v", results)
+	}
+	forwardID := int64(valueAsInt(first["forwardId"]))
+	if got := mustQueryString(t, repo, `SELECT protocol FROM forward WHERE id = ? AND user_id = 2 AND name = 'web' AND max_conns = 10`, forwardID); got != "tcp" {
+		t.Fatalf("expected the template settings on the forward, got protocol %q", got)
+	}
+
+	cloned := decode(post("/api/v1/forward/clone", adminToken, `{"userId":2,"targetUserId":1}`))
+	if valueAsInt(cloned["successCount"]) != 1 {
+		t.Fatalf("expected the user's forward to be cloned, got %v", cloned)
+	}
+	results, _ = cloned["results"].([]interface{})
+	copied, _ := results[0].(map[string]interface{})
+	if int64(valueAsInt(copied["sourceId"])) != forwardID || valueAsInt(copied["inPort"]) == valueAsInt(first["inPort"]) {
+		t.Fatalf("expected a copy on a fresh port, got %v", copied)
+	}
+	if owner := mustQueryInt64(t, repo, `SELECT user_id FROM forward WHERE id = ?`, int64(valueAsInt(copied["forwardId"]))); owner != 1 {
+		t.Fatalf("expected the copy to belong to user 1, got %d", owner)
+	}
+
+	refused := decode(post("/api/v1/forward/clone", adminToken, `{"forwardIds":[`+jsonNumber(forwardID)+`],"targetUserId":3}`))
+	if valueAsInt(refused["failCount"]) != 1 {
+		t.Fatalf("expected cloning to a user without the tunnel to fail, got %v", refused)
+	}
+	if count := mustQueryInt(t, repo, `SELECT COUNT(*) FROM forward`); count != 2 {
+		t.Fatalf("expected 2 forwards, got %d", count)
+	}
+}
@@ -128,6 +128,157 @@ func TestTunnelUpdateAssignsChainPortsContract(t *testing.T) {
 	}
 }
 
+func TestTunnelUpdateStoresTransportOptionsContract(t *testing.T) {
+	secret := "contract-jwt-secret"
+	router, repo := setupContractRouter(t, secret)
+	now := time.Now().UnixMilli()
+
+	adminToken, err := auth.GenerateToken(1, "admin_user", 0, secret)
+	if err != nil {
+		t.Fatalf("generate admin token: %v", err)
+	}
+
+	insertNode := func(name, ip, portRange string) int64 {
+		if err := repo.DB().Exec(`
+			INSERT INTO node(name, secret, server_ip, server_ip_v4, server_ip_v6, port, interface_name, version, http, tls, socks, created_time, updated_time, status, tcp_listen_addr, udp_listen_addr, inx)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, name, name+"-secret", ip, ip, "", portRange, "", "v1", 1, 1, 1, now, now, 1, "[::]", "[::]", 0).Error; err != nil {
+			t.Fatalf("insert node %s: %v", name, err)
+		}
+		return mustLastInsertID(t, repo, name)
+	}
+
+	entryID := insertNode("transport-entry", "10.40.0.1", "43000-43010")
+	exitID := insertNode("transport-exit", "10.40.0.2", "44000-44010")
+
+	if err := repo.DB().Exec(`
+		INSERT INTO tunnel(name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, in_ip, inx)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, "transport-tunnel", 1.0, 2, "tls", 99999, now, now, 1, nil, 0).Error; err != nil {
+		t.Fatalf("insert tunnel: %v", err)
+	}
+	tunnelID := mustLastInsertID(t, repo, "transport-tunnel")
+
+	update := func(out string) *httptest.ResponseRecorder {
+		payload := `{"id":` + jsonInt(tunnelID) + `,"name":"transport-tunnel","type":2,"flow":99999,"trafficRatio":1.0,"status":1,"inNodeId":[{"nodeId":` + jsonInt(entryID) + `}],"outNodeId":[{"nodeId":` + jsonInt(exitID) + `,` + out + `}]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tunnel/update", bytes.NewBufferString(payload))
+		req.Header.Set("Authorization", adminToken)
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	assertCode(t, update(`"protocol":"KCP","options":{"keepalive":20,"kcp":{"mode":"Fast","mtu":1350}}`), 0)
+
+	protocol := mustQueryString(t, repo, `SELECT protocol FROM chain_tunnel WHERE tunnel_id = ? AND chain_type = 3`, tunnelID)
+	options := mustQueryString(t, repo, `SELECT options FROM chain_tunnel WHERE tunnel_id = ? AND chain_type = 3`, tunnelID)
+	if protocol != "kcp" || options != `{"keepalive":20,"kcp":{"mode":"fast","mtu":1350}}` {
+		t.Fatalf("unexpected stored transport %q %q", protocol, options)
+	}
+
+	assertCodeMsg(t, update(`"protocol":"kcp","options":{"sni":"a.example.com"}`), -1, "协议 kcp 不使用 TLS，不能设置 SNI")
+	if got := mustQueryString(t, repo, `SELECT options FROM chain_tunnel WHERE tunnel_id = ? AND chain_type = 3`, tunnelID); got != options {
+		t.Fatalf("expected a rejected update to keep the stored options, got %q", got)
+	}
+}
+
+func TestTunnelRelaySecretMigratesAndRotatesContract(t *testing.T) {
+	secret := "contract-jwt-secret"
+	router, repo := setupContractRouter(t, secret)
+	now := time.Now().UnixMilli()
+
+	adminToken, err := auth.GenerateToken(1, "admin_user", 0, secret)
+	if err != nil {
+		t.Fatalf("generate admin token: %v", err)
+	}
+
+	insertNode := func(name, ip, portRange string) int64 {
+		if err := repo.DB().Exec(`
+			INSERT INTO node(name, secret, server_ip, server_ip_v4, server_ip_v6, port, interface_name, version, http, tls, socks, created_time, updated_time, status, tcp_listen_addr, udp_listen_addr, inx)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, name, name+"-secret", ip, ip, "", portRange, "", "v1", 1, 1, 1, now, now, 1, "[::]", "[::]", 0).Error; err != nil {
+			t.Fatalf("insert node %s: %v", name, err)
+		}
+		return mustLastInsertID(t, repo, name)
+	}
+
+	entryID := insertNode("relay-entry", "10.41.0.1", "43000-43010")
+	exitID := insertNode("relay-exit", "10.41.0.2", "44000-44010")
+
+	// A tunnel created before relay authentication has no secret yet.
+	if err := repo.DB().Exec(`
+		INSERT INTO tunnel(name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, in_ip, inx)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, "relay-tunnel", 1.0, 2, "tls", 99999, now, now, 1, nil, 0).Error; err != nil {
+		t.Fatalf("insert tunnel: %v", err)
+	}
+	tunnelID := mustLastInsertID(t, repo, "relay-tunnel")
+
+	post := func(path, payload string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(payload))
+		req.Header.Set("Authorization", adminToken)
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	assertCode(t, post("/api/v1/tunnel/update", `{"id":`+jsonInt(tunnelID)+`,"name":"relay-tunnel","type":2,"flow":99999,"trafficRatio":1.0,"status":1,"inNodeId":[{"nodeId":`+jsonInt(entryID)+`}],"outNodeId":[{"nodeId":`+jsonInt(exitID)+`,"protocol":"tls"}]}`), 0)
+
+	migrated := mustQueryString(t, repo, `SELECT relay_secret FROM tunnel WHERE id = ?`, tunnelID)
+	if migrated == "" {
+		t.Fatalf("expected deploying the tunnel to give it a relay secret")
+	}
+
+	assertCode(t, post("/api/v1/tunnel/batch-redeploy", `{"ids":[`+jsonInt(tunnelID)+`]}`), 0)
+	if got := mustQueryString(t, repo, `SELECT relay_secret FROM tunnel WHERE id = ?`, tunnelID); got != migrated {
+		t.Fatalf("expected a redeploy to keep the relay secret, got %q", got)
+	}
+
+	rotate := func() map[string]interface{} {
+		res := post("/api/v1/tunnel/batch-rotate-auth", `{"ids":[`+jsonInt(tunnelID)+`]}`)
+		body := append([]byte(nil), res.Body.Bytes()...)
+		assertCode(t, res, 0)
+		var out struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal(body, &out); err != nil {
+			t.Fatalf("decode rotation result: %v", err)
+		}
+		return out.Data
+	}
+
+	// The nodes are offline, so the redeploy fails and the old secret stays.
+	if result := rotate(); valueAsInt(result["failCount"]) != 1 {
+		t.Fatalf("expected rotation to fail with the nodes offline, got %v", result)
+	}
+	if got := mustQueryString(t, repo, `SELECT relay_secret FROM tunnel WHERE id = ?`, tunnelID); got != migrated {
+		t.Fatalf("expected a failed rotation to restore the relay secret, got %q", got)
+	}
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	for _, nodeID := range []int64{entryID, exitID} {
+		if err := repo.DB().Exec(`UPDATE node SET status = 0 WHERE id = ?`, nodeID).Error; err != nil {
+			t.Fatalf("mark node offline: %v", err)
+		}
+	}
+	stopEntry := startMockNodeSession(t, server.URL, "relay-entry-secret")
+	defer stopEntry()
+	stopExit := startMockNodeSession(t, server.URL, "relay-exit-secret")
+	defer stopExit()
+	waitNodeStatus(t, repo, entryID, 1)
+	waitNodeStatus(t, repo, exitID, 1)
+
+	if result := rotate(); valueAsInt(result["successCount"]) != 1 {
+		t.Fatalf("expected rotation to succeed with the nodes online, got %v", result)
+	}
+	if got := mustQueryString(t, repo, `SELECT relay_secret FROM tunnel WHERE id = ?`, tunnelID); got == "" || got == migrated {
+		t.Fatalf("expected rotation to replace the relay secret, got %q", got)
+	}
+}
+
 func jsonInt(v int64) string {
 	return strconv.FormatInt(v, 10)
 }
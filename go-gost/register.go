@@ -97,6 +97,7 @@ import (
 	_ "github.com/go-gost/x/listener/rtcp"
 	_ "github.com/go-gost/x/listener/rudp"
 	_ "github.com/go-gost/x/listener/serial"
+	_ "github.com/go-gost/x/listener/sni"
 	_ "github.com/go-gost/x/listener/ssh"
 	_ "github.com/go-gost/x/listener/sshd"
 	_ "github.com/go-gost/x/listener/tap"
@@ -537,20 +537,18 @@ func pauseService(ctx *gin.Context) {
 		return
 	}
 
-	// 获取服务地址用于强制断开连接
-	var serviceAddr string
+	// 获取服务配置用于强制断开连接
+	var serviceConfig *config.ServiceConfig
 	cfg := config.Global()
 	for _, s := range cfg.Services {
 		if s.Name == name {
-			serviceAddr = s.Addr
+			serviceConfig = s
 			break
 		}
 	}
 
 	// 强制断开端口的所有连接
-	if serviceAddr != "" {
-		_ = kill.ForceClosePortConnections(serviceAddr)
-	}
+	_ = kill.ForceCloseServiceConnections(serviceConfig)
 
 	// 更新配置中的暂停状态
 	config.OnUpdate(func(c *config.Config) error {
@@ -909,9 +907,7 @@ func pauseServices(ctx *gin.Context) {
 		}
 
 		// 强制断开端口的所有连接
-		if serviceConfig.Addr != "" {
-			_ = kill.ForceClosePortConnections(serviceConfig.Addr)
-		}
+		_ = kill.ForceCloseServiceConnections(serviceConfig)
 
 		// 记录已暂停的服务
 		pausedServices = append(pausedServices, struct {
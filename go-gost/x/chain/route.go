@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-gost/core/chain"
@@ -16,6 +18,7 @@ import (
 	"github.com/go-gost/x/internal/net/dialer"
 	"github.com/go-gost/x/internal/net/udp"
 	xmetrics "github.com/go-gost/x/metrics"
+	xselector "github.com/go-gost/x/selector"
 )
 
 var (
@@ -149,9 +152,42 @@ func (r *chainRoute) Dial(ctx context.Context, network, address string, opts ...
 		}
 		return nil, err
 	}
+	if strings.HasPrefix(network, "tcp") {
+		cc = newCountedConn(cc, r.Nodes())
+	}
 	return cc, nil
 }
 
+// countedConn holds the open connection count of the route's nodes for the
+// least connections strategy until it is closed. Only stream connections
+// are wrapped, so packet connections keep their own interfaces.
+type countedConn struct {
+	net.Conn
+	releases []func()
+}
+
+func newCountedConn(c net.Conn, nodes []*chain.Node) net.Conn {
+	releases := make([]func(), 0, len(nodes))
+	for _, node := range nodes {
+		releases = append(releases, xselector.AcquireConn(node))
+	}
+	return &countedConn{Conn: c, releases: releases}
+}
+
+func (c *countedConn) Close() error {
+	for _, release := range c.releases {
+		release()
+	}
+	return c.Conn.Close()
+}
+
+func (c *countedConn) SyscallConn() (syscall.RawConn, error) {
+	if sc, ok := c.Conn.(syscall.Conn); ok {
+		return sc.SyscallConn()
+	}
+	return nil, errors.ErrUnsupported
+}
+
 func (r *chainRoute) Bind(ctx context.Context, network, address string, opts ...chain.BindOption) (net.Listener, error) {
 	if len(r.Nodes()) == 0 {
 		return DefaultRoute.Bind(ctx, network, address, opts...)
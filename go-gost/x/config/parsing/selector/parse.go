@@ -22,6 +22,12 @@ func ParseChainSelector(cfg *config.SelectorConfig) selector.Selector[chain.Chai
 		strategy = xs.FIFOStrategy[chain.Chainer]()
 	case "hash":
 		strategy = xs.HashStrategy[chain.Chainer]()
+	case "weighted", "wrr":
+		strategy = xs.WeightedRoundRobinStrategy[chain.Chainer]()
+	case "least", "leastconn":
+		strategy = xs.LeastConnStrategy[chain.Chainer]()
+	case "sticky":
+		strategy = xs.StickyStrategy[chain.Chainer]()
 	default:
 		strategy = xs.RoundRobinStrategy[chain.Chainer]()
 	}
@@ -47,6 +53,12 @@ func ParseNodeSelector(cfg *config.SelectorConfig) selector.Selector[*chain.Node
 		strategy = xs.FIFOStrategy[*chain.Node]()
 	case "hash":
 		strategy = xs.HashStrategy[*chain.Node]()
+	case "weighted", "wrr":
+		strategy = xs.WeightedRoundRobinStrategy[*chain.Node]()
+	case "least", "leastconn":
+		strategy = xs.LeastConnStrategy[*chain.Node]()
+	case "sticky":
+		strategy = xs.StickyStrategy[*chain.Node]()
 	default:
 		strategy = xs.RoundRobinStrategy[*chain.Node]()
 	}
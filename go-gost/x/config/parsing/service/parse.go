@@ -11,6 +11,7 @@ import (
 	"github.com/go-gost/core/chain"
 	"github.com/go-gost/core/handler"
 	"github.com/go-gost/core/hop"
+	"github.com/go-gost/core/limiter/traffic"
 	"github.com/go-gost/core/listener"
 	"github.com/go-gost/core/logger"
 	"github.com/go-gost/core/observer"
@@ -30,6 +31,7 @@ import (
 	hop_parser "github.com/go-gost/x/config/parsing/hop"
 	logger_parser "github.com/go-gost/x/config/parsing/logger"
 	selector_parser "github.com/go-gost/x/config/parsing/selector"
+	xnet "github.com/go-gost/x/internal/net"
 	tls_util "github.com/go-gost/x/internal/util/tls"
 	xtraffic "github.com/go-gost/x/limiter/traffic"
 	cache_limiter "github.com/go-gost/x/limiter/traffic/cache"
@@ -185,28 +187,28 @@ func ParseService(cfg *config.ServiceConfig) (service.Service, error) {
 
 	var trafficLimiter listener.Option
 	if cfg.Limiter != "" {
-		lim := registry.TrafficLimiterRegistry().Get(cfg.Limiter)
-		if lim == nil {
-			// Try to parse as simple number (bandwidth in bytes/sec)
-			if val, err := strconv.Atoi(cfg.Limiter); err == nil && val > 0 {
-				lim = xtraffic.NewTrafficLimiter(
-					xtraffic.LimitsOption(fmt.Sprintf("%s %dB %dB", xtraffic.ServiceLimitKey, val, val)),
-				)
-			}
-			if lim == nil {
-				lim = xtraffic.NewTrafficLimiter(
-					xtraffic.LimitsOption(fmt.Sprintf("%s %s %s", xtraffic.ServiceLimitKey, cfg.Limiter, cfg.Limiter)),
-				)
+		// A comma separated list (e.g. "12,user_3") stacks several named
+		// limiters. Each one is cached on its own so a reload of one member
+		// is picked up even when the tightest limit stays the same.
+		var lims []traffic.TrafficLimiter
+		for _, name := range strings.Split(cfg.Limiter, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
 			}
-		}
-		trafficLimiter = listener.TrafficLimiterOption(
-			cache_limiter.NewCachedTrafficLimiter(
-				lim,
+			lims = append(lims, cache_limiter.NewCachedTrafficLimiter(
+				parseServiceTrafficLimiter(name),
 				cache_limiter.RefreshIntervalOption(limiterRefreshInterval),
 				cache_limiter.CleanupIntervalOption(limiterCleanupInterval),
 				cache_limiter.ScopeOption(limiterScope),
-			),
-		)
+			))
+		}
+		switch len(lims) {
+		case 0:
+		case 1:
+			trafficLimiter = listener.TrafficLimiterOption(lims[0])
+		default:
+			trafficLimiter = listener.TrafficLimiterOption(xtraffic.NewTrafficLimiterGroup(lims...))
+		}
 	}
 
 	listenOpts := []listener.Option{
@@ -254,21 +256,28 @@ func ParseService(cfg *config.ServiceConfig) (service.Service, error) {
 		}
 	}
 
-	var ln listener.Listener
-	if rf := registry.ListenerRegistry().Get(cfg.Listener.Type); rf != nil {
-		ln = rf(listenOpts...)
-	} else {
-		return nil, fmt.Errorf("unknown listener: %s", cfg.Listener.Type)
-	}
-
 	if cfg.Listener.Metadata == nil {
 		cfg.Listener.Metadata = make(map[string]any)
 	}
 	listenerLogger.Debugf("metadata: %v", cfg.Listener.Metadata)
-	if err := ln.Init(metadata.NewMetadata(cfg.Listener.Metadata)); err != nil {
+
+	var ln listener.Listener
+	if addrs := xnet.AddrPortRange(cfg.Addr).Addrs(); len(addrs) > 1 {
+		ln, err = parsePortRangeListener(cfg.Listener, addrs, listenOpts)
+	} else {
+		ln, err = parseListener(cfg.Listener, listenOpts)
+	}
+	if err != nil {
 		listenerLogger.Error("init: ", err)
 		return nil, err
 	}
+	// 后续任一步失败都要释放监听，接管来的套接字也不能遗留
+	started := false
+	defer func() {
+		if !started {
+			ln.Close()
+		}
+	}()
 
 	handlerLogger := serviceLogger.WithFields(map[string]any{
 		"kind": "handler",
@@ -380,8 +389,13 @@ func ParseService(cfg *config.ServiceConfig) (service.Service, error) {
 		observer = registry.ObserverRegistry().Get("console")
 	}
 
+	// 客户端IP跟踪只挂在转发服务的服务层，每个连接只记录一次
+	serviceAdmissions := admissions
+	if xservice.IsForwardService(cfg.Name) {
+		serviceAdmissions = append(serviceAdmissions, xservice.ClientIPAdmission(cfg.Name))
+	}
 	s := xservice.NewService(cfg.Name, ln, h,
-		xservice.AdmissionOption(xadmission.AdmissionGroup(admissions...)),
+		xservice.AdmissionOption(xadmission.AdmissionGroup(serviceAdmissions...)),
 		xservice.PreUpOption(preUp),
 		xservice.PreDownOption(preDown),
 		xservice.PostUpOption(postUp),
@@ -393,10 +407,29 @@ func ParseService(cfg *config.ServiceConfig) (service.Service, error) {
 		xservice.LoggerOption(serviceLogger),
 	)
 
+	started = true
 	serviceLogger.Infof("listening on %s/%s", s.Addr().String(), s.Addr().Network())
 	return s, nil
 }
 
+func parseServiceTrafficLimiter(name string) traffic.TrafficLimiter {
+	lim := registry.TrafficLimiterRegistry().Get(name)
+	if lim == nil {
+		// Try to parse as simple number (bandwidth in bytes/sec)
+		if val, err := strconv.Atoi(name); err == nil && val > 0 {
+			lim = xtraffic.NewTrafficLimiter(
+				xtraffic.LimitsOption(fmt.Sprintf("%s %dB %dB", xtraffic.ServiceLimitKey, val, val)),
+			)
+		}
+		if lim == nil {
+			lim = xtraffic.NewTrafficLimiter(
+				xtraffic.LimitsOption(fmt.Sprintf("%s %s %s", xtraffic.ServiceLimitKey, name, name)),
+			)
+		}
+	}
+	return lim
+}
+
 func parseForwarder(cfg *config.ForwarderConfig, log logger.Logger) (hop.Hop, error) {
 	if cfg == nil {
 		return nil, nil
@@ -455,6 +488,35 @@ func parseForwarder(cfg *config.ForwarderConfig, log logger.Logger) (hop.Hop, er
 	return hop_parser.ParseHop(&hc, log)
 }
 
+func parseListener(cfg *config.ListenerConfig, opts []listener.Option) (listener.Listener, error) {
+	rf := registry.ListenerRegistry().Get(cfg.Type)
+	if rf == nil {
+		return nil, fmt.Errorf("unknown listener: %s", cfg.Type)
+	}
+	ln := rf(opts...)
+	if err := ln.Init(metadata.NewMetadata(cfg.Metadata)); err != nil {
+		return nil, err
+	}
+	return ln, nil
+}
+
+// parsePortRangeListener creates a listener for each port of a range such as
+// [::]:20000-20100 and serves them as one.
+func parsePortRangeListener(cfg *config.ListenerConfig, addrs []string, opts []listener.Option) (listener.Listener, error) {
+	lns := make([]listener.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		ln, err := parseListener(cfg, append(opts[:len(opts):len(opts)], listener.AddrOption(addr)))
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return nil, fmt.Errorf("%s: %w", addr, err)
+		}
+		lns = append(lns, ln)
+	}
+	return xservice.NewPortRangeListener(lns...), nil
+}
+
 func chainGroup(name string, group *config.ChainGroupConfig) chain.Chainer {
 	var chains []chain.Chainer
 	var sel selector.Selector[chain.Chainer]
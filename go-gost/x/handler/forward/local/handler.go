@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/go-gost/core/chain"
@@ -16,6 +17,7 @@ import (
 	"github.com/go-gost/core/recorder"
 	ctxvalue "github.com/go-gost/x/ctx"
 	xnet "github.com/go-gost/x/internal/net"
+	"github.com/go-gost/x/internal/net/proxyproto"
 	"github.com/go-gost/x/internal/util/forwarder"
 	"github.com/go-gost/x/internal/util/sniffing"
 	tls_util "github.com/go-gost/x/internal/util/tls"
@@ -24,6 +26,8 @@ import (
 	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
 	xrecorder "github.com/go-gost/x/recorder"
 	"github.com/go-gost/x/registry"
+	xselector "github.com/go-gost/x/selector"
+	xservice "github.com/go-gost/x/service"
 )
 
 func init() {
@@ -38,6 +42,9 @@ type forwardHandler struct {
 	options  handler.Options
 	recorder recorder.RecorderObject
 	certPool tls_util.CertPool
+
+	healthChecker *healthChecker
+	reverseProxy  *reverseProxy
 }
 
 func NewHandler(opts ...handler.Option) handler.Handler {
@@ -67,6 +74,12 @@ func (h *forwardHandler) Init(md md.Metadata) (err error) {
 		h.certPool = tls_util.NewMemoryCertPool()
 	}
 
+	h.startHealthCheck()
+
+	if h.md.reverseProxy.enabled {
+		h.reverseProxy = newReverseProxy(h)
+	}
+
 	return
 }
 
@@ -106,6 +119,13 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 	}
 	ro.Network = network
 
+	// A port range service maps each entry port to the target port at the
+	// same position in the target range.
+	var portOffset int
+	if po, ok := conn.(xnet.PortOffset); ok && h.md.portMap {
+		portOffset = po.PortOffset()
+	}
+
 	pStats := xstats.Stats{}
 	conn = stats_wrapper.WrapConn(conn, &pStats)
 
@@ -117,12 +137,19 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 		ro.OutputBytes = pStats.Get(stats.KindOutputBytes)
 		ro.Duration = time.Since(start)
 
+		if h.md.connLog {
+			h.logConn(ro)
+		}
 	}()
 
 	if !h.checkRateLimit(conn.RemoteAddr()) {
 		return rate_limiter.ErrRateLimit
 	}
 
+	if h.reverseProxy != nil && network == "tcp" {
+		return h.reverseProxy.serve(ctx, conn, ro)
+	}
+
 	var proto string
 	if network == "tcp" && h.md.sniffing {
 		if h.md.sniffingTimeout > 0 {
@@ -227,6 +254,9 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 				}
 			}
 		}
+		if portOffset > 0 {
+			addr = offsetPort(addr, portOffset)
+		}
 
 		ro.Network = network
 		ro.Host = addr
@@ -251,6 +281,11 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 			marker.Reset()
 		}
 		defer cc.Close()
+		defer xselector.AcquireConn(target)()
+
+		if network == "tcp" {
+			cc = proxyproto.WrapClientConn(h.md.proxyProtocol, conn.RemoteAddr(), conn.LocalAddr(), cc)
+		}
 
 		if err := xnet.Transport(conn, cc); err != nil {
 			if marker := target.Marker(); marker != nil {
@@ -270,6 +305,21 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 	return errors.New("all nodes failed")
 }
 
+// logConn queues the finished connection for the panel's connection log.
+func (h *forwardHandler) logConn(ro *xrecorder.HandlerRecorderObject) {
+	xservice.GetConnLogTracker().Add(h.options.Service, xservice.ConnLogEntry{
+		Client:  ro.RemoteAddr,
+		Entry:   ro.LocalAddr,
+		Target:  ro.Host,
+		Network: ro.Network,
+		Start:   ro.Time.UnixMilli(),
+		End:     ro.Time.Add(ro.Duration).UnixMilli(),
+		Up:      int64(ro.InputBytes),
+		Down:    int64(ro.OutputBytes),
+		Reason:  ro.Err,
+	})
+}
+
 func (h *forwardHandler) checkRateLimit(addr net.Addr) bool {
 	if h.options.RateLimiter == nil {
 		return true
@@ -281,3 +331,17 @@ func (h *forwardHandler) checkRateLimit(addr net.Addr) bool {
 
 	return true
 }
+
+// offsetPort moves the port of addr forward by offset. addr is returned
+// unchanged when it has no numeric port or the result is out of range.
+func offsetPort(addr string, offset int) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n+offset > 65535 {
+		return addr
+	}
+	return net.JoinHostPort(host, strconv.Itoa(n+offset))
+}
@@ -0,0 +1,22 @@
+package local
+
+import "testing"
+
+func TestOffsetPort(t *testing.T) {
+	cases := []struct {
+		addr   string
+		offset int
+		want   string
+	}{
+		{"10.0.0.1:8000", 5, "10.0.0.1:8005"},
+		{"[::1]:8000", 1, "[::1]:8001"},
+		{"example.com:65535", 1, "example.com:65535"},
+		{"example.com", 1, "example.com"},
+		{"example.com:http", 1, "example.com:http"},
+	}
+	for _, c := range cases {
+		if got := offsetPort(c.addr, c.offset); got != c.want {
+			t.Errorf("offsetPort(%q, %d) = %q, want %q", c.addr, c.offset, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package local
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-gost/core/chain"
+	"github.com/go-gost/core/hop"
+	xservice "github.com/go-gost/x/service"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 3 * time.Second
+)
+
+type healthCheckOptions struct {
+	// typ is the probe type: tcp, udp or http.
+	typ      string
+	interval time.Duration
+	timeout  time.Duration
+	// path is the request path of http probes.
+	path string
+	// healthy and unhealthy are the numbers of consecutive successful or
+	// failed probes that flip a target's state.
+	healthy   int
+	unhealthy int
+}
+
+type targetHealth struct {
+	healthy   bool
+	successes int
+	failures  int
+	// known is false for a udp target that has not answered a probe yet.
+	// Its state is not reported and does not affect the selector.
+	known bool
+}
+
+// errNoReply is returned by a udp probe that got no answer before the
+// timeout. Many udp services ignore unexpected datagrams, so silence from a
+// target that never replied leaves it unknown rather than healthy.
+var errNoReply = errors.New("no reply")
+
+// healthChecker probes the targets of a forward through the handler's
+// router, so a target behind a tunnel is checked from the exit node. An
+// unhealthy target is kept marked as failed, which takes it out of the
+// selector; a healthy one has its failures cleared without waiting for the
+// fail timeout.
+type healthChecker struct {
+	service string
+	hop     hop.NodeList
+	opts    healthCheckOptions
+	dial    func(ctx context.Context, network, addr string) (net.Conn, error)
+	states  map[string]*targetHealth
+	cancel  context.CancelFunc
+}
+
+func (h *forwardHandler) startHealthCheck() {
+	switch h.md.healthCheck.typ {
+	case "tcp", "udp", "http":
+	default:
+		return
+	}
+	nl, ok := h.hop.(hop.NodeList)
+	if !ok || h.options.Router == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &healthChecker{
+		service: h.options.Service,
+		hop:     nl,
+		opts:    h.md.healthCheck,
+		dial:    h.options.Router.Dial,
+		states:  make(map[string]*targetHealth),
+		cancel:  cancel,
+	}
+	xservice.GetTargetHealthTracker().Register(c.service, c)
+	h.healthChecker = c
+	go c.run(ctx)
+}
+
+func (c *healthChecker) run(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		c.checkAll(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *healthChecker) checkAll(ctx context.Context) {
+	nodes := c.hop.Nodes()
+	addrs := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		addrs = append(addrs, node.Addr)
+		c.update(node, c.probe(ctx, node))
+	}
+	for addr := range c.states {
+		if !slices.Contains(addrs, addr) {
+			delete(c.states, addr)
+		}
+	}
+	xservice.GetTargetHealthTracker().Retain(c.service, c, addrs)
+}
+
+func (c *healthChecker) update(node *chain.Node, err error) {
+	st, found := c.states[node.Addr]
+	if !found {
+		st = &targetHealth{healthy: true, known: c.opts.typ != "udp"}
+		c.states[node.Addr] = st
+	}
+	if !st.known && errors.Is(err, errNoReply) {
+		return
+	}
+	ok := err == nil
+	if ok {
+		st.failures = 0
+		st.successes++
+		if !st.healthy && st.successes >= c.opts.healthy {
+			st.healthy = true
+		}
+	} else {
+		st.successes = 0
+		st.failures++
+		if st.healthy && st.failures >= c.opts.unhealthy {
+			st.healthy = false
+		}
+	}
+	// A udp target becomes known with its first reply, or once errors
+	// such as port unreachable reports mark it down.
+	if !st.known {
+		if st.healthy && !ok {
+			return
+		}
+		st.known = true
+	}
+
+	if marker := node.Marker(); marker != nil {
+		if st.healthy {
+			if marker.Count() > 0 {
+				marker.Reset()
+			}
+		} else {
+			marker.Mark()
+		}
+	}
+	xservice.GetTargetHealthTracker().Set(c.service, c, node.Addr, st.healthy)
+}
+
+func (c *healthChecker) probe(ctx context.Context, node *chain.Node) error {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+	defer cancel()
+
+	addr := node.Addr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr += ":0"
+	}
+
+	network := "tcp"
+	if c.opts.typ == "udp" {
+		network = "udp"
+	}
+	conn, err := c.dial(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.opts.timeout))
+
+	switch c.opts.typ {
+	case "http":
+		return c.probeHTTP(conn, addr)
+	case "udp":
+		return probeUDP(conn)
+	}
+	return nil
+}
+
+func (c *healthChecker) probeHTTP(conn net.Conn, addr string) error {
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+c.opts.path, nil)
+	if err != nil {
+		return err
+	}
+	req.Close = true
+	req.Header.Set("User-Agent", "GOST-HealthCheck/1.0")
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// probeUDP sends a single datagram and waits for any reply. Silence until
+// the deadline returns errNoReply; an error such as a port unreachable
+// report is returned as is.
+func probeUDP(conn net.Conn) error {
+	if _, err := conn.Write([]byte{0}); err != nil {
+		return err
+	}
+	var b [1]byte
+	if _, err := conn.Read(b[:]); err != nil {
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return errNoReply
+		}
+		return err
+	}
+	return nil
+}
+
+// Close stops the health checker. The service closes its handler when it is
+// deleted or replaced.
+func (h *forwardHandler) Close() error {
+	if c := h.healthChecker; c != nil {
+		c.cancel()
+		xservice.GetTargetHealthTracker().Unregister(c.service, c)
+	}
+	if p := h.reverseProxy; p != nil {
+		p.close()
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package local
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/chain"
+	xservice "github.com/go-gost/x/service"
+)
+
+func TestHealthCheckerThresholds(t *testing.T) {
+	c := &healthChecker{
+		service: "hc_tcp",
+		opts:    healthCheckOptions{typ: "tcp", healthy: 2, unhealthy: 2},
+		states:  make(map[string]*targetHealth),
+	}
+	xservice.GetTargetHealthTracker().Register(c.service, c)
+	defer xservice.GetTargetHealthTracker().Unregister(c.service, c)
+	node := chain.NewNode("t1", "10.0.0.1:80")
+
+	c.update(node, net.ErrClosed)
+	if !c.states[node.Addr].healthy || node.Marker().Count() != 0 {
+		t.Fatalf("expected a single failure to stay below the threshold")
+	}
+	c.update(node, net.ErrClosed)
+	if c.states[node.Addr].healthy || node.Marker().Count() == 0 {
+		t.Fatalf("expected the target to be marked down")
+	}
+	c.update(node, nil)
+	if c.states[node.Addr].healthy {
+		t.Fatalf("expected a single success to stay below the threshold")
+	}
+	c.update(node, nil)
+	if !c.states[node.Addr].healthy || node.Marker().Count() != 0 {
+		t.Fatalf("expected the target to recover and its failures to be cleared")
+	}
+}
+
+func TestHealthCheckerUDPStaysUnknownUntilReply(t *testing.T) {
+	c := &healthChecker{
+		service: "hc_udp",
+		opts:    healthCheckOptions{typ: "udp", healthy: 1, unhealthy: 1},
+		states:  make(map[string]*targetHealth),
+	}
+	tracker := xservice.GetTargetHealthTracker()
+	tracker.Register(c.service, c)
+	defer tracker.Unregister(c.service, c)
+	node := chain.NewNode("t1", "10.0.0.1:53")
+
+	c.update(node, errNoReply)
+	if c.states[node.Addr].known {
+		t.Fatalf("expected a silent udp target to stay unknown")
+	}
+	if node.Marker().Count() != 0 {
+		t.Fatalf("expected an unknown target to stay in the selector")
+	}
+
+	c.update(node, nil)
+	if st := c.states[node.Addr]; !st.known || !st.healthy {
+		t.Fatalf("expected a reply to make the target healthy, got %+v", st)
+	}
+	c.update(node, errNoReply)
+	if c.states[node.Addr].healthy {
+		t.Fatalf("expected silence after a reply to count as a failure")
+	}
+}
+
+func TestProbeUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer pc.Close()
+	go func() {
+		b := make([]byte, 16)
+		for {
+			n, addr, err := pc.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(b[:n], addr)
+		}
+	}()
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if err := probeUDP(conn); err != nil {
+		t.Fatalf("expected the echo reply to pass, got %v", err)
+	}
+	conn.Close()
+
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer silent.Close()
+	conn, err = net.Dial("udp", silent.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	if err := probeUDP(conn); err != errNoReply {
+		t.Fatalf("expected errNoReply from a silent target, got %v", err)
+	}
+}
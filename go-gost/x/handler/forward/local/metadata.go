@@ -4,6 +4,7 @@ import (
 	"crypto"
 	"crypto/tls"
 	"crypto/x509"
+	"strings"
 	"time"
 
 	"github.com/go-gost/core/bypass"
@@ -31,6 +32,24 @@ type metadata struct {
 	// 0 means use the total number of available nodes (try all nodes once).
 	// Default: 0 (try all available nodes)
 	maxRetries int
+
+	// proxyProtocol is the PROXY protocol version (1 or 2) written to TCP
+	// targets ahead of the client's data. 0 disables it.
+	proxyProtocol int
+
+	// portMap sends connections accepted on a port range to the target
+	// port at the same offset instead of the target's own port.
+	portMap bool
+
+	// healthCheck configures active probing of the forward targets. An
+	// empty type disables it.
+	healthCheck healthCheckOptions
+
+	// reverseProxy serves TCP connections as an HTTP reverse proxy.
+	reverseProxy reverseProxyOptions
+
+	// connLog reports every finished connection to the panel.
+	connLog bool
 }
 
 func (h *forwardHandler) parseMetadata(md mdata.Metadata) (err error) {
@@ -65,5 +84,75 @@ func (h *forwardHandler) parseMetadata(md mdata.Metadata) (err error) {
 	// maxRetries: 0 means try all available nodes (default behavior)
 	h.md.maxRetries = mdutil.GetInt(md, "maxRetries", "retry.max")
 
+	h.md.proxyProtocol = mdutil.GetInt(md, "proxyProtocol")
+
+	h.md.portMap = mdutil.GetBool(md, "portMap")
+
+	h.md.connLog = mdutil.GetBool(md, "connLog")
+
+	h.md.healthCheck = healthCheckOptions{
+		typ:       strings.ToLower(mdutil.GetString(md, "healthCheck.type")),
+		interval:  mdutil.GetDuration(md, "healthCheck.interval"),
+		timeout:   mdutil.GetDuration(md, "healthCheck.timeout"),
+		path:      mdutil.GetString(md, "healthCheck.path"),
+		healthy:   mdutil.GetInt(md, "healthCheck.healthy"),
+		unhealthy: mdutil.GetInt(md, "healthCheck.unhealthy"),
+	}
+	if h.md.healthCheck.interval <= 0 {
+		h.md.healthCheck.interval = defaultHealthCheckInterval
+	}
+	if h.md.healthCheck.timeout <= 0 || h.md.healthCheck.timeout > h.md.healthCheck.interval {
+		h.md.healthCheck.timeout = min(defaultHealthCheckTimeout, h.md.healthCheck.interval)
+	}
+	if h.md.healthCheck.path == "" {
+		h.md.healthCheck.path = "/"
+	}
+	if h.md.healthCheck.healthy <= 0 {
+		h.md.healthCheck.healthy = 1
+	}
+	if h.md.healthCheck.unhealthy <= 0 {
+		h.md.healthCheck.unhealthy = 1
+	}
+
+	h.md.reverseProxy = reverseProxyOptions{
+		enabled:     mdutil.GetBool(md, "reverseProxy"),
+		certificate: mdutil.GetString(md, "reverseProxy.certificate"),
+		accessLog:   mdutil.GetBool(md, "reverseProxy.accessLog"),
+	}
+	if md != nil {
+		h.md.reverseProxy.routes = parseProxyRoutes(md.Get("reverseProxy.routes"))
+	}
+
 	return
 }
+
+// parseProxyRoutes reads the reverse proxy routes, a list of objects with
+// host, path and targets.
+func parseProxyRoutes(v any) []*proxyRoute {
+	items, _ := v.([]any)
+	routes := make([]*proxyRoute, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		route := &proxyRoute{}
+		route.host, _ = m["host"].(string)
+		route.host = strings.ToLower(route.host)
+		route.path, _ = m["path"].(string)
+		switch targets := m["targets"].(type) {
+		case []any:
+			for _, t := range targets {
+				if s, _ := t.(string); s != "" {
+					route.targets = append(route.targets, s)
+				}
+			}
+		case []string:
+			route.targets = append(route.targets, targets...)
+		}
+		if len(route.targets) > 0 {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
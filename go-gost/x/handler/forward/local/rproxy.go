@@ -0,0 +1,289 @@
+package local
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-gost/core/chain"
+	"github.com/go-gost/core/hop"
+	"github.com/go-gost/x/internal/util/certstore"
+	xrecorder "github.com/go-gost/x/recorder"
+	xselector "github.com/go-gost/x/selector"
+)
+
+const reverseProxyIdleTimeout = 90 * time.Second
+
+// proxyRoute sends the requests matching host and path to its own targets
+// instead of the forward's. An empty host matches any host, "*.example.com"
+// its subdomains, and path is a prefix matched on whole segments.
+type proxyRoute struct {
+	host    string
+	path    string
+	targets []string
+	next    atomic.Uint64
+}
+
+type reverseProxyOptions struct {
+	enabled     bool
+	routes      []*proxyRoute
+	certificate string
+	accessLog   bool
+}
+
+type proxyTargetKey struct{}
+
+// proxyTarget is the target chosen for one request. node is set when the
+// target is one of the forward's own nodes.
+type proxyTarget struct {
+	addr string
+	node *chain.Node
+}
+
+// reverseProxy serves a forward as an HTTP reverse proxy: each request is
+// routed by host and path, and TLS is terminated at the entry node when a
+// certificate is set. The bytes still flow through the service's listener,
+// so traffic stats and limits apply as for a plain forward.
+type reverseProxy struct {
+	h         *forwardHandler
+	proxy     *httputil.ReverseProxy
+	transport *http.Transport
+}
+
+func newReverseProxy(h *forwardHandler) *reverseProxy {
+	p := &reverseProxy{h: h}
+	p.transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return h.options.Router.Dial(ctx, "tcp", addr)
+		},
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     reverseProxyIdleTimeout,
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			target := pr.In.Context().Value(proxyTargetKey{}).(*proxyTarget)
+			pr.SetURL(&url.URL{Scheme: "http", Host: target.addr})
+			pr.Out.Host = pr.In.Host
+			pr.SetXForwarded()
+		},
+		Transport: p.transport,
+		ModifyResponse: func(resp *http.Response) error {
+			target := resp.Request.Context().Value(proxyTargetKey{}).(*proxyTarget)
+			if target.node != nil {
+				if marker := target.node.Marker(); marker != nil {
+					marker.Reset()
+				}
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			target := r.Context().Value(proxyTargetKey{}).(*proxyTarget)
+			if target.node != nil && !errors.Is(err, context.Canceled) {
+				if marker := target.node.Marker(); marker != nil {
+					marker.Mark()
+				}
+			}
+			h.options.Logger.Debugf("reverse proxy %s -> %s: %v", r.Host, target.addr, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	return p
+}
+
+// serve runs an HTTP server on the single client connection until the
+// client or the service closes it.
+func (p *reverseProxy) serve(ctx context.Context, conn net.Conn, ro *xrecorder.HandlerRecorderObject) error {
+	ro.Proto = "http"
+	ln := newSingleConnListener(conn)
+	conn = ln.conn
+	if name := p.h.md.reverseProxy.certificate; name != "" {
+		ro.Proto = "https"
+		conn = tls.Server(conn, &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return certstore.Get(name)
+			},
+			NextProtos: []string{"http/1.1"},
+		})
+	}
+	ln.next = conn
+
+	srv := &http.Server{
+		Handler:           p,
+		ReadHeaderTimeout: p.h.md.readTimeout,
+		IdleTimeout:       reverseProxyIdleTimeout,
+		ErrorLog:          log.New(io.Discard, "", 0),
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+func (p *reverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	target := p.target(r.Context(), host, r.URL.Path)
+	if target == nil {
+		http.Error(w, "no target available", http.StatusBadGateway)
+		p.logAccess(r, http.StatusBadGateway, 0, start, "-")
+		return
+	}
+	if target.node != nil {
+		defer xselector.AcquireConn(target.node)()
+	}
+
+	lw := &accessLogWriter{ResponseWriter: w, status: http.StatusOK}
+	p.proxy.ServeHTTP(lw, r.WithContext(context.WithValue(r.Context(), proxyTargetKey{}, target)))
+	p.logAccess(r, lw.status, lw.bytes, start, target.addr)
+}
+
+// target picks the target of a request: a route's targets in turn, or else
+// one of the forward's nodes through its selector.
+func (p *reverseProxy) target(ctx context.Context, host, path string) *proxyTarget {
+	if route := p.route(host, path); route != nil {
+		n := route.next.Add(1) - 1
+		return &proxyTarget{addr: route.targets[n%uint64(len(route.targets))]}
+	}
+	if p.h.hop == nil {
+		return nil
+	}
+	node := p.h.hop.Select(ctx, hop.ProtocolSelectOption("http"))
+	if node == nil {
+		return nil
+	}
+	return &proxyTarget{addr: node.Addr, node: node}
+}
+
+// route finds the most specific route for a request: an exact host before
+// a wildcard before any host, then the longest path.
+func (p *reverseProxy) route(host, path string) *proxyRoute {
+	var best *proxyRoute
+	bestHost, bestPath := -1, -1
+	for _, route := range p.h.md.reverseProxy.routes {
+		score := hostScore(route.host, host)
+		if score < 0 || !pathMatch(route.path, path) {
+			continue
+		}
+		if score > bestHost || (score == bestHost && len(route.path) > bestPath) {
+			best, bestHost, bestPath = route, score, len(route.path)
+		}
+	}
+	return best
+}
+
+func hostScore(pattern, host string) int {
+	switch {
+	case pattern == "":
+		return 0
+	case pattern == host:
+		return 2
+	case strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]):
+		return 1
+	}
+	return -1
+}
+
+func pathMatch(prefix, path string) bool {
+	if prefix == "" || path == prefix {
+		return true
+	}
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+func (p *reverseProxy) logAccess(r *http.Request, status int, bytes int64, start time.Time, target string) {
+	if !p.h.md.reverseProxy.accessLog {
+		return
+	}
+	client, _, _ := net.SplitHostPort(r.RemoteAddr)
+	p.h.options.Logger.WithFields(map[string]any{"kind": "access"}).Infof("%s \"%s %s %s %s\" %d %d %q %s -> %s",
+		client, r.Method, r.Host, r.RequestURI, r.Proto, status, bytes, r.UserAgent(), time.Since(start).Round(time.Millisecond), target)
+}
+
+func (p *reverseProxy) close() {
+	p.transport.CloseIdleConnections()
+}
+
+// accessLogWriter records the status and size of a response. Unwrap lets
+// the proxy reach Flush and Hijack of the connection for streaming and
+// protocol upgrades.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// singleConnListener hands one connection to an http.Server and reports
+// closed once that connection has been closed, by the server or by a
+// handler that hijacked it.
+type singleConnListener struct {
+	conn *notifyConn
+	next net.Conn
+	once sync.Once
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	return &singleConnListener{conn: &notifyConn{Conn: conn, done: make(chan struct{})}}
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() { conn = l.next })
+	if conn != nil {
+		return conn, nil
+	}
+	<-l.conn.done
+	return nil, net.ErrClosed
+}
+
+func (l *singleConnListener) Close() error {
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+type notifyConn struct {
+	net.Conn
+	done chan struct{}
+	once sync.Once
+}
+
+func (c *notifyConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,68 @@
+package local
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReverseProxyRoute(t *testing.T) {
+	routes := []*proxyRoute{
+		{path: "/", targets: []string{"any:80"}},
+		{host: "*.example.com", targets: []string{"wild:80"}},
+		{host: "api.example.com", path: "/v1", targets: []string{"v1a:80", "v1b:80"}},
+		{host: "api.example.com", targets: []string{"api:80"}},
+	}
+	h := &forwardHandler{}
+	h.md.reverseProxy.routes = routes
+	p := &reverseProxy{h: h}
+
+	cases := []struct {
+		host, path string
+		want       *proxyRoute
+	}{
+		{"api.example.com", "/v1/users", routes[2]},
+		{"api.example.com", "/v1", routes[2]},
+		{"api.example.com", "/v10", routes[3]},
+		{"www.example.com", "/v1", routes[1]},
+		{"example.org", "/x", routes[0]},
+	}
+	for _, c := range cases {
+		if got := p.route(c.host, c.path); got != c.want {
+			t.Errorf("route(%q, %q) = %v, want %v", c.host, c.path, got, c.want)
+		}
+	}
+
+	// A route's targets are used in turn.
+	var got []string
+	for i := 0; i < 3; i++ {
+		got = append(got, p.target(context.Background(), "api.example.com", "/v1").addr)
+	}
+	if got[0] != "v1a:80" || got[1] != "v1b:80" || got[2] != "v1a:80" {
+		t.Fatalf("unexpected target order %v", got)
+	}
+
+	// Without a matching route or a hop there is no target.
+	h.md.reverseProxy.routes = routes[1:2]
+	if target := p.target(context.Background(), "example.org", "/"); target != nil {
+		t.Fatalf("expected no target, got %+v", target)
+	}
+}
+
+func TestPathMatch(t *testing.T) {
+	cases := []struct {
+		prefix, path string
+		want         bool
+	}{
+		{"", "/anything", true},
+		{"/api", "/api", true},
+		{"/api", "/api/x", true},
+		{"/api", "/apix", false},
+		{"/api/", "/api/x", true},
+		{"/api", "/", false},
+	}
+	for _, c := range cases {
+		if got := pathMatch(c.prefix, c.path); got != c.want {
+			t.Errorf("pathMatch(%q, %q) = %v, want %v", c.prefix, c.path, got, c.want)
+		}
+	}
+}
@@ -197,3 +197,9 @@ func (r *IPRange) Contains(addr netip.Addr) bool {
 type ClientAddr interface {
 	ClientAddr() net.Addr
 }
+
+// PortOffset is implemented by connections accepted by a port range
+// listener. It returns the position of the accepting port in the range.
+type PortOffset interface {
+	PortOffset() int
+}
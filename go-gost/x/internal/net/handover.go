@@ -0,0 +1,46 @@
+package net
+
+import (
+	"os"
+	"sync"
+)
+
+// Handover passes a bound socket from a service being replaced to the one
+// replacing it. The new listener adopts the socket instead of binding the
+// address again, so the port never closes and connections already accepted
+// by the old service are left alone.
+type Handover interface {
+	Handover() error
+}
+
+var handovers sync.Map
+
+func handoverKey(network, addr string) string {
+	return network + "/" + addr
+}
+
+// OfferHandover parks a duplicate of the socket bound to addr until the next
+// listener for the same network and address takes it. A previous offer that
+// was never taken is closed.
+func OfferHandover(network, addr string, f *os.File) {
+	if prev, loaded := handovers.Swap(handoverKey(network, addr), f); loaded {
+		prev.(*os.File).Close()
+	}
+}
+
+// TakeHandover returns the socket offered for addr, or nil.
+func TakeHandover(network, addr string) *os.File {
+	if v, ok := handovers.LoadAndDelete(handoverKey(network, addr)); ok {
+		return v.(*os.File)
+	}
+	return nil
+}
+
+// DropHandovers closes any offer for addr that no listener took.
+func DropHandovers(addr string) {
+	for _, network := range []string{"tcp", "udp"} {
+		if f := TakeHandover(network, addr); f != nil {
+			f.Close()
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package certstore keeps the TLS certificates the panel pushes for HTTPS
+// forwards. Certificates are written next to the saved config so services
+// restored at startup find them again.
+package certstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Dir holds one name.crt and name.key pair per certificate. Only the agent
+// user can read it.
+var Dir = "certs"
+
+var (
+	mu    sync.RWMutex
+	certs = map[string]*tls.Certificate{}
+)
+
+// Set stores a PEM certificate chain and its private key under name,
+// replacing any certificate stored under it before.
+func Set(name, certPEM, keyPEM string) error {
+	if !validName(name) {
+		return fmt.Errorf("invalid certificate name %q", name)
+	}
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return fmt.Errorf("certificate %s: %w", name, err)
+	}
+	cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+
+	if err := os.MkdirAll(Dir, 0o700); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(Dir, name+".key"), keyPEM); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(Dir, name+".crt"), certPEM); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	certs[name] = &cert
+	mu.Unlock()
+	return nil
+}
+
+// Delete removes the certificate stored under name.
+func Delete(name string) error {
+	if !validName(name) {
+		return fmt.Errorf("invalid certificate name %q", name)
+	}
+	mu.Lock()
+	delete(certs, name)
+	mu.Unlock()
+
+	for _, ext := range []string{".crt", ".key"} {
+		if err := os.Remove(filepath.Join(Dir, name+ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the certificate stored under name, loading it from Dir the
+// first time it is asked for after a restart.
+func Get(name string) (*tls.Certificate, error) {
+	mu.RLock()
+	cert := certs[name]
+	mu.RUnlock()
+	if cert != nil {
+		return cert, nil
+	}
+	if !validName(name) {
+		return nil, fmt.Errorf("invalid certificate name %q", name)
+	}
+
+	c, err := tls.LoadX509KeyPair(filepath.Join(Dir, name+".crt"), filepath.Join(Dir, name+".key"))
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s: %w", name, err)
+	}
+	c.Leaf, _ = x509.ParseCertificate(c.Certificate[0])
+
+	mu.Lock()
+	defer mu.Unlock()
+	if cert := certs[name]; cert != nil {
+		return cert, nil
+	}
+	certs[name] = &c
+	return &c, nil
+}
+
+// writeFile replaces path atomically so a reader never sees half a key.
+func writeFile(path, data string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func validName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package certstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testKeyPair(t *testing.T, cn string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM)
+}
+
+func TestCertStore(t *testing.T) {
+	Dir = t.TempDir()
+	certPEM, keyPEM := testKeyPair(t, "a.example.com")
+
+	if err := Set("../escape", certPEM, keyPEM); err == nil {
+		t.Fatalf("expected an invalid name to be rejected")
+	}
+	if err := Set("cert_1", certPEM, "not a key"); err == nil {
+		t.Fatalf("expected a broken key pair to be rejected")
+	}
+	if err := Set("cert_1", certPEM, keyPEM); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(Dir, "cert_1.key"))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected a private key file, got %v, %v", info, err)
+	}
+
+	// A restarted agent loads the certificate from disk.
+	mu.Lock()
+	certs = map[string]*tls.Certificate{}
+	mu.Unlock()
+	cert, err := Get("cert_1")
+	if err != nil || cert.Leaf == nil || cert.Leaf.Subject.CommonName != "a.example.com" {
+		t.Fatalf("expected the stored certificate, got %v, %v", cert, err)
+	}
+
+	if err := Delete("cert_1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := Get("cert_1"); err == nil {
+		t.Fatalf("expected a deleted certificate to be gone")
+	}
+	if err := Delete("cert_1"); err != nil {
+		t.Fatalf("expected deleting twice to succeed, got %v", err)
+	}
+}
@@ -5,9 +5,24 @@ import (
 	"net"
 	"os/exec"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/go-gost/x/config"
 )
 
+// ForceCloseServiceConnections 断开服务端口上的所有连接。
+// 共享端口的 sni 监听器在关闭时只断开自己的连接，不能按端口断开。
+func ForceCloseServiceConnections(cfg *config.ServiceConfig) error {
+	if cfg == nil || cfg.Addr == "" {
+		return nil
+	}
+	if cfg.Listener != nil && cfg.Listener.Type == "sni" {
+		return nil
+	}
+	return ForceClosePortConnections(cfg.Addr)
+}
+
 func ForceClosePortConnections(addr string) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -27,13 +42,16 @@ func ForceClosePortConnections(addr string) (err error) {
 		return nil
 	}
 
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
+	// 端口段服务（如 20000-20100）按 portrange 过滤
+	primitive := "port"
+	if strings.Contains(portStr, "-") {
+		primitive = "portrange"
+	} else if _, err := strconv.Atoi(portStr); err != nil {
 		fmt.Printf("⚠️ 端口非法: %v\n", err)
 		return nil
 	}
 
-	cmd := exec.Command("tcpkill", "-i", "any", "port", fmt.Sprintf("%d", port))
+	cmd := exec.Command("tcpkill", "-i", "any", primitive, portStr)
 	if err := cmd.Start(); err != nil {
 		fmt.Printf("⚠️ 启动 tcpkill 失败: %v\n", err)
 		return nil
@@ -53,6 +71,6 @@ func ForceClosePortConnections(addr string) (err error) {
 		}
 	}()
 
-	fmt.Printf("✅ 正在断开端口 %d 上的所有连接...\n", port)
+	fmt.Printf("✅ 正在断开端口 %s 上的所有连接...\n", portStr)
 	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strconv"
 
+	corelimiter "github.com/go-gost/core/limiter"
 	limiter "github.com/go-gost/core/limiter/traffic"
 	"golang.org/x/time/rate"
 )
@@ -74,3 +75,44 @@ func (l *limiterGroup) Set(n int) {}
 func (l *limiterGroup) String() string {
 	return fmt.Sprintf("%v", l.limiters)
 }
+
+type trafficLimiterGroup struct {
+	limiters []limiter.TrafficLimiter
+}
+
+// NewTrafficLimiterGroup combines several traffic limiters into one. Traffic
+// must pass every member, so the tightest of the matching limits applies.
+func NewTrafficLimiterGroup(limiters ...limiter.TrafficLimiter) limiter.TrafficLimiter {
+	return &trafficLimiterGroup{limiters: limiters}
+}
+
+func (g *trafficLimiterGroup) In(ctx context.Context, key string, opts ...corelimiter.Option) limiter.Limiter {
+	var lims []limiter.Limiter
+	for _, l := range g.limiters {
+		if lim := l.In(ctx, key, opts...); lim != nil {
+			lims = append(lims, lim)
+		}
+	}
+	return joinLimiters(lims)
+}
+
+func (g *trafficLimiterGroup) Out(ctx context.Context, key string, opts ...corelimiter.Option) limiter.Limiter {
+	var lims []limiter.Limiter
+	for _, l := range g.limiters {
+		if lim := l.Out(ctx, key, opts...); lim != nil {
+			lims = append(lims, lim)
+		}
+	}
+	return joinLimiters(lims)
+}
+
+func joinLimiters(lims []limiter.Limiter) limiter.Limiter {
+	switch len(lims) {
+	case 0:
+		return nil
+	case 1:
+		return lims[0]
+	default:
+		return newLimiterGroup(lims...)
+	}
+}
@@ -0,0 +1,185 @@
+package sni
+
+import (
+	"net"
+	"sync"
+
+	"github.com/go-gost/core/limiter"
+	"github.com/go-gost/core/listener"
+	"github.com/go-gost/core/logger"
+	md "github.com/go-gost/core/metadata"
+	admission "github.com/go-gost/x/admission/wrapper"
+	xnet "github.com/go-gost/x/internal/net"
+	climiter "github.com/go-gost/x/limiter/conn/wrapper"
+	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	metrics "github.com/go-gost/x/metrics/wrapper"
+	stats "github.com/go-gost/x/observer/stats/wrapper"
+	"github.com/go-gost/x/registry"
+)
+
+func init() {
+	registry.ListenerRegistry().Register("sni", NewListener)
+}
+
+// sniListener is a TCP listener that shares its address with other sni
+// listeners. Connections are routed to it by TLS server name or HTTP Host,
+// so several services can serve one port while keeping their own limiters
+// and traffic stats.
+type sniListener struct {
+	ln      net.Listener
+	mux     *mux
+	logger  logger.Logger
+	md      metadata
+	options listener.Options
+
+	connc  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func NewListener(opts ...listener.Option) listener.Listener {
+	options := listener.Options{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &sniListener{
+		logger:  options.Logger,
+		options: options,
+		connc:   make(chan net.Conn, 128),
+		closed:  make(chan struct{}),
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+func (l *sniListener) Init(md md.Metadata) (err error) {
+	if err = l.parseMetadata(md); err != nil {
+		return
+	}
+
+	network := "tcp"
+	if xnet.IsIPv4(l.options.Addr) {
+		network = "tcp4"
+	}
+
+	l.mux, err = register(network, l.options.Addr, l)
+	if err != nil {
+		return
+	}
+
+	var ln net.Listener = &routedListener{l}
+	ln = metrics.WrapListener(l.options.Service, ln)
+	ln = stats.WrapListener(ln, l.options.Stats)
+	ln = admission.WrapListener(l.options.Admission, ln)
+	ln = limiter_wrapper.WrapListener(l.options.Service, ln, l.options.TrafficLimiter)
+	ln = climiter.WrapListener(l.options.ConnLimiter, ln)
+	l.ln = ln
+
+	return
+}
+
+func (l *sniListener) Accept() (conn net.Conn, err error) {
+	conn, err = l.ln.Accept()
+	if err != nil {
+		return
+	}
+
+	conn = limiter_wrapper.WrapConn(
+		conn,
+		l.options.TrafficLimiter,
+		conn.RemoteAddr().String(),
+		limiter.ScopeOption(limiter.ScopeConn),
+		limiter.ServiceOption(l.options.Service),
+		limiter.NetworkOption(conn.LocalAddr().Network()),
+		limiter.SrcOption(conn.RemoteAddr().String()),
+	)
+
+	return
+}
+
+func (l *sniListener) Addr() net.Addr {
+	return l.mux.ln.Addr()
+}
+
+// Close stops routing to the listener and closes the connections it has
+// accepted. The shared port stays open for the other listeners on it.
+func (l *sniListener) Close() error {
+	l.once.Do(func() {
+		l.mux.unregister(l)
+		close(l.closed)
+
+		l.mu.Lock()
+		conns := make([]net.Conn, 0, len(l.conns))
+		for conn := range l.conns {
+			conns = append(conns, conn)
+		}
+		l.mu.Unlock()
+
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	return nil
+}
+
+// deliver hands a routed connection to Accept.
+func (l *sniListener) deliver(conn net.Conn) {
+	tc := &trackedConn{Conn: conn, l: l}
+
+	l.mu.Lock()
+	select {
+	case <-l.closed:
+		l.mu.Unlock()
+		conn.Close()
+		return
+	default:
+	}
+	l.conns[tc] = struct{}{}
+	l.mu.Unlock()
+
+	select {
+	case l.connc <- tc:
+	case <-l.closed:
+		tc.Close()
+	}
+}
+
+// routedListener adapts the routed connections to a net.Listener so the
+// usual listener wrappers apply.
+type routedListener struct {
+	l *sniListener
+}
+
+func (rl *routedListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-rl.l.connc:
+		return conn, nil
+	case <-rl.l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (rl *routedListener) Addr() net.Addr {
+	return rl.l.Addr()
+}
+
+func (rl *routedListener) Close() error {
+	return rl.l.Close()
+}
+
+type trackedConn struct {
+	net.Conn
+	l    *sniListener
+	once sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.l.mu.Lock()
+		delete(c.l.conns, c)
+		c.l.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
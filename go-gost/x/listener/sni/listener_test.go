@@ -0,0 +1,157 @@
+package sni
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/listener"
+	xlogger "github.com/go-gost/x/logger"
+	xmetadata "github.com/go-gost/x/metadata"
+)
+
+func newTestListener(t *testing.T, addr, service string, hosts ...string) (*sniListener, error) {
+	t.Helper()
+	l := NewListener(
+		listener.AddrOption(addr),
+		listener.ServiceOption(service),
+		listener.LoggerOption(xlogger.Nop()),
+	).(*sniListener)
+	err := l.Init(xmetadata.NewMetadata(map[string]any{
+		"sni.hosts":       hosts,
+		"sni.readTimeout": "1s",
+	}))
+	return l, err
+}
+
+func acceptOne(t *testing.T, l *sniListener) net.Conn {
+	t.Helper()
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := l.Accept()
+		ch <- result{conn, err}
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			t.Fatalf("accept on %s: %v", l.options.Service, r.err)
+		}
+		return r.conn
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no connection routed to %s", l.options.Service)
+	}
+	return nil
+}
+
+func TestRouteWildcard(t *testing.T) {
+	exact, wildcard := &sniListener{}, &sniListener{}
+	m := &mux{routes: map[string]*sniListener{
+		"a.example.com":   exact,
+		"*.example.com":   wildcard,
+		"*.b.example.com": exact,
+	}}
+
+	cases := map[string]*sniListener{
+		"a.example.com":   exact,
+		"c.example.com":   wildcard,
+		"x.c.example.com": wildcard,
+		"x.b.example.com": exact,
+		"example.com":     nil,
+		"a.example.org":   nil,
+	}
+	for host, want := range cases {
+		if got := m.route(host); got != want {
+			t.Errorf("route(%q) = %p, want %p", host, got, want)
+		}
+	}
+}
+
+func TestSharedPortRouting(t *testing.T) {
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := probe.Addr().String()
+	probe.Close()
+
+	a, err := newTestListener(t, addr, "svc_a", "a.example.com")
+	if err != nil {
+		t.Fatalf("init a: %v", err)
+	}
+	defer a.Close()
+
+	b, err := newTestListener(t, addr, "svc_b", "*.example.org")
+	if err != nil {
+		t.Fatalf("init b: %v", err)
+	}
+	defer b.Close()
+	if b.Addr().String() != addr {
+		t.Fatalf("expected b to share %s, got %s", addr, b.Addr())
+	}
+
+	if _, err := newTestListener(t, addr, "svc_c", "A.example.com"); err == nil {
+		t.Fatalf("expected a duplicate host to be rejected")
+	}
+
+	// HTTP is routed by Host and the request is replayed to the service.
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	io.WriteString(c, "GET /x HTTP/1.1\r\nHost: a.example.com:8080\r\n\r\n")
+	conn := acceptOne(t, a)
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil || req.URL.Path != "/x" {
+		t.Fatalf("expected the replayed request, got %v, %v", req, err)
+	}
+	conn.Close()
+
+	// TLS is routed by server name, matching the wildcard.
+	tc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer tc.Close()
+	go tls.Client(tc, &tls.Config{ServerName: "www.example.org", InsecureSkipVerify: true}).Handshake()
+	conn = acceptOne(t, b)
+	var hdr [1]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil || hdr[0] != 0x16 {
+		t.Fatalf("expected the replayed ClientHello, got %x, %v", hdr, err)
+	}
+	conn.Close()
+
+	// A connection for an unknown host is dropped.
+	u, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer u.Close()
+	io.WriteString(u, "GET / HTTP/1.1\r\nHost: other.example.net\r\n\r\n")
+	u.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := u.Read(hdr[:]); err == nil || strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("expected the unrouted connection to be closed, got %v", err)
+	}
+
+	// The port stays open until the last listener on it closes.
+	a.Close()
+	if c, err := net.Dial("tcp", addr); err != nil {
+		t.Fatalf("expected the port to stay open for b: %v", err)
+	} else {
+		c.Close()
+	}
+	b.Close()
+	if c, err := net.Dial("tcp", addr); err == nil {
+		c.Close()
+		t.Fatalf("expected the port to close with its last listener")
+	}
+}
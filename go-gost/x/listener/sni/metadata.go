@@ -0,0 +1,33 @@
+package sni
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	md "github.com/go-gost/core/metadata"
+	mdutil "github.com/go-gost/x/metadata/util"
+)
+
+type metadata struct {
+	hosts       []string
+	readTimeout time.Duration
+}
+
+func (l *sniListener) parseMetadata(md md.Metadata) (err error) {
+	for _, host := range mdutil.GetStrings(md, "sni.hosts", "hosts") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			l.md.hosts = append(l.md.hosts, host)
+		}
+	}
+	if len(l.md.hosts) == 0 {
+		return errors.New("sni: no hosts")
+	}
+
+	l.md.readTimeout = mdutil.GetDuration(md, "sni.readTimeout", "readTimeout")
+	if l.md.readTimeout <= 0 {
+		l.md.readTimeout = 10 * time.Second
+	}
+
+	return
+}
@@ -0,0 +1,203 @@
+package sni
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/logger"
+	dissector "github.com/go-gost/tls-dissector"
+	xnet "github.com/go-gost/x/internal/net"
+	"github.com/go-gost/x/internal/util/sniffing"
+)
+
+var (
+	muxesMu sync.Mutex
+	muxes   = map[string]*mux{}
+)
+
+// mux owns the TCP listener shared by every sni listener on one address
+// and hands each accepted connection to the listener registered for its
+// TLS server name or HTTP Host.
+type mux struct {
+	key         string
+	ln          net.Listener
+	logger      logger.Logger
+	readTimeout time.Duration
+
+	mu     sync.RWMutex
+	routes map[string]*sniListener
+}
+
+// register adds l under each of its hosts to the mux listening on addr,
+// starting the mux if l is the first listener on it.
+func register(network, addr string, l *sniListener) (*mux, error) {
+	muxesMu.Lock()
+	defer muxesMu.Unlock()
+
+	key := network + "://" + addr
+	m := muxes[key]
+	if m == nil {
+		ln, err := (&net.ListenConfig{}).Listen(context.Background(), network, addr)
+		if err != nil {
+			return nil, err
+		}
+		m = &mux{
+			key:         key,
+			ln:          ln,
+			logger:      l.logger,
+			readTimeout: l.md.readTimeout,
+			routes:      map[string]*sniListener{},
+		}
+		muxes[key] = m
+		go m.serve()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, host := range l.md.hosts {
+		if other := m.routes[host]; other != nil {
+			m.closeIfUnusedLocked()
+			return nil, fmt.Errorf("sni: host %s is already served on %s by %s", host, addr, other.options.Service)
+		}
+	}
+	for _, host := range l.md.hosts {
+		m.routes[host] = l
+	}
+	return m, nil
+}
+
+// unregister removes l from the mux and stops the mux once no listener is
+// left on it.
+func (m *mux) unregister(l *sniListener) {
+	muxesMu.Lock()
+	defer muxesMu.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for host, route := range m.routes {
+		if route == l {
+			delete(m.routes, host)
+		}
+	}
+	m.closeIfUnusedLocked()
+}
+
+// closeIfUnusedLocked must be called with muxesMu and m.mu held.
+func (m *mux) closeIfUnusedLocked() {
+	if len(m.routes) > 0 {
+		return
+	}
+	if muxes[m.key] == m {
+		delete(muxes, m.key)
+	}
+	m.ln.Close()
+}
+
+func (m *mux) serve() {
+	var tempDelay time.Duration
+	for {
+		conn, err := m.ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if max := 1 * time.Second; tempDelay > max {
+					tempDelay = max
+				}
+				time.Sleep(tempDelay)
+				continue
+			}
+			return
+		}
+		tempDelay = 0
+
+		go m.dispatch(conn)
+	}
+}
+
+func (m *mux) dispatch(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(m.readTimeout))
+	host, conn, err := readHost(conn)
+	if err != nil {
+		m.logger.Debugf("sni: %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	l := m.route(host)
+	if l == nil {
+		m.logger.Debugf("sni: %s: no service for host %q", conn.RemoteAddr(), host)
+		conn.Close()
+		return
+	}
+	l.deliver(conn)
+}
+
+// route finds the listener for host: an exact match first, then the
+// closest wildcard such as *.example.com.
+func (m *mux) route(host string) *sniListener {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if l := m.routes[host]; l != nil {
+		return l
+	}
+	for name := host; ; {
+		_, parent, found := strings.Cut(name, ".")
+		if !found {
+			return nil
+		}
+		if l := m.routes["*."+parent]; l != nil {
+			return l
+		}
+		name = parent
+	}
+}
+
+// readHost reads the server name of a TLS ClientHello or the Host header
+// of an HTTP request from conn. The returned conn replays what was read.
+func readHost(conn net.Conn) (string, net.Conn, error) {
+	br := bufio.NewReader(conn)
+	proto, _ := sniffing.Sniff(context.Background(), br)
+
+	buf := &bytes.Buffer{}
+	r := io.TeeReader(br, buf)
+	replay := func() net.Conn {
+		return xnet.NewReadWriteConn(io.MultiReader(buf, br), conn, conn)
+	}
+
+	var host string
+	switch proto {
+	case sniffing.ProtoTLS:
+		info, err := dissector.ParseClientHello(r)
+		if err != nil {
+			return "", replay(), err
+		}
+		host = info.ServerName
+	case sniffing.ProtoHTTP:
+		req, err := http.ReadRequest(bufio.NewReader(r))
+		if err != nil {
+			return "", replay(), err
+		}
+		host = req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	default:
+		return "", replay(), errors.New("neither TLS nor HTTP")
+	}
+	return strings.ToLower(strings.TrimSuffix(host, ".")), replay(), nil
+}
@@ -2,7 +2,9 @@ package tcp
 
 import (
 	"context"
+	"errors"
 	"net"
+	"os"
 	"time"
 
 	"github.com/go-gost/core/limiter"
@@ -25,6 +27,7 @@ func init() {
 
 type tcpListener struct {
 	ln      net.Listener
+	raw     net.Listener
 	logger  logger.Logger
 	md      metadata
 	options listener.Options
@@ -56,10 +59,18 @@ func (l *tcpListener) Init(md md.Metadata) (err error) {
 		lc.SetMultipathTCP(true)
 		l.logger.Debugf("mptcp enabled: %v", lc.MultipathTCP())
 	}
-	ln, err := lc.Listen(context.Background(), network, l.options.Addr)
+	var ln net.Listener
+	if f := xnet.TakeHandover("tcp", l.options.Addr); f != nil {
+		// 接管被替换服务的监听套接字，端口不会出现空窗
+		ln, err = net.FileListener(f)
+		f.Close()
+	} else {
+		ln, err = lc.Listen(context.Background(), network, l.options.Addr)
+	}
 	if err != nil {
 		return
 	}
+	l.raw = ln
 
 	l.logger.Debugf("pp: %d", l.options.ProxyProtocol)
 
@@ -100,3 +111,19 @@ func (l *tcpListener) Addr() net.Addr {
 func (l *tcpListener) Close() error {
 	return l.ln.Close()
 }
+
+// Handover offers a duplicate of the listening socket to the next tcp
+// listener on the same address. Closing this listener afterwards leaves the
+// socket open for the successor.
+func (l *tcpListener) Handover() error {
+	fl, ok := l.raw.(interface{ File() (*os.File, error) })
+	if !ok {
+		return errors.New("tcp listener: handover not supported")
+	}
+	f, err := fl.File()
+	if err != nil {
+		return err
+	}
+	xnet.OfferHandover("tcp", l.options.Addr, f)
+	return nil
+}
@@ -1,6 +1,7 @@
 package udp
 
 import (
+	"errors"
 	"net"
 
 	"github.com/go-gost/core/limiter"
@@ -23,6 +24,7 @@ func init() {
 
 type udpListener struct {
 	ln      net.Listener
+	raw     *net.UDPConn
 	logger  logger.Logger
 	md      metadata
 	options listener.Options
@@ -53,11 +55,27 @@ func (l *udpListener) Init(md md.Metadata) (err error) {
 		return
 	}
 
-	var conn net.PacketConn
-	conn, err = net.ListenUDP(network, laddr)
+	var raw *net.UDPConn
+	if f := xnet.TakeHandover("udp", l.options.Addr); f != nil {
+		// 接管被替换服务的套接字，端口不会出现空窗
+		var pc net.PacketConn
+		pc, err = net.FilePacketConn(f)
+		f.Close()
+		if err == nil {
+			if raw, _ = pc.(*net.UDPConn); raw == nil {
+				pc.Close()
+				err = errors.New("udp listener: handed over socket is not udp")
+			}
+		}
+	} else {
+		raw, err = net.ListenUDP(network, laddr)
+	}
 	if err != nil {
 		return
 	}
+	l.raw = raw
+
+	var conn net.PacketConn = raw
 	conn = metrics.WrapPacketConn(l.options.Service, conn)
 	conn = stats.WrapPacketConn(conn, l.options.Stats)
 	conn = admission.WrapPacketConn(l.options.Admission, conn)
@@ -92,3 +110,18 @@ func (l *udpListener) Addr() net.Addr {
 func (l *udpListener) Close() error {
 	return l.ln.Close()
 }
+
+// Handover offers a duplicate of the socket to the next udp listener on the
+// same address. Sessions of this listener still end when it is closed, but
+// datagrams keep arriving at the successor without a gap.
+func (l *udpListener) Handover() error {
+	if l.raw == nil {
+		return errors.New("udp listener: handover not supported")
+	}
+	f, err := l.raw.File()
+	if err != nil {
+		return err
+	}
+	xnet.OfferHandover("udp", l.options.Addr, f)
+	return nil
+}
@@ -105,6 +105,38 @@ func (r *registry[T]) GetAll() (m map[string]T) {
 	return
 }
 
+// swap puts v under name in place of the current object and returns the
+// replaced one without closing it, so the name never goes missing.
+func (r *registry[T]) swap(name string, v T) (old T) {
+	if prev, loaded := r.m.Swap(name, v); loaded {
+		old, _ = prev.(T)
+	}
+	return
+}
+
+// SwapService registers svc under name and returns the service it replaced,
+// still open, or nil.
+func SwapService(name string, svc service.Service) service.Service {
+	return serviceReg.(*serviceRegistry).swap(name, svc)
+}
+
+// SwapChain registers c under name and returns the chain it replaced.
+func SwapChain(name string, c chain.Chainer) chain.Chainer {
+	return chainReg.(*chainRegistry).swap(name, c)
+}
+
+// SwapTrafficLimiter registers lim under name and returns the limiter it
+// replaced.
+func SwapTrafficLimiter(name string, lim traffic.TrafficLimiter) traffic.TrafficLimiter {
+	return trafficLimiterReg.(*trafficLimiterRegistry).swap(name, lim)
+}
+
+// SwapConnLimiter registers lim under name and returns the limiter it
+// replaced.
+func SwapConnLimiter(name string, lim conn.ConnLimiter) conn.ConnLimiter {
+	return connLimiterReg.(*connLimiterRegistry).swap(name, lim)
+}
+
 func ListenerRegistry() reg.Registry[NewListener] {
 	return listenerReg
 }
@@ -0,0 +1,43 @@
+package selector
+
+import "sync"
+
+var (
+	connCountsMu sync.Mutex
+	connCounts   = map[any]int64{}
+)
+
+// AcquireConn records an open connection to v for the least connections
+// strategy and returns the function that releases it. The release function
+// is safe to call more than once.
+func AcquireConn(v any) (release func()) {
+	if v == nil {
+		return func() {}
+	}
+
+	connCountsMu.Lock()
+	connCounts[v]++
+	connCountsMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			connCountsMu.Lock()
+			defer connCountsMu.Unlock()
+
+			if connCounts[v] <= 1 {
+				delete(connCounts, v)
+				return
+			}
+			connCounts[v]--
+		})
+	}
+}
+
+// ActiveConns returns the number of open connections recorded for v.
+func ActiveConns(v any) int64 {
+	connCountsMu.Lock()
+	defer connCountsMu.Unlock()
+
+	return connCounts[v]
+}
@@ -3,11 +3,15 @@ package selector
 import (
 	"context"
 	"hash/crc32"
+	"hash/fnv"
+	"math"
 	"math/rand"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/go-gost/core/chain"
 	"github.com/go-gost/core/logger"
 	"github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/x/metadata/util"
@@ -113,3 +117,136 @@ func (s *hashStrategy[T]) Apply(ctx context.Context, vs ...T) (v T) {
 
 	return vs[s.r.Intn(len(vs))]
 }
+
+func weightOf(v any) int {
+	weight := 0
+	if md, _ := v.(metadata.Metadatable); md != nil {
+		weight = mdutil.GetInt(md.Metadata(), labelWeight)
+	}
+	if weight <= 0 {
+		weight = 1
+	}
+	return weight
+}
+
+type weightedRoundRobinStrategy[T any] struct {
+	current map[any]int
+	mu      sync.Mutex
+}
+
+// WeightedRoundRobinStrategy is a strategy for node selector.
+// The nodes are selected in turn, each as often as its weight,
+// using the smooth weighted round-robin algorithm.
+func WeightedRoundRobinStrategy[T any]() selector.Strategy[T] {
+	return &weightedRoundRobinStrategy[T]{
+		current: make(map[any]int),
+	}
+}
+
+func (s *weightedRoundRobinStrategy[T]) Apply(ctx context.Context, vs ...T) (v T) {
+	if len(vs) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Only the current candidates are kept, so a node that comes back
+	// after a failure starts from zero.
+	current := make(map[any]int, len(vs))
+	total := 0
+	best := 0
+	for i := range vs {
+		weight := weightOf(vs[i])
+		current[vs[i]] = s.current[vs[i]] + weight
+		total += weight
+		if current[vs[i]] > current[vs[best]] {
+			best = i
+		}
+	}
+	current[vs[best]] -= total
+	s.current = current
+
+	return vs[best]
+}
+
+type leastConnStrategy[T any] struct {
+	counter uint64
+}
+
+// LeastConnStrategy is a strategy for node selector.
+// The node with the fewest open connections relative to its weight is
+// selected; ties are broken in round-robin order. Connections are counted
+// by the callers through AcquireConn.
+func LeastConnStrategy[T any]() selector.Strategy[T] {
+	return &leastConnStrategy[T]{}
+}
+
+func (s *leastConnStrategy[T]) Apply(ctx context.Context, vs ...T) (v T) {
+	if len(vs) == 0 {
+		return
+	}
+
+	start := int((atomic.AddUint64(&s.counter, 1) - 1) % uint64(len(vs)))
+	best := start
+	bestConns, bestWeight := ActiveConns(vs[start]), weightOf(vs[start])
+	for i := 1; i < len(vs); i++ {
+		idx := (start + i) % len(vs)
+		conns, weight := ActiveConns(vs[idx]), weightOf(vs[idx])
+		// conns/weight < bestConns/bestWeight
+		if conns*int64(bestWeight) < bestConns*int64(weight) {
+			best, bestConns, bestWeight = idx, conns, weight
+		}
+	}
+	return vs[best]
+}
+
+type stickyStrategy[T any] struct {
+	fallback selector.Strategy[T]
+}
+
+// StickyStrategy is a strategy for node selector.
+// The node is selected by weighted rendezvous hashing of the client
+// address, so a client keeps its node while that node is available and
+// only the clients of a failed node move elsewhere.
+func StickyStrategy[T any]() selector.Strategy[T] {
+	return &stickyStrategy[T]{
+		fallback: RandomStrategy[T](),
+	}
+}
+
+func (s *stickyStrategy[T]) Apply(ctx context.Context, vs ...T) (v T) {
+	if len(vs) == 0 {
+		return
+	}
+	h := ctxvalue.HashFromContext(ctx)
+	if h == nil || h.Source == "" {
+		return s.fallback.Apply(ctx, vs...)
+	}
+
+	best := 0
+	bestScore := math.Inf(-1)
+	for i := range vs {
+		hash := fnv.New64a()
+		hash.Write([]byte(h.Source))
+		hash.Write([]byte{0})
+		hash.Write([]byte(stickyKey(vs[i], i)))
+		// Map the hash into (0, 1) and weight it: -weight/ln(u).
+		u := (float64(hash.Sum64()>>11) + 0.5) / (1 << 53)
+		score := float64(weightOf(vs[i])) / -math.Log(u)
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return vs[best]
+}
+
+func stickyKey(v any, i int) string {
+	switch t := v.(type) {
+	case *chain.Node:
+		return t.Addr
+	case interface{ Name() string }:
+		return t.Name()
+	}
+	return strconv.Itoa(i)
+}
@@ -0,0 +1,94 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-gost/core/chain"
+	ctxvalue "github.com/go-gost/x/ctx"
+	"github.com/go-gost/x/metadata"
+)
+
+func testNodes(weights ...int) []*chain.Node {
+	nodes := make([]*chain.Node, 0, len(weights))
+	for i, weight := range weights {
+		md := metadata.NewMetadata(map[string]any{labelWeight: weight})
+		addr := fmt.Sprintf("10.0.0.%d:80", i+1)
+		nodes = append(nodes, chain.NewNode(addr, addr, chain.MetadataNodeOption(md)))
+	}
+	return nodes
+}
+
+func TestWeightedRoundRobinStrategy(t *testing.T) {
+	nodes := testNodes(3, 1)
+	s := WeightedRoundRobinStrategy[*chain.Node]()
+
+	var order string
+	counts := map[*chain.Node]int{}
+	for i := 0; i < 8; i++ {
+		node := s.Apply(context.Background(), nodes...)
+		counts[node]++
+		order += node.Addr[7:8]
+	}
+	if counts[nodes[0]] != 6 || counts[nodes[1]] != 2 {
+		t.Fatalf("expected a 3:1 split, got %d:%d", counts[nodes[0]], counts[nodes[1]])
+	}
+	// The smooth algorithm interleaves the light node instead of bursting.
+	if order != "11211121" {
+		t.Fatalf("unexpected selection order %s", order)
+	}
+}
+
+func TestLeastConnStrategy(t *testing.T) {
+	nodes := testNodes(1, 2)
+	s := LeastConnStrategy[*chain.Node]()
+
+	release := AcquireConn(nodes[0])
+	if got := s.Apply(context.Background(), nodes...); got != nodes[1] {
+		t.Fatalf("expected the idle node, got %s", got.Addr)
+	}
+
+	// Two connections on a weight 2 node equal one on a weight 1 node.
+	r1, r2 := AcquireConn(nodes[1]), AcquireConn(nodes[1])
+	r3 := AcquireConn(nodes[1])
+	if got := s.Apply(context.Background(), nodes...); got != nodes[0] {
+		t.Fatalf("expected the less loaded node, got %s", got.Addr)
+	}
+	r3()
+	r3()
+	if ActiveConns(nodes[1]) != 2 {
+		t.Fatalf("expected a repeated release to count once, got %d", ActiveConns(nodes[1]))
+	}
+
+	release()
+	r1()
+	r2()
+	if ActiveConns(nodes[0]) != 0 || ActiveConns(nodes[1]) != 0 {
+		t.Fatalf("expected all connections to be released")
+	}
+}
+
+func TestStickyStrategy(t *testing.T) {
+	nodes := testNodes(1, 1, 1)
+	s := StickyStrategy[*chain.Node]()
+
+	picks := map[string]*chain.Node{}
+	for i := 0; i < 32; i++ {
+		src := fmt.Sprintf("192.168.0.%d", i)
+		ctx := ctxvalue.ContextWithHash(context.Background(), &ctxvalue.Hash{Source: src})
+		picks[src] = s.Apply(ctx, nodes...)
+		if again := s.Apply(ctx, nodes...); again != picks[src] {
+			t.Fatalf("expected %s to keep its node", src)
+		}
+	}
+
+	// Removing a node only moves the clients that were on it.
+	for src, node := range picks {
+		ctx := ctxvalue.ContextWithHash(context.Background(), &ctxvalue.Hash{Source: src})
+		got := s.Apply(ctx, nodes[:2]...)
+		if node != nodes[2] && got != node {
+			t.Fatalf("expected %s to stay on %s, got %s", src, node.Addr, got.Addr)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/admission"
+)
+
+// defaultClientIPWindow 客户端IP的保留时长（滑动窗口）
+const defaultClientIPWindow = 5 * time.Minute
+
+// ClientIPTracker 记录每个服务在滑动窗口内接入过的客户端IP，
+// 新出现或刷新过的IP随流量上报发送给面板，由面板统计用户的并发IP数。
+type ClientIPTracker struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]map[string]*clientIPEntry // key: 服务名 -> 客户端IP
+	guards map[string]map[string]struct{}       // key: 服务名, value: 锁定后允许的IP
+}
+
+type clientIPEntry struct {
+	lastSeen time.Time
+	reported bool
+}
+
+var (
+	clientIPTracker     *ClientIPTracker
+	clientIPTrackerOnce sync.Once
+)
+
+// GetClientIPTracker 获取客户端IP跟踪器单例
+func GetClientIPTracker() *ClientIPTracker {
+	clientIPTrackerOnce.Do(func() {
+		clientIPTracker = &ClientIPTracker{
+			window: defaultClientIPWindow,
+			seen:   make(map[string]map[string]*clientIPEntry),
+			guards: make(map[string]map[string]struct{}),
+		}
+	})
+	return clientIPTracker
+}
+
+// admit 记录客户端IP；服务被锁定时，仅放行面板下发的IP
+func (t *ClientIPTracker) admit(serviceName, ip string) bool {
+	if serviceName == "" || ip == "" {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if allowed, locked := t.guards[serviceName]; locked {
+		if _, ok := allowed[ip]; !ok {
+			return false
+		}
+	}
+
+	ips, ok := t.seen[serviceName]
+	if !ok {
+		ips = make(map[string]*clientIPEntry)
+		t.seen[serviceName] = ips
+	}
+	entry, ok := ips[ip]
+	if !ok {
+		entry = &clientIPEntry{}
+		ips[ip] = entry
+	}
+	entry.lastSeen = time.Now()
+	entry.reported = false
+	return true
+}
+
+// SetGuard 锁定或解锁服务。锁定后只有 allowed 中的IP可以建立新连接，
+// 已建立的连接不受影响。
+func (t *ClientIPTracker) SetGuard(services []string, locked bool, allowed []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, name := range services {
+		if name == "" {
+			continue
+		}
+		if !locked {
+			delete(t.guards, name)
+			continue
+		}
+		set := make(map[string]struct{}, len(allowed))
+		for _, ip := range allowed {
+			set[ip] = struct{}{}
+		}
+		t.guards[name] = set
+	}
+}
+
+// ClearGuards 解除所有服务的锁定。锁定状态只保存在面板内存中，
+// 与面板重新建立连接后由面板根据新的上报重新判定。
+func (t *ClientIPTracker) ClearGuards() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.guards = make(map[string]map[string]struct{})
+}
+
+// ClientIPs 返回服务在窗口内出现过的客户端IP
+func (t *ClientIPTracker) ClientIPs(serviceName string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := time.Now().Add(-t.window)
+	ips := make([]string, 0, len(t.seen[serviceName]))
+	for ip, entry := range t.seen[serviceName] {
+		if entry.lastSeen.After(cutoff) {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// pending 返回上次上报后新出现或刷新过的IP，同时清理窗口外的记录
+func (t *ClientIPTracker) pending() map[string][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := time.Now().Add(-t.window)
+	result := make(map[string][]string)
+	for name, ips := range t.seen {
+		for ip, entry := range ips {
+			if entry.lastSeen.Before(cutoff) {
+				delete(ips, ip)
+				continue
+			}
+			if !entry.reported {
+				result[name] = append(result[name], ip)
+			}
+		}
+		if len(ips) == 0 {
+			delete(t.seen, name)
+		}
+	}
+	return result
+}
+
+// markReported 标记已成功上报的IP
+func (t *ClientIPTracker) markReported(reported map[string][]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name, list := range reported {
+		ips := t.seen[name]
+		for _, ip := range list {
+			if entry, ok := ips[ip]; ok {
+				entry.reported = true
+			}
+		}
+	}
+}
+
+// IsForwardService 判断服务是否为面板下发的转发服务，
+// 名称格式为 转发ID_用户ID_用户隧道ID，新版本带 _tcp/_udp 后缀。
+// 隧道中转服务（_tls）和共享服务等不参与客户端IP统计。
+func IsForwardService(name string) bool {
+	parts := strings.Split(name, "_")
+	switch len(parts) {
+	case 3:
+	case 4:
+		if parts[3] != "tcp" && parts[3] != "udp" {
+			return false
+		}
+	default:
+		return false
+	}
+	for _, part := range parts[:3] {
+		if _, err := strconv.ParseInt(part, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+type clientIPAdmission struct {
+	service string
+	tracker *ClientIPTracker
+}
+
+// ClientIPAdmission 返回记录客户端IP的准入控制器，供服务在接入连接时调用
+func ClientIPAdmission(serviceName string) admission.Admission {
+	return &clientIPAdmission{
+		service: serviceName,
+		tracker: GetClientIPTracker(),
+	}
+}
+
+func (a *clientIPAdmission) Admit(ctx context.Context, addr string, opts ...admission.Option) bool {
+	ip := addr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		ip = host
+	}
+	return a.tracker.admit(a.service, ip)
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsForwardService(t *testing.T) {
+	cases := map[string]bool{
+		"12_3_4":         true,
+		"12_3_4_tcp":     true,
+		"12_3_4_udp":     true,
+		"12_tls":         false,
+		"12_3_4_tls":     false,
+		"fed_svc_1_2_3":  false,
+		"a_3_4":          false,
+		"web_api":        false,
+		"12_3_4_tcp_udp": false,
+	}
+	for name, want := range cases {
+		if got := IsForwardService(name); got != want {
+			t.Errorf("IsForwardService(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestClientIPTrackerGuard(t *testing.T) {
+	tracker := &ClientIPTracker{
+		window: time.Minute,
+		seen:   make(map[string]map[string]*clientIPEntry),
+		guards: make(map[string]map[string]struct{}),
+	}
+
+	if !tracker.admit("1_1_1_tcp", "10.0.0.1") {
+		t.Fatalf("expected an unlocked service to admit")
+	}
+	tracker.SetGuard([]string{"1_1_1_tcp"}, true, []string{"10.0.0.1"})
+	if !tracker.admit("1_1_1_tcp", "10.0.0.1") {
+		t.Fatalf("expected an allowed IP to be admitted")
+	}
+	if tracker.admit("1_1_1_tcp", "10.0.0.2") {
+		t.Fatalf("expected a new IP to be rejected while locked")
+	}
+
+	tracker.ClearGuards()
+	if !tracker.admit("1_1_1_tcp", "10.0.0.2") {
+		t.Fatalf("expected cleared guards to admit again")
+	}
+	if got := len(tracker.pending()["1_1_1_tcp"]); got != 2 {
+		t.Fatalf("expected 2 pending IPs, got %d", got)
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"sync"
+)
+
+const (
+	// defaultConnLogBuffer 待上报连接日志的上限，面板不可达时丢弃最早的记录
+	defaultConnLogBuffer = 5000
+	// defaultConnLogBatch 单次上报携带的连接日志条数上限
+	defaultConnLogBatch = 1000
+)
+
+// ConnLogEntry 一条连接日志（压缩格式），时间为毫秒时间戳
+type ConnLogEntry struct {
+	Client  string `json:"c"`           // 客户端地址
+	Entry   string `json:"e"`           // 入口地址
+	Target  string `json:"t"`           // 目标地址
+	Network string `json:"p"`           // 协议
+	Start   int64  `json:"s"`           // 开始时间
+	End     int64  `json:"f"`           // 结束时间
+	Up      int64  `json:"u"`           // 客户端发送的字节数
+	Down    int64  `json:"d"`           // 客户端接收的字节数
+	Reason  string `json:"r,omitempty"` // 关闭原因，正常关闭时为空
+}
+
+// ConnLogTracker 缓存开启了连接日志的服务的连接记录，
+// 随流量上报分批发送给面板。
+type ConnLogTracker struct {
+	mu      sync.Mutex
+	limit   int
+	batch   int
+	seq     uint64
+	entries []connLogRecord
+	dropped int
+}
+
+type connLogRecord struct {
+	seq     uint64
+	service string
+	entry   ConnLogEntry
+}
+
+var (
+	connLogTracker     *ConnLogTracker
+	connLogTrackerOnce sync.Once
+)
+
+// GetConnLogTracker 获取连接日志跟踪器单例
+func GetConnLogTracker() *ConnLogTracker {
+	connLogTrackerOnce.Do(func() {
+		connLogTracker = &ConnLogTracker{
+			limit: defaultConnLogBuffer,
+			batch: defaultConnLogBatch,
+		}
+	})
+	return connLogTracker
+}
+
+// Add 记录服务的一条连接日志
+func (t *ConnLogTracker) Add(serviceName string, entry ConnLogEntry) {
+	if serviceName == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.entries) >= t.limit {
+		n := len(t.entries) - t.limit + 1
+		t.entries = append(t.entries[:0], t.entries[n:]...)
+		t.dropped += n
+	}
+	t.seq++
+	t.entries = append(t.entries, connLogRecord{seq: t.seq, service: serviceName, entry: entry})
+}
+
+// pending 返回最早的一批待上报日志，以及其中最后一条的序号
+func (t *ConnLogTracker) pending() (map[string][]ConnLogEntry, uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := min(len(t.entries), t.batch)
+	if n == 0 {
+		return nil, 0
+	}
+	result := make(map[string][]ConnLogEntry)
+	for _, rec := range t.entries[:n] {
+		result[rec.service] = append(result[rec.service], rec.entry)
+	}
+	return result, t.entries[n-1].seq
+}
+
+// markReported 移除序号不大于 seq 的已上报日志，返回上次上报后因缓存已满丢弃的条数
+func (t *ConnLogTracker) markReported(seq uint64) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := 0
+	for i < len(t.entries) && t.entries[i].seq <= seq {
+		i++
+	}
+	t.entries = append(t.entries[:0], t.entries[i:]...)
+	dropped := t.dropped
+	t.dropped = 0
+	return dropped
+}
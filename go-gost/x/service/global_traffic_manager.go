@@ -87,10 +87,14 @@ func (m *GlobalTrafficManager) startReporting() {
 
 // collectAndReport 收集所有服务流量并合并上报
 func (m *GlobalTrafficManager) collectAndReport() {
+	clientIPs := GetClientIPTracker().pending()
+	targetHealth := GetTargetHealthTracker().pending()
+	connLogs, connLogSeq := GetConnLogTracker().pending()
+
 	m.mu.Lock()
-	
-	// 如果没有流量，直接返回
-	if len(m.serviceTraffic) == 0 {
+
+	// 如果没有流量、新的客户端IP、健康状态和连接日志，直接返回
+	if len(m.serviceTraffic) == 0 && len(clientIPs) == 0 && len(targetHealth) == 0 && len(connLogs) == 0 {
 		m.mu.Unlock()
 		return
 	}
@@ -118,8 +122,8 @@ func (m *GlobalTrafficManager) collectAndReport() {
 	}
 	m.mu.Unlock()
 
-	// 如果没有需要上报的流量，返回
-	if len(reportData) == 0 {
+	// 如果没有需要上报的流量、客户端IP、健康状态和连接日志，返回
+	if len(reportData) == 0 && len(clientIPs) == 0 && len(targetHealth) == 0 && len(connLogs) == 0 {
 		return
 	}
 
@@ -132,10 +136,35 @@ func (m *GlobalTrafficManager) collectAndReport() {
 			N: serviceName, // 保持服务名不变
 			U: data.up,
 			D: data.down,
+			I: clientIPs[serviceName],
+			H: targetHealth[serviceName],
+			C: connLogs[serviceName],
 		})
 		totalUp += data.up
 		totalDown += data.down
 	}
+	// 没有流量但有新客户端IP、健康状态或连接日志的服务单独上报
+	extra := make(map[string]struct{})
+	for serviceName := range clientIPs {
+		extra[serviceName] = struct{}{}
+	}
+	for serviceName := range targetHealth {
+		extra[serviceName] = struct{}{}
+	}
+	for serviceName := range connLogs {
+		extra[serviceName] = struct{}{}
+	}
+	for serviceName := range extra {
+		if _, ok := reportData[serviceName]; ok {
+			continue
+		}
+		reportItems = append(reportItems, TrafficReportItem{
+			N: serviceName,
+			I: clientIPs[serviceName],
+			H: targetHealth[serviceName],
+			C: connLogs[serviceName],
+		})
+	}
 
 	// 批量发送上报请求（一次HTTP请求包含所有服务）
 	success, err := sendBatchTrafficReport(m.ctx, reportItems)
@@ -151,6 +180,11 @@ func (m *GlobalTrafficManager) collectAndReport() {
 
 	// 上报成功，清空已上报的流量
 	m.clearReportedTraffic(reportData)
+	GetClientIPTracker().markReported(clientIPs)
+	GetTargetHealthTracker().markReported(targetHealth)
+	if dropped := GetConnLogTracker().markReported(connLogSeq); dropped > 0 {
+		fmt.Printf("⚠️ 连接日志缓存已满，丢弃 %d 条\n", dropped)
+	}
 }
 
 // clearReportedTraffic 清空已成功上报的流量
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-gost/core/listener"
+	"github.com/go-gost/core/metadata"
+	xnet "github.com/go-gost/x/internal/net"
+)
+
+var errUnsupport = errors.New("unsupported operation")
+
+// portRangeListener serves every port of a range through one service, so
+// the handler, limiters and traffic stats are shared instead of being set up
+// once per port.
+type portRangeListener struct {
+	lns    []listener.Listener
+	conns  chan net.Conn
+	errc   chan error
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewPortRangeListener merges lns, which listen on consecutive ports, into a
+// single listener. Accepted connections report the position of their port
+// in the range through xnet.PortOffset. The listeners must be initialized.
+func NewPortRangeListener(lns ...listener.Listener) listener.Listener {
+	l := &portRangeListener{
+		lns:    lns,
+		conns:  make(chan net.Conn),
+		errc:   make(chan error, 1),
+		closed: make(chan struct{}),
+	}
+	for i, ln := range lns {
+		go l.accept(i, ln)
+	}
+	return l
+}
+
+func (l *portRangeListener) Init(md metadata.Metadata) error {
+	return nil
+}
+
+func (l *portRangeListener) accept(offset int, ln listener.Listener) {
+	var tempDelay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else if tempDelay *= 2; tempDelay > time.Second {
+					tempDelay = time.Second
+				}
+				select {
+				case <-time.After(tempDelay):
+					continue
+				case <-l.closed:
+					return
+				}
+			}
+			select {
+			case l.errc <- err:
+			default:
+			}
+			return
+		}
+		tempDelay = 0
+
+		select {
+		case l.conns <- &portRangeConn{Conn: conn, offset: offset}:
+		case <-l.closed:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Accept returns the next connection from any port. A listener failing for
+// good closes the whole range, so the service does not keep serving only
+// part of it.
+func (l *portRangeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errc:
+		l.Close()
+		return nil, err
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *portRangeListener) Addr() net.Addr {
+	return l.lns[0].Addr()
+}
+
+func (l *portRangeListener) Close() (err error) {
+	l.once.Do(func() {
+		close(l.closed)
+		for _, ln := range l.lns {
+			if e := ln.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	})
+	return
+}
+
+type portRangeConn struct {
+	net.Conn
+	offset int
+}
+
+func (c *portRangeConn) PortOffset() int {
+	return c.offset
+}
+
+func (c *portRangeConn) ClientAddr() net.Addr {
+	if ca, ok := c.Conn.(xnet.ClientAddr); ok {
+		return ca.ClientAddr()
+	}
+	return nil
+}
+
+func (c *portRangeConn) SyscallConn() (rc syscall.RawConn, err error) {
+	if sc, ok := c.Conn.(syscall.Conn); ok {
+		rc, err = sc.SyscallConn()
+		return
+	}
+	err = errUnsupport
+	return
+}
+
+func (c *portRangeConn) Metadata() metadata.Metadata {
+	if md, ok := c.Conn.(metadata.Metadatable); ok {
+		return md.Metadata()
+	}
+	return nil
+}
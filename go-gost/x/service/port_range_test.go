@@ -0,0 +1,74 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/metadata"
+	xnet "github.com/go-gost/x/internal/net"
+)
+
+type tcpTestListener struct {
+	net.Listener
+}
+
+func (l *tcpTestListener) Init(md metadata.Metadata) error {
+	return nil
+}
+
+func TestPortRangeListener(t *testing.T) {
+	var lns []*tcpTestListener
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		lns = append(lns, &tcpTestListener{Listener: ln})
+	}
+	ln := NewPortRangeListener(lns[0], lns[1])
+	if ln.Addr().String() != lns[0].Addr().String() {
+		t.Fatalf("expected the range to report its first port, got %s", ln.Addr())
+	}
+
+	for offset, l := range lns {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer c.Close()
+
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatalf("accept: %v", err)
+		}
+		po, ok := conn.(xnet.PortOffset)
+		if !ok || po.PortOffset() != offset {
+			t.Fatalf("expected offset %d, got %v", offset, conn)
+		}
+		conn.Close()
+	}
+
+	// A port failing for good takes the whole range down.
+	lns[1].Listener.Close()
+	done := make(chan error, 1)
+	go func() {
+		_, err := ln.Accept()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected accept to fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("accept did not return after a port closed")
+	}
+	if _, err := ln.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected the range to be closed, got %v", err)
+	}
+	if _, err := net.Dial("tcp", lns[0].Addr().String()); err == nil {
+		t.Fatalf("expected the remaining port to be closed")
+	}
+}
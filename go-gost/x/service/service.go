@@ -63,6 +63,10 @@ func SetProtocolBlock(httpOn int, tlsOn int, socksOn int) {
 type Option func(opts *options)
 
 func init() {
+	// config.json 缺失时由 main 报错退出，这里保持默认协议开关（单元测试也依赖这一点）
+	if _, err := os.Stat("config.json"); os.IsNotExist(err) {
+		return
+	}
 	_, err := LoadConfig("config.json")
 	fmt.Println("config.json loaded")
 	if err != nil {
@@ -321,6 +325,16 @@ func (s *defaultService) Close() error {
 	return s.listener.Close()
 }
 
+// Handover offers the listening socket to the service that will replace this
+// one on the same address, so the replacement adopts it instead of binding
+// again. It fails when the listener cannot pass its socket on.
+func (s *defaultService) Handover() error {
+	if h, ok := s.listener.(xnet.Handover); ok {
+		return h.Handover()
+	}
+	return errors.New("listener does not support handover")
+}
+
 func (s *defaultService) execCmds(phase string, cmds []string) {
 	for _, cmd := range cmds {
 		cmd := strings.TrimSpace(cmd)
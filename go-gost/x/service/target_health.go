@@ -0,0 +1,143 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// targetHealthRefresh 健康状态没有变化时的重新上报间隔，面板重启后据此恢复展示
+const targetHealthRefresh = time.Minute
+
+// TargetHealthTracker 记录各服务转发目标的主动健康检查结果，
+// 状态变化随流量上报发送给面板，由面板在转发列表中展示。
+type TargetHealthTracker struct {
+	mu       sync.Mutex
+	refresh  time.Duration
+	owners   map[string]any                           // key: 服务名, value: 当前执行检查的对象
+	services map[string]map[string]*targetHealthEntry // key: 服务名 -> 目标地址
+}
+
+type targetHealthEntry struct {
+	healthy    bool
+	reported   bool
+	reportedAt time.Time
+}
+
+var (
+	targetHealthTracker     *TargetHealthTracker
+	targetHealthTrackerOnce sync.Once
+)
+
+// GetTargetHealthTracker 获取目标健康状态跟踪器单例
+func GetTargetHealthTracker() *TargetHealthTracker {
+	targetHealthTrackerOnce.Do(func() {
+		targetHealthTracker = &TargetHealthTracker{
+			refresh:  targetHealthRefresh,
+			owners:   make(map[string]any),
+			services: make(map[string]map[string]*targetHealthEntry),
+		}
+	})
+	return targetHealthTracker
+}
+
+// Register 由 owner 接管服务的健康检查，之前记录的状态一并清除
+func (t *TargetHealthTracker) Register(serviceName string, owner any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.owners[serviceName] = owner
+	delete(t.services, serviceName)
+}
+
+// Unregister 服务关闭时清除其健康状态；服务已被新的 owner 接管时忽略
+func (t *TargetHealthTracker) Unregister(serviceName string, owner any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.owners[serviceName] != owner {
+		return
+	}
+	delete(t.owners, serviceName)
+	delete(t.services, serviceName)
+}
+
+// Set 记录目标的检查结果，状态变化时等待下一次上报
+func (t *TargetHealthTracker) Set(serviceName string, owner any, addr string, healthy bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.owners[serviceName] != owner {
+		return
+	}
+	targets, ok := t.services[serviceName]
+	if !ok {
+		targets = make(map[string]*targetHealthEntry)
+		t.services[serviceName] = targets
+	}
+	entry, ok := targets[addr]
+	if !ok {
+		entry = &targetHealthEntry{healthy: healthy}
+		targets[addr] = entry
+	}
+	if entry.healthy != healthy {
+		entry.healthy = healthy
+		entry.reported = false
+	}
+}
+
+// Retain 只保留仍在目标列表中的地址，目标被移除后不再上报
+func (t *TargetHealthTracker) Retain(serviceName string, owner any, addrs []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.owners[serviceName] != owner {
+		return
+	}
+	keep := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		keep[addr] = struct{}{}
+	}
+	for addr := range t.services[serviceName] {
+		if _, ok := keep[addr]; !ok {
+			delete(t.services[serviceName], addr)
+		}
+	}
+}
+
+// pending 返回状态变化或超过刷新间隔未上报的目标
+func (t *TargetHealthTracker) pending() map[string]map[string]bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	result := make(map[string]map[string]bool)
+	for name, targets := range t.services {
+		for addr, entry := range targets {
+			if entry.reported && now.Sub(entry.reportedAt) < t.refresh {
+				continue
+			}
+			if result[name] == nil {
+				result[name] = make(map[string]bool)
+			}
+			result[name][addr] = entry.healthy
+		}
+	}
+	return result
+}
+
+// markReported 标记已成功上报的状态；上报期间状态又发生变化的目标保持待上报
+func (t *TargetHealthTracker) markReported(reported map[string]map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for name, list := range reported {
+		targets := t.services[name]
+		for addr, healthy := range list {
+			if entry, ok := targets[addr]; ok && entry.healthy == healthy {
+				entry.reported = true
+				entry.reportedAt = now
+			}
+		}
+	}
+}
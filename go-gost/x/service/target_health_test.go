@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTargetHealthTrackerReportsChanges(t *testing.T) {
+	tracker := &TargetHealthTracker{
+		refresh:  time.Hour,
+		owners:   make(map[string]any),
+		services: make(map[string]map[string]*targetHealthEntry),
+	}
+	owner, stale := new(int), new(int)
+	tracker.Register("1_1_1", stale)
+	tracker.Register("1_1_1", owner)
+
+	tracker.Set("1_1_1", stale, "10.0.0.1:80", false)
+	if len(tracker.pending()) != 0 {
+		t.Fatalf("expected a replaced owner to be ignored")
+	}
+
+	tracker.Set("1_1_1", owner, "10.0.0.1:80", true)
+	tracker.Set("1_1_1", owner, "10.0.0.2:80", false)
+	pending := tracker.pending()
+	if len(pending["1_1_1"]) != 2 || pending["1_1_1"]["10.0.0.2:80"] {
+		t.Fatalf("unexpected pending states: %v", pending)
+	}
+	tracker.markReported(pending)
+	if len(tracker.pending()) != 0 {
+		t.Fatalf("expected reported states to wait for the refresh")
+	}
+
+	tracker.Set("1_1_1", owner, "10.0.0.2:80", true)
+	tracker.Retain("1_1_1", owner, []string{"10.0.0.2:80"})
+	pending = tracker.pending()
+	if len(pending["1_1_1"]) != 1 || !pending["1_1_1"]["10.0.0.2:80"] {
+		t.Fatalf("expected only the changed, retained target, got %v", pending)
+	}
+
+	tracker.Unregister("1_1_1", stale)
+	if len(tracker.pending()) == 0 {
+		t.Fatalf("expected a stale owner not to clear the service")
+	}
+	tracker.Unregister("1_1_1", owner)
+	if len(tracker.pending()) != 0 {
+		t.Fatalf("expected unregister to clear the service")
+	}
+}
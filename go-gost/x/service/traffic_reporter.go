@@ -21,9 +21,12 @@ var httpAESCrypto *crypto.AESCrypto // 新增：HTTP上报加密器
 
 // TrafficReportItem 流量报告项（压缩格式）
 type TrafficReportItem struct {
-	N string `json:"n"` // 服务名（name缩写）
-	U int64  `json:"u"` // 上行流量（up缩写）
-	D int64  `json:"d"` // 下行流量（down缩写）
+	N string          `json:"n"`           // 服务名（name缩写）
+	U int64           `json:"u"`           // 上行流量（up缩写）
+	D int64           `json:"d"`           // 下行流量（down缩写）
+	I []string        `json:"i,omitempty"` // 新接入的客户端IP（ip缩写）
+	H map[string]bool `json:"h,omitempty"` // 转发目标健康状态（health缩写），key为目标地址
+	C []ConnLogEntry  `json:"c,omitempty"` // 连接日志（conn缩写）
 }
 
 func SetHTTPReportURL(addr string, secret string) {
@@ -0,0 +1,81 @@
+package socket
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-gost/x/config"
+	parser "github.com/go-gost/x/config/parsing/admission"
+	"github.com/go-gost/x/registry"
+)
+
+// updateAdmission replaces the named admission, registering it when it does
+// not exist yet. Services look admissions up by name on every connection,
+// so the new rules apply without restarting them.
+func updateAdmission(req updateAdmissionRequest) error {
+	name := strings.TrimSpace(req.Admission)
+	if name == "" {
+		return errors.New("admission name is required")
+	}
+
+	if registry.AdmissionRegistry().IsRegistered(name) {
+		registry.AdmissionRegistry().Unregister(name)
+	}
+
+	req.Data.Name = name
+
+	v := parser.ParseAdmission(&req.Data)
+
+	if err := registry.AdmissionRegistry().Register(name, v); err != nil {
+		return errors.New("admission " + name + " already exists")
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		found := false
+		for i := range c.Admissions {
+			if c.Admissions[i].Name == name {
+				c.Admissions[i] = &req.Data
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.Admissions = append(c.Admissions, &req.Data)
+		}
+		return nil
+	})
+
+	return nil
+}
+
+func deleteAdmission(req deleteAdmissionRequest) error {
+
+	name := strings.TrimSpace(req.Admission)
+
+	if registry.AdmissionRegistry().IsRegistered(name) {
+		registry.AdmissionRegistry().Unregister(name)
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		admissions := c.Admissions
+		c.Admissions = nil
+		for _, s := range admissions {
+			if s.Name == name {
+				continue
+			}
+			c.Admissions = append(c.Admissions, s)
+		}
+		return nil
+	})
+
+	return nil
+}
+
+type updateAdmissionRequest struct {
+	Admission string                 `json:"admission"`
+	Data      config.AdmissionConfig `json:"data"`
+}
+
+type deleteAdmissionRequest struct {
+	Admission string `json:"admission"`
+}
@@ -2,6 +2,7 @@ package socket
 
 import (
 	"errors"
+	"io"
 	"strings"
 
 	"github.com/go-gost/core/logger"
@@ -39,23 +40,24 @@ func createChain(req createChainRequest) error {
 	return nil
 }
 
+// updateChain parses the new chain before touching the registered one, so
+// a rejected config leaves the old chain in place.
 func updateChain(req updateChainRequest) error {
 
 	name := strings.TrimSpace(req.Chain)
-
-	if registry.ChainRegistry().IsRegistered(name) {
-		registry.ChainRegistry().Unregister(name)
+	if name == "" {
+		return &updateError{Kind: "chain", Stage: "validate", Err: errors.New("chain name is required"), RolledBack: true}
 	}
 
 	req.Data.Name = name
 
 	v, err := parser.ParseChain(&req.Data, logger.Default())
 	if err != nil {
-		return errors.New("create chain " + name + " failed: " + err.Error())
+		return &updateError{Kind: "chain", Name: name, Stage: "parse", Err: err, RolledBack: true}
 	}
 
-	if err := registry.ChainRegistry().Register(name, v); err != nil {
-		return errors.New("chain " + name + " already exists")
+	if old, ok := registry.SwapChain(name, v).(io.Closer); ok {
+		old.Close()
 	}
 
 	config.OnUpdate(func(c *config.Config) error {
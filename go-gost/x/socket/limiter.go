@@ -2,10 +2,14 @@ package socket
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/units"
 	"github.com/go-gost/x/config"
 	parser "github.com/go-gost/x/config/parsing/limiter"
 	"github.com/go-gost/x/registry"
-	"strings"
 )
 
 func createLimiter(req createLimiterRequest) error {
@@ -18,6 +22,9 @@ func createLimiter(req createLimiterRequest) error {
 	if registry.TrafficLimiterRegistry().IsRegistered(name) {
 		return errors.New("limiter " + name + " already exists")
 	}
+	if err := validateTrafficLimits(req.Data.Limits); err != nil {
+		return errors.New("create limiter " + name + " failed: " + err.Error())
+	}
 
 	v := parser.ParseTrafficLimiter(&req.Data)
 
@@ -33,20 +40,24 @@ func createLimiter(req createLimiterRequest) error {
 	return nil
 }
 
+// updateLimiter checks the new limits before touching the registered
+// limiter, so a rejected config leaves the old limits in force.
 func updateLimiter(req updateLimiterRequest) error {
 
 	name := strings.TrimSpace(req.Limiter)
-
-	if registry.TrafficLimiterRegistry().IsRegistered(name) {
-		registry.TrafficLimiterRegistry().Unregister(name)
+	if name == "" {
+		return &updateError{Kind: "limiter", Stage: "validate", Err: errors.New("limiter name is required"), RolledBack: true}
+	}
+	if err := validateTrafficLimits(req.Data.Limits); err != nil {
+		return &updateError{Kind: "limiter", Name: name, Stage: "validate", Err: err, RolledBack: true}
 	}
 
 	req.Data.Name = name
 
 	v := parser.ParseTrafficLimiter(&req.Data)
 
-	if err := registry.TrafficLimiterRegistry().Register(name, v); err != nil {
-		return errors.New("limiter " + name + " already exists")
+	if old, ok := registry.SwapTrafficLimiter(name, v).(io.Closer); ok {
+		old.Close()
 	}
 
 	config.OnUpdate(func(c *config.Config) error {
@@ -67,6 +78,27 @@ func updateLimiter(req updateLimiterRequest) error {
 	return nil
 }
 
+// validateTrafficLimits rejects limit lines the traffic limiter would skip
+// silently: every line needs a scope and in, optionally out, rates such as
+// "$ 10.0MB 10.0MB".
+func validateTrafficLimits(limits []string) error {
+	for _, line := range limits {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return fmt.Errorf("invalid limit %q", line)
+		}
+		for _, rate := range fields[1:] {
+			if _, err := units.ParseBase2Bytes(rate); err != nil {
+				return fmt.Errorf("invalid rate %q in limit %q", rate, line)
+			}
+		}
+	}
+	return nil
+}
+
 func deleteLimiter(req deleteLimiterRequest) error {
 
 	name := strings.TrimSpace(req.Limiter)
@@ -90,6 +122,65 @@ func deleteLimiter(req deleteLimiterRequest) error {
 	return nil
 }
 
+// updateConnLimiter replaces the named conn limiter, registering it when it
+// does not exist yet so the panel can push limits without tracking state.
+// Running services look it up by name and pick up the new limits in place.
+func updateConnLimiter(req updateLimiterRequest) error {
+	name := strings.TrimSpace(req.Limiter)
+	if name == "" {
+		return errors.New("limiter name is required")
+	}
+
+	req.Data.Name = name
+
+	v := parser.ParseConnLimiter(&req.Data)
+
+	// 原地替换，服务持有的是按名称查找的包装，无需重启
+	if old, ok := registry.SwapConnLimiter(name, v).(io.Closer); ok {
+		old.Close()
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		found := false
+		for i := range c.CLimiters {
+			if c.CLimiters[i].Name == name {
+				c.CLimiters[i] = &req.Data
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.CLimiters = append(c.CLimiters, &req.Data)
+		}
+		return nil
+	})
+
+	return nil
+}
+
+func deleteConnLimiter(req deleteLimiterRequest) error {
+
+	name := strings.TrimSpace(req.Limiter)
+
+	if registry.ConnLimiterRegistry().IsRegistered(name) {
+		registry.ConnLimiterRegistry().Unregister(name)
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		limiteres := c.CLimiters
+		c.CLimiters = nil
+		for _, s := range limiteres {
+			if s.Name == name {
+				continue
+			}
+			c.CLimiters = append(c.CLimiters, s)
+		}
+		return nil
+	})
+
+	return nil
+}
+
 type createLimiterRequest struct {
 	Data config.LimiterConfig `json:"data"`
 }
@@ -0,0 +1,133 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-gost/x/config"
+	parser "github.com/go-gost/x/config/parsing/resolver"
+	"github.com/go-gost/x/registry"
+)
+
+// updateResolver replaces the named resolver, registering it when it does
+// not exist yet. Services look resolvers up by name on every dial, so the
+// new nameservers apply without restarting them.
+func updateResolver(req updateResolverRequest) error {
+	name := strings.TrimSpace(req.Resolver)
+	if name == "" {
+		return errors.New("resolver name is required")
+	}
+
+	req.Data.Name = name
+
+	v, err := parser.ParseResolver(&req.Data)
+	if err != nil {
+		return err
+	}
+
+	if registry.ResolverRegistry().IsRegistered(name) {
+		registry.ResolverRegistry().Unregister(name)
+	}
+	if err := registry.ResolverRegistry().Register(name, v); err != nil {
+		return errors.New("resolver " + name + " already exists")
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		found := false
+		for i := range c.Resolvers {
+			if c.Resolvers[i].Name == name {
+				c.Resolvers[i] = &req.Data
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.Resolvers = append(c.Resolvers, &req.Data)
+		}
+		return nil
+	})
+
+	return nil
+}
+
+func deleteResolver(req deleteResolverRequest) error {
+
+	name := strings.TrimSpace(req.Resolver)
+
+	if registry.ResolverRegistry().IsRegistered(name) {
+		registry.ResolverRegistry().Unregister(name)
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		resolvers := c.Resolvers
+		c.Resolvers = nil
+		for _, s := range resolvers {
+			if s.Name == name {
+				continue
+			}
+			c.Resolvers = append(c.Resolvers, s)
+		}
+		return nil
+	})
+
+	return nil
+}
+
+// resolveHost looks a host up the way a service referencing the named
+// resolver does, falling back to the system resolver without one.
+func resolveHost(req resolveRequest) ResolveResponse {
+	resp := ResolveResponse{Host: req.Host, Resolver: req.Resolver}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var ips []net.IP
+	var err error
+	if name := strings.TrimSpace(req.Resolver); name != "" {
+		if !registry.ResolverRegistry().IsRegistered(name) {
+			resp.ErrorMessage = "解析器 " + name + " 不存在"
+			return resp
+		}
+		ips, err = registry.ResolverRegistry().Get(name).Resolve(ctx, "ip", req.Host)
+	} else {
+		ips, err = net.DefaultResolver.LookupIP(ctx, "ip", req.Host)
+	}
+	if err != nil {
+		resp.ErrorMessage = err.Error()
+		return resp
+	}
+	if len(ips) == 0 {
+		resp.ErrorMessage = "未解析到任何地址"
+		return resp
+	}
+	for _, ip := range ips {
+		resp.IPs = append(resp.IPs, ip.String())
+	}
+	resp.Success = true
+	return resp
+}
+
+type updateResolverRequest struct {
+	Resolver string                `json:"resolver"`
+	Data     config.ResolverConfig `json:"data"`
+}
+
+type deleteResolverRequest struct {
+	Resolver string `json:"resolver"`
+}
+
+type resolveRequest struct {
+	Host     string `json:"host"`
+	Resolver string `json:"resolver"`
+}
+
+// ResolveResponse 域名解析诊断结果
+type ResolveResponse struct {
+	Host         string   `json:"host"`
+	Resolver     string   `json:"resolver,omitempty"`
+	Success      bool     `json:"success"`
+	IPs          []string `json:"ips,omitempty"`
+	ErrorMessage string   `json:"errorMessage,omitempty"`
+}
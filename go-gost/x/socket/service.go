@@ -9,6 +9,7 @@ import (
 	"github.com/go-gost/core/service"
 	"github.com/go-gost/x/config"
 	parser "github.com/go-gost/x/config/parsing/service"
+	xnet "github.com/go-gost/x/internal/net"
 	kill "github.com/go-gost/x/internal/util/port"
 	"github.com/go-gost/x/registry"
 )
@@ -81,6 +82,22 @@ func createServices(req createServicesRequest) error {
 	return nil
 }
 
+// serviceUpdate tracks one service of an update batch through the swap.
+type serviceUpdate struct {
+	config    *config.ServiceConfig
+	old       service.Service
+	oldConfig *config.ServiceConfig
+	svc       service.Service
+	// closed is set once the old service was stopped to free its address.
+	closed bool
+}
+
+// updateServices replaces a batch of services all or nothing. New services
+// are parsed and bound before anything is swapped. A service keeping its
+// address and listener type adopts the old listening socket, so the port
+// stays open and established connections run on; any other service on the
+// same address is closed first to free it. Any failure closes every new
+// service and restores every old one.
 func updateServices(req updateServicesRequest) error {
 
 	if len(req.Data) == 0 {
@@ -88,49 +105,181 @@ func updateServices(req updateServicesRequest) error {
 	}
 
 	// 第一阶段：验证所有服务名称有效性
+	updates := make([]serviceUpdate, len(req.Data))
+	seen := make(map[string]struct{}, len(req.Data))
 	for i := range req.Data {
 		name := strings.TrimSpace(req.Data[i].Name)
 		if name == "" {
-			return errors.New("service name is required")
+			return &updateError{Kind: "service", Stage: "validate", Err: errors.New("service name is required"), RolledBack: true}
 		}
+		if _, ok := seen[name]; ok {
+			return &updateError{Kind: "service", Name: name, Stage: "validate", Err: errors.New("duplicate service in batch"), RolledBack: true}
+		}
+		seen[name] = struct{}{}
 		req.Data[i].Name = name
+		updates[i].config = &req.Data[i]
 	}
 
-	// 第二阶段：逐个更新服务（Upsert模式：存在则更新，不存在则创建）
-	for i := range req.Data {
-		serviceConfig := &req.Data[i]
-		name := serviceConfig.Name
+	// 第二阶段：新增或换地址的服务先解析并绑定，旧服务保持运行
+	for i := range updates {
+		u := &updates[i]
+		reclaimDraining(u.config.Name, u.config.Addr)
+		u.old = registry.ServiceRegistry().Get(u.config.Name)
+		u.oldConfig = findServiceConfig(u.config.Name)
+		// 没有旧配置就无法在失败时恢复旧服务，拒绝更新而不是冒险关闭它
+		if u.old != nil && u.oldConfig == nil {
+			rollbackServiceUpdates(updates)
+			return &updateError{Kind: "service", Name: u.config.Name, Stage: "validate", Err: errors.New("running service has no config to restore"), RolledBack: true}
+		}
+		if u.old != nil && u.oldConfig.Addr == u.config.Addr {
+			continue
+		}
+		svc, err := parser.ParseService(u.config)
+		if err != nil {
+			rollbackServiceUpdates(updates)
+			return &updateError{Kind: "service", Name: u.config.Name, Stage: "parse", Err: err, RolledBack: true}
+		}
+		u.svc = svc
+	}
 
-		// 1. 获取旧服务
-		old := registry.ServiceRegistry().Get(name)
+	// 第三阶段：地址和监听类型都不变的服务接管旧监听套接字；
+	// 换了监听类型或不支持接管的先关闭旧服务再绑定
+	for i := range updates {
+		u := &updates[i]
+		if u.svc != nil {
+			continue
+		}
+		if !canHandover(u.oldConfig, u.config) || !handoverService(u.old) {
+			u.old.Close()
+			u.closed = true
+		}
+		svc, err := parser.ParseService(u.config)
+		xnet.DropHandovers(u.config.Addr)
+		if err != nil {
+			rollbackServiceUpdates(updates)
+			return &updateError{Kind: "service", Name: u.config.Name, Stage: "parse", Err: err, RolledBack: true}
+		}
+		u.svc = svc
+	}
 
-		// 2. 关闭旧服务 (如果存在)
-		if old != nil {
+	// 第四阶段：全部就绪后原子切换并启动
+	for i := range updates {
+		u := &updates[i]
+		if old := registry.SwapService(u.config.Name, u.svc); old != nil && !u.closed {
 			old.Close()
-			// 3. 从注册表移除旧服务
-			registry.ServiceRegistry().Unregister(name)
 		}
+		go u.svc.Serve()
+	}
 
-		// 4. 解析新服务配置
-		svc, err := parser.ParseService(serviceConfig)
-		if err != nil {
-			return errors.New("create service " + name + " failed: " + err.Error())
+	// 第五阶段：更新配置
+	config.OnUpdate(func(c *config.Config) error {
+		for i := range req.Data {
+			// 创建副本以确保指针安全
+			cfgCopy := req.Data[i]
+			found := false
+			for j := range c.Services {
+				if c.Services[j].Name == cfgCopy.Name {
+					c.Services[j] = &cfgCopy
+					found = true
+					break
+				}
+			}
+			if !found {
+				c.Services = append(c.Services, &cfgCopy)
+			}
 		}
+		return nil
+	})
 
-		// 5. 注册新服务
-		if err := registry.ServiceRegistry().Register(name, svc); err != nil {
-			svc.Close()
-			return errors.New("service " + name + " already exists")
+	return nil
+}
+
+// handoverListeners are the listener types that adopt the socket offered by
+// the service they replace.
+var handoverListeners = map[string]bool{"tcp": true, "udp": true}
+
+// canHandover reports whether the replacement of a service can adopt its
+// socket. Only a listener of the same type that supports it can; a forward
+// moving to the sni listener, for one, binds the address itself and needs
+// the old service closed first.
+func canHandover(oldConfig, cfg *config.ServiceConfig) bool {
+	if oldConfig == nil {
+		return false
+	}
+	typ := listenerType(cfg)
+	return typ == listenerType(oldConfig) && handoverListeners[typ]
+}
+
+// listenerType returns the listener type of cfg, tcp when unset as in
+// ParseService.
+func listenerType(cfg *config.ServiceConfig) string {
+	if cfg.Listener == nil || strings.TrimSpace(cfg.Listener.Type) == "" {
+		return "tcp"
+	}
+	return strings.TrimSpace(cfg.Listener.Type)
+}
+
+// handoverService offers the socket of a running service to its replacement.
+// It reports false when the listener cannot pass its socket on.
+func handoverService(svc service.Service) bool {
+	h, ok := svc.(xnet.Handover)
+	return ok && h.Handover() == nil
+}
+
+// rollbackServiceUpdates undoes a batch that failed before the swap: new
+// services are closed, and old ones that were stopped to free their address
+// are started again from their previous config under the same name.
+func rollbackServiceUpdates(updates []serviceUpdate) {
+	for i := range updates {
+		u := &updates[i]
+		if u.svc != nil {
+			u.svc.Close()
+		}
+		if u.closed && u.oldConfig != nil {
+			restoreService(u.oldConfig)
+		}
+	}
+}
+
+// migrateServices moves services to a new address without a gap: every new
+// listener is bound before any old one is touched, and the old services
+// keep accepting for the drain window before they are closed.
+func migrateServices(req migrateServicesRequest) error {
+	if len(req.Data) == 0 {
+		return errors.New("services list cannot be empty")
+	}
+
+	// 第一阶段：解析所有新服务，任一失败则全部放弃，旧服务不受影响
+	parsed := make([]service.Service, 0, len(req.Data))
+	for i := range req.Data {
+		name := strings.TrimSpace(req.Data[i].Name)
+		if name == "" {
+			closeServices(parsed)
+			return &updateError{Kind: "service", Stage: "validate", Err: errors.New("service name is required"), RolledBack: true}
 		}
+		req.Data[i].Name = name
+		reclaimDraining(name, req.Data[i].Addr)
+		svc, err := parser.ParseService(&req.Data[i])
+		if err != nil {
+			closeServices(parsed)
+			return &updateError{Kind: "service", Name: name, Stage: "parse", Err: err, RolledBack: true}
+		}
+		parsed = append(parsed, svc)
+	}
 
-		// 6. 启动新服务
+	// 第二阶段：新服务接管名称，旧服务进入排空
+	drain := time.Duration(req.Drain) * time.Second
+	for i, svc := range parsed {
+		name := req.Data[i].Name
+		if old := registry.SwapService(name, svc); old != nil {
+			drainService(name, old, findServiceConfig(name), drain)
+		}
 		go svc.Serve()
 	}
 
 	// 第三阶段：更新配置
 	config.OnUpdate(func(c *config.Config) error {
 		for i := range req.Data {
-			// 创建副本以确保指针安全
 			cfgCopy := req.Data[i]
 			found := false
 			for j := range c.Services {
@@ -150,6 +299,42 @@ func updateServices(req updateServicesRequest) error {
 	return nil
 }
 
+// findServiceConfig 在配置锁内查找服务配置，避免与并发的 OnUpdate 竞争
+func findServiceConfig(name string) *config.ServiceConfig {
+	var found *config.ServiceConfig
+	config.OnUpdate(func(c *config.Config) error {
+		for _, s := range c.Services {
+			if s != nil && s.Name == name {
+				found = s
+				break
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// restoreService starts a service again from its config in place of the
+// stopped one; a paused one is left closed, the way pauseServices leaves it.
+func restoreService(cfg *config.ServiceConfig) {
+	svc, err := parser.ParseService(cfg)
+	if err != nil {
+		return
+	}
+	registry.SwapService(cfg.Name, svc)
+	if paused, _ := cfg.Metadata["paused"].(bool); paused {
+		svc.Close()
+		return
+	}
+	go svc.Serve()
+}
+
+func closeServices(services []service.Service) {
+	for _, svc := range services {
+		svc.Close()
+	}
+}
+
 func deleteServices(req deleteServicesRequest) error {
 
 	if len(req.Services) == 0 {
@@ -180,6 +365,9 @@ func deleteServices(req deleteServicesRequest) error {
 	}
 
 	// 第二阶段：删除所有服务
+	for _, name := range namesToRemove {
+		stopDraining(name)
+	}
 	for _, std := range servicesToDelete {
 		registry.ServiceRegistry().Unregister(std.name)
 		std.service.Close()
@@ -284,12 +472,11 @@ func pauseServices(req pauseServicesRequest) error {
 		}
 
 		// 暂停服务
+		stopDraining(stp.name)
 		stp.service.Close()
 
 		// 强制断开端口的所有连接
-		if serviceConfig.Addr != "" {
-			_ = kill.ForceClosePortConnections(serviceConfig.Addr)
-		}
+		_ = kill.ForceCloseServiceConnections(serviceConfig)
 
 		// 记录已暂停的服务
 		pausedServices = append(pausedServices, struct {
@@ -525,6 +712,11 @@ type deleteServicesRequest struct {
 	Services []string `json:"services"`
 }
 
+type migrateServicesRequest struct {
+	Data  []config.ServiceConfig `json:"data"`
+	Drain int                    `json:"drain"`
+}
+
 type updateServicesRequest struct {
 	Data []config.ServiceConfig `json:"data"`
 }
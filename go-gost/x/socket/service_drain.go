@@ -0,0 +1,100 @@
+package socket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/service"
+	"github.com/go-gost/x/config"
+	kill "github.com/go-gost/x/internal/util/port"
+)
+
+// drainingService is an old listener that keeps serving after its name was
+// handed to a migrated service, until the drain window ends.
+type drainingService struct {
+	service service.Service
+	config  *config.ServiceConfig
+	timer   *time.Timer
+}
+
+var (
+	drainingMu       sync.Mutex
+	drainingServices = map[string][]*drainingService{}
+)
+
+func drainService(name string, svc service.Service, cfg *config.ServiceConfig, drain time.Duration) {
+	if drain <= 0 {
+		closeDrained(svc, cfg)
+		return
+	}
+	d := &drainingService{service: svc, config: cfg}
+	drainingMu.Lock()
+	defer drainingMu.Unlock()
+	drainingServices[name] = append(drainingServices[name], d)
+	d.timer = time.AfterFunc(drain, func() {
+		drainingMu.Lock()
+		list := drainingServices[name]
+		for i := range list {
+			if list[i] == d {
+				list = append(list[:i], list[i+1:]...)
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(drainingServices, name)
+		} else {
+			drainingServices[name] = list
+		}
+		drainingMu.Unlock()
+		closeDrained(svc, cfg)
+	})
+}
+
+// reclaimDraining closes the old listeners of a service that still hold addr,
+// so a service moved back to its previous address can bind it again.
+func reclaimDraining(name, addr string) {
+	drainingMu.Lock()
+	var reclaimed []*drainingService
+	kept := drainingServices[name][:0]
+	for _, d := range drainingServices[name] {
+		if d.config != nil && d.config.Addr == addr {
+			reclaimed = append(reclaimed, d)
+		} else {
+			kept = append(kept, d)
+		}
+	}
+	if len(kept) == 0 {
+		delete(drainingServices, name)
+	} else {
+		drainingServices[name] = kept
+	}
+	drainingMu.Unlock()
+
+	for _, d := range reclaimed {
+		d.timer.Stop()
+		closeDrained(d.service, d.config)
+	}
+}
+
+// stopDraining closes the old listeners of a service right away, so deleting
+// or pausing it does not leave them running out the window.
+func stopDraining(name string) {
+	drainingMu.Lock()
+	list := drainingServices[name]
+	delete(drainingServices, name)
+	drainingMu.Unlock()
+
+	for _, d := range list {
+		d.timer.Stop()
+		closeDrained(d.service, d.config)
+	}
+}
+
+// closeDrained closes the old listener and the connections still on its
+// port, so the port is free for reuse once the window is over.
+func closeDrained(svc service.Service, cfg *config.ServiceConfig) {
+	svc.Close()
+	if cfg != nil {
+		_ = kill.ForceCloseServiceConnections(cfg)
+	}
+}
@@ -0,0 +1,75 @@
+package socket
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-gost/x/config"
+)
+
+type fakeService struct {
+	closed atomic.Int32
+}
+
+func (s *fakeService) Serve() error   { return nil }
+func (s *fakeService) Addr() net.Addr { return nil }
+func (s *fakeService) Close() error {
+	s.closed.Add(1)
+	return nil
+}
+
+func TestReclaimDraining(t *testing.T) {
+	a, b := &fakeService{}, &fakeService{}
+	drainService("drain_reclaim", a, &config.ServiceConfig{Name: "drain_reclaim", Addr: "127.0.0.1:0"}, time.Hour)
+	drainService("drain_reclaim", b, &config.ServiceConfig{Name: "drain_reclaim", Addr: "127.0.0.2:0"}, time.Hour)
+
+	reclaimDraining("drain_reclaim", "127.0.0.1:0")
+	if a.closed.Load() != 1 || b.closed.Load() != 0 {
+		t.Fatalf("expected only the listener on the reclaimed address to close, got %d, %d", a.closed.Load(), b.closed.Load())
+	}
+	drainingMu.Lock()
+	left := len(drainingServices["drain_reclaim"])
+	drainingMu.Unlock()
+	if left != 1 {
+		t.Fatalf("expected one listener left draining, got %d", left)
+	}
+
+	stopDraining("drain_reclaim")
+	if b.closed.Load() != 1 {
+		t.Fatalf("expected stopDraining to close the rest")
+	}
+	drainingMu.Lock()
+	_, ok := drainingServices["drain_reclaim"]
+	drainingMu.Unlock()
+	if ok {
+		t.Fatalf("expected the service to be forgotten")
+	}
+}
+
+func TestDrainWindowEnds(t *testing.T) {
+	a := &fakeService{}
+	drainService("drain_window", a, nil, 10*time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for a.closed.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if a.closed.Load() != 1 {
+		t.Fatalf("expected the old listener to close after the window")
+	}
+	drainingMu.Lock()
+	_, ok := drainingServices["drain_window"]
+	drainingMu.Unlock()
+	if ok {
+		t.Fatalf("expected the expired listener to be forgotten")
+	}
+
+	// Without a window the old listener closes right away.
+	b := &fakeService{}
+	drainService("drain_window", b, nil, 0)
+	if b.closed.Load() != 1 {
+		t.Fatalf("expected an immediate close without a window")
+	}
+}
@@ -0,0 +1,289 @@
+package socket
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/logger"
+	"github.com/go-gost/x/config"
+	_ "github.com/go-gost/x/connector/http"
+	_ "github.com/go-gost/x/dialer/tcp"
+	_ "github.com/go-gost/x/handler/forward/local"
+	_ "github.com/go-gost/x/listener/sni"
+	_ "github.com/go-gost/x/listener/tcp"
+	xlogger "github.com/go-gost/x/logger"
+	"github.com/go-gost/x/registry"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetDefault(xlogger.Nop())
+	os.Exit(m.Run())
+}
+
+// freeAddr returns a loopback address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func forwardServiceConfig(name, addr, listener string) config.ServiceConfig {
+	return forwardServiceConfigTo(name, addr, listener, "127.0.0.1:9")
+}
+
+func forwardServiceConfigTo(name, addr, listener, target string) config.ServiceConfig {
+	return config.ServiceConfig{
+		Name:     name,
+		Addr:     addr,
+		Handler:  &config.HandlerConfig{Type: "tcp"},
+		Listener: &config.ListenerConfig{Type: listener},
+		Forwarder: &config.ForwarderConfig{
+			Nodes: []*config.ForwardNodeConfig{{Name: "target", Addr: target}},
+		},
+	}
+}
+
+// echoServer returns the address of a server that echoes every connection.
+func echoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// echo writes msg to conn and expects it back.
+func echo(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.WriteString(conn, msg); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != msg {
+		t.Fatalf("expected %q back, got %q, %v", msg, buf, err)
+	}
+}
+
+func dialEcho(t *testing.T, addr, msg string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial %s: %v", addr, err)
+	}
+	defer conn.Close()
+	echo(t, conn, msg)
+}
+
+func TestUpdateServicesRollsBackOnBindFailure(t *testing.T) {
+	config.Set(&config.Config{})
+	oldAddr, newAddr := freeAddr(t), freeAddr(t)
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer busy.Close()
+
+	if err := createServices(createServicesRequest{Data: []config.ServiceConfig{forwardServiceConfig("rb_a", oldAddr, "tcp")}}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer deleteServices(deleteServicesRequest{Services: []string{"rb_a", "rb_b"}})
+	old := registry.ServiceRegistry().Get("rb_a")
+
+	err = updateServices(updateServicesRequest{Data: []config.ServiceConfig{
+		forwardServiceConfig("rb_a", newAddr, "tcp"),
+		forwardServiceConfig("rb_b", busy.Addr().String(), "tcp"),
+	}})
+	var ue *updateError
+	if !errors.As(err, &ue) || ue.Name != "rb_b" || ue.Stage != "parse" || !ue.RolledBack {
+		t.Fatalf("expected a rolled back parse error for rb_b, got %v", err)
+	}
+
+	if registry.ServiceRegistry().Get("rb_a") != old {
+		t.Fatalf("expected the old service to stay registered")
+	}
+	if registry.ServiceRegistry().IsRegistered("rb_b") {
+		t.Fatalf("expected the failed service not to be registered")
+	}
+	if c, err := net.Dial("tcp", oldAddr); err != nil {
+		t.Fatalf("expected the old address to keep serving: %v", err)
+	} else {
+		c.Close()
+	}
+	ln, err := net.Listen("tcp", newAddr)
+	if err != nil {
+		t.Fatalf("expected the new address to be released: %v", err)
+	}
+	ln.Close()
+	if cfg := findServiceConfig("rb_a"); cfg == nil || cfg.Addr != oldAddr {
+		t.Fatalf("expected the saved config to be unchanged, got %+v", cfg)
+	}
+}
+
+func TestValidateTrafficLimits(t *testing.T) {
+	valid := [][]string{
+		nil,
+		{"$ 10MB 10MB"},
+		{"$$ 1MiB", "  "},
+		{"192.168.0.1 100KB 1GB"},
+	}
+	for _, limits := range valid {
+		if err := validateTrafficLimits(limits); err != nil {
+			t.Errorf("validateTrafficLimits(%q) = %v, want nil", limits, err)
+		}
+	}
+	invalid := [][]string{
+		{"$"},
+		{"$ 10MB 10MB 10MB"},
+		{"$ fast"},
+		{"$ 10MB", "$$ 10XB"},
+	}
+	for _, limits := range invalid {
+		if err := validateTrafficLimits(limits); err == nil {
+			t.Errorf("validateTrafficLimits(%q) = nil, want an error", limits)
+		}
+	}
+}
+
+func TestUpdateLimiterKeepsOldLimitsOnError(t *testing.T) {
+	config.Set(&config.Config{})
+	if err := updateLimiter(updateLimiterRequest{Limiter: "lim_keep", Data: config.LimiterConfig{Limits: []string{"$ 10MB 10MB"}}}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	defer deleteLimiter(deleteLimiterRequest{Limiter: "lim_keep"})
+
+	err := updateLimiter(updateLimiterRequest{Limiter: "lim_keep", Data: config.LimiterConfig{Limits: []string{"$ lots"}}})
+	var ue *updateError
+	if !errors.As(err, &ue) || ue.Stage != "validate" || !ue.RolledBack {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if !registry.TrafficLimiterRegistry().IsRegistered("lim_keep") {
+		t.Fatalf("expected the old limiter to stay registered")
+	}
+	if limits := config.Global().Limiters[0].Limits; len(limits) != 1 || limits[0] != "$ 10MB 10MB" {
+		t.Fatalf("expected the saved limits to be unchanged, got %v", limits)
+	}
+}
+
+func TestUpdateServicesHandsOverSameListener(t *testing.T) {
+	config.Set(&config.Config{})
+	addr, target := freeAddr(t), echoServer(t)
+	if err := createServices(createServicesRequest{Data: []config.ServiceConfig{forwardServiceConfigTo("ho_same", addr, "tcp", target)}}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer deleteServices(deleteServicesRequest{Services: []string{"ho_same"}})
+	old := registry.ServiceRegistry().Get("ho_same")
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	echo(t, conn, "before")
+
+	cfg := forwardServiceConfigTo("ho_same", addr, "tcp", target)
+	cfg.Metadata = map[string]any{"updated": true}
+	if err := updateServices(updateServicesRequest{Data: []config.ServiceConfig{cfg}}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if registry.ServiceRegistry().Get("ho_same") == old {
+		t.Fatalf("expected the service to be replaced")
+	}
+
+	// The replacement adopted the socket: the established connection runs
+	// on and new connections are accepted.
+	echo(t, conn, "after")
+	dialEcho(t, addr, "new")
+}
+
+func TestUpdateServicesChangesListenerOnSameAddr(t *testing.T) {
+	config.Set(&config.Config{})
+	addr, target := freeAddr(t), echoServer(t)
+	if err := createServices(createServicesRequest{Data: []config.ServiceConfig{forwardServiceConfigTo("ho_type", addr, "tcp", target)}}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer deleteServices(deleteServicesRequest{Services: []string{"ho_type"}})
+
+	cfg := forwardServiceConfigTo("ho_type", addr, "sni", target)
+	cfg.Listener.Metadata = map[string]any{"sni.hosts": []string{"a.example.com"}}
+	if err := updateServices(updateServicesRequest{Data: []config.ServiceConfig{cfg}}); err != nil {
+		t.Fatalf("expected the sni listener to bind the freed address, got %v", err)
+	}
+
+	req := "GET / HTTP/1.1\r\nHost: a.example.com\r\n\r\n"
+	dialEcho(t, addr, req)
+	if saved := findServiceConfig("ho_type"); saved == nil || saved.Listener.Type != "sni" {
+		t.Fatalf("expected the sni config to be saved, got %+v", saved)
+	}
+}
+
+func TestUpdateServicesRestoresClosedServiceOnFailure(t *testing.T) {
+	config.Set(&config.Config{})
+	addr, target := freeAddr(t), echoServer(t)
+	if err := createServices(createServicesRequest{Data: []config.ServiceConfig{forwardServiceConfigTo("ho_rb", addr, "tcp", target)}}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer deleteServices(deleteServicesRequest{Services: []string{"ho_rb"}})
+
+	// An sni listener without hosts is rejected after the old tcp service
+	// was closed to free the address.
+	err := updateServices(updateServicesRequest{Data: []config.ServiceConfig{forwardServiceConfigTo("ho_rb", addr, "sni", target)}})
+	var ue *updateError
+	if !errors.As(err, &ue) || ue.Stage != "parse" || !ue.RolledBack {
+		t.Fatalf("expected a rolled back parse error, got %v", err)
+	}
+
+	if !registry.ServiceRegistry().IsRegistered("ho_rb") {
+		t.Fatalf("expected the service to stay registered")
+	}
+	dialEcho(t, addr, "restored")
+	if saved := findServiceConfig("ho_rb"); saved == nil || saved.Listener.Type != "tcp" {
+		t.Fatalf("expected the saved config to be unchanged, got %+v", saved)
+	}
+}
+
+func TestUpdateServicesRefusesServiceWithoutConfig(t *testing.T) {
+	config.Set(&config.Config{})
+	addr, target := freeAddr(t), echoServer(t)
+	if err := createServices(createServicesRequest{Data: []config.ServiceConfig{forwardServiceConfigTo("ho_nocfg", addr, "tcp", target)}}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer deleteServices(deleteServicesRequest{Services: []string{"ho_nocfg"}})
+	old := registry.ServiceRegistry().Get("ho_nocfg")
+
+	// Without a saved config the old service could not be restored after a
+	// failed update, so it must not be closed.
+	config.Set(&config.Config{})
+	err := updateServices(updateServicesRequest{Data: []config.ServiceConfig{forwardServiceConfigTo("ho_nocfg", addr, "sni", target)}})
+	var ue *updateError
+	if !errors.As(err, &ue) || ue.Stage != "validate" || !ue.RolledBack {
+		t.Fatalf("expected a rolled back validate error, got %v", err)
+	}
+	if registry.ServiceRegistry().Get("ho_nocfg") != old {
+		t.Fatalf("expected the old service to stay registered")
+	}
+	dialEcho(t, addr, "kept")
+}
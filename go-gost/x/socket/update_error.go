@@ -0,0 +1,33 @@
+package socket
+
+import "fmt"
+
+// updateError reports which item of an update batch failed and at what
+// stage, so the panel can tell a rejected config from a busy port. When
+// RolledBack is set the node still runs exactly what it ran before.
+type updateError struct {
+	Kind       string
+	Name       string
+	Stage      string
+	Err        error
+	RolledBack bool
+}
+
+func (e *updateError) Error() string {
+	return fmt.Sprintf("update %s %s failed: %v", e.Kind, e.Name, e.Err)
+}
+
+func (e *updateError) Unwrap() error {
+	return e.Err
+}
+
+// result is the response data sent back with the failed command.
+func (e *updateError) result() map[string]interface{} {
+	return map[string]interface{}{
+		"kind":       e.Kind,
+		"name":       e.Name,
+		"stage":      e.Stage,
+		"error":      e.Err.Error(),
+		"rolledBack": e.RolledBack,
+	}
+}
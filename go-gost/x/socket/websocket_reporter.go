@@ -7,6 +7,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -21,6 +22,7 @@ import (
 	"time"
 
 	"github.com/go-gost/x/config"
+	"github.com/go-gost/x/internal/util/certstore"
 	"github.com/go-gost/x/internal/util/crypto"
 	"github.com/go-gost/x/service"
 	"github.com/gorilla/websocket"
@@ -32,11 +34,18 @@ import (
 
 // SystemInfo 系统信息结构体
 type SystemInfo struct {
-	Uptime           uint64  `json:"uptime"`            // 开机时间	（秒）
-	BytesReceived    uint64  `json:"bytes_received"`    // 接收字节数
-	BytesTransmitted uint64  `json:"bytes_transmitted"` // 发送字节数
-	CPUUsage         float64 `json:"cpu_usage"`         // CPU使用率（百分比）
-	MemoryUsage      float64 `json:"memory_usage"`      // 内存使用率（百分比）
+	Uptime           uint64          `json:"uptime"`               // 开机时间	（秒）
+	BytesReceived    uint64          `json:"bytes_received"`       // 接收字节数
+	BytesTransmitted uint64          `json:"bytes_transmitted"`    // 发送字节数
+	CPUUsage         float64         `json:"cpu_usage"`            // CPU使用率（百分比）
+	MemoryUsage      float64         `json:"memory_usage"`         // 内存使用率（百分比）
+	Interfaces       []InterfaceInfo `json:"interfaces,omitempty"` // 网卡地址，仅在连接后首次及变化时上报
+}
+
+// InterfaceInfo 网卡及其地址，供面板校验转发的出口网卡或 IP
+type InterfaceInfo struct {
+	Name  string   `json:"name"`
+	Addrs []string `json:"addrs"`
 }
 
 // NetworkStats 网络统计信息
@@ -265,6 +274,9 @@ func (w *WebSocketReporter) connect() error {
 		return nil
 	})
 
+	// 面板可能已重启并丢失锁定状态，先解除客户端IP锁定，由面板重新判定
+	service.GetClientIPTracker().ClearGuards()
+
 	fmt.Printf("✅ WebSocket连接建立成功 (http=%d, tls=%d, socks=%d)\n", cfg.Http, cfg.Tls, cfg.Socks)
 	return nil
 }
@@ -289,6 +301,9 @@ func (w *WebSocketReporter) handleConnection() {
 	ticker := time.NewTicker(w.pingInterval)
 	defer ticker.Stop()
 
+	// 上次上报的网卡地址，变化时才随系统信息重新上报
+	reportedInterfaces := ""
+
 	for {
 		select {
 		case <-w.ctx.Done():
@@ -305,10 +320,16 @@ func (w *WebSocketReporter) handleConnection() {
 
 			// 获取系统信息并发送
 			sysInfo := w.collectSystemInfo()
+			interfaces := getInterfaces()
+			key := fmt.Sprint(interfaces)
+			if key != reportedInterfaces {
+				sysInfo.Interfaces = interfaces
+			}
 			if err := w.sendSystemInfo(sysInfo); err != nil {
 				fmt.Printf("❌ 发送系统信息失败: %v，准备重连\n", err)
 				return
 			}
+			reportedInterfaces = key
 		}
 	}
 }
@@ -515,6 +536,43 @@ func (w *WebSocketReporter) handleReceivedMessage(messageType int, message []byt
 	}
 }
 
+// redactedFields 打印命令时需要隐藏的字段：中转服务和转发链的认证信息、KCP 密钥
+var redactedFields = map[string]bool{
+	"auth":    true,
+	"kcp.key": true,
+}
+
+// redactCommand 返回隐藏了认证信息和密钥的命令内容，仅用于打印
+func redactCommand(data []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return string(data)
+	}
+	redactValue(v)
+	out, err := json.Marshal(v)
+	if err != nil {
+		return string(data)
+	}
+	return string(out)
+}
+
+func redactValue(v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, item := range t {
+			if redactedFields[k] && item != nil {
+				t[k] = "***"
+				continue
+			}
+			redactValue(item)
+		}
+	case []interface{}:
+		for _, item := range t {
+			redactValue(item)
+		}
+	}
+}
+
 // routeCommand 路由命令到对应的处理函数
 func (w *WebSocketReporter) routeCommand(cmd CommandMessage) {
 	jsonBytes, errs := json.Marshal(cmd)
@@ -523,7 +581,12 @@ func (w *WebSocketReporter) routeCommand(cmd CommandMessage) {
 		return
 	}
 
-	fmt.Println("🔔 收到命令: ", string(jsonBytes))
+	if cmd.Type == "SetCertificates" {
+		// 证书命令携带私钥，不打印内容
+		fmt.Println("🔔 收到命令: ", cmd.Type)
+	} else {
+		fmt.Println("🔔 收到命令: ", redactCommand(jsonBytes))
+	}
 	var err error
 	var response CommandResponse
 	var needSaveConfig bool // 标记是否需要保存配置（只有状态变更命令才需要）
@@ -541,6 +604,10 @@ func (w *WebSocketReporter) routeCommand(cmd CommandMessage) {
 		err = w.handleUpdateService(cmd.Data)
 		response.Type = "UpdateServiceResponse"
 		needSaveConfig = true
+	case "MigrateService":
+		err = w.handleMigrateService(cmd.Data)
+		response.Type = "MigrateServiceResponse"
+		needSaveConfig = true
 	case "DeleteService":
 		err = w.handleDeleteService(cmd.Data)
 		response.Type = "DeleteServiceResponse"
@@ -582,6 +649,56 @@ func (w *WebSocketReporter) routeCommand(cmd CommandMessage) {
 		response.Type = "DeleteLimitersResponse"
 		needSaveConfig = true
 
+	// 连接数限制器（climiter）相关命令
+	case "AddCLimiters", "UpdateCLimiters":
+		err = w.handleUpdateConnLimiter(cmd.Data)
+		response.Type = cmd.Type + "Response"
+		needSaveConfig = true
+	case "DeleteCLimiters":
+		err = w.handleDeleteConnLimiter(cmd.Data)
+		response.Type = "DeleteCLimitersResponse"
+		needSaveConfig = true
+
+	// 准入控制（来源IP黑白名单）相关命令
+	case "AddAdmissions", "UpdateAdmissions":
+		err = w.handleUpdateAdmission(cmd.Data)
+		response.Type = cmd.Type + "Response"
+		needSaveConfig = true
+	case "DeleteAdmissions":
+		err = w.handleDeleteAdmission(cmd.Data)
+		response.Type = "DeleteAdmissionsResponse"
+		needSaveConfig = true
+
+	// 域名解析器相关命令
+	case "AddResolvers", "UpdateResolvers":
+		err = w.handleUpdateResolver(cmd.Data)
+		response.Type = cmd.Type + "Response"
+		needSaveConfig = true
+	case "DeleteResolvers":
+		err = w.handleDeleteResolver(cmd.Data)
+		response.Type = "DeleteResolversResponse"
+		needSaveConfig = true
+
+	// 域名解析诊断命令（只读，不需要保存配置）
+	case "Resolve":
+		var resolveResult ResolveResponse
+		resolveResult, err = w.handleResolve(cmd.Data)
+		response.Type = "ResolveResponse"
+		response.Data = resolveResult
+
+	// 客户端IP锁定由面板根据上报实时下发，不写入配置
+	case "SetClientIPGuard":
+		err = w.handleSetClientIPGuard(cmd.Data)
+		response.Type = "SetClientIPGuardResponse"
+
+	// 反向代理转发的 TLS 证书单独保存在证书目录，不写入配置
+	case "SetCertificates":
+		err = w.handleSetCertificates(cmd.Data)
+		response.Type = "SetCertificatesResponse"
+	case "DeleteCertificates":
+		err = w.handleDeleteCertificates(cmd.Data)
+		response.Type = "DeleteCertificatesResponse"
+
 	// TCP Ping 诊断命令（只读，不需要保存配置）
 	case "TcpPing":
 		var tcpPingResult TcpPingResponse
@@ -631,6 +748,11 @@ func (w *WebSocketReporter) routeCommand(cmd CommandMessage) {
 	if err != nil {
 		response.Success = false
 		response.Message = err.Error()
+		// 更新失败时附带失败项和阶段，供面板定位
+		var ue *updateError
+		if errors.As(err, &ue) {
+			response.Data = ue.result()
+		}
 	} else {
 		response.Success = true
 		response.Message = "OK"
@@ -683,6 +805,24 @@ func (w *WebSocketReporter) handleUpdateService(data interface{}) error {
 	return updateServices(req)
 }
 
+func (w *WebSocketReporter) handleMigrateService(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+
+	processedData, err := w.preprocessDurationFields(jsonData)
+	if err != nil {
+		return fmt.Errorf("预处理duration字段失败: %v", err)
+	}
+
+	var req migrateServicesRequest
+	if err := json.Unmarshal(processedData, &req); err != nil {
+		return fmt.Errorf("解析迁移请求失败: %v", err)
+	}
+	return migrateServices(req)
+}
+
 func (w *WebSocketReporter) handleDeleteService(data interface{}) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
@@ -861,6 +1001,220 @@ func (w *WebSocketReporter) handleDeleteLimiter(data interface{}) error {
 	return deleteLimiter(deleteReq)
 }
 
+// handleUpdateConnLimiter 创建或更新连接数限制器，格式与 UpdateLimiters 相同
+func (w *WebSocketReporter) handleUpdateConnLimiter(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+
+	var req updateLimiterRequest
+	if err := json.Unmarshal(jsonData, &req); err != nil {
+		return fmt.Errorf("解析限流器配置失败: %v", err)
+	}
+	if strings.TrimSpace(req.Limiter) == "" {
+		// 兼容直接发送 LimiterConfig 的格式
+		if err := json.Unmarshal(jsonData, &req.Data); err != nil {
+			return fmt.Errorf("解析限流器配置失败: %v", err)
+		}
+		req.Limiter = req.Data.Name
+	}
+
+	return updateConnLimiter(req)
+}
+
+func (w *WebSocketReporter) handleDeleteConnLimiter(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+
+	var req deleteLimiterRequest
+	if err := json.Unmarshal(jsonData, &req); err != nil {
+		var limiterName string
+		if err := json.Unmarshal(jsonData, &limiterName); err != nil {
+			return fmt.Errorf("解析限流器删除请求失败: %v", err)
+		}
+		req.Limiter = limiterName
+	}
+
+	return deleteConnLimiter(req)
+}
+
+// handleUpdateAdmission 创建或更新准入控制器，格式: {"admission": "name", "data": {...}}
+func (w *WebSocketReporter) handleUpdateAdmission(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+
+	var req updateAdmissionRequest
+	if err := json.Unmarshal(jsonData, &req); err != nil {
+		return fmt.Errorf("解析准入控制器配置失败: %v", err)
+	}
+	if strings.TrimSpace(req.Admission) == "" {
+		// 兼容直接发送 AdmissionConfig 的格式
+		if err := json.Unmarshal(jsonData, &req.Data); err != nil {
+			return fmt.Errorf("解析准入控制器配置失败: %v", err)
+		}
+		req.Admission = req.Data.Name
+	}
+
+	return updateAdmission(req)
+}
+
+func (w *WebSocketReporter) handleDeleteAdmission(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+
+	var req deleteAdmissionRequest
+	if err := json.Unmarshal(jsonData, &req); err != nil {
+		var admissionName string
+		if err := json.Unmarshal(jsonData, &admissionName); err != nil {
+			return fmt.Errorf("解析准入控制器删除请求失败: %v", err)
+		}
+		req.Admission = admissionName
+	}
+
+	return deleteAdmission(req)
+}
+
+// handleUpdateResolver 创建或更新域名解析器，格式: {"resolver": "name", "data": {...}}
+func (w *WebSocketReporter) handleUpdateResolver(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+
+	var req updateResolverRequest
+	if err := json.Unmarshal(jsonData, &req); err != nil {
+		return fmt.Errorf("解析解析器配置失败: %v", err)
+	}
+	if strings.TrimSpace(req.Resolver) == "" {
+		// 兼容直接发送 ResolverConfig 的格式
+		if err := json.Unmarshal(jsonData, &req.Data); err != nil {
+			return fmt.Errorf("解析解析器配置失败: %v", err)
+		}
+		req.Resolver = req.Data.Name
+	}
+
+	return updateResolver(req)
+}
+
+func (w *WebSocketReporter) handleDeleteResolver(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+
+	var req deleteResolverRequest
+	if err := json.Unmarshal(jsonData, &req); err != nil {
+		var resolverName string
+		if err := json.Unmarshal(jsonData, &resolverName); err != nil {
+			return fmt.Errorf("解析解析器删除请求失败: %v", err)
+		}
+		req.Resolver = resolverName
+	}
+
+	return deleteResolver(req)
+}
+
+// handleResolve 使用指定解析器解析域名，供面板诊断转发目标
+func (w *WebSocketReporter) handleResolve(data interface{}) (ResolveResponse, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return ResolveResponse{}, fmt.Errorf("序列化数据失败: %v", err)
+	}
+
+	var req resolveRequest
+	if err := json.Unmarshal(jsonData, &req); err != nil {
+		return ResolveResponse{}, fmt.Errorf("解析域名解析请求失败: %v", err)
+	}
+	if !isValidHostname(req.Host) {
+		return ResolveResponse{}, fmt.Errorf("无效的主机名: %s", req.Host)
+	}
+
+	return resolveHost(req), nil
+}
+
+type clientIPGuardRequest struct {
+	Services []string `json:"services"`
+	Locked   bool     `json:"locked"`
+	Allowed  []string `json:"allowed"`
+}
+
+// handleSetClientIPGuard 锁定或解锁服务的客户端IP。锁定后只允许 allowed 中的IP建立新连接。
+func (w *WebSocketReporter) handleSetClientIPGuard(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+
+	var req clientIPGuardRequest
+	if err := json.Unmarshal(jsonData, &req); err != nil {
+		return fmt.Errorf("解析客户端IP限制失败: %v", err)
+	}
+	if len(req.Services) == 0 {
+		return fmt.Errorf("服务列表不能为空")
+	}
+
+	service.GetClientIPTracker().SetGuard(req.Services, req.Locked, req.Allowed)
+	return nil
+}
+
+type setCertificatesRequest struct {
+	Certificates []struct {
+		Name string `json:"name"`
+		Cert string `json:"cert"`
+		Key  string `json:"key"`
+	} `json:"certificates"`
+}
+
+// handleSetCertificates 保存面板下发的证书和私钥，格式: {"certificates": [{"name", "cert", "key"}]}
+func (w *WebSocketReporter) handleSetCertificates(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+
+	var req setCertificatesRequest
+	if err := json.Unmarshal(jsonData, &req); err != nil {
+		return fmt.Errorf("解析证书失败: %v", err)
+	}
+	if len(req.Certificates) == 0 {
+		return fmt.Errorf("证书列表不能为空")
+	}
+	for _, c := range req.Certificates {
+		if err := certstore.Set(c.Name, c.Cert, c.Key); err != nil {
+			return fmt.Errorf("保存证书失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// handleDeleteCertificates 删除证书，格式: {"certificates": ["name"]}
+func (w *WebSocketReporter) handleDeleteCertificates(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+
+	var req struct {
+		Certificates []string `json:"certificates"`
+	}
+	if err := json.Unmarshal(jsonData, &req); err != nil {
+		return fmt.Errorf("解析证书删除请求失败: %v", err)
+	}
+	for _, name := range req.Certificates {
+		if err := certstore.Delete(name); err != nil {
+			return fmt.Errorf("删除证书失败: %v", err)
+		}
+	}
+	return nil
+}
+
 // handleSetProtocol 处理设置屏蔽协议的命令
 func (w *WebSocketReporter) handleSetProtocol(data interface{}) error {
 	jsonData, err := json.Marshal(data)
@@ -1259,6 +1613,31 @@ func getNetworkStats() NetworkStats {
 	return stats
 }
 
+// getInterfaces 获取已启用的非回环网卡及其地址，跳过 IPv6 链路本地地址
+func getInterfaces() []InterfaceInfo {
+	ifces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var result []InterfaceInfo
+	for _, ifce := range ifces {
+		if ifce.Flags&net.FlagUp == 0 || ifce.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := ifce.Addrs()
+		info := InterfaceInfo{Name: ifce.Name, Addrs: []string{}}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			info.Addrs = append(info.Addrs, ipNet.IP.String())
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
 // getCPUInfo 获取CPU信息
 func getCPUInfo() CPUInfo {
 	var cpuInfo CPUInfo
@@ -0,0 +1,40 @@
+package socket
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactCommand(t *testing.T) {
+	cmd := CommandMessage{
+		Type: "AddChains",
+		Data: map[string]interface{}{
+			"name": "chains_1",
+			"hops": []interface{}{map[string]interface{}{
+				"nodes": []interface{}{map[string]interface{}{
+					"addr":      "10.0.0.2:30000",
+					"connector": map[string]interface{}{"type": "relay", "auth": map[string]interface{}{"username": "t1", "password": "chain-secret"}},
+					"dialer":    map[string]interface{}{"type": "kcp", "metadata": map[string]interface{}{"kcp.key": "kcp-secret", "kcp.mode": "fast"}},
+				}},
+			}},
+			"handler": map[string]interface{}{"type": "relay", "auth": map[string]interface{}{"username": "t1", "password": "service-secret"}},
+		},
+	}
+	raw, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	out := redactCommand(raw)
+	for _, secret := range []string{"chain-secret", "kcp-secret", "service-secret"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("expected %s to be redacted: %s", secret, out)
+		}
+	}
+	for _, kept := range []string{"10.0.0.2:30000", `"kcp.mode":"fast"`, "AddChains"} {
+		if !strings.Contains(out, kept) {
+			t.Fatalf("expected %s to be kept: %s", kept, out)
+		}
+	}
+}
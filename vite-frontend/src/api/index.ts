@@ -108,6 +108,19 @@ export const resumeForwardService = (forwardId: number) =>
 // 转发诊断操作
 export const diagnoseForward = (forwardId: number) =>
   Network.post("/forward/diagnose", { forwardId });
+export const getForwardClientIps = (forwardId: number) =>
+  Network.post("/forward/client-ips", { forwardId });
+export const getForwardConnLogs = (data: {
+  forwardId?: number;
+  nodeId?: number;
+  client?: string;
+  target?: string;
+  failed?: boolean;
+  startTime?: number;
+  endTime?: number;
+  current?: number;
+  size?: number;
+}) => Network.post("/forward/conn-logs", data);
 
 // 转发排序操作
 export const updateForwardOrder = (data: {
@@ -123,6 +136,22 @@ export const updateSpeedLimit = (data: any) =>
 export const deleteSpeedLimit = (id: number) =>
   Network.post("/speed-limit/delete", { id });
 
+// HTTPS 转发证书
+export const getCertificateList = () => Network.post("/certificate/list");
+export const createCertificate = (data: {
+  name: string;
+  cert: string;
+  key: string;
+}) => Network.post("/certificate/create", data);
+export const updateCertificate = (data: {
+  id: number;
+  name: string;
+  cert?: string;
+  key?: string;
+}) => Network.post("/certificate/update", data);
+export const deleteCertificate = (id: number) =>
+  Network.post("/certificate/delete", { id });
+
 // 修改密码接口
 export const updatePassword = (data: any) =>
   Network.post("/user/updatePassword", data);
@@ -165,10 +194,34 @@ export const batchRedeployForwards = (ids: number[]) =>
   Network.post("/forward/batch-redeploy", { ids });
 export const batchRedeployTunnels = (ids: number[]) =>
   Network.post("/tunnel/batch-redeploy", { ids });
+export const batchRotateTunnelAuth = (ids: number[]) =>
+  Network.post("/tunnel/batch-rotate-auth", { ids });
 export const batchChangeTunnel = (data: {
   forwardIds: number[];
   targetTunnelId: number;
 }) => Network.post("/forward/batch-change-tunnel", data);
+export const cloneForwards = (data: {
+  forwardIds?: number[];
+  userId?: number;
+  targetTunnelId?: number;
+  targetUserId?: number;
+}) => Network.post("/forward/clone", data);
+
+// 转发模板（管理员）
+export const getForwardTemplateList = () =>
+  Network.post("/forward/template/list");
+export const createForwardTemplate = (data: any) =>
+  Network.post("/forward/template/create", data);
+export const updateForwardTemplate = (data: any) =>
+  Network.post("/forward/template/update", data);
+export const deleteForwardTemplate = (id: number) =>
+  Network.post("/forward/template/delete", { id });
+export const applyForwardTemplate = (data: {
+  id: number;
+  name?: string;
+  userIds: number[];
+  tunnelIds: number[];
+}) => Network.post("/forward/template/apply", data);
 
 // 分组与权限分配接口
 export const getTunnelGroupList = () => Network.post("/group/tunnel/list");
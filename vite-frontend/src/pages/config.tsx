@@ -96,6 +96,14 @@ const CONFIG_ITEMS: ConfigItem[] = [
     dependsOn: "captcha_enabled",
     dependsValue: "true",
   },
+  {
+    key: "conn_log_retention_days",
+    label: "连接日志保留天数",
+    placeholder: "7",
+    description:
+      "开启了连接日志的转发，其日志保留的天数，默认 7 天；总条数超过 100 万时最早的记录会被提前清理",
+    type: "input",
+  },
 ];
 
 // 初始化时从缓存读取配置，避免闪烁
@@ -107,6 +115,7 @@ const getInitialConfigs = (): Record<string, string> => {
     "captcha_enabled",
     "cloudflare_site_key",
     "cloudflare_secret_key",
+    "conn_log_retention_days",
     "ip",
     "panel_domain",
   ];
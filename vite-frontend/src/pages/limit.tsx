@@ -26,6 +26,8 @@ interface SpeedLimitRule {
   id: number;
   name: string;
   speed: number;
+  connSpeed?: number;
+  ipSpeed?: number;
   status: number;
   tunnelId: number;
   tunnelName: string;
@@ -42,6 +44,8 @@ interface SpeedLimitForm {
   id?: number;
   name: string;
   speed: number;
+  connSpeed: number;
+  ipSpeed: number;
   tunnelId: number | null;
   tunnelName: string;
   status: number;
@@ -64,6 +68,8 @@ export default function LimitPage() {
   const [form, setForm] = useState<SpeedLimitForm>({
     name: "",
     speed: 100,
+    connSpeed: 0,
+    ipSpeed: 0,
     tunnelId: null,
     tunnelName: "",
     status: 1,
@@ -131,6 +137,8 @@ export default function LimitPage() {
     setForm({
       name: "",
       speed: 100,
+      connSpeed: 0,
+      ipSpeed: 0,
       tunnelId: null,
       tunnelName: "",
       status: 1,
@@ -146,6 +154,8 @@ export default function LimitPage() {
       id: rule.id,
       name: rule.name,
       speed: rule.speed,
+      connSpeed: rule.connSpeed ?? 0,
+      ipSpeed: rule.ipSpeed ?? 0,
       tunnelId: rule.tunnelId,
       tunnelName: rule.tunnelName,
       status: rule.status,
@@ -429,6 +439,50 @@ export default function LimitPage() {
                     }
                   />
 
+                  <Input
+                    description="每条连接单独限速，仅对 TCP 生效，0 表示不限"
+                    endContent={
+                      <div className="pointer-events-none flex items-center">
+                        <span className="text-default-400 text-small">
+                          Mbps
+                        </span>
+                      </div>
+                    }
+                    label="单连接限速"
+                    min="0"
+                    type="number"
+                    value={form.connSpeed.toString()}
+                    variant="bordered"
+                    onChange={(e) =>
+                      setForm((prev) => ({
+                        ...prev,
+                        connSpeed: Math.max(parseInt(e.target.value) || 0, 0),
+                      }))
+                    }
+                  />
+
+                  <Input
+                    description="每个来源 IP 单独限速，仅对 TCP 生效，0 表示不限"
+                    endContent={
+                      <div className="pointer-events-none flex items-center">
+                        <span className="text-default-400 text-small">
+                          Mbps
+                        </span>
+                      </div>
+                    }
+                    label="单 IP 限速"
+                    min="0"
+                    type="number"
+                    value={form.ipSpeed.toString()}
+                    variant="bordered"
+                    onChange={(e) =>
+                      setForm((prev) => ({
+                        ...prev,
+                        ipSpeed: Math.max(parseInt(e.target.value) || 0, 0),
+                      }))
+                    }
+                  />
+
                   <Select
                     description={isEdit ? "编辑时无法修改绑定隧道" : undefined}
                     errorMessage={errors.tunnelId}
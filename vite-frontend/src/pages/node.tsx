@@ -63,6 +63,11 @@ interface Node {
   port: string;
   tcpListenAddr?: string;
   udpListenAddr?: string;
+  listenIps?: string;
+  interfaces?: { name: string; addrs: string[] }[] | null;
+  dnsServers?: string;
+  dnsPrefer?: string;
+  dnsTtl?: number;
   version?: string;
   http?: number; // 0 关 1 开
   tls?: number; // 0 关 1 开
@@ -95,7 +100,11 @@ interface NodeForm {
   port: string;
   tcpListenAddr: string;
   udpListenAddr: string;
+  listenIps: string;
   interfaceName: string;
+  dnsServers: string;
+  dnsPrefer: string;
+  dnsTtl: number;
   http: number; // 0 关 1 开
   tls: number; // 0 关 1 开
   socks: number; // 0 关 1 开
@@ -160,7 +169,11 @@ export default function NodePage() {
     port: "1000-65535",
     tcpListenAddr: "[::]",
     udpListenAddr: "[::]",
+    listenIps: "",
     interfaceName: "",
+    dnsServers: "",
+    dnsPrefer: "",
+    dnsTtl: 0,
     http: 0,
     tls: 0,
     socks: 0,
@@ -745,7 +758,11 @@ export default function NodePage() {
       port: node.port || "1000-65535",
       tcpListenAddr: node.tcpListenAddr || "[::]",
       udpListenAddr: node.udpListenAddr || "[::]",
+      listenIps: (node.listenIps || "").split(",").join("\n"),
       interfaceName: (node as any).interfaceName || "",
+      dnsServers: node.dnsServers || "",
+      dnsPrefer: node.dnsPrefer || "",
+      dnsTtl: node.dnsTtl ?? 0,
       http: typeof node.http === "number" ? node.http : 1,
       tls: typeof node.tls === "number" ? node.tls : 1,
       socks: typeof node.socks === "number" ? node.socks : 1,
@@ -970,7 +987,14 @@ export default function NodePage() {
                     port: form.port,
                     tcpListenAddr: form.tcpListenAddr,
                     udpListenAddr: form.udpListenAddr,
+                    listenIps: form.listenIps
+                      .split(/[\s,]+/)
+                      .filter(Boolean)
+                      .join(","),
                     interfaceName: form.interfaceName,
+                    dnsServers: form.dnsServers,
+                    dnsPrefer: form.dnsPrefer,
+                    dnsTtl: form.dnsTtl,
                     http: form.http,
                     tls: form.tls,
                     socks: form.socks,
@@ -1002,7 +1026,11 @@ export default function NodePage() {
       port: "1000-65535",
       tcpListenAddr: "[::]",
       udpListenAddr: "[::]",
+      listenIps: "",
       interfaceName: "",
+      dnsServers: "",
+      dnsPrefer: "",
+      dnsTtl: 0,
       http: 0,
       tls: 0,
       socks: 0,
@@ -1745,6 +1773,19 @@ export default function NodePage() {
                         }))
                       }
                     />
+                    {(nodeList.find((n) => n.id === form.id)?.interfaces || [])
+                      .length > 0 && (
+                      <div className="text-xs text-default-500 space-y-1">
+                        <p>节点上报的网卡（转发和隧道权限可选用）：</p>
+                        {nodeList
+                          .find((n) => n.id === form.id)
+                          ?.interfaces?.map((item) => (
+                            <p key={item.name} className="font-mono">
+                              {item.name}: {item.addrs.join(", ")}
+                            </p>
+                          ))}
+                      </div>
+                    )}
 
                     <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
                       <Input
@@ -1791,6 +1832,81 @@ export default function NodePage() {
                         }
                       />
                     </div>
+
+                    <Textarea
+                      description="节点上可供转发单独绑定的 IP，每行一个；转发未指定时使用上面的监听地址"
+                      errorMessage={errors.listenIps}
+                      isInvalid={!!errors.listenIps}
+                      label="可选监听 IP"
+                      maxRows={6}
+                      minRows={2}
+                      placeholder={"203.0.113.10\n203.0.113.11"}
+                      value={form.listenIps}
+                      variant="bordered"
+                      onChange={(e) =>
+                        setForm((prev) => ({
+                          ...prev,
+                          listenIps: e.target.value,
+                        }))
+                      }
+                    />
+
+                    <Textarea
+                      description="转发解析域名目标使用的 DNS 服务器，每行一个，支持 tcp://、tls://、https://；转发可单独覆盖，留空使用系统解析"
+                      label="DNS 服务器"
+                      maxRows={4}
+                      minRows={2}
+                      placeholder={"1.1.1.1\ntls://dns.google"}
+                      value={form.dnsServers}
+                      variant="bordered"
+                      onChange={(e) =>
+                        setForm((prev) => ({
+                          ...prev,
+                          dnsServers: e.target.value,
+                        }))
+                      }
+                    />
+                    {form.dnsServers.trim() && (
+                      <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
+                        <Select
+                          label="解析优先"
+                          selectedKeys={[form.dnsPrefer || "auto"]}
+                          variant="bordered"
+                          onSelectionChange={(keys) => {
+                            const selectedKey = Array.from(keys)[0] as string;
+
+                            setForm((prev) => ({
+                              ...prev,
+                              dnsPrefer:
+                                selectedKey && selectedKey !== "auto"
+                                  ? selectedKey
+                                  : "",
+                            }));
+                          }}
+                        >
+                          <SelectItem key="auto">自动</SelectItem>
+                          <SelectItem key="ipv4">IPv4 优先</SelectItem>
+                          <SelectItem key="ipv6">IPv6 优先</SelectItem>
+                        </Select>
+                        <Input
+                          description="解析结果缓存秒数，0 表示按记录 TTL"
+                          label="缓存时间"
+                          min="0"
+                          type="number"
+                          value={form.dnsTtl.toString()}
+                          variant="bordered"
+                          onChange={(e) =>
+                            setForm((prev) => ({
+                              ...prev,
+                              dnsTtl: Math.max(
+                                parseInt(e.target.value) || 0,
+                                0,
+                              ),
+                            }))
+                          }
+                        />
+                      </div>
+                    )}
                     {/* 屏蔽协议 */}
                     <div>
                       <div className="text-sm font-medium text-default-700 mb-2">
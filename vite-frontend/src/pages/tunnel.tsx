@@ -44,21 +44,126 @@ import {
   updateTunnelOrder,
   batchDeleteTunnels,
   batchRedeployTunnels,
+  batchRotateTunnelAuth,
 } from "@/api";
 
+interface TransportOptions {
+  path?: string;
+  host?: string;
+  sni?: string;
+  alpn?: string[];
+  keepalive?: number; // 秒
+  mux?: {
+    version?: number;
+    keepaliveInterval?: number;
+    keepaliveTimeout?: number;
+    maxFrameSize?: number;
+    maxReceiveBuffer?: number;
+    maxStreamBuffer?: number;
+  };
+  kcp?: {
+    mode?: string;
+    crypt?: string;
+    key?: string;
+    mtu?: number;
+    sndwnd?: number;
+    rcvwnd?: number;
+    nocomp?: boolean;
+  };
+}
+
 interface ChainTunnel {
   nodeId: number;
-  protocol?: string; // 'tls' | 'wss' | 'tcp' | 'mtls' | 'mwss' | 'mtcp' - 转发链协议
-  strategy?: string; // 'fifo' | 'round' | 'rand' - 仅转发链需要
+  protocol?: string; // 见 TRANSPORT_PROTOCOLS - 转发链协议
+  strategy?: string; // 'fifo' | 'round' | 'rand' | 'weighted' | 'least' | 'sticky' - 仅转发链需要
   chainType?: number; // 1: 入口, 2: 转发链, 3: 出口
   inx?: number; // 转发链序号
+  options?: TransportOptions; // 传输参数，同一跳的节点共用
 }
 
+// 隧道可用的传输协议及其支持的参数，需与后端 tunnelTransports 保持一致
+const TRANSPORT_PROTOCOLS: Array<{
+  key: string;
+  label: string;
+  tls?: boolean;
+  path?: boolean;
+  host?: boolean;
+  keepalive?: boolean;
+  mux?: boolean;
+  kcp?: boolean;
+}> = [
+  { key: "tls", label: "TLS", tls: true },
+  { key: "tcp", label: "TCP" },
+  { key: "mtls", label: "MTLS", tls: true, mux: true },
+  { key: "mtcp", label: "MTCP", mux: true },
+  { key: "ws", label: "WS", path: true, host: true, keepalive: true },
+  {
+    key: "wss",
+    label: "WSS",
+    tls: true,
+    path: true,
+    host: true,
+    keepalive: true,
+  },
+  { key: "mws", label: "MWS", path: true, host: true, mux: true },
+  { key: "mwss", label: "MWSS", tls: true, path: true, host: true, mux: true },
+  {
+    key: "grpc",
+    label: "gRPC",
+    tls: true,
+    path: true,
+    host: true,
+    keepalive: true,
+  },
+  { key: "h2", label: "HTTP/2", tls: true, path: true, host: true },
+  { key: "ohttp", label: "obfs-http", host: true },
+  { key: "otls", label: "obfs-tls", host: true },
+  { key: "kcp", label: "KCP (UDP)", kcp: true, keepalive: true },
+  { key: "quic", label: "QUIC (UDP)", tls: true, keepalive: true },
+];
+
+const KCP_MODES = ["normal", "fast", "fast2", "fast3"];
+
+const KCP_CRYPTS = [
+  "aes",
+  "aes-128",
+  "aes-192",
+  "salsa20",
+  "blowfish",
+  "twofish",
+  "cast5",
+  "3des",
+  "tea",
+  "xtea",
+  "xor",
+  "sm4",
+  "none",
+];
+
+const getTransportProtocol = (protocol?: string) =>
+  TRANSPORT_PROTOCOLS.find((p) => p.key === (protocol || "tls")) ||
+  TRANSPORT_PROTOCOLS[0];
+
+// 统计已设置的传输参数数量，用于按钮上的提示
+const countTransportOptions = (options?: TransportOptions) => {
+  if (!options) return 0;
+
+  return [
+    options.path,
+    options.host,
+    options.sni,
+    options.alpn && options.alpn.length > 0,
+    options.keepalive,
+    options.mux && Object.values(options.mux).some((v) => !!v),
+    options.kcp && Object.values(options.kcp).some((v) => !!v),
+  ].filter(Boolean).length;
+};
+
 interface Tunnel {
   id: number;
   inx?: number;
   name: string;
-  type: number; // 1: 端口转发, 2: 隧道转发
+  type: number; // 1: 端口转发, 2: 隧道转发, 3: 反向隧道
   inNodeId: ChainTunnel[]; // 入口节点列表
   outNodeId?: ChainTunnel[]; // 出口节点列表
   chainNodes?: ChainTunnel[][]; // 转发链节点列表，二维数组
@@ -68,6 +173,8 @@ interface Tunnel {
   flow: number; // 1: 单向, 2: 双向
   trafficRatio: number;
   ipPreference?: string;
+  allowIps?: string;
+  denyIps?: string;
   status: number;
   createdTime: string;
 }
@@ -89,6 +196,8 @@ interface TunnelForm {
   trafficRatio: number;
   inIp: string; // 入口IP
   ipPreference: string;
+  allowIps: string;
+  denyIps: string;
   status: number;
 }
 
@@ -133,6 +242,13 @@ export default function TunnelPage() {
   const [diagnosisResult, setDiagnosisResult] =
     useState<DiagnosisResult | null>(null);
 
+  // 传输参数模态框状态，transportGroup 为 -1 时表示出口
+  const [transportModalOpen, setTransportModalOpen] = useState(false);
+  const [transportGroup, setTransportGroup] = useState(-1);
+  const [transportProtocol, setTransportProtocol] = useState("tls");
+  const [transportForm, setTransportForm] = useState<TransportOptions>({});
+  const [alpnInput, setAlpnInput] = useState("");
+
   // 表单状态
   const [form, setForm] = useState<TunnelForm>({
     name: "",
@@ -144,6 +260,8 @@ export default function TunnelPage() {
     trafficRatio: 1.0,
     inIp: "",
     ipPreference: "",
+    allowIps: "",
+    denyIps: "",
     status: 1,
   });
 
@@ -154,6 +272,7 @@ export default function TunnelPage() {
   const [selectMode, setSelectMode] = useState(false);
   const [selectedIds, setSelectedIds] = useState<Set<number>>(new Set());
   const [batchDeleteModalOpen, setBatchDeleteModalOpen] = useState(false);
+  const [batchRotateModalOpen, setBatchRotateModalOpen] = useState(false);
   const [batchLoading, setBatchLoading] = useState(false);
 
   useEffect(() => {
@@ -260,8 +379,13 @@ export default function TunnelPage() {
       newErrors.trafficRatio = "流量倍率须大于0，支持小数（如 0.5）";
     }
 
-    // 隧道转发时的验证
-    if (form.type === 2) {
+    // 反向隧道只有一个公网入口和一个内网出口
+    if (form.type === 3 && form.inNodeId.length > 1) {
+      newErrors.inNodeId = "反向隧道只能选择一个入口节点";
+    }
+
+    // 隧道转发和反向隧道时的验证
+    if (form.type === 2 || form.type === 3) {
       if (!form.outNodeId || form.outNodeId.length === 0) {
         newErrors.outNodeId = "请至少选择一个出口节点";
       } else {
@@ -276,13 +400,17 @@ export default function TunnelPage() {
           newErrors.outNodeId = "所有出口节点必须在线";
         }
 
+        if (form.type === 3 && form.outNodeId.length > 1) {
+          newErrors.outNodeId = "反向隧道只能选择一个出口节点";
+        }
+
         // 检查是否有重复节点
         const inNodeIds = form.inNodeId.map((item) => item.nodeId);
         const outNodeIds = form.outNodeId.map((item) => item.nodeId);
         const overlap = inNodeIds.filter((id) => outNodeIds.includes(id));
 
         if (overlap.length > 0) {
-          newErrors.outNodeId = "隧道转发模式下，入口和出口不能有相同节点";
+          newErrors.outNodeId = "入口和出口不能有相同节点";
         }
       }
     }
@@ -305,6 +433,8 @@ export default function TunnelPage() {
       trafficRatio: 1.0,
       inIp: "",
       ipPreference: "",
+      allowIps: "",
+      denyIps: "",
       status: 1,
     });
     setErrors({});
@@ -332,6 +462,8 @@ export default function TunnelPage() {
           .join("\n")
       : "",
     ipPreference: tunnel.ipPreference || "",
+    allowIps: (tunnel.allowIps || "").split(",").join("\n"),
+    denyIps: (tunnel.denyIps || "").split(",").join("\n"),
     status: tunnel.status,
     });
     setErrors({});
@@ -372,7 +504,7 @@ export default function TunnelPage() {
       ...prev,
       type,
       outNodeId: type === 1 ? [] : prev.outNodeId,
-      chainNodes: type === 1 ? [] : prev.chainNodes,
+      chainNodes: type === 2 ? prev.chainNodes : [],
     }));
   };
 
@@ -395,11 +527,12 @@ export default function TunnelPage() {
       // 获取当前组的策略和协议
       const strategy = group.length > 0 ? group[0].strategy : "round";
       const protocol = group.length > 0 ? group[0].protocol : "tls";
+      const options = group.length > 0 ? group[0].options : undefined;
 
       // 添加节点到该组
       chainNodes[groupIndex] = [
         ...group,
-        { nodeId, chainType: 2, protocol, strategy },
+        { nodeId, chainType: 2, protocol, strategy, options },
       ];
 
       return { ...prev, chainNodes };
@@ -419,7 +552,7 @@ export default function TunnelPage() {
     });
   };
 
-  // 更新某一跳的所有节点的协议
+  // 更新某一跳的所有节点的协议，各协议的参数不通用，切换时清空
   const updateChainProtocol = (groupIndex: number, protocol: string) => {
     setForm((prev) => {
       const chainNodes = [...(prev.chainNodes || [])];
@@ -427,6 +560,7 @@ export default function TunnelPage() {
       chainNodes[groupIndex] = (chainNodes[groupIndex] || []).map((node) => ({
         ...node,
         protocol,
+        options: undefined,
       }));
 
       return { ...prev, chainNodes };
@@ -447,6 +581,102 @@ export default function TunnelPage() {
     });
   };
 
+  // 打开某一跳（或出口）的传输参数设置
+  const openTransportModal = (groupIndex: number, group: ChainTunnel[]) => {
+    const options = group.length > 0 ? group[0].options || {} : {};
+
+    setTransportGroup(groupIndex);
+    setTransportProtocol(group.length > 0 ? group[0].protocol || "tls" : "tls");
+    setTransportForm({
+      ...options,
+      mux: { ...(options.mux || {}) },
+      kcp: { ...(options.kcp || {}) },
+    });
+    setAlpnInput((options.alpn || []).join(", "));
+    setTransportModalOpen(true);
+  };
+
+  // 只保留当前协议支持且已填写的参数
+  const buildTransportOptions = (): TransportOptions | undefined => {
+    const capability = getTransportProtocol(transportProtocol);
+    const options: TransportOptions = {};
+    const alpn = alpnInput
+      .split(/[,，\s]+/)
+      .map((p) => p.trim())
+      .filter((p) => p);
+
+    if (capability.path && transportForm.path?.trim()) {
+      options.path = transportForm.path.trim();
+    }
+    if (capability.host && transportForm.host?.trim()) {
+      options.host = transportForm.host.trim();
+    }
+    if (capability.tls && transportForm.sni?.trim()) {
+      options.sni = transportForm.sni.trim();
+    }
+    if (capability.tls && alpn.length > 0) {
+      options.alpn = alpn;
+    }
+    if (capability.keepalive && transportForm.keepalive) {
+      options.keepalive = transportForm.keepalive;
+    }
+    if (
+      capability.mux &&
+      Object.values(transportForm.mux || {}).some((v) => !!v)
+    ) {
+      options.mux = transportForm.mux;
+    }
+    if (
+      capability.kcp &&
+      Object.values(transportForm.kcp || {}).some((v) => !!v)
+    ) {
+      options.kcp = transportForm.kcp;
+    }
+
+    return countTransportOptions(options) > 0 ? options : undefined;
+  };
+
+  // 保存传输参数到该跳（或出口）的所有节点
+  const saveTransportOptions = () => {
+    const options = buildTransportOptions();
+
+    setForm((prev) => {
+      if (transportGroup >= 0) {
+        const chainNodes = [...(prev.chainNodes || [])];
+
+        chainNodes[transportGroup] = (chainNodes[transportGroup] || []).map(
+          (node) => ({ ...node, options }),
+        );
+
+        return { ...prev, chainNodes };
+      }
+
+      const currentOutNodes = prev.outNodeId || [];
+
+      if (currentOutNodes.length === 0) {
+        // 如果还没有出口节点，创建一个占位节点保存设置
+        return {
+          ...prev,
+          outNodeId: [
+            {
+              nodeId: -1,
+              chainType: 3,
+              protocol: transportProtocol,
+              strategy: "round",
+              options,
+            },
+          ],
+        };
+      }
+
+      return {
+        ...prev,
+        outNodeId: currentOutNodes.map((ct) => ({ ...ct, options })),
+      };
+    });
+    setTransportModalOpen(false);
+  };
+
   // 获取所有转发链中已选择的节点ID列表
   const getSelectedChainNodeIds = (): number[] => {
     return (form.chainNodes || []).flatMap((group) =>
@@ -523,7 +753,7 @@ export default function TunnelPage() {
         toast.error(response.msg || "诊断失败");
         setDiagnosisResult({
           tunnelName: tunnel.name,
-          tunnelType: tunnel.type === 1 ? "端口转发" : "隧道转发",
+          tunnelType: getTypeDisplay(tunnel.type).text,
           timestamp: Date.now(),
           results: [
             {
@@ -542,7 +772,7 @@ export default function TunnelPage() {
       toast.error("网络错误，请重试");
       setDiagnosisResult({
         tunnelName: tunnel.name,
-        tunnelType: tunnel.type === 1 ? "端口转发" : "隧道转发",
+        tunnelType: getTypeDisplay(tunnel.type).text,
         timestamp: Date.now(),
         results: [
           {
@@ -568,6 +798,8 @@ export default function TunnelPage() {
         return { text: "端口转发", color: "primary" };
       case 2:
         return { text: "隧道转发", color: "secondary" };
+      case 3:
+        return { text: "反向隧道", color: "warning" };
       default:
         return { text: "未知", color: "default" };
     }
@@ -737,6 +969,37 @@ export default function TunnelPage() {
     }
   };
 
+  // 轮换隧道中转服务的认证凭据，并重新下发隧道
+  const handleBatchRotateAuth = async () => {
+    if (selectedIds.size === 0) return;
+    setBatchLoading(true);
+    try {
+      const res = await batchRotateTunnelAuth(Array.from(selectedIds));
+
+      if (res.code === 0) {
+        const result = res.data;
+
+        if (result.failCount === 0) {
+          toast.success(`成功轮换 ${result.successCount} 项隧道凭据`);
+        } else {
+          toast.error(
+            `成功 ${result.successCount} 项，失败 ${result.failCount} 项`,
+          );
+        }
+        setBatchRotateModalOpen(false);
+        setSelectedIds(new Set());
+        setSelectMode(false);
+        loadData();
+      } else {
+        toast.error(res.msg || "轮换失败");
+      }
+    } catch (e: any) {
+      toast.error(e.message || "轮换失败");
+    } finally {
+      setBatchLoading(false);
+    }
+  };
+
   // 传感器配置
   const sensors = useSensors(
     useSensor(MouseSensor, {
@@ -889,6 +1152,15 @@ export default function TunnelPage() {
             >
               下发
             </Button>
+            <Button
+              color="warning"
+              isLoading={batchLoading}
+              size="sm"
+              variant="flat"
+              onPress={() => setBatchRotateModalOpen(true)}
+            >
+              轮换凭据
+            </Button>
           </div>
         </div>
       )}
@@ -1040,9 +1312,9 @@ export default function TunnelPage() {
                                     />
                                   </svg>
                                   <span className="font-semibold text-success-700 dark:text-success-400">
-                                    {tunnel.type === 2
-                                      ? tunnel.outNodeId?.length || 0
-                                      : tunnel.inNodeId?.length || 0}
+                                    {tunnel.type === 1
+                                      ? tunnel.inNodeId?.length || 0
+                                      : tunnel.outNodeId?.length || 0}
                                     出口
                                   </span>
                                 </div>
@@ -1050,7 +1322,7 @@ export default function TunnelPage() {
                             </div>
 
                             {/* 流量配置 */}
-                            <div className={`grid gap-2 ${tunnel.type === 2 && tunnel.ipPreference ? "grid-cols-3" : "grid-cols-2"}`}>
+                            <div className={`grid gap-2 ${tunnel.type !== 1 && tunnel.ipPreference ? "grid-cols-3" : "grid-cols-2"}`}>
                               <div className="text-center p-1.5 bg-default-50 dark:bg-default-100/30 rounded">
                                 <div className="text-xs text-default-500">
                                   流量计算
@@ -1067,7 +1339,7 @@ export default function TunnelPage() {
                                   {tunnel.trafficRatio}x
                                 </div>
                               </div>
-                              {tunnel.type === 2 && tunnel.ipPreference && (
+                              {tunnel.type !== 1 && tunnel.ipPreference && (
                                 <div className="text-center p-1.5 bg-default-50 dark:bg-default-100/30 rounded">
                                   <div className="text-xs text-default-500">
                                     连接偏好
@@ -1228,7 +1500,13 @@ export default function TunnelPage() {
                   />
 
                   <Select
-                    description={isEdit ? "编辑时无法修改隧道类型" : undefined}
+                    description={
+                      isEdit
+                        ? "编辑时无法修改隧道类型"
+                        : form.type === 3
+                          ? "内网出口主动连接公网入口，入口收到的连接经反向连接送达出口"
+                          : undefined
+                    }
                     errorMessage={errors.type}
                     isDisabled={isEdit}
                     isInvalid={!!errors.type}
@@ -1246,6 +1524,7 @@ export default function TunnelPage() {
                   >
                     <SelectItem key="1">端口转发</SelectItem>
                     <SelectItem key="2">隧道转发</SelectItem>
+                    <SelectItem key="3">反向隧道</SelectItem>
                   </Select>
 
                   <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
@@ -1311,7 +1590,7 @@ export default function TunnelPage() {
                     }
                   />
 
-                  {form.type === 2 && (
+                  {(form.type === 2 || form.type === 3) && (
                     <Select
                       description="当节点同时拥有IPv4和IPv6地址时，选择隧道连接使用的地址类型"
                       label="隧道连接地址偏好"
@@ -1332,6 +1611,33 @@ export default function TunnelPage() {
                     </Select>
                   )}
 
+                  <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
+                    <Textarea
+                      description="只允许这些来源访问，留空不限制"
+                      label="来源 IP 白名单"
+                      maxRows={4}
+                      minRows={2}
+                      placeholder="一行一个 IP 或 CIDR，例如:&#10;203.0.113.8&#10;10.0.0.0/8"
+                      value={form.allowIps}
+                      variant="bordered"
+                      onChange={(e) =>
+                        setForm((prev) => ({ ...prev, allowIps: e.target.value }))
+                      }
+                    />
+                    <Textarea
+                      description="拒绝这些来源访问"
+                      label="来源 IP 黑名单"
+                      maxRows={4}
+                      minRows={2}
+                      placeholder="一行一个 IP 或 CIDR"
+                      value={form.denyIps}
+                      variant="bordered"
+                      onChange={(e) =>
+                        setForm((prev) => ({ ...prev, denyIps: e.target.value }))
+                      }
+                    />
+                  </div>
+
                   <Divider />
                   <h3 className="text-lg font-semibold">入口配置</h3>
 
@@ -1663,12 +1969,11 @@ export default function TunnelPage() {
                                       }
                                     }}
                                   >
-                                    <SelectItem key="tls">TLS</SelectItem>
-                                    <SelectItem key="wss">WSS</SelectItem>
-                                    <SelectItem key="tcp">TCP</SelectItem>
-                                    <SelectItem key="mtls">MTLS</SelectItem>
-                                    <SelectItem key="mwss">MWSS</SelectItem>
-                                    <SelectItem key="mtcp">MTCP</SelectItem>
+                                    {TRANSPORT_PROTOCOLS.map((p) => (
+                                      <SelectItem key={p.key}>
+                                        {p.label}
+                                      </SelectItem>
+                                    ))}
                                   </Select>
 
                                   {/* 负载策略 - 25% */}
@@ -1698,8 +2003,26 @@ export default function TunnelPage() {
                                     <SelectItem key="fifo">主备</SelectItem>
                                     <SelectItem key="round">轮询</SelectItem>
                                     <SelectItem key="rand">随机</SelectItem>
+                                    <SelectItem key="least">最少连接</SelectItem>
+                                    <SelectItem key="sticky">会话保持</SelectItem>
                                   </Select>
                                 </div>
+
+                                <div className="flex justify-end mt-2">
+                                  <Button
+                                    size="sm"
+                                    variant="flat"
+                                    onPress={() =>
+                                      openTransportModal(groupIndex, groupNodes)
+                                    }
+                                  >
+                                    传输参数
+                                    {countTransportOptions(
+                                      groupNodes[0]?.options,
+                                    ) > 0 &&
+                                      `（${countTransportOptions(groupNodes[0]?.options)}）`}
+                                  </Button>
+                                </div>
                               </div>
                             );
                           })}
@@ -1716,8 +2039,8 @@ export default function TunnelPage() {
                     </>
                   )}
 
-                  {/* 隧道转发时显示出口配置 */}
-                  {form.type === 2 && (
+                  {/* 隧道转发和反向隧道时显示出口配置 */}
+                  {(form.type === 2 || form.type === 3) && (
                     <>
                       <Divider />
                       <h3 className="text-lg font-semibold">出口配置</h3>
@@ -1762,11 +2085,13 @@ export default function TunnelPage() {
 
                               let protocol = "tls";
                               let strategy = "round";
+                              let options: TransportOptions | undefined;
 
                               if (currentOutNodes.length > 0) {
                                 protocol = currentOutNodes[0].protocol || "tls";
                                 strategy =
                                   currentOutNodes[0].strategy || "round";
+                                options = currentOutNodes[0].options;
                               }
 
                               const realNodes = currentOutNodes.filter(
@@ -1784,6 +2109,7 @@ export default function TunnelPage() {
                                       chainType: 3,
                                       protocol,
                                       strategy,
+                                      options,
                                     }
                                   );
                                 });
@@ -1890,24 +2216,22 @@ export default function TunnelPage() {
                                   };
                                 }
 
-                                // 更新所有出口节点的协议
+                                // 更新所有出口节点的协议，并清空旧协议的参数
                                 return {
                                   ...prev,
                                   outNodeId: currentOutNodes.map((ct) => ({
                                     ...ct,
                                     protocol: selectedKey,
+                                    options: undefined,
                                   })),
                                 };
                               });
                             }
                           }}
                         >
-                          <SelectItem key="tls">TLS</SelectItem>
-                          <SelectItem key="wss">WSS</SelectItem>
-                          <SelectItem key="tcp">TCP</SelectItem>
-                          <SelectItem key="mtls">MTLS</SelectItem>
-                          <SelectItem key="mwss">MWSS</SelectItem>
-                          <SelectItem key="mtcp">MTCP</SelectItem>
+                          {TRANSPORT_PROTOCOLS.map((p) => (
+                            <SelectItem key={p.key}>{p.label}</SelectItem>
+                          ))}
                         </Select>
 
                         {/* 负载策略 - 25% */}
@@ -1969,8 +2293,25 @@ export default function TunnelPage() {
                           <SelectItem key="fifo">主备</SelectItem>
                           <SelectItem key="round">轮询</SelectItem>
                           <SelectItem key="rand">随机</SelectItem>
+                          <SelectItem key="least">最少连接</SelectItem>
+                          <SelectItem key="sticky">会话保持</SelectItem>
                         </Select>
                       </div>
+
+                      <div className="flex justify-end">
+                        <Button
+                          size="sm"
+                          variant="flat"
+                          onPress={() =>
+                            openTransportModal(-1, form.outNodeId || [])
+                          }
+                        >
+                          传输参数
+                          {countTransportOptions(form.outNodeId?.[0]?.options) >
+                            0 &&
+                            `（${countTransportOptions(form.outNodeId?.[0]?.options)}）`}
+                        </Button>
+                      </div>
                     </>
                   )}
                 </div>
@@ -1998,6 +2339,275 @@ export default function TunnelPage() {
         </ModalContent>
       </Modal>
 
+      {/* 传输参数模态框 */}
+      <Modal
+        backdrop="blur"
+        isOpen={transportModalOpen}
+        placement="center"
+        scrollBehavior="outside"
+        size="2xl"
+        onOpenChange={setTransportModalOpen}
+      >
+        <ModalContent>
+          {(onClose) => {
+            const capability = getTransportProtocol(transportProtocol);
+            const numberInput = (
+              label: string,
+              value: number | undefined,
+              onChange: (value: number) => void,
+              description?: string,
+            ) => (
+              <Input
+                description={description}
+                label={label}
+                placeholder="默认"
+                type="number"
+                value={value ? value.toString() : ""}
+                variant="bordered"
+                onChange={(e) =>
+                  onChange(Math.max(parseInt(e.target.value) || 0, 0))
+                }
+              />
+            );
+
+            return (
+              <>
+                <ModalHeader className="flex flex-col gap-1">
+                  <h2 className="text-xl font-bold">
+                    {transportGroup >= 0
+                      ? `第${transportGroup + 1}跳传输参数`
+                      : "出口传输参数"}
+                  </h2>
+                  <p className="text-small text-default-500">
+                    协议：{capability.label}
+                    ，连接两端使用同一组参数生成，留空则使用默认值
+                  </p>
+                </ModalHeader>
+                <ModalBody>
+                  <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
+                    {capability.path && (
+                      <Input
+                        label="路径"
+                        placeholder="例如 /tunnel"
+                        value={transportForm.path || ""}
+                        variant="bordered"
+                        onChange={(e) =>
+                          setTransportForm((prev) => ({
+                            ...prev,
+                            path: e.target.value,
+                          }))
+                        }
+                      />
+                    )}
+                    {capability.host && (
+                      <Input
+                        label="Host"
+                        placeholder="例如 cdn.example.com"
+                        value={transportForm.host || ""}
+                        variant="bordered"
+                        onChange={(e) =>
+                          setTransportForm((prev) => ({
+                            ...prev,
+                            host: e.target.value,
+                          }))
+                        }
+                      />
+                    )}
+                    {capability.tls && (
+                      <Input
+                        label="SNI"
+                        placeholder="TLS 握手时使用的服务器名"
+                        value={transportForm.sni || ""}
+                        variant="bordered"
+                        onChange={(e) =>
+                          setTransportForm((prev) => ({
+                            ...prev,
+                            sni: e.target.value,
+                          }))
+                        }
+                      />
+                    )}
+                    {capability.tls && (
+                      <Input
+                        label="ALPN"
+                        placeholder="例如 h2, http/1.1"
+                        value={alpnInput}
+                        variant="bordered"
+                        onChange={(e) => setAlpnInput(e.target.value)}
+                      />
+                    )}
+                    {capability.keepalive &&
+                      numberInput(
+                        "心跳间隔（秒）",
+                        transportForm.keepalive,
+                        (keepalive) =>
+                          setTransportForm((prev) => ({ ...prev, keepalive })),
+                      )}
+                  </div>
+
+                  {capability.mux && (
+                    <>
+                      <Divider />
+                      <h3 className="text-sm font-semibold">多路复用</h3>
+                      <div className="grid grid-cols-1 md:grid-cols-3 gap-4">
+                        {(
+                          [
+                            ["version", "版本", "1 或 2"],
+                            ["keepaliveInterval", "心跳间隔（秒）"],
+                            ["keepaliveTimeout", "心跳超时（秒）"],
+                            ["maxFrameSize", "最大帧（字节）"],
+                            ["maxReceiveBuffer", "接收缓冲（字节）"],
+                            ["maxStreamBuffer", "流缓冲（字节）"],
+                          ] as Array<
+                            [
+                              keyof NonNullable<TransportOptions["mux"]>,
+                              string,
+                              string?,
+                            ]
+                          >
+                        ).map(([key, label, description]) => (
+                          <div key={key}>
+                            {numberInput(
+                              label,
+                              transportForm.mux?.[key],
+                              (value) =>
+                                setTransportForm((prev) => ({
+                                  ...prev,
+                                  mux: { ...prev.mux, [key]: value },
+                                })),
+                              description,
+                            )}
+                          </div>
+                        ))}
+                      </div>
+                    </>
+                  )}
+
+                  {capability.kcp && (
+                    <>
+                      <Divider />
+                      <h3 className="text-sm font-semibold">KCP</h3>
+                      <div className="grid grid-cols-1 md:grid-cols-3 gap-4">
+                        <Select
+                          label="模式"
+                          placeholder="默认"
+                          selectedKeys={
+                            transportForm.kcp?.mode
+                              ? [transportForm.kcp.mode]
+                              : []
+                          }
+                          variant="bordered"
+                          onSelectionChange={(keys) =>
+                            setTransportForm((prev) => ({
+                              ...prev,
+                              kcp: {
+                                ...prev.kcp,
+                                mode: Array.from(keys)[0] as string,
+                              },
+                            }))
+                          }
+                        >
+                          {KCP_MODES.map((mode) => (
+                            <SelectItem key={mode}>{mode}</SelectItem>
+                          ))}
+                        </Select>
+                        <Select
+                          label="加密"
+                          placeholder="默认"
+                          selectedKeys={
+                            transportForm.kcp?.crypt
+                              ? [transportForm.kcp.crypt]
+                              : []
+                          }
+                          variant="bordered"
+                          onSelectionChange={(keys) =>
+                            setTransportForm((prev) => ({
+                              ...prev,
+                              kcp: {
+                                ...prev.kcp,
+                                crypt: Array.from(keys)[0] as string,
+                              },
+                            }))
+                          }
+                        >
+                          {KCP_CRYPTS.map((crypt) => (
+                            <SelectItem key={crypt}>{crypt}</SelectItem>
+                          ))}
+                        </Select>
+                        <Input
+                          label="密钥"
+                          placeholder="默认"
+                          value={transportForm.kcp?.key || ""}
+                          variant="bordered"
+                          onChange={(e) =>
+                            setTransportForm((prev) => ({
+                              ...prev,
+                              kcp: { ...prev.kcp, key: e.target.value },
+                            }))
+                          }
+                        />
+                        {(
+                          [
+                            ["mtu", "MTU", "576 - 1500"],
+                            ["sndwnd", "发送窗口"],
+                            ["rcvwnd", "接收窗口"],
+                          ] as Array<
+                            ["mtu" | "sndwnd" | "rcvwnd", string, string?]
+                          >
+                        ).map(([key, label, description]) => (
+                          <div key={key}>
+                            {numberInput(
+                              label,
+                              transportForm.kcp?.[key],
+                              (value) =>
+                                setTransportForm((prev) => ({
+                                  ...prev,
+                                  kcp: { ...prev.kcp, [key]: value },
+                                })),
+                              description,
+                            )}
+                          </div>
+                        ))}
+                        <Checkbox
+                          isSelected={!!transportForm.kcp?.nocomp}
+                          onValueChange={(nocomp) =>
+                            setTransportForm((prev) => ({
+                              ...prev,
+                              kcp: { ...prev.kcp, nocomp },
+                            }))
+                          }
+                        >
+                          禁用压缩
+                        </Checkbox>
+                      </div>
+                    </>
+                  )}
+
+                  {!capability.tls &&
+                    !capability.path &&
+                    !capability.host &&
+                    !capability.keepalive &&
+                    !capability.mux &&
+                    !capability.kcp && (
+                      <p className="text-sm text-default-500">
+                        {capability.label} 协议没有可调整的传输参数
+                      </p>
+                    )}
+                </ModalBody>
+                <ModalFooter>
+                  <Button variant="light" onPress={onClose}>
+                    取消
+                  </Button>
+                  <Button color="primary" onPress={saveTransportOptions}>
+                    确定
+                  </Button>
+                </ModalFooter>
+              </>
+            );
+          }}
+        </ModalContent>
+      </Modal>
+
       {/* 删除确认模态框 */}
       <Modal
         backdrop="blur"
@@ -2066,16 +2676,12 @@ export default function TunnelPage() {
                     </span>
                     <Chip
                       color={
-                        currentDiagnosisTunnel.type === 1
-                          ? "primary"
-                          : "secondary"
+                        getTypeDisplay(currentDiagnosisTunnel.type).color as any
                       }
                       size="sm"
                       variant="flat"
                     >
-                      {currentDiagnosisTunnel.type === 1
-                        ? "端口转发"
-                        : "隧道转发"}
+                      {getTypeDisplay(currentDiagnosisTunnel.type).text}
                     </Chip>
                   </div>
                 )}
@@ -2586,6 +3192,37 @@ export default function TunnelPage() {
           )}
         </ModalContent>
       </Modal>
+
+      <Modal
+        isOpen={batchRotateModalOpen}
+        onOpenChange={setBatchRotateModalOpen}
+      >
+        <ModalContent>
+          {(onClose) => (
+            <>
+              <ModalHeader>确认轮换凭据</ModalHeader>
+              <ModalBody>
+                <p>
+                  确定要轮换选中的 {selectedIds.size}{" "}
+                  项隧道的中转凭据吗？隧道会重新下发，经过这些隧道的现有连接都会断开。下发失败的隧道保留原凭据。
+                </p>
+              </ModalBody>
+              <ModalFooter>
+                <Button variant="light" onPress={onClose}>
+                  取消
+                </Button>
+                <Button
+                  color="warning"
+                  isLoading={batchLoading}
+                  onPress={handleBatchRotateAuth}
+                >
+                  确认轮换
+                </Button>
+              </ModalFooter>
+            </>
+          )}
+        </ModalContent>
+      </Modal>
     </div>
   );
 }
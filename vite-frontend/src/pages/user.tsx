@@ -139,6 +139,9 @@ export default function UserPage() {
     num: 10,
     expTime: null,
     flowResetTime: 0,
+    speed: 0,
+    maxIps: 0,
+    ipLimitMode: 0,
   });
   const [userFormLoading, setUserFormLoading] = useState(false);
 
@@ -289,6 +292,9 @@ export default function UserPage() {
       num: 10,
       expTime: null,
       flowResetTime: 0,
+      speed: 0,
+      maxIps: 0,
+      ipLimitMode: 0,
     });
     onUserModalOpen();
   };
@@ -305,6 +311,9 @@ export default function UserPage() {
       num: user.num,
       expTime: user.expTime ? new Date(user.expTime) : null,
       flowResetTime: user.flowResetTime ?? 0,
+      speed: user.speed ?? 0,
+      maxIps: user.maxIps ?? 0,
+      ipLimitMode: user.ipLimitMode ?? 0,
     });
     onUserModalOpen();
   };
@@ -426,6 +435,10 @@ export default function UserPage() {
         id: editTunnelForm.id,
         flow: editTunnelForm.flow,
         num: editTunnelForm.num,
+        maxIps: editTunnelForm.maxIps ?? 0,
+        interfaceName: editTunnelForm.interfaceName ?? "",
+        scheduleOn: editTunnelForm.scheduleOn ?? "",
+        scheduleOff: editTunnelForm.scheduleOff ?? "",
         expTime: editTunnelForm.expTime,
         flowResetTime: editTunnelForm.flowResetTime,
         speedId: editTunnelForm.speedId,
@@ -883,6 +896,57 @@ export default function UserPage() {
                   setUserForm((prev) => ({ ...prev, num: value }));
                 }}
               />
+              <Input
+                description="该用户在每个节点上所有转发共享的带宽上限，0 表示不限"
+                label="总带宽(Mbps)"
+                max="100000"
+                min="0"
+                type="number"
+                value={userForm.speed.toString()}
+                onChange={(e) => {
+                  const value = Math.min(
+                    Math.max(Number(e.target.value) || 0, 0),
+                    100000,
+                  );
+
+                  setUserForm((prev) => ({ ...prev, speed: value }));
+                }}
+              />
+              <Input
+                description="所有转发在最近 5 分钟内的不同来源 IP 数上限，0 表示不限"
+                label="IP 数限制"
+                max="10000"
+                min="0"
+                type="number"
+                value={userForm.maxIps.toString()}
+                onChange={(e) => {
+                  const value = Math.min(
+                    Math.max(Number(e.target.value) || 0, 0),
+                    10000,
+                  );
+
+                  setUserForm((prev) => ({ ...prev, maxIps: value }));
+                }}
+              />
+              <Select
+                label="超出 IP 数限制时"
+                selectedKeys={[userForm.ipLimitMode.toString()]}
+                onSelectionChange={(keys) => {
+                  const value = Array.from(keys)[0] as string;
+
+                  setUserForm((prev) => ({
+                    ...prev,
+                    ipLimitMode: Number(value),
+                  }));
+                }}
+              >
+                <SelectItem key="0" textValue="拒绝新 IP">
+                  拒绝新 IP
+                </SelectItem>
+                <SelectItem key="1" textValue="仅告警">
+                  仅告警
+                </SelectItem>
+              </Select>
               <Select
                 label="流量重置日期"
                 selectedKeys={[userForm.flowResetTime.toString()]}
@@ -1314,6 +1378,62 @@ export default function UserPage() {
                     }}
                   />
 
+                  <Input
+                    description="该隧道下所有转发的来源 IP 数上限，0 表示不限"
+                    label="IP 数限制"
+                    max="10000"
+                    min="0"
+                    type="number"
+                    value={(editTunnelForm.maxIps ?? 0).toString()}
+                    onChange={(e) => {
+                      const value = Math.min(
+                        Math.max(Number(e.target.value) || 0, 0),
+                        10000,
+                      );
+
+                      setEditTunnelForm((prev) =>
+                        prev ? { ...prev, maxIps: value } : null,
+                      );
+                    }}
+                  />
+
+                  <Input
+                    description="该隧道下未单独设置出口的转发从此网卡或源 IP 连接目标，留空使用节点设置；隧道转发不支持"
+                    label="出口网卡 / IP"
+                    placeholder="eth1 或 203.0.113.10"
+                    value={editTunnelForm.interfaceName ?? ""}
+                    onChange={(e) =>
+                      setEditTunnelForm((prev) =>
+                        prev ? { ...prev, interfaceName: e.target.value } : null,
+                      )
+                    }
+                  />
+
+                  <div className="grid grid-cols-2 gap-4">
+                    <Input
+                      description="按服务器时间启动该隧道下的转发"
+                      label="启用计划 (cron)"
+                      placeholder="0 9 * * 1-5"
+                      value={editTunnelForm.scheduleOn ?? ""}
+                      onChange={(e) =>
+                        setEditTunnelForm((prev) =>
+                          prev ? { ...prev, scheduleOn: e.target.value } : null,
+                        )
+                      }
+                    />
+                    <Input
+                      description="需与启用计划同时填写"
+                      label="停用计划 (cron)"
+                      placeholder="0 18 * * 1-5"
+                      value={editTunnelForm.scheduleOff ?? ""}
+                      onChange={(e) =>
+                        setEditTunnelForm((prev) =>
+                          prev ? { ...prev, scheduleOff: e.target.value } : null,
+                        )
+                      }
+                    />
+                  </div>
+
                   <Select
                     label="限速规则"
                     selectedKeys={
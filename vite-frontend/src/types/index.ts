@@ -15,6 +15,9 @@ export interface User {
   num: number; // 转发数量
   expTime?: number; // 过期时间戳
   flowResetTime?: number; // 流量重置日期(1-31号)
+  speed?: number; // 用户总带宽(Mbps)，0 表示不限
+  maxIps?: number; // 同时在线的来源 IP 数上限，0 表示不限
+  ipLimitMode?: number; // 超出 IP 数后的处理：0-拒绝新 IP, 1-仅告警
   createdTime?: number; // 创建时间戳
   inFlow?: number; // 下载流量(字节)
   outFlow?: number; // 上传流量(字节)
@@ -30,6 +33,9 @@ export interface UserForm {
   num: number;
   expTime: Date | null;
   flowResetTime: number;
+  speed: number;
+  maxIps: number;
+  ipLimitMode: number;
 }
 
 export interface UserTunnel {
@@ -40,6 +46,10 @@ export interface UserTunnel {
   status: number; // 1-正常, 0-禁用
   flow: number; // 流量限制(GB)
   num: number; // 转发数量
+  maxIps?: number; // 同时在线的来源 IP 数上限，0 表示不限
+  interfaceName?: string; // 出口网卡或源 IP，空表示使用节点设置
+  scheduleOn?: string; // 启用计划 cron 表达式
+  scheduleOff?: string; // 停用计划 cron 表达式
   expTime: number; // 过期时间戳
   flowResetTime: number; // 流量重置日期
   speedId?: number | null; // 限速规则ID
@@ -91,3 +101,26 @@ export interface Pagination {
   size: number;
   total: number;
 }
+
+export interface ForwardClientIp {
+  ip: string;
+  nodeId: number;
+  firstSeen: number;
+  lastSeen: number;
+  active: boolean; // 是否仍计入 IP 数限制
+}
+
+export interface ForwardConnLog {
+  id: number;
+  forwardId: number;
+  nodeId: number;
+  network: string;
+  clientAddr: string;
+  entryAddr: string;
+  targetAddr: string;
+  startTime: number;
+  endTime: number;
+  inBytes: number; // 客户端发送的字节数
+  outBytes: number; // 客户端接收的字节数
+  reason: string; // 关闭原因，正常关闭时为空
+}